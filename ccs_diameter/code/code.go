@@ -8,6 +8,13 @@ const (
 	ABMF_CreditControl  = 272
 )
 
+// RFC 4006 9.1 Result-Code AVP values
+const (
+	CreditLimitReached = 4012
+	UserUnknown        = 5030
+	RatingFailed       = 5031
+)
+
 const (
 	BeginTime = iota + 7000
 	ActualTime
@@ -39,4 +46,5 @@ const (
 	VendorSpecificAppId
 	ABResponse
 	AcctBalanceId
+	AcctBalance
 )
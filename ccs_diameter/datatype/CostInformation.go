@@ -7,5 +7,5 @@ import (
 type CostInformation struct {
 	CurrencyCode diam_datatype.Unsigned32 `avp:"Currency-Code"`
 	UnitValue    *UnitValue               `avp:"Unit-Value"`
-	UnitCost     *UnitCost                `avp:"Unit-Cost"`
+	CostUnit     diam_datatype.UTF8String `avp:"Cost-Unit"`
 }
@@ -10,7 +10,7 @@ type ServiceRating struct {
 	ServiceInformation             diam_datatype.Grouped          `avp:"ServiceInformation"`
 	Extension                      diam_datatype.Grouped          `avp:"Extension"`
 	RequestSubType                 RequestSubType                 `avp:"RequestSubType"`
-	Price                          diam_datatype.Unsigned32       `avp:"Price"`
+	Price                          *CCMoney                       `avp:"Price"`
 	BillingInfo                    diam_datatype.UTF8String       `avp:"BillingInfo"`
 	ImpactOnCounter                *diam_datatype.Grouped         `avp:"ImpactonCounter"`
 	RequestedUnits                 diam_datatype.Unsigned32       `avp:"RequestedUnits"`
@@ -22,7 +22,7 @@ type ServiceRating struct {
 	ExpiryTime                     diam_datatype.Time             `avp:"ExpiryTime"`
 	ValidUnits                     diam_datatype.Unsigned32       `avp:"ValidUnits"`
 	MonetaryTariffAfterValidUnits  *MonetaryTariffAfterValidUnits `avp:"MonetaryTariffAfterValidUnits"`
-	MonetaryQuota                  diam_datatype.Unsigned32       `avp:"MonetaryQuota"`
+	MonetaryQuota                  *CCMoney                       `avp:"MonetaryQuota"`
 	MinimalRequestedUnits          diam_datatype.Unsigned32       `avp:"MinimalRequestedUnits"`
 	AllowedUnits                   diam_datatype.Unsigned32       `avp:"AllowedUnits"`
 }
@@ -9,6 +9,7 @@ const (
 	END_USER_IMSI    SubscriptionIdType = 1
 	END_USER_SIP_URI SubscriptionIdType = 2
 	END_USER_NAI     SubscriptionIdType = 3
+	END_USER_PRIVATE SubscriptionIdType = 4
 )
 
 type SubscriptionIdType diam_datatype.Enumerated
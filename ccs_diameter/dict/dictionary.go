@@ -83,7 +83,11 @@ const (
 		</avp>
 
 		<avp name="Price" code="7005">
-			<data type="Unsigned32"/>
+			<!-- the money as CC-Money of RFC 4006 8.22, in the currency of the MonetaryTariff -->
+			<data type="Grouped">
+				<rule avp="Unit-Value" required="true" max="1"/>
+				<rule avp="Currency-Code" required="false" max="1"/>
+			</data>
 		</avp>
 
 		<avp name="BillingInfo" code="7006">
@@ -144,7 +148,11 @@ const (
 		</avp>
 
 		<avp name="MonetaryQuota" code="7016">
-			<data type="Unsigned32"/>
+			<!-- the money as CC-Money of RFC 4006 8.22, in the currency of the account -->
+			<data type="Grouped">
+				<rule avp="Unit-Value" required="true" max="1"/>
+				<rule avp="Currency-Code" required="false" max="1"/>
+			</data>
 		</avp>
 
 		<avp name="RequestedUnits" code="7017">
@@ -211,6 +219,7 @@ const (
 				<item code="1" name="END_USER_IMSI"/>
 				<item code="2" name="END_USER_SIP_URI"/>
 				<item code="3" name="END_USER_NAI"/>
+				<item code="4" name="END_USER_PRIVATE"/>
 			</data>
 		</avp>
 
@@ -663,6 +672,7 @@ const (
 				<item code="1" name="END_USER_IMSI"/>
 				<item code="2" name="END_USER_SIP_URI"/>
 				<item code="3" name="END_USER_NAI"/>
+				<item code="4" name="END_USER_PRIVATE"/>
 			</data>
 		</avp>
 
@@ -781,7 +791,7 @@ const (
 			</data>
 		</avp>
 
-		<avp name="Acct-Balance" code="7028">
+		<avp name="Acct-Balance" code="7030">
 			<data type="Grouped">
 				<rule avp="Acct-Balance-Id" required="true" max="1"/>
 				<rule avp="Unit-Value" required="true" max="1"/>
@@ -0,0 +1,33 @@
+package dict
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/fiorix/go-diameter/diam/dict"
+)
+
+var (
+	rateOnce sync.Once
+	rateErr  error
+	abmfOnce sync.Once
+	abmfErr  error
+)
+
+// LoadRateDictionary loads the RateDictionary on top of the default one once,
+// it is shared by the RF and its clients running in the same process
+func LoadRateDictionary() error {
+	rateOnce.Do(func() {
+		rateErr = dict.Default.Load(bytes.NewReader([]byte(RateDictionary)))
+	})
+	return rateErr
+}
+
+// LoadAbmfDictionary loads the AbmfDictionary on top of the default one once,
+// it is shared by the ABMF and its clients running in the same process
+func LoadAbmfDictionary() error {
+	abmfOnce.Do(func() {
+		abmfErr = dict.Default.Load(bytes.NewReader([]byte(AbmfDictionary)))
+	})
+	return abmfErr
+}
@@ -0,0 +1,208 @@
+package cdrConvert
+
+import (
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/openapi/models"
+)
+
+// TODO: UTRA/GERA location and TNAP/TWAP/HFC identifiers of N3GA location are not converted currently.
+func UserLocationToCdr(userLocation *models.UserLocation) *cdrType.UserLocationInformationStructured {
+	if userLocation == nil {
+		return nil
+	}
+
+	cdrUserLocation := &cdrType.UserLocationInformationStructured{}
+
+	if eutra := userLocation.EutraLocation; eutra != nil {
+		cdrUserLocation.EutraLocation = &cdrType.EutraLocation{
+			Tai:           taiToCdr(eutra.Tai),
+			GlobalNgenbId: globalRanNodeIdToCdr(eutra.GlobalNgenbId),
+			GlobalENbId:   globalRanNodeIdToCdr(eutra.GlobalENbId),
+		}
+		if ecgi := eutra.Ecgi; ecgi != nil && ecgi.PlmnId != nil {
+			cdrUserLocation.EutraLocation.Ecgi = &cdrType.Ecgi{
+				PlmnId:      PlmnIdToCdr(*ecgi.PlmnId),
+				EutraCellId: cdrType.EutraCellId{Value: asn.UTF8String(ecgi.EutraCellId)},
+				Nid:         nidToCdr(ecgi.Nid),
+			}
+		}
+		if eutra.AgeOfLocationInformation != 0 {
+			cdrUserLocation.EutraLocation.AgeOfLocationInformation = &cdrType.AgeOfLocationInformation{
+				Value: int64(eutra.AgeOfLocationInformation),
+			}
+		}
+		if eutra.UeLocationTimestamp != nil {
+			timeStamp := TimeStampToCdr(eutra.UeLocationTimestamp)
+			cdrUserLocation.EutraLocation.UeLocationTimestamp = &timeStamp
+		}
+	}
+
+	if nr := userLocation.NrLocation; nr != nil {
+		cdrUserLocation.NrLocation = &cdrType.NrLocation{
+			Tai:         taiToCdr(nr.Tai),
+			GlobalGnbId: globalRanNodeIdToCdr(nr.GlobalGnbId),
+		}
+		if ncgi := nr.Ncgi; ncgi != nil && ncgi.PlmnId != nil {
+			cdrUserLocation.NrLocation.Ncgi = &cdrType.Ncgi{
+				PlmnId:   PlmnIdToCdr(*ncgi.PlmnId),
+				NrCellId: cdrType.NrCellId{Value: asn.UTF8String(ncgi.NrCellId)},
+				Nid:      nidToCdr(ncgi.Nid),
+			}
+		}
+		if nr.AgeOfLocationInformation != 0 {
+			cdrUserLocation.NrLocation.AgeOfLocationInformation = &cdrType.AgeOfLocationInformation{
+				Value: int64(nr.AgeOfLocationInformation),
+			}
+		}
+		if nr.UeLocationTimestamp != nil {
+			timeStamp := TimeStampToCdr(nr.UeLocationTimestamp)
+			cdrUserLocation.NrLocation.UeLocationTimestamp = &timeStamp
+		}
+	}
+
+	if n3ga := userLocation.N3gaLocation; n3ga != nil {
+		cdrUserLocation.N3gaLocation = &cdrType.N3gaLocation{
+			N3gppTai:   taiToCdr(n3ga.N3gppTai),
+			UeIpv4Addr: IPAddressToCdr(n3ga.UeIpv4Addr),
+			UeIpv6Addr: IPAddressToCdr(n3ga.UeIpv6Addr),
+		}
+		if n3ga.N3IwfId != "" {
+			cdrUserLocation.N3gaLocation.N3IwfId = &cdrType.N3IwFId{Value: asn.IA5String(n3ga.N3IwfId)}
+		}
+		if n3ga.PortNumber != 0 {
+			portNumber := int64(n3ga.PortNumber)
+			cdrUserLocation.N3gaLocation.PortNumber = &portNumber
+		}
+	}
+
+	return cdrUserLocation
+}
+
+func taiToCdr(tai *models.Tai) *cdrType.TAI {
+	if tai == nil || tai.PlmnId == nil {
+		return nil
+	}
+
+	cdrTai := &cdrType.TAI{
+		PLMNId: PlmnIdToCdr(*tai.PlmnId),
+	}
+	if tac, err := hex.DecodeString(tai.Tac); err == nil {
+		cdrTai.Tac = cdrType.TAC{Value: tac}
+	}
+	return cdrTai
+}
+
+func nidToCdr(nid string) *cdrType.Nid {
+	if nid == "" {
+		return nil
+	}
+	return &cdrType.Nid{Value: asn.UTF8String(nid)}
+}
+
+func globalRanNodeIdToCdr(ranNodeId *models.GlobalRanNodeId) *cdrType.GlobalRanNodeId {
+	if ranNodeId == nil {
+		return nil
+	}
+
+	cdrRanNodeId := &cdrType.GlobalRanNodeId{
+		Nid: nidToCdr(ranNodeId.Nid),
+	}
+	if ranNodeId.PlmnId != nil {
+		plmnId := PlmnIdToCdr(*ranNodeId.PlmnId)
+		cdrRanNodeId.PLMNId = &plmnId
+	}
+	if ranNodeId.N3IwfId != "" {
+		cdrRanNodeId.N3IwfId = &cdrType.N3IwFId{Value: asn.IA5String(ranNodeId.N3IwfId)}
+	}
+	if gNbId := ranNodeId.GNbId; gNbId != nil {
+		cdrRanNodeId.GNbId = &cdrType.GNbId{
+			BitLength: int64(gNbId.BitLength),
+			GNbValue:  asn.IA5String(gNbId.GNBValue),
+		}
+	}
+	if ranNodeId.NgeNbId != "" {
+		cdrRanNodeId.NgeNbId = &cdrType.NgeNbId{Value: asn.IA5String(ranNodeId.NgeNbId)}
+	}
+	if ranNodeId.WagfId != "" {
+		cdrRanNodeId.WagfId = &cdrType.WAgfId{Value: asn.UTF8String(ranNodeId.WagfId)}
+	}
+	if ranNodeId.TngfId != "" {
+		cdrRanNodeId.TngfId = &cdrType.TngfId{Value: asn.UTF8String(ranNodeId.TngfId)}
+	}
+	if ranNodeId.ENbId != "" {
+		cdrRanNodeId.ENbId = &cdrType.ENbId{Value: asn.UTF8String(ranNodeId.ENbId)}
+	}
+	return cdrRanNodeId
+}
+
+func IPAddressToCdr(address string) *cdrType.IPAddress {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return &cdrType.IPAddress{
+			Present:        cdrType.IPAddressPresentIPBinV4Address,
+			IPBinV4Address: &cdrType.IPBinV4Address{Value: asn.OctetString(ipv4)},
+		}
+	}
+	return &cdrType.IPAddress{
+		Present:        cdrType.IPAddressPresentIPBinV6Address,
+		IPBinV6Address: &cdrType.IPBinV6Address{Value: asn.OctetString(ip.To16())},
+	}
+}
+
+// 29.571 TimeZone, e.g. "-08:00+1", into 29.061 MS-TimeZone:
+// 24.008 10.5.3.8 time zone in quarters of an hour, followed by the daylight saving time
+func TimeZoneToCdr(timeZone string) *cdrType.MSTimeZone {
+	if len(timeZone) < 6 || (timeZone[0] != '+' && timeZone[0] != '-') {
+		return nil
+	}
+
+	hours, errHours := strconv.Atoi(timeZone[1:3])
+	minutes, errMinutes := strconv.Atoi(timeZone[4:6])
+	if errHours != nil || errMinutes != nil {
+		return nil
+	}
+	var dst int
+	if daylightSaving := strings.TrimPrefix(timeZone[6:], "+"); daylightSaving != "" {
+		dst, _ = strconv.Atoi(daylightSaving)
+	}
+
+	quarters := (hours*60 + minutes) / 15
+	tz := byte(quarters%10)<<4 | byte(quarters/10)
+	if timeZone[0] == '-' {
+		tz |= 0x08
+	}
+	return &cdrType.MSTimeZone{
+		Value: asn.OctetString{tz, byte(dst)},
+	}
+}
+
+// PEI: imeisv-<16 digits> or imei-<15 digits>
+func PeiToCdr(pei string) *cdrType.SubscriberEquipmentNumber {
+	var digits string
+
+	switch {
+	case strings.HasPrefix(pei, "imeisv-"):
+		digits = strings.TrimPrefix(pei, "imeisv-")
+	case strings.HasPrefix(pei, "imei-"):
+		digits = strings.TrimPrefix(pei, "imei-")
+	default:
+		return nil
+	}
+
+	return &cdrType.SubscriberEquipmentNumber{
+		SubscriberEquipmentNumberType: cdrType.SubscriberEquipmentType{
+			Value: cdrType.SubscriberEquipmentTypePresentIMEISV,
+		},
+		SubscriberEquipmentNumberData: tbcdToCdr(digits),
+	}
+}
@@ -0,0 +1,63 @@
+package cdrConvert
+
+import (
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/openapi/models"
+)
+
+func NefChargingInformationToCdr(nefInfo *models.NefChargingInformation) *cdrType.ExposureFunctionAPIInformation {
+	cdrNefInfo := &cdrType.ExposureFunctionAPIInformation{
+		APIName: asn.IA5String(nefInfo.APIName),
+	}
+
+	if nefInfo.GroupIdentifier != "" {
+		cdrNefInfo.GroupIdentifier = &cdrType.AddressString{
+			Value: asn.OctetString(nefInfo.GroupIdentifier),
+		}
+	}
+
+	switch nefInfo.APIDirection {
+	case models.ApiDirection_INVOCATION:
+		cdrNefInfo.APIDirection = &cdrType.APIDirection{Value: cdrType.APIDirectionPresentInvocation}
+	case models.ApiDirection_NOTIFICATION:
+		cdrNefInfo.APIDirection = &cdrType.APIDirection{Value: cdrType.APIDirectionPresentNotification}
+	}
+
+	if nefInfo.APITargetNetworkFunction != nil {
+		targetNf := NfIdentificationToCdr(nefInfo.APITargetNetworkFunction)
+		cdrNefInfo.APITargetNetworkFunction = &targetNf
+	}
+
+	if nefInfo.APIResultCode != 0 {
+		cdrNefInfo.APIResultCode = &cdrType.APIResultCode{
+			Value: int64(nefInfo.APIResultCode),
+		}
+	}
+
+	if nefInfo.APIReference != "" {
+		apiReference := asn.IA5String(nefInfo.APIReference)
+		cdrNefInfo.APIReference = &apiReference
+	}
+
+	if nefInfo.APIContent != "" {
+		apiContent := asn.OctetString(nefInfo.APIContent)
+		cdrNefInfo.APIContent = &apiContent
+	}
+
+	if nefInfo.ExternalIndividualIdentifier != "" {
+		externalId := asn.UTF8String(nefInfo.ExternalIndividualIdentifier)
+		cdrNefInfo.ExternalIndividualIdentifier = &cdrType.InvolvedParty{
+			Present:    cdrType.InvolvedPartyPresentExternalId,
+			ExternalId: &externalId,
+		}
+	}
+
+	if nefInfo.ExternalGroupIdentifier != "" {
+		cdrNefInfo.ExternalGroupIdentifier = &cdrType.ExternalGroupIdentifier{
+			Value: asn.UTF8String(nefInfo.ExternalGroupIdentifier),
+		}
+	}
+
+	return cdrNefInfo
+}
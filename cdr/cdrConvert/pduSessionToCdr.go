@@ -0,0 +1,472 @@
+package cdrConvert
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/openapi/models"
+)
+
+// PduSessionChargingInformationToCdr writes the PDU session charging information into the CDR,
+// only the fields present in the request are overwritten, so the CDR keeps the latest value of each field
+func PduSessionChargingInformationToCdr(pduSessionInfo *models.PduSessionChargingInformation,
+	cdrPduSessionInfo *cdrType.PDUSessionChargingInformation) {
+	if pduSessionInfo.ChargingId != 0 {
+		cdrPduSessionInfo.PDUSessionChargingID = cdrType.ChargingID{
+			Value: int64(pduSessionInfo.ChargingId),
+		}
+	}
+	if pduSessionInfo.HomeProvidedChargingId != 0 {
+		cdrPduSessionInfo.HomeProvidedChargingID = &cdrType.ChargingID{
+			Value: int64(pduSessionInfo.HomeProvidedChargingId),
+		}
+	}
+
+	if userInfo := pduSessionInfo.UserInformation; userInfo != nil {
+		if userIdentifier := GpsiToCdr(userInfo.ServedGPSI); userIdentifier != nil {
+			cdrPduSessionInfo.UserIdentifier = userIdentifier
+		}
+		if userEquipment := PeiToCdr(userInfo.ServedPEI); userEquipment != nil {
+			cdrPduSessionInfo.UserEquipmentInfo = userEquipment
+		}
+		if userInfo.UnauthenticatedFlag {
+			unauthenticated := asn.NULL(true)
+			cdrPduSessionInfo.SUPIunauthenticatedFlag = &unauthenticated
+		}
+		switch userInfo.RoamerInOut {
+		case models.RoamerInOut_IN_BOUND:
+			cdrPduSessionInfo.UserRoamerInOut = &cdrType.RoamerInOut{Value: cdrType.RoamerInOutPresentRoamerInBound}
+		case models.RoamerInOut_OUT_BOUND:
+			cdrPduSessionInfo.UserRoamerInOut = &cdrType.RoamerInOut{Value: cdrType.RoamerInOutPresentRoamerOutBound}
+		}
+	}
+
+	if userLocation := UserLocationToCdr(pduSessionInfo.UserLocationinfo); userLocation != nil {
+		cdrPduSessionInfo.UserLocationInformationASN1 = userLocation
+	}
+	if userLocation := UserLocationToCdr(pduSessionInfo.MAPDUNon3GPPUserLocationInfo); userLocation != nil {
+		cdrPduSessionInfo.MAPDUNonThreeGPPUserLocationInfoASN1 = userLocation
+	}
+	if presenceInfo := presenceReportingAreaInfoToCdr(pduSessionInfo.PresenceReportingAreaInformation); presenceInfo != nil {
+		cdrPduSessionInfo.PresenceReportingAreaInfo = presenceInfo
+	}
+	if timeZone := TimeZoneToCdr(pduSessionInfo.UetimeZone); timeZone != nil {
+		cdrPduSessionInfo.UETimeZone = timeZone
+	}
+
+	if sessionInfo := pduSessionInfo.PduSessionInformation; sessionInfo != nil {
+		pduSessionInformationToCdr(sessionInfo, cdrPduSessionInfo)
+	}
+
+	if report := pduSessionInfo.RANSecondaryRATUsageReport; report != nil {
+		cdrPduSessionInfo.RANSecondaryRATUsageReport = append(cdrPduSessionInfo.RANSecondaryRATUsageReport,
+			ranSecondaryRatUsageReportToCdr(report))
+	}
+}
+
+func pduSessionInformationToCdr(sessionInfo *models.PduSessionInformation,
+	cdrPduSessionInfo *cdrType.PDUSessionChargingInformation) {
+	if sessionInfo.PduSessionID != 0 {
+		cdrPduSessionInfo.PDUSessionId = cdrType.PDUSessionId{
+			Value: int64(sessionInfo.PduSessionID),
+		}
+	}
+
+	if slicingInfo := sessionInfo.NetworkSlicingInfo; slicingInfo != nil && slicingInfo.SNSSAI != nil {
+		cdrPduSessionInfo.NetworkSliceInstanceID = SnssaiToCdr(*slicingInfo.SNSSAI)
+	}
+
+	if pduType, ok := pduSessionTypeToCdr[sessionInfo.PduType]; ok {
+		cdrPduSessionInfo.PDUType = &cdrType.PDUSessionType{Value: pduType}
+	}
+
+	// SSC_MODE_1, SSC_MODE_2, SSC_MODE_3
+	if sscMode, err := strconv.Atoi(strings.TrimPrefix(string(sessionInfo.SscMode), "SSC_MODE_")); err == nil {
+		cdrPduSessionInfo.SSCMode = &cdrType.SSCMode{Value: int64(sscMode)}
+	}
+
+	if sessionInfo.HPlmnId != nil {
+		plmnId := PlmnIdToCdr(*sessionInfo.HPlmnId)
+		cdrPduSessionInfo.SUPIPLMNIdentifier = &plmnId
+	}
+	if sessionInfo.ServingCNPlmnId != nil {
+		plmnId := PlmnIdToCdr(*sessionInfo.ServingCNPlmnId)
+		cdrPduSessionInfo.ServingCNPLMNID = &plmnId
+	}
+
+	if servingNf := sessionInfo.ServingNetworkFunctionID; servingNf != nil {
+		cdrServingNf := cdrType.ServingNetworkFunctionID{
+			ServingNetworkFunctionInformation: NfIdentificationToCdr(servingNf.ServingNetworkFunctionInformation),
+		}
+		if amfId, err := hex.DecodeString(servingNf.AMFId); err == nil && len(amfId) != 0 {
+			cdrServingNf.AMFIdentifier = &cdrType.AMFID{Value: amfId}
+		}
+		cdrPduSessionInfo.ServingNetworkFunctionID = []cdrType.ServingNetworkFunctionID{cdrServingNf}
+	}
+
+	if ratType, ok := RatTypeToCdr(sessionInfo.RatType); ok {
+		cdrPduSessionInfo.RATType = &ratType
+	}
+	if ratType, ok := RatTypeToCdr(sessionInfo.MAPDUNon3GPPRATType); ok {
+		cdrPduSessionInfo.MAPDUNonThreeGPPRATType = &ratType
+	}
+
+	if sessionInfo.DnnId != "" {
+		cdrPduSessionInfo.DataNetworkNameIdentifier = &cdrType.DataNetworkNameIdentifier{
+			Value: asn.IA5String(sessionInfo.DnnId),
+		}
+	}
+	switch sessionInfo.DnnSelectionMode {
+	case models.DnnSelectionMode_VERIFIED:
+		cdrPduSessionInfo.DnnSelectionMode = &cdrType.DNNSelectionMode{
+			Value: cdrType.DNNSelectionModePresentUEorNetworkProvidedSubscriptionVerified,
+		}
+	case models.DnnSelectionMode_UE_DNN_NOT_VERIFIED:
+		cdrPduSessionInfo.DnnSelectionMode = &cdrType.DNNSelectionMode{
+			Value: cdrType.DNNSelectionModePresentUEProvidedSubscriptionNotVerified,
+		}
+	case models.DnnSelectionMode_NW_DNN_NOT_VERIFIED:
+		cdrPduSessionInfo.DnnSelectionMode = &cdrType.DNNSelectionMode{
+			Value: cdrType.DNNSelectionModePresentNetworkProvidedSubscriptionNotVerified,
+		}
+	}
+
+	if chargingCharacteristics := hexStringToCdr(sessionInfo.ChargingCharacteristics); chargingCharacteristics != nil {
+		cdrPduSessionInfo.ChargingCharacteristics = &cdrType.ChargingCharacteristics{
+			Value: *chargingCharacteristics,
+		}
+	}
+	switch sessionInfo.ChargingCharacteristicsSelectionMode {
+	case models.ChargingCharacteristicsSelectionMode_HOME_DEFAULT:
+		cdrPduSessionInfo.ChChSelectionMode = &cdrType.ChChSelectionMode{
+			Value: cdrType.ChChSelectionModePresentHomeDefault,
+		}
+	case models.ChargingCharacteristicsSelectionMode_ROAMING_DEFAULT:
+		cdrPduSessionInfo.ChChSelectionMode = &cdrType.ChChSelectionMode{
+			Value: cdrType.ChChSelectionModePresentRoamingDefault,
+		}
+	case models.ChargingCharacteristicsSelectionMode_VISITING_DEFAULT:
+		cdrPduSessionInfo.ChChSelectionMode = &cdrType.ChChSelectionMode{
+			Value: cdrType.ChChSelectionModePresentVisitingDefault,
+		}
+	}
+
+	if sessionInfo.StartTime != nil {
+		startTime := TimeStampToCdr(sessionInfo.StartTime)
+		cdrPduSessionInfo.PDUSessionstartTime = &startTime
+	}
+	if sessionInfo.StopTime != nil {
+		stopTime := TimeStampToCdr(sessionInfo.StopTime)
+		cdrPduSessionInfo.PDUSessionstopTime = &stopTime
+	}
+
+	switch sessionInfo.Var3gppPSDataOffStatus {
+	case models.Model3GpppsDataOffStatus_ACTIVE:
+		cdrPduSessionInfo.ThreeGPPPSDataOffStatus = &cdrType.ThreeGPPPSDataOffStatus{
+			Value: cdrType.ThreeGPPPSDataOffStatusPresentActive,
+		}
+	case models.Model3GpppsDataOffStatus_INACTIVE:
+		cdrPduSessionInfo.ThreeGPPPSDataOffStatus = &cdrType.ThreeGPPPSDataOffStatus{
+			Value: cdrType.ThreeGPPPSDataOffStatusPresentInactive,
+		}
+	}
+
+	if pduAddress := pduAddressToCdr(sessionInfo.PduAddress); pduAddress != nil {
+		cdrPduSessionInfo.PDUAddress = pduAddress
+	}
+
+	// 5GSM cause of the PDU session release
+	if sessionInfo.Diagnostics != 0 {
+		cause := int64(sessionInfo.Diagnostics)
+		cdrPduSessionInfo.Diagnostics = &cdrType.Diagnostics{
+			Present:      cdrType.DiagnosticsPresentGsm0408Cause,
+			Gsm0408Cause: &cause,
+		}
+	}
+
+	if qos := sessionInfo.AuthorizedQoSInformation; qos != nil {
+		cdrPduSessionInfo.AuthorizedQoSInformation = &cdrType.AuthorizedQoSInformation{
+			FiveQi:          optionalInt64(qos.Var5qi),
+			ARP:             arpToCdr(qos.Arp),
+			PriorityLevel:   optionalInt64(qos.PriorityLevel),
+			AverWindow:      optionalInt64(qos.AverWindow),
+			MaxDataBurstVol: optionalInt64(qos.MaxDataBurstVol),
+		}
+	}
+	if qos := sessionInfo.SubscribedQoSInformation; qos != nil {
+		cdrPduSessionInfo.SubscribedQoSInformation = &cdrType.SubscribedQoSInformation{
+			FiveQi:        optionalInt64(qos.Var5qi),
+			ARP:           arpToCdr(qos.Arp),
+			PriorityLevel: optionalInt64(qos.PriorityLevel),
+		}
+	}
+
+	if ambr := sessionInfo.AuthorizedSessionAMBR; ambr != nil {
+		cdrPduSessionInfo.AuthorizedSessionAMBR = ambrToCdr(ambr)
+	}
+	if ambr := sessionInfo.SubscribedSessionAMBR; ambr != nil {
+		cdrPduSessionInfo.SubscribedSessionAMBR = ambrToCdr(ambr)
+	}
+
+	if maPduInfo := sessionInfo.MAPDUSessionInformation; maPduInfo != nil {
+		cdrPduSessionInfo.MAPDUSessionInformation = maPduSessionInformationToCdr(maPduInfo)
+	}
+
+	if len(sessionInfo.EnhancedDiagnostics) != 0 {
+		cdrPduSessionInfo.EnhancedDiagnostics = enhancedDiagnosticsToCdr(sessionInfo.EnhancedDiagnostics)
+	}
+}
+
+var pduSessionTypeToCdr = map[models.PduSessionType]asn.Enumerated{
+	models.PduSessionType_IPV4_V6:      cdrType.PDUSessionTypePresentIPv4v6,
+	models.PduSessionType_IPV4:         cdrType.PDUSessionTypePresentIPv4,
+	models.PduSessionType_IPV6:         cdrType.PDUSessionTypePresentIPv6,
+	models.PduSessionType_UNSTRUCTURED: cdrType.PDUSessionTypePresentUnstructured,
+	models.PduSessionType_ETHERNET:     cdrType.PDUSessionTypePresentEthernet,
+}
+
+func SnssaiToCdr(snssai models.Snssai) *cdrType.SingleNSSAI {
+	cdrSnssai := &cdrType.SingleNSSAI{
+		SST: cdrType.SliceServiceType{Value: int64(snssai.Sst)},
+	}
+	if sd, err := hex.DecodeString(snssai.Sd); err == nil && len(sd) != 0 {
+		cdrSnssai.SD = &cdrType.SliceDifferentiator{Value: sd}
+	}
+	return cdrSnssai
+}
+
+// GpsiToCdr converts the GPSI, msisdn-<digits> or extid-<external identifier>, to the involved party
+func GpsiToCdr(gpsi string) *cdrType.InvolvedParty {
+	switch {
+	case strings.HasPrefix(gpsi, "msisdn-"):
+		telUri := asn.GraphicString("tel:+" + strings.TrimPrefix(gpsi, "msisdn-"))
+		return &cdrType.InvolvedParty{
+			Present: cdrType.InvolvedPartyPresentTELURI,
+			TELURI:  &telUri,
+		}
+	case strings.HasPrefix(gpsi, "extid-"):
+		externalId := asn.UTF8String(strings.TrimPrefix(gpsi, "extid-"))
+		return &cdrType.InvolvedParty{
+			Present:    cdrType.InvolvedPartyPresentExternalId,
+			ExternalId: &externalId,
+		}
+	}
+	return nil
+}
+
+func pduAddressToCdr(pduAddress *models.PduAddress) *cdrType.PDUAddress {
+	if pduAddress == nil {
+		return nil
+	}
+
+	cdrPduAddress := &cdrType.PDUAddress{
+		PDUIPv4Address: IPAddressToCdr(pduAddress.PduIPv4Address),
+	}
+	if pduAddress.PduIPv4Address != "" {
+		cdrPduAddress.IPV4dynamicAddressFlag = &cdrType.DynamicAddressFlag{Value: pduAddress.IPv4dynamicAddressFlag}
+	}
+	if prefix := ipv6PrefixToCdr(pduAddress.PduIPv6AddresswithPrefix, pduAddress.PduAddressprefixlength); prefix != nil {
+		cdrPduAddress.PDUIPv6AddresswithPrefix = prefix
+		cdrPduAddress.IPV6dynamicPrefixFlag = &cdrType.DynamicAddressFlag{Value: pduAddress.IPv6dynamicPrefixFlag}
+	}
+	for _, additional := range strings.Fields(strings.Replace(pduAddress.AddIpv6AddrPrefixes, ",", " ", -1)) {
+		if prefix := ipv6PrefixToCdr(additional, 0); prefix != nil {
+			cdrPduAddress.AdditionalPDUIPv6Prefixes = append(cdrPduAddress.AdditionalPDUIPv6Prefixes, *prefix)
+		}
+	}
+
+	return cdrPduAddress
+}
+
+// IPv6 address with prefix, e.g. 2001:db8::/64, the prefix length defaults to 64
+func ipv6PrefixToCdr(address string, prefixLength int32) *cdrType.IPAddress {
+	if address == "" {
+		return nil
+	}
+	if slash := strings.Index(address, "/"); slash != -1 {
+		if length, err := strconv.Atoi(address[slash+1:]); err == nil {
+			prefixLength = int32(length)
+		}
+		address = address[:slash]
+	}
+
+	ip := IPAddressToCdr(address)
+	if ip == nil || ip.IPBinV6Address == nil {
+		return nil
+	}
+	prefix := &cdrType.IPBinV6AddressWithPrefixLength{
+		IPBinV6Address: *ip.IPBinV6Address,
+	}
+	if prefixLength != 0 {
+		prefix.PDPAddressPrefixLength = &cdrType.PDPAddressPrefixLength{Value: int64(prefixLength)}
+	}
+	return &cdrType.IPAddress{
+		Present:                  cdrType.IPAddressPresentIPBinV6AddressWithPrefix,
+		IPBinV6AddressWithPrefix: prefix,
+	}
+}
+
+func arpToCdr(arp *models.Arp) *cdrType.AllocationRetentionPriority {
+	if arp == nil {
+		return nil
+	}
+
+	cdrArp := &cdrType.AllocationRetentionPriority{
+		PriorityLevel: int64(arp.PriorityLevel),
+	}
+	if arp.PreemptCap == models.PreemptionCapability_MAY_PREEMPT {
+		cdrArp.PreemptionCapability.Value = cdrType.PreemptionCapabilityPresentMAYPREEMPT
+	}
+	if arp.PreemptVuln == models.PreemptionVulnerability_PREEMPTABLE {
+		cdrArp.PreemptionVulnerability.Value = cdrType.PreemptionVulnerabilityPresentPREEMPTABLE
+	}
+	return cdrArp
+}
+
+// Bit rate string of 29.571, e.g. "1 Gbps"
+func ambrToCdr(ambr *models.Ambr) *cdrType.SessionAMBR {
+	return &cdrType.SessionAMBR{
+		AmbrUL: cdrType.Bitrate{Value: asn.OctetString(ambr.Uplink)},
+		AmbrDL: cdrType.Bitrate{Value: asn.OctetString(ambr.Downlink)},
+	}
+}
+
+func maPduSessionInformationToCdr(maPduInfo *models.MapduSessionInformation) *cdrType.MAPDUSessionInformation {
+	cdrMaPduInfo := &cdrType.MAPDUSessionInformation{}
+
+	switch maPduInfo.MAPDUSessionIndicator {
+	case models.MaPduIndication_REQUEST:
+		cdrMaPduInfo.MAPDUSessionIndicator = &cdrType.MAPDUSessionIndicator{
+			Value: cdrType.MAPDUSessionIndicatorPresentMAPDURequest,
+		}
+	case models.MaPduIndication_NETWORK_UPGRADE_ALLOWED:
+		cdrMaPduInfo.MAPDUSessionIndicator = &cdrType.MAPDUSessionIndicator{
+			Value: cdrType.MAPDUSessionIndicatorPresentMAPDUNetworkUpgradeAllowed,
+		}
+	}
+
+	if capability := maPduInfo.ATSSSCapability; capability != nil {
+		switch {
+		case capability.Mptcp && capability.AtsssLL:
+			cdrMaPduInfo.ATSSSCapability = &cdrType.ATSSSCapability{
+				Value: cdrType.ATSSSCapabilityPresentMPTCPATSSLL,
+			}
+		case capability.AtsssLL:
+			cdrMaPduInfo.ATSSSCapability = &cdrType.ATSSSCapability{
+				Value: cdrType.ATSSSCapabilityPresentATSSSLL,
+			}
+		}
+	}
+
+	return cdrMaPduInfo
+}
+
+func enhancedDiagnosticsToCdr(causes []models.RanNasRelCause) *cdrType.EnhancedDiagnostics5G {
+	cdrDiagnostics := &cdrType.EnhancedDiagnostics5G{}
+
+	for _, cause := range causes {
+		cdrCause := cdrType.RANNASRelCause{}
+		if cause.NgApCause != nil {
+			cdrCause.NgApCause = &cdrType.NgApCause{
+				Group: int64(cause.NgApCause.Group),
+				Value: int64(cause.NgApCause.Value),
+			}
+		}
+		if cause.Var5gMmCause != 0 {
+			cdrCause.FivegMmCause = &cdrType.FiveGMmCause{Value: int64(cause.Var5gMmCause)}
+		}
+		if cause.Var5gSmCause != 0 {
+			cdrCause.FivegSmCause = &cdrType.FiveGSmCause{Value: int64(cause.Var5gSmCause)}
+		}
+		if epsCause := hexStringToCdr(cause.EpsCause); epsCause != nil {
+			cdrCause.EpsCause = &cdrType.RANNASCause{Value: *epsCause}
+		}
+		cdrDiagnostics.RANNASRelCause = append(cdrDiagnostics.RANNASRelCause, cdrCause)
+	}
+
+	return cdrDiagnostics
+}
+
+func ranSecondaryRatUsageReportToCdr(report *models.RanSecondaryRatUsageReport) cdrType.NGRANSecondaryRATUsageReport {
+	cdrReport := cdrType.NGRANSecondaryRATUsageReport{}
+
+	if report.RANSecondaryRATType != "" {
+		cdrReport.NGRANSecondaryRATType = &cdrType.NGRANSecondaryRATType{
+			Value: asn.OctetString(report.RANSecondaryRATType),
+		}
+	}
+
+	for _, usage := range report.QosFlowsUsageReports {
+		cdrUsage := cdrType.QosFlowsUsageReport{
+			QosFlowId:          &cdrType.QoSFlowId{Value: int64(usage.QFI)},
+			DataVolumeDownlink: cdrType.DataVolumeOctets{Value: int64(usage.DownlinkVolume)},
+			DataVolumeUplink:   cdrType.DataVolumeOctets{Value: int64(usage.UplinkVolume)},
+		}
+		if usage.StartTimestamp != nil {
+			cdrUsage.StartTime = TimeStampToCdr(usage.StartTimestamp)
+		}
+		if usage.EndTimestamp != nil {
+			cdrUsage.EndTime = TimeStampToCdr(usage.EndTimestamp)
+		}
+		cdrReport.QosFlowsUsageReports = append(cdrReport.QosFlowsUsageReports, cdrUsage)
+	}
+
+	return cdrReport
+}
+
+// The CDR carries one presence reporting area, the first one ordered by the PRA ID is taken
+func presenceReportingAreaInfoToCdr(presenceInfos map[string]models.PresenceInfo) *cdrType.PresenceReportingAreaInfo {
+	if len(presenceInfos) == 0 {
+		return nil
+	}
+
+	praIds := make([]string, 0, len(presenceInfos))
+	for praId := range presenceInfos {
+		praIds = append(praIds, praId)
+	}
+	sort.Strings(praIds)
+	presenceInfo := presenceInfos[praIds[0]]
+
+	// 29.274 8.108 Presence Reporting Area Identifier: 3 octets
+	praIdentifier := make(asn.OctetString, 4)
+	if praId, err := strconv.ParseUint(presenceInfo.PraId, 10, 32); err == nil {
+		binary.BigEndian.PutUint32(praIdentifier, uint32(praId))
+	}
+	cdrPresenceInfo := &cdrType.PresenceReportingAreaInfo{
+		PresenceReportingAreaIdentifier: praIdentifier[1:],
+	}
+
+	switch presenceInfo.PresenceState {
+	case models.PresenceState_IN_AREA:
+		cdrPresenceInfo.PresenceReportingAreaStatus = &cdrType.PresenceReportingAreaStatus{
+			Value: cdrType.PresenceReportingAreaStatusPresentInsideArea,
+		}
+	case models.PresenceState_OUT_OF_AREA:
+		cdrPresenceInfo.PresenceReportingAreaStatus = &cdrType.PresenceReportingAreaStatus{
+			Value: cdrType.PresenceReportingAreaStatusPresentOutsideArea,
+		}
+	case models.PresenceState_INACTIVE:
+		cdrPresenceInfo.PresenceReportingAreaStatus = &cdrType.PresenceReportingAreaStatus{
+			Value: cdrType.PresenceReportingAreaStatusPresentInactive,
+		}
+	case models.PresenceState_UNKNOWN:
+		cdrPresenceInfo.PresenceReportingAreaStatus = &cdrType.PresenceReportingAreaStatus{
+			Value: cdrType.PresenceReportingAreaStatusPresentUnknown,
+		}
+	}
+
+	return cdrPresenceInfo
+}
+
+func optionalInt64(value int32) *int64 {
+	if value == 0 {
+		return nil
+	}
+	v := int64(value)
+	return &v
+}
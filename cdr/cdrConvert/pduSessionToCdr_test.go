@@ -0,0 +1,63 @@
+package cdrConvert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestPduSessionChargingInformationToCdr(t *testing.T) {
+	cdrPduSessionInfo := &cdrType.PDUSessionChargingInformation{}
+
+	PduSessionChargingInformationToCdr(&models.PduSessionChargingInformation{
+		ChargingId: 1,
+		UserInformation: &models.UserInformation{
+			ServedGPSI: "msisdn-886912345678",
+		},
+		UetimeZone: "-08:00+1",
+		PduSessionInformation: &models.PduSessionInformation{
+			NetworkSlicingInfo: &models.NetworkSlicingInfo{
+				SNSSAI: &models.Snssai{Sst: 1, Sd: "010203"},
+			},
+			PduSessionID: 10,
+			PduType:      models.PduSessionType_IPV4,
+			SscMode:      models.SscMode__1,
+			DnnId:        "internet",
+			PduAddress: &models.PduAddress{
+				PduIPv4Address: "10.60.0.1",
+			},
+		},
+	}, cdrPduSessionInfo)
+
+	// update only overwrites the fields carried in the request
+	PduSessionChargingInformationToCdr(&models.PduSessionChargingInformation{
+		PduSessionInformation: &models.PduSessionInformation{
+			Var3gppPSDataOffStatus: models.Model3GpppsDataOffStatus_ACTIVE,
+		},
+	}, cdrPduSessionInfo)
+
+	require.Equal(t, int64(1), cdrPduSessionInfo.PDUSessionChargingID.Value)
+	require.Equal(t, int64(10), cdrPduSessionInfo.PDUSessionId.Value)
+	require.Equal(t, asn.GraphicString("tel:+886912345678"), *cdrPduSessionInfo.UserIdentifier.TELURI)
+	require.Equal(t, asn.OctetString{0x2b, 0x01}, cdrPduSessionInfo.UETimeZone.Value)
+	require.Equal(t, int64(1), cdrPduSessionInfo.NetworkSliceInstanceID.SST.Value)
+	require.Equal(t, asn.OctetString{0x01, 0x02, 0x03}, cdrPduSessionInfo.NetworkSliceInstanceID.SD.Value)
+	require.Equal(t, cdrType.PDUSessionTypePresentIPv4, cdrPduSessionInfo.PDUType.Value)
+	require.Equal(t, int64(1), cdrPduSessionInfo.SSCMode.Value)
+	require.Equal(t, asn.IA5String("internet"), cdrPduSessionInfo.DataNetworkNameIdentifier.Value)
+	require.Equal(t, asn.OctetString{10, 60, 0, 1}, cdrPduSessionInfo.PDUAddress.PDUIPv4Address.IPBinV4Address.Value)
+	require.Equal(t, cdrType.ThreeGPPPSDataOffStatusPresentActive, cdrPduSessionInfo.ThreeGPPPSDataOffStatus.Value)
+
+	record := cdrType.CHFRecord{
+		Present: 1,
+		ChargingFunctionRecord: &cdrType.ChargingRecord{
+			PDUSessionChargingInformation: cdrPduSessionInfo,
+		},
+	}
+	_, err := asn.BerMarshalWithParams(&record, "explicit,choice")
+	require.NoError(t, err)
+}
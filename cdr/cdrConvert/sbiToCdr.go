@@ -2,6 +2,7 @@ package cdrConvert
 
 import (
 	"encoding/hex"
+	"fmt"
 	"strings"
 	"time"
 
@@ -32,8 +33,8 @@ func MultiUnitUsageToCdr(multiUnitUsageList []models.MultipleUnitUsage) []cdrTyp
 	return cdrMultiUnitUsageList
 }
 
-// TODO: Only convert Local Sequence Number, Uplink, Downlink, Total Volumn,
-//       Service Specific Units currently.
+// TODO: Only convert Local Sequence Number, Triggers, Time, Uplink, Downlink, Total Volumn,
+// Service Specific Units, Event Time Stamps and PDU Container Information currently.
 func UsedUnitContainerToCdr(usedUnitContainerList []models.UsedUnitContainer) []cdrType.UsedUnitContainer {
 	cdrUsedUnitContainerList := make([]cdrType.UsedUnitContainer, 0, len(usedUnitContainerList))
 
@@ -54,19 +55,221 @@ func UsedUnitContainerToCdr(usedUnitContainerList []models.UsedUnitContainer) []
 			},
 			ServiceSpecificUnits: &serviceSpecificUnits,
 		}
+		if usedUnitContainer.Time != 0 {
+			cdrUsedUnitContainer.Time = &cdrType.CallDuration{
+				Value: int64(usedUnitContainer.Time),
+			}
+		}
+		if len(usedUnitContainer.Triggers) != 0 {
+			cdrUsedUnitContainer.Triggers = TriggersToCdr(usedUnitContainer.Triggers)
+		}
+		if usedUnitContainer.TriggerTimestamp != nil {
+			triggerTimeStamp := TimeStampToCdr(usedUnitContainer.TriggerTimestamp)
+			cdrUsedUnitContainer.TriggerTimeStamp = &triggerTimeStamp
+		}
+		// the first event time stamp is kept in eventTimeStamp, the others in eventTimeStampExt
+		for _, eventTimeStamp := range usedUnitContainer.EventTimeStamps {
+			if eventTimeStamp == nil {
+				continue
+			}
+			cdrEventTimeStamp := TimeStampToCdr(eventTimeStamp)
+			if cdrUsedUnitContainer.EventTimeStamp == nil {
+				cdrUsedUnitContainer.EventTimeStamp = &cdrEventTimeStamp
+			} else {
+				cdrUsedUnitContainer.EventTimeStampExt = append(cdrUsedUnitContainer.EventTimeStampExt, cdrEventTimeStamp)
+			}
+		}
+		if pduContainerInfo := usedUnitContainer.PDUContainerInformation; pduContainerInfo != nil {
+			cdrUsedUnitContainer.PDUContainerInformation = PduContainerInformationToCdr(pduContainerInfo)
+		}
 		cdrUsedUnitContainerList = append(cdrUsedUnitContainerList, cdrUsedUnitContainer)
 	}
 
 	return cdrUsedUnitContainerList
 }
 
-// TODO convert type Trigger
+func NfIdentificationToCdr(nfIdentification *models.NfIdentification) cdrType.NetworkFunctionInformation {
+	var nfInfo cdrType.NetworkFunctionInformation
+	if nfIdentification == nil {
+		return nfInfo
+	}
+
+	if name := nfIdentification.NFName; name != "" {
+		nfInfo.NetworkFunctionName = &cdrType.NetworkFunctionName{
+			Value: asn.IA5String(name),
+		}
+	}
+	if v4Addr := nfIdentification.NFIPv4Address; v4Addr != "" {
+		nfInfo.NetworkFunctionIPv4Address = &cdrType.IPAddress{
+			Present:         3,
+			IPTextV4Address: (*asn.IA5String)(&v4Addr),
+		}
+	}
+	if v6Addr := nfIdentification.NFIPv6Address; v6Addr != "" {
+		nfInfo.NetworkFunctionIPv6Address = &cdrType.IPAddress{
+			Present:         4,
+			IPTextV6Address: (*asn.IA5String)(&v6Addr),
+		}
+	}
+	if fqdn := nfIdentification.NFFqdn; fqdn != "" {
+		nfInfo.NetworkFunctionFQDN = &cdrType.NodeAddress{
+			Present:    2,
+			DomainName: (*asn.GraphicString)(&fqdn),
+		}
+	}
+	if plmnId := nfIdentification.NFPLMNID; plmnId != nil {
+		plmnIdByte := PlmnIdToCdr(*plmnId)
+		nfInfo.NetworkFunctionPLMNIdentifier = &cdrType.PLMNId{
+			Value: plmnIdByte.Value,
+		}
+	}
+	switch nfIdentification.NodeFunctionality {
+	case "SMF":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentSMF
+	case "AMF":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentAMF
+	case "SMSF":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentSMSF
+	case "PGW_C_SMF":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentPGWCSMF
+	case "NEF":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentNEF
+	case "SGW":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentSGW
+	case "I_SMF":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentISMF
+	case "ePDG":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentEPDG
+	case "CEF":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentCEF
+	case "MnS_Producer":
+		nfInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentMnSProducer
+	}
+
+	return nfInfo
+}
+
 func TriggersToCdr(triggers []models.Trigger) []cdrType.Trigger {
 	cdrTriggers := make([]cdrType.Trigger, 0, len(triggers))
 
+	for _, trigger := range triggers {
+		cdrTriggers = append(cdrTriggers, cdrType.Trigger{
+			Present:    cdrType.TriggerPresentSMFTrigger,
+			SMFTrigger: SmfTriggerToCdr(trigger),
+		})
+	}
+
 	return cdrTriggers
 }
 
+func SmfTriggerToCdr(trigger models.Trigger) *cdrType.SMFTrigger {
+	smfTrigger := &cdrType.SMFTrigger{}
+
+	if triggerType, ok := smfTriggerTypeToCdr[trigger.TriggerType]; ok {
+		smfTrigger.SMFTriggerType = &cdrType.SMFTriggerType{Value: triggerType}
+	}
+	switch trigger.TriggerCategory {
+	case models.TriggerCategory_IMMEDIATE_REPORT:
+		smfTrigger.SMFTriggerCategory = &cdrType.TriggerCategory{
+			Value: cdrType.TriggerCategoryPresentImmediateReport,
+		}
+	case models.TriggerCategory_DEFERRED_REPORT:
+		smfTrigger.SMFTriggerCategory = &cdrType.TriggerCategory{
+			Value: cdrType.TriggerCategoryPresentDeferredReport,
+		}
+	}
+
+	if trigger.TimeLimit != 0 {
+		smfTrigger.SMFTimeLimit = &cdrType.CallDuration{Value: int64(trigger.TimeLimit)}
+	}
+	// volumeLimit64 replaces volumeLimit for volumes above 32 bits
+	if trigger.VolumeLimit64 != 0 {
+		smfTrigger.SMFVolumeLimit = &cdrType.DataVolumeOctets{Value: int64(trigger.VolumeLimit64)}
+	} else if trigger.VolumeLimit != 0 {
+		smfTrigger.SMFVolumeLimit = &cdrType.DataVolumeOctets{Value: int64(trigger.VolumeLimit)}
+	}
+	if trigger.EventLimit != 0 {
+		eventLimit := int64(trigger.EventLimit)
+		smfTrigger.SMFEventLimit = &eventLimit
+	}
+	if trigger.MaxNumberOfccc != 0 {
+		maxNumberOfccc := int64(trigger.MaxNumberOfccc)
+		smfTrigger.SMFMaxNumberofccc = &maxNumberOfccc
+	}
+
+	return smfTrigger
+}
+
+var smfTriggerTypeToCdr = map[models.TriggerType]int64{
+	models.TriggerType_QUOTA_THRESHOLD:                                  cdrType.SMFTriggerTypePresentQuotaThreshold,
+	models.TriggerType_QHT:                                              cdrType.SMFTriggerTypePresentQHT,
+	models.TriggerType_FINAL:                                            cdrType.SMFTriggerTypePresentFinal,
+	models.TriggerType_QUOTA_EXHAUSTED:                                  cdrType.SMFTriggerTypePresentQuotaExhausted,
+	models.TriggerType_VALIDITY_TIME:                                    cdrType.SMFTriggerTypePresentValidityTime,
+	models.TriggerType_OTHER_QUOTA_TYPE:                                 cdrType.SMFTriggerTypePresentOtherQuotaType,
+	models.TriggerType_FORCED_REAUTHORISATION:                           cdrType.SMFTriggerTypePresentForcedReauthorisation,
+	models.TriggerType_UNUSED_QUOTA_TIMER:                               cdrType.SMFTriggerTypePresentUnusedQuotaTimer,
+	models.TriggerType_UNIT_COUNT_INACTIVITY_TIMER:                      cdrType.SMFTriggerTypePresentUnitCountInactivityTimer,
+	models.TriggerType_ABNORMAL_RELEASE:                                 cdrType.SMFTriggerTypePresentAbnormalRelease,
+	models.TriggerType_QOS_CHANGE:                                       cdrType.SMFTriggerTypePresentQoSChange,
+	models.TriggerType_VOLUME_LIMIT:                                     cdrType.SMFTriggerTypePresentVolumeLimit,
+	models.TriggerType_TIME_LIMIT:                                       cdrType.SMFTriggerTypePresentTimeLimit,
+	models.TriggerType_EVENT_LIMIT:                                      cdrType.SMFTriggerTypePresentEventLimit,
+	models.TriggerType_PLMN_CHANGE:                                      cdrType.SMFTriggerTypePresentPLMNChange,
+	models.TriggerType_USER_LOCATION_CHANGE:                             cdrType.SMFTriggerTypePresentUserLocationChange,
+	models.TriggerType_RAT_CHANGE:                                       cdrType.SMFTriggerTypePresentRATChange,
+	models.TriggerType_SESSION_AMBR_CHANGE:                              cdrType.SMFTriggerTypePresentSessionAMBRChange,
+	models.TriggerType_UE_TIMEZONE_CHANGE:                               cdrType.SMFTriggerTypePresentUETimezoneChange,
+	models.TriggerType_TARIFF_TIME_CHANGE:                               cdrType.SMFTriggerTypePresentTariffTimeChange,
+	models.TriggerType_MAX_NUMBER_OF_CHANGES_IN_CHARGING_CONDITIONS:     cdrType.SMFTriggerTypePresentMaxNumberOfChangesInChargingConditions,
+	models.TriggerType_MANAGEMENT_INTERVENTION:                          cdrType.SMFTriggerTypePresentManagementIntervention,
+	models.TriggerType_CHANGE_OF_UE_PRESENCE_IN_PRESENCE_REPORTING_AREA: cdrType.SMFTriggerTypePresentChangeOfUEPresenceInPresenceReportingArea,
+	models.TriggerType_CHANGE_OF_3_GPP_PS_DATA_OFF_STATUS:               cdrType.SMFTriggerTypePresentChangeOf3GPPPSDataOffStatus,
+	models.TriggerType_SERVING_NODE_CHANGE:                              cdrType.SMFTriggerTypePresentServingNodeChange,
+	models.TriggerType_REMOVAL_OF_UPF:                                   cdrType.SMFTriggerTypePresentRemovalOfUPF,
+	models.TriggerType_ADDITION_OF_UPF:                                  cdrType.SMFTriggerTypePresentAdditionOfUPF,
+	models.TriggerType_INSERTION_OF_ISMF:                                cdrType.SMFTriggerTypePresentInsertionOfISMF,
+	models.TriggerType_REMOVAL_OF_ISMF:                                  cdrType.SMFTriggerTypePresentRemovalOfISMF,
+	models.TriggerType_CHANGE_OF_ISMF:                                   cdrType.SMFTriggerTypePresentChangeOfISMF,
+	models.TriggerType_START_OF_SERVICE_DATA_FLOW:                       cdrType.SMFTriggerTypePresentStartOfServiceDataFlow,
+	models.TriggerType_ECGI_CHANGE:                                      cdrType.SMFTriggerTypePresentECGIChange,
+	models.TriggerType_TAI_CHANGE:                                       cdrType.SMFTriggerTypePresentTAIChange,
+	models.TriggerType_HANDOVER_CANCEL:                                  cdrType.SMFTriggerTypePresentHandoverCancel,
+	models.TriggerType_HANDOVER_START:                                   cdrType.SMFTriggerTypePresentHandoverStart,
+	models.TriggerType_HANDOVER_COMPLETE:                                cdrType.SMFTriggerTypePresentHandoverComplete,
+	models.TriggerType_GFBR_GUARANTEED_STATUS_CHANGE:                    cdrType.SMFTriggerTypePresentGFBRGuaranteedStatusChange,
+	models.TriggerType_ADDITION_OF_ACCESS:                               cdrType.SMFTriggerTypePresentAdditionOfAccess,
+	models.TriggerType_REMOVAL_OF_ACCESS:                                cdrType.SMFTriggerTypePresentRemovalOfAccess,
+	models.TriggerType_START_OF_SDF_ADDITIONAL_ACCESS:                   cdrType.SMFTriggerTypePresentStartOfSDFAdditionalAccess,
+}
+
+// TODO: Only convert usage time, user location, UE time zone and RAT type currently.
+func PduContainerInformationToCdr(pduContainerInfo *models.PduContainerInformation) *cdrType.PDUContainerInformation {
+	cdrPduContainerInfo := &cdrType.PDUContainerInformation{
+		UserLocationInformationASN1: UserLocationToCdr(pduContainerInfo.UserLocationInformation),
+		UETimeZone:                  TimeZoneToCdr(pduContainerInfo.UetimeZone),
+	}
+
+	if pduContainerInfo.TimeofFirstUsage != nil {
+		timeOfFirstUsage := TimeStampToCdr(pduContainerInfo.TimeofFirstUsage)
+		cdrPduContainerInfo.TimeOfFirstUsage = &timeOfFirstUsage
+	}
+	if pduContainerInfo.TimeofLastUsage != nil {
+		timeOfLastUsage := TimeStampToCdr(pduContainerInfo.TimeofLastUsage)
+		cdrPduContainerInfo.TimeOfLastUsage = &timeOfLastUsage
+	}
+	if ratType, ok := RatTypeToCdr(pduContainerInfo.RATType); ok {
+		cdrPduContainerInfo.RATType = &ratType
+	}
+	if pduContainerInfo.ChargingRuleBaseName != "" {
+		cdrPduContainerInfo.ChargingRuleBaseName = &cdrType.ChargingRuleBaseName{
+			Value: asn.IA5String(pduContainerInfo.ChargingRuleBaseName),
+		}
+	}
+
+	return cdrPduContainerInfo
+}
+
 // format: YYMMDDhhmmssShhmm
 // BCD encoded
 func TimeStampToCdr(t *time.Time) cdrType.TimeStamp {
@@ -79,13 +282,16 @@ func TimeStampToCdr(t *time.Time) cdrType.TimeStamp {
 	ts[3] = (byte(t.Hour()/10) << 4) | (byte(t.Hour() % 10))
 	ts[4] = (byte(t.Minute()/10) << 4) | (byte(t.Minute() % 10))
 	ts[5] = (byte(t.Second()/10) << 4) | (byte(t.Second() % 10))
+	// The deviation from UTC is the sign, then the hours and the minutes of its magnitude
 	if tz >= 0 {
 		ts[6] = byte('+')
 	} else {
 		ts[6] = byte('-')
+		tz = -tz
 	}
-	ts[7] = (byte(tz/3600/10) << 4) | (byte(tz / 3600 % 10))
-	ts[8] = (byte(tz%3600/10) << 4) | (byte(tz % 3600 % 10))
+	hours, minutes := tz/3600, tz%3600/60
+	ts[7] = (byte(hours/10) << 4) | (byte(hours % 10))
+	ts[8] = (byte(minutes/10) << 4) | (byte(minutes % 10))
 	cdrTimeStamp := cdrType.TimeStamp{
 		Value: ts,
 	}
@@ -93,6 +299,25 @@ func TimeStampToCdr(t *time.Time) cdrType.TimeStamp {
 	return cdrTimeStamp
 }
 
+// TimeStampFromCdr decodes the TimeStamp of TimeStampToCdr back into time
+func TimeStampFromCdr(cdrTimeStamp cdrType.TimeStamp) (time.Time, error) {
+	ts := cdrTimeStamp.Value
+	if len(ts) != 9 || (ts[6] != '+' && ts[6] != '-') {
+		return time.Time{}, fmt.Errorf("invalid CDR time stamp: %x", []byte(ts))
+	}
+
+	bcd := func(b byte) int {
+		return int(b>>4)*10 + int(b&0x0f)
+	}
+	offset := bcd(ts[7])*3600 + bcd(ts[8])*60
+	if ts[6] == '-' {
+		offset = -offset
+	}
+
+	return time.Date(2000+bcd(ts[0]), time.Month(bcd(ts[1])), bcd(ts[2]),
+		bcd(ts[3]), bcd(ts[4]), bcd(ts[5]), 0, time.FixedZone("", offset)), nil
+}
+
 func PlmnIdToCdr(modelsPlmnid models.PlmnId) cdrType.PLMNId {
 	var hexString string
 	mcc := strings.Split(modelsPlmnid.Mcc, "")
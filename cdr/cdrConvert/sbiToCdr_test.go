@@ -0,0 +1,84 @@
+package cdrConvert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestUsedUnitContainerTriggersToCdr(t *testing.T) {
+	triggerTime := time.Date(2023, 5, 4, 10, 20, 30, 0, time.UTC)
+
+	containers := UsedUnitContainerToCdr([]models.UsedUnitContainer{
+		{
+			LocalSequenceNumber: 1,
+			TotalVolume:         1000,
+			Triggers: []models.Trigger{
+				{
+					TriggerType:     models.TriggerType_VOLUME_LIMIT,
+					TriggerCategory: models.TriggerCategory_IMMEDIATE_REPORT,
+					VolumeLimit:     1000,
+				},
+				{
+					TriggerType:     models.TriggerType_MAX_NUMBER_OF_CHANGES_IN_CHARGING_CONDITIONS,
+					TriggerCategory: models.TriggerCategory_DEFERRED_REPORT,
+					MaxNumberOfccc:  5,
+				},
+			},
+			TriggerTimestamp: &triggerTime,
+		},
+	})
+	require.Len(t, containers, 1)
+	require.Len(t, containers[0].Triggers, 2)
+	require.Equal(t, TimeStampToCdr(&triggerTime), *containers[0].TriggerTimeStamp)
+
+	volumeTrigger := containers[0].Triggers[0].SMFTrigger
+	require.Equal(t, cdrType.SMFTriggerTypePresentVolumeLimit, volumeTrigger.SMFTriggerType.Value)
+	require.Equal(t, cdrType.TriggerCategoryPresentImmediateReport, volumeTrigger.SMFTriggerCategory.Value)
+	require.Equal(t, int64(1000), volumeTrigger.SMFVolumeLimit.Value)
+
+	changesTrigger := containers[0].Triggers[1].SMFTrigger
+	require.Equal(t, cdrType.TriggerCategoryPresentDeferredReport, changesTrigger.SMFTriggerCategory.Value)
+	require.Equal(t, int64(5), *changesTrigger.SMFMaxNumberofccc)
+
+	record := cdrType.CHFRecord{
+		Present: 1,
+		ChargingFunctionRecord: &cdrType.ChargingRecord{
+			Triggers: containers[0].Triggers,
+			ListOfMultipleUnitUsage: []cdrType.MultipleUnitUsage{
+				{UsedUnitContainers: containers},
+			},
+		},
+	}
+	_, err := asn.BerMarshalWithParams(&record, "explicit,choice")
+	require.NoError(t, err)
+}
+
+func TestTimeStampFromCdr(t *testing.T) {
+	localTime := time.Date(2023, 5, 4, 10, 20, 30, 0, time.FixedZone("", 8*3600))
+
+	decoded, err := TimeStampFromCdr(TimeStampToCdr(&localTime))
+	require.NoError(t, err)
+	require.True(t, localTime.Equal(decoded))
+
+	// The deviation is encoded as hours and minutes with its sign
+	for _, offset := range []int{-5 * 3600, 5*3600 + 30*60} {
+		localTime = time.Date(2023, 5, 4, 10, 20, 30, 0, time.FixedZone("", offset))
+		timeStamp := TimeStampToCdr(&localTime)
+		decoded, err = TimeStampFromCdr(timeStamp)
+		require.NoError(t, err)
+		require.True(t, localTime.Equal(decoded))
+		_, decodedOffset := decoded.Zone()
+		require.Equal(t, offset, decodedOffset)
+	}
+	localTime = time.Date(2023, 5, 4, 10, 20, 30, 0, time.FixedZone("", -5*3600))
+	require.Equal(t, asn.OctetString{'-', 0x05, 0x00}, TimeStampToCdr(&localTime).Value[6:])
+
+	_, err = TimeStampFromCdr(cdrType.TimeStamp{Value: asn.OctetString{0x23}})
+	require.Error(t, err)
+}
@@ -0,0 +1,363 @@
+package cdrConvert
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/openapi/models"
+)
+
+func SmsChargingInformationToCdr(smsInfo *models.SmsChargingInformation, eventTime *time.Time) *cdrType.SMSChargingInformation {
+	if eventTime == nil {
+		now := time.Now()
+		eventTime = &now
+	}
+
+	cdrSmsInfo := &cdrType.SMSChargingInformation{
+		Eventtimestamp: TimeStampToCdr(eventTime),
+	}
+
+	if originator := smsInfo.OriginatorInfo; originator != nil {
+		cdrSmsInfo.OriginatorInfo = &cdrType.OriginatorInfo{
+			OriginatorIMSI:            imsiToCdr(originator.OriginatorSUPI),
+			OriginatorMSISDN:          msisdnToCdr(originator.OriginatorGPSI),
+			OriginatorOtherAddress:    smAddressInfoToCdr(originator.OriginatorOtherAddress),
+			OriginatorSCCPAddress:     addressStringToCdr(originator.OriginatorSCCPAddress),
+			OriginatorReceivedAddress: smAddressInfoToCdr(originator.OriginatorReceivedAddress),
+			SMOriginatorInterface:     smInterfaceToCdr(originator.SMOriginatorInterface),
+			SMOriginatorProtocolID:    hexStringToCdr(originator.SMOriginatorProtocolId),
+		}
+	}
+
+	for _, recipient := range smsInfo.RecipientInfo {
+		cdrSmsInfo.RecipientInfos = append(cdrSmsInfo.RecipientInfos, cdrType.RecipientInfo{
+			RecipientIMSI:            imsiToCdr(recipient.RecipientSUPI),
+			RecipientMSISDN:          msisdnToCdr(recipient.RecipientGPSI),
+			RecipientOtherAddress:    smAddressInfoToCdr(recipient.RecipientOtherAddress),
+			RecipientSCCPAddress:     addressStringToCdr(recipient.RecipientSCCPAddress),
+			RecipientReceivedAddress: smAddressInfoToCdr(recipient.RecipientReceivedAddress),
+			SMDestinationInterface:   smInterfaceToCdr(recipient.SMDestinationInterface),
+			SMRecipientProtocolID:    hexStringToCdr(recipient.SMrecipientProtocolId),
+		})
+	}
+
+	cdrSmsInfo.UserEquipmentInfo = PeiToCdr(smsInfo.UserEquipmentInfo)
+	cdrSmsInfo.UserLocationInformationASN1 = UserLocationToCdr(smsInfo.UserLocationinfo)
+	cdrSmsInfo.UETimeZone = TimeZoneToCdr(smsInfo.UetimeZone)
+
+	switch smsInfo.RoamerInOut {
+	case models.RoamerInOut_IN_BOUND:
+		cdrSmsInfo.UserRoamerInOut = &cdrType.RoamerInOut{Value: cdrType.RoamerInOutPresentRoamerInBound}
+	case models.RoamerInOut_OUT_BOUND:
+		cdrSmsInfo.UserRoamerInOut = &cdrType.RoamerInOut{Value: cdrType.RoamerInOutPresentRoamerOutBound}
+	}
+
+	if ratType, ok := RatTypeToCdr(smsInfo.RATType); ok {
+		cdrSmsInfo.RATType = &ratType
+	}
+
+	cdrSmsInfo.SMSCAddress = addressStringToCdr(smsInfo.SMSCAddress)
+
+	if smsInfo.SMDataCodingScheme != 0 {
+		dataCodingScheme := int64(smsInfo.SMDataCodingScheme)
+		cdrSmsInfo.SMDataCodingScheme = &dataCodingScheme
+	}
+
+	switch smsInfo.SMMessageType {
+	case models.SmMessageType_SUBMISSION:
+		cdrSmsInfo.SMMessageType = &cdrType.SMMessageType{Value: cdrType.SMMessageTypePresentSubmission}
+	case models.SmMessageType_DELIVERY_REPORT:
+		cdrSmsInfo.SMMessageType = &cdrType.SMMessageType{Value: cdrType.SMMessageTypePresentDeliveryReport}
+	case models.SmMessageType_SM_SERVICE_REQUEST:
+		cdrSmsInfo.SMMessageType = &cdrType.SMMessageType{Value: cdrType.SMMessageTypePresentSMServiceRequest}
+	case models.SmMessageType_DELIVERY:
+		cdrSmsInfo.SMMessageType = &cdrType.SMMessageType{Value: cdrType.SMMessageTypePresentDelivery}
+	}
+
+	switch smsInfo.SMReplyPathRequested {
+	case models.ReplyPathRequested_NO_REPLY_PATH_SET:
+		cdrSmsInfo.SMReplyPathRequested = &cdrType.SMReplyPathRequested{
+			Value: cdrType.SMReplyPathRequestedPresentNoReplyPathSet,
+		}
+	case models.ReplyPathRequested_REPLY_PATH_SET:
+		cdrSmsInfo.SMReplyPathRequested = &cdrType.SMReplyPathRequested{
+			Value: cdrType.SMReplyPathRequestedPresentReplyPathSet,
+		}
+	}
+
+	cdrSmsInfo.SMUserDataHeader = hexStringToCdr(smsInfo.SMUserDataHeader)
+	if status := hexStringToCdr(smsInfo.SMStatus); status != nil {
+		cdrSmsInfo.SMSStatus = &cdrType.SMSStatus{Value: *status}
+	}
+
+	if smsInfo.SMDischargeTime != nil {
+		dischargeTime := TimeStampToCdr(smsInfo.SMDischargeTime)
+		cdrSmsInfo.SMDischargeTime = &dischargeTime
+	}
+
+	if smsInfo.NumberofMessagesSent != 0 {
+		totalNumber := int64(smsInfo.NumberofMessagesSent)
+		cdrSmsInfo.SMTotalNumber = &totalNumber
+	}
+
+	if serviceType, ok := smServiceTypeToCdr[smsInfo.SMServiceType]; ok {
+		cdrSmsInfo.SMServiceType = &cdrType.SMServiceType{Value: serviceType}
+	}
+
+	if smsInfo.SMSequenceNumber != 0 {
+		sequenceNumber := int64(smsInfo.SMSequenceNumber)
+		cdrSmsInfo.SMSequenceNumber = &sequenceNumber
+	}
+
+	if smsInfo.SMSresult != 0 {
+		result := int64(smsInfo.SMSresult)
+		cdrSmsInfo.SMSResult = &cdrType.SMSResult{
+			Value: cdrType.Diagnostics{
+				Present:                                 cdrType.DiagnosticsPresentDiameterResultCodeAndExperimentalResult,
+				DiameterResultCodeAndExperimentalResult: &result,
+			},
+		}
+	}
+
+	if smsInfo.SubmissionTime != nil {
+		submissionTime := TimeStampToCdr(smsInfo.SubmissionTime)
+		cdrSmsInfo.SubmissionTime = &submissionTime
+	}
+
+	switch smsInfo.SMPriority {
+	case models.SmPriority_LOW:
+		cdrSmsInfo.SMPriority = &cdrType.PriorityType{Value: cdrType.PriorityTypePresentLow}
+	case models.SmPriority_NORMAL:
+		cdrSmsInfo.SMPriority = &cdrType.PriorityType{Value: cdrType.PriorityTypePresentNormal}
+	case models.SmPriority_HIGH:
+		cdrSmsInfo.SMPriority = &cdrType.PriorityType{Value: cdrType.PriorityTypePresentHigh}
+	}
+
+	if reference := hexStringToCdr(smsInfo.MessageReference); reference != nil {
+		cdrSmsInfo.MessageReference = &cdrType.MessageReference{Value: *reference}
+	}
+
+	if smsInfo.MessageSize != 0 {
+		messageSize := int64(smsInfo.MessageSize)
+		cdrSmsInfo.MessageSize = &messageSize
+	}
+
+	if messageClass := smsInfo.MessageClass; messageClass != nil {
+		switch messageClass.ClassIdentifier {
+		case models.ClassIdentifier_PERSONAL:
+			cdrSmsInfo.MessageClass = &cdrType.MessageClass{Value: cdrType.MessageClassPresentPersonal}
+		case models.ClassIdentifier_ADVERTISEMENT:
+			cdrSmsInfo.MessageClass = &cdrType.MessageClass{Value: cdrType.MessageClassPresentAdvertisement}
+		case models.ClassIdentifier_INFORMATIONAL:
+			cdrSmsInfo.MessageClass = &cdrType.MessageClass{Value: cdrType.MessageClassPresentInformationService}
+		case models.ClassIdentifier_AUTO:
+			cdrSmsInfo.MessageClass = &cdrType.MessageClass{Value: cdrType.MessageClassPresentAuto}
+		}
+		if messageClass.TokenText != "" {
+			tokenText := asn.UTF8String(messageClass.TokenText)
+			cdrSmsInfo.MessageClassTokenText = &tokenText
+		}
+	}
+
+	switch smsInfo.DeliveryReportRequested {
+	case models.DeliveryReportRequested_TRUE:
+		cdrSmsInfo.SMdeliveryReportRequested = &cdrType.SMdeliveryReportRequested{
+			Value: cdrType.SMdeliveryReportRequestedPresentYes,
+		}
+	case models.DeliveryReportRequested_FALSE:
+		cdrSmsInfo.SMdeliveryReportRequested = &cdrType.SMdeliveryReportRequested{
+			Value: cdrType.SMdeliveryReportRequestedPresentNo,
+		}
+	}
+
+	return cdrSmsInfo
+}
+
+// 32.298 SMServiceType: VAS4SMS service types
+var smServiceTypeToCdr = map[models.SmServiceType]int64{
+	models.SmServiceType_CONTENT_PROCESSING:                0,
+	models.SmServiceType_FORWARDING:                        1,
+	models.SmServiceType_FORWARDING_MULTIPLE_SUBSCRIPTIONS: 2,
+	models.SmServiceType_FILTERING:                         3,
+	models.SmServiceType_RECEIPT:                           4,
+	models.SmServiceType_NETWORK_STORAGE:                   5,
+	models.SmServiceType_TO_MULTIPLE_DESTINATIONS:          6,
+	models.SmServiceType_VIRTUAL_PRIVATE_NETWORK_VPN:       7,
+	models.SmServiceType_AUTO_REPLY:                        8,
+	models.SmServiceType_PERSONAL_SIGNATURE:                9,
+	models.SmServiceType_DEFERRED_DELIVERY:                 10,
+}
+
+// 29.274 8.17 RAT Type values
+func RatTypeToCdr(ratType models.RatType) (cdrType.RATType, bool) {
+	switch ratType {
+	case models.RatType_UTRA:
+		return cdrType.RATType{Value: 1}, true
+	case models.RatType_GERA:
+		return cdrType.RATType{Value: 2}, true
+	case models.RatType_WLAN:
+		return cdrType.RATType{Value: 3}, true
+	case models.RatType_EUTRA:
+		return cdrType.RATType{Value: 6}, true
+	case models.RatType_VIRTUAL:
+		return cdrType.RATType{Value: 7}, true
+	case models.RatType_NBIOT:
+		return cdrType.RATType{Value: 8}, true
+	case models.RatType_LTE_M:
+		return cdrType.RATType{Value: 9}, true
+	case models.RatType_NR:
+		return cdrType.RATType{Value: 10}, true
+	}
+	return cdrType.RATType{}, false
+}
+
+func smAddressInfoToCdr(addressInfo *models.SmAddressInfo) *cdrType.SMAddressInfo {
+	if addressInfo == nil {
+		return nil
+	}
+
+	cdrAddressInfo := &cdrType.SMAddressInfo{}
+	if addressType, ok := smAddressTypeToCdr[addressInfo.SMaddressType]; ok {
+		cdrAddressInfo.SMAddressType = &cdrType.SMAddressType{Value: addressType}
+	}
+	if addressInfo.SMaddressData != "" {
+		addressData := asn.GraphicString(addressInfo.SMaddressData)
+		cdrAddressInfo.SMAddressData = &addressData
+	}
+	if domain := addressInfo.SMaddressDomain; domain != nil {
+		cdrAddressInfo.SMAddressDomain = &cdrType.SMAddressDomain{}
+		if domain.DomainName != "" {
+			domainName := asn.GraphicString(domain.DomainName)
+			cdrAddressInfo.SMAddressDomain.SMDomainName = &domainName
+		}
+		// MCC and MNC of the IMSI, e.g. 20893
+		if mccMnc := domain.Var3GPPIMSIMCCMNC; len(mccMnc) == 5 || len(mccMnc) == 6 {
+			plmnId := PlmnIdToCdr(models.PlmnId{Mcc: mccMnc[:3], Mnc: mccMnc[3:]})
+			cdrAddressInfo.SMAddressDomain.ThreeGPPIMSIMCCMNC = &plmnId
+		}
+	}
+
+	return cdrAddressInfo
+}
+
+var smAddressTypeToCdr = map[models.SmAddressType]asn.Enumerated{
+	models.SmAddressType_EMAIL_ADDRESS:          cdrType.SMAddressTypePresentEmailAddress,
+	models.SmAddressType_MSISDN:                 cdrType.SMAddressTypePresentMSISDN,
+	models.SmAddressType_IPV4_ADDRESS:           cdrType.SMAddressTypePresentIPv4Address,
+	models.SmAddressType_IPV6_ADDRESS:           cdrType.SMAddressTypePresentIPv6Address,
+	models.SmAddressType_NUMERIC_SHORTCODE:      cdrType.SMAddressTypePresentNumericShortCode,
+	models.SmAddressType_ALPHANUMERIC_SHORTCODE: cdrType.SMAddressTypePresentAlphanumericShortCode,
+	models.SmAddressType_OTHER:                  cdrType.SMAddressTypePresentOther,
+	models.SmAddressType_IMSI:                   cdrType.SMAddressTypePresentIMSI,
+}
+
+func smInterfaceToCdr(smInterface *models.SmInterface) *cdrType.SMInterface {
+	if smInterface == nil {
+		return nil
+	}
+
+	cdrInterface := &cdrType.SMInterface{}
+	if smInterface.InterfaceId != "" {
+		interfaceId := asn.GraphicString(smInterface.InterfaceId)
+		cdrInterface.InterfaceId = &interfaceId
+	}
+	if smInterface.InterfaceText != "" {
+		interfaceText := asn.GraphicString(smInterface.InterfaceText)
+		cdrInterface.InterfaceText = &interfaceText
+	}
+	if smInterface.InterfacePort != "" {
+		interfacePort := asn.GraphicString(smInterface.InterfacePort)
+		cdrInterface.InterfacePort = &interfacePort
+	}
+	switch smInterface.InterfaceType {
+	case models.InterfaceType_UNKNOWN:
+		cdrInterface.InterfaceType = &cdrType.SMInterfaceType{Value: cdrType.SMInterfaceTypePresentUnkown}
+	case models.InterfaceType_MOBILE_ORIGINATING:
+		cdrInterface.InterfaceType = &cdrType.SMInterfaceType{Value: cdrType.SMInterfaceTypePresentMobileOriginating}
+	case models.InterfaceType_MOBILE_TERMINATING:
+		cdrInterface.InterfaceType = &cdrType.SMInterfaceType{Value: cdrType.SMInterfaceTypePresentMobileTerminating}
+	case models.InterfaceType_APPLICATION_ORIGINATING:
+		cdrInterface.InterfaceType = &cdrType.SMInterfaceType{
+			Value: cdrType.SMInterfaceTypePresentApplicationOriginating,
+		}
+	case models.InterfaceType_APPLICATION_TERMINATING:
+		cdrInterface.InterfaceType = &cdrType.SMInterfaceType{
+			Value: cdrType.SMInterfaceTypePresentApplicationTerminating,
+		}
+	}
+
+	return cdrInterface
+}
+
+// SUPI: imsi-<digits>
+func imsiToCdr(supi string) *cdrType.IMSI {
+	if !strings.HasPrefix(supi, "imsi-") {
+		return nil
+	}
+	return &cdrType.IMSI{
+		Value: cdrType.TBCDSTRING{Value: tbcdToCdr(strings.TrimPrefix(supi, "imsi-"))},
+	}
+}
+
+// GPSI: msisdn-<digits>
+func msisdnToCdr(gpsi string) *cdrType.MSISDN {
+	if !strings.HasPrefix(gpsi, "msisdn-") {
+		return nil
+	}
+	address := addressStringToCdr(strings.TrimPrefix(gpsi, "msisdn-"))
+	return &cdrType.MSISDN{
+		Value: cdrType.ISDNAddressString{Value: *address},
+	}
+}
+
+// 29.002 17.7.8 AddressString: international number of ISDN/telephony numbering plan, followed by TBCD digits
+func addressStringToCdr(number string) *cdrType.AddressString {
+	if number == "" {
+		return nil
+	}
+	number = strings.TrimPrefix(number, "+")
+	return &cdrType.AddressString{
+		Value: append(asn.OctetString{0x91}, tbcdToCdr(number)...),
+	}
+}
+
+// 29.002 17.7.8 TBCD-STRING: two digits per octet, the first digit in the lower nibble, filled with 'f'
+func tbcdToCdr(digits string) asn.OctetString {
+	if len(digits)%2 == 1 {
+		digits += "f"
+	}
+
+	tbcd := make(asn.OctetString, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		tbcd = append(tbcd, hexDigit(digits[i+1])<<4|hexDigit(digits[i]))
+	}
+	return tbcd
+}
+
+func hexDigit(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0xf
+}
+
+// Octets carried as a hex string in SBI
+func hexStringToCdr(s string) *asn.OctetString {
+	if s == "" {
+		return nil
+	}
+	octets, err := hex.DecodeString(s)
+	if err != nil {
+		octets = []byte(s)
+	}
+	octetString := asn.OctetString(octets)
+	return &octetString
+}
@@ -0,0 +1,50 @@
+package cdrConvert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestSmsChargingInformationToCdr(t *testing.T) {
+	eventTime := time.Date(2023, 5, 4, 10, 20, 30, 0, time.UTC)
+
+	cdrSmsInfo := SmsChargingInformationToCdr(&models.SmsChargingInformation{
+		OriginatorInfo: &models.OriginatorInfo{
+			OriginatorSUPI: "imsi-208930000000001",
+			OriginatorGPSI: "msisdn-886912345678",
+		},
+		RecipientInfo: []models.RecipientInfo{
+			{RecipientGPSI: "msisdn-886987654321"},
+		},
+		SMMessageType: models.SmMessageType_SUBMISSION,
+		SMPriority:    models.SmPriority_HIGH,
+		RATType:       models.RatType_NR,
+		MessageSize:   140,
+	}, &eventTime)
+
+	require.Equal(t, asn.OctetString{0x02, 0x98, 0x03, 0x00, 0x00, 0x00, 0x00, 0xf1},
+		cdrSmsInfo.OriginatorInfo.OriginatorIMSI.Value.Value)
+	require.Equal(t, asn.OctetString{0x91, 0x88, 0x96, 0x21, 0x43, 0x65, 0x87},
+		cdrSmsInfo.OriginatorInfo.OriginatorMSISDN.Value.Value.Value)
+	require.Len(t, cdrSmsInfo.RecipientInfos, 1)
+	require.Equal(t, cdrType.SMMessageTypePresentSubmission, cdrSmsInfo.SMMessageType.Value)
+	require.Equal(t, cdrType.PriorityTypePresentHigh, cdrSmsInfo.SMPriority.Value)
+	require.Equal(t, int64(10), cdrSmsInfo.RATType.Value)
+	require.Equal(t, int64(140), *cdrSmsInfo.MessageSize)
+	require.Equal(t, TimeStampToCdr(&eventTime), cdrSmsInfo.Eventtimestamp)
+
+	record := cdrType.CHFRecord{
+		Present: 1,
+		ChargingFunctionRecord: &cdrType.ChargingRecord{
+			SMSChargingInformation: cdrSmsInfo,
+		},
+	}
+	_, err := asn.BerMarshalWithParams(&record, "explicit,choice")
+	require.NoError(t, err)
+}
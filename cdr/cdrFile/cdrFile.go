@@ -346,6 +346,14 @@ func (header CdrHeader) Encoding() []byte{
 }
 
 func (cdfFile CDRFile) Encoding(fileName string) {
+	err := ioutil.WriteFile(fileName, cdfFile.Marshal(), 0666)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Marshal encodes the CDR file header and the CDRs into bytes
+func (cdfFile CDRFile) Marshal() []byte {
 	buf := new(bytes.Buffer)
 
 	// Cdr File Header
@@ -377,10 +385,7 @@ func (cdfFile CDRFile) Encoding(fileName string) {
 	}
 
 	// fmt.Printf("Encoded: %b\n", buf.Bytes())
-	err := ioutil.WriteFile(fileName, buf.Bytes(), 0666) 
-	if err != nil {
-		panic(err)
-	}
+	return buf.Bytes()
 }
 
 func (cdfFile *CDRFile) Decoding(fileName string) {
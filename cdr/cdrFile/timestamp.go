@@ -0,0 +1,26 @@
+package cdrFile
+
+import "time"
+
+// NewCdrHdrTimeStamp converts t to the local time stamp with UTC deviation used in the CDR file header,
+// refer to TS 32.297 6.1.1.1
+func NewCdrHdrTimeStamp(t time.Time) CdrHdrTimeStamp {
+	_, offset := t.Zone()
+
+	var sign uint8
+	if offset >= 0 {
+		sign = 1
+	} else {
+		offset = -offset
+	}
+
+	return CdrHdrTimeStamp{
+		MonthLocal:                            uint8(t.Month()),
+		DateLocal:                             uint8(t.Day()),
+		HourLocal:                             uint8(t.Hour()),
+		MinuteLocal:                           uint8(t.Minute()),
+		SignOfTheLocalTimeDifferentialFromUtc: sign,
+		HourDeviation:                         uint8(offset / 3600),
+		MinuteDeviation:                       uint8(offset / 60 % 60),
+	}
+}
@@ -2,7 +2,20 @@ package cdrType
 
 // Need to import "gofree5gc/lib/aper" if it uses "aper"
 
+const ( /* Integer Type */
+	CauseForRecClosingPresentNormalRelease          int64 = 0
+	CauseForRecClosingPresentPartialRecord          int64 = 1
+	CauseForRecClosingPresentAbnormalRelease        int64 = 4
+	CauseForRecClosingPresentVolumeLimit            int64 = 16
+	CauseForRecClosingPresentTimeLimit              int64 = 17
+	CauseForRecClosingPresentServingNodeChange      int64 = 18
+	CauseForRecClosingPresentMaxChangeCond          int64 = 19
+	CauseForRecClosingPresentManagementIntervention int64 = 20
+	CauseForRecClosingPresentRATChange              int64 = 22
+	CauseForRecClosingPresentMSTimeZoneChange       int64 = 23
+	CauseForRecClosingPresentSGSNPLMNIDChange       int64 = 24
+)
+
 type CauseForRecClosing struct {
 	Value	int64 
 }
-
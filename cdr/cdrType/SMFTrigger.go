@@ -2,7 +2,11 @@ package cdrType
 
 // Need to import "gofree5gc/lib/aper" if it uses "aper"
 
-type SMFTrigger struct {
-	Value	int64 
+type SMFTrigger struct {	/* Sequence Type */
+	SMFTriggerType	*SMFTriggerType `ber:"tagNum:0,optional"`
+	SMFTriggerCategory	*TriggerCategory `ber:"tagNum:1,optional"`
+	SMFTimeLimit	*CallDuration `ber:"tagNum:2,optional"`
+	SMFVolumeLimit	*DataVolumeOctets `ber:"tagNum:3,optional"`
+	SMFEventLimit	*int64 `ber:"tagNum:4,optional"`
+	SMFMaxNumberofccc	*int64 `ber:"tagNum:5,optional"`
 }
-
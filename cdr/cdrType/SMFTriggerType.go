@@ -0,0 +1,51 @@
+package cdrType
+
+// Need to import "gofree5gc/lib/aper" if it uses "aper"
+
+// Values follow the order of the TriggerType enumeration of 32.291 6.1.6.3.3
+const ( /* Integer Type */
+	SMFTriggerTypePresentQuotaThreshold                            int64 = 1
+	SMFTriggerTypePresentQHT                                       int64 = 2
+	SMFTriggerTypePresentFinal                                     int64 = 3
+	SMFTriggerTypePresentQuotaExhausted                            int64 = 4
+	SMFTriggerTypePresentValidityTime                              int64 = 5
+	SMFTriggerTypePresentOtherQuotaType                            int64 = 6
+	SMFTriggerTypePresentForcedReauthorisation                     int64 = 7
+	SMFTriggerTypePresentUnusedQuotaTimer                          int64 = 8
+	SMFTriggerTypePresentUnitCountInactivityTimer                  int64 = 9
+	SMFTriggerTypePresentAbnormalRelease                           int64 = 10
+	SMFTriggerTypePresentQoSChange                                 int64 = 11
+	SMFTriggerTypePresentVolumeLimit                               int64 = 12
+	SMFTriggerTypePresentTimeLimit                                 int64 = 13
+	SMFTriggerTypePresentEventLimit                                int64 = 14
+	SMFTriggerTypePresentPLMNChange                                int64 = 15
+	SMFTriggerTypePresentUserLocationChange                        int64 = 16
+	SMFTriggerTypePresentRATChange                                 int64 = 17
+	SMFTriggerTypePresentSessionAMBRChange                         int64 = 18
+	SMFTriggerTypePresentUETimezoneChange                          int64 = 19
+	SMFTriggerTypePresentTariffTimeChange                          int64 = 20
+	SMFTriggerTypePresentMaxNumberOfChangesInChargingConditions    int64 = 21
+	SMFTriggerTypePresentManagementIntervention                    int64 = 22
+	SMFTriggerTypePresentChangeOfUEPresenceInPresenceReportingArea int64 = 23
+	SMFTriggerTypePresentChangeOf3GPPPSDataOffStatus               int64 = 24
+	SMFTriggerTypePresentServingNodeChange                         int64 = 25
+	SMFTriggerTypePresentRemovalOfUPF                              int64 = 26
+	SMFTriggerTypePresentAdditionOfUPF                             int64 = 27
+	SMFTriggerTypePresentInsertionOfISMF                           int64 = 28
+	SMFTriggerTypePresentRemovalOfISMF                             int64 = 29
+	SMFTriggerTypePresentChangeOfISMF                              int64 = 30
+	SMFTriggerTypePresentStartOfServiceDataFlow                    int64 = 31
+	SMFTriggerTypePresentECGIChange                                int64 = 32
+	SMFTriggerTypePresentTAIChange                                 int64 = 33
+	SMFTriggerTypePresentHandoverCancel                            int64 = 34
+	SMFTriggerTypePresentHandoverStart                             int64 = 35
+	SMFTriggerTypePresentHandoverComplete                          int64 = 36
+	SMFTriggerTypePresentGFBRGuaranteedStatusChange                int64 = 37
+	SMFTriggerTypePresentAdditionOfAccess                          int64 = 38
+	SMFTriggerTypePresentRemovalOfAccess                           int64 = 39
+	SMFTriggerTypePresentStartOfSDFAdditionalAccess                int64 = 40
+)
+
+type SMFTriggerType struct {
+	Value int64
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/urfave/cli"
+
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/internal/util"
+	"github.com/free5gc/chf/pkg/rf"
+	"github.com/free5gc/chf/pkg/service"
+	"github.com/free5gc/util/version"
+)
+
+var RF = &service.Server{
+	Name:              "RF",
+	DefaultConfigPath: util.RfDefaultConfigPath,
+	Open:              rf.OpenServer,
+}
+
+func main() {
+	defer func() {
+		if p := recover(); p != nil {
+			// Print stack for panic to log. Fatalf() will let program exit.
+			logger.AppLog.Fatalf("panic: %v\n%s", p, string(debug.Stack()))
+		}
+	}()
+
+	app := cli.NewApp()
+	app.Name = "rf"
+	app.Usage = "5G CHF Rating Function (RF)"
+	app.Action = action
+	app.Flags = RF.GetCliCmd()
+	if err := app.Run(os.Args); err != nil {
+		fmt.Printf("RF Run Error: %v\n", err)
+	}
+}
+
+func action(c *cli.Context) error {
+	if err := RF.Initialize(c); err != nil {
+		switch err1 := err.(type) {
+		case govalidator.Errors:
+			errs := err1.Errors()
+			for _, e := range errs {
+				logger.CfgLog.Errorf("%+v", e)
+			}
+		default:
+			logger.CfgLog.Errorf("%+v", err)
+		}
+
+		logger.CfgLog.Errorf("[-- PLEASE REFER TO SAMPLE CONFIG FILE COMMENTS --]")
+		return fmt.Errorf("Failed to initialize !!")
+	}
+	logger.AppLog.Infoln(c.App.Name)
+	logger.AppLog.Infoln("RF version: ", version.GetVersion())
+
+	return RF.Start()
+}
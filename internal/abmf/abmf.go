@@ -2,11 +2,6 @@ package abmf
 
 import (
 	"fmt"
-	"strconv"
-	"time"
-
-	chf_context "github.com/free5gc/chf/internal/context"
-	"github.com/free5gc/chf/pkg/factory"
 
 	"github.com/fiorix/go-diameter/diam"
 	"github.com/fiorix/go-diameter/diam/datatype"
@@ -14,57 +9,46 @@ import (
 	"github.com/fiorix/go-diameter/diam/sm/smpeer"
 	charging_code "github.com/free5gc/chf/ccs_diameter/code"
 	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
-	"github.com/free5gc/chf/internal/logger"
+	chf_context "github.com/free5gc/chf/internal/context"
 )
 
-func SendAccountDebitRequest(ue *chf_context.ChfUe, ccr *charging_datatype.AccountDebitRequest) (*charging_datatype.AccountDebitResponse, error) {
-	ue.AbmfMux.Handle("CCA", HandleCCA(ue.AcctChan))
-	abmfDiameter := factory.ChfConfig.Configuration.AbmfDiameter
-	addr := abmfDiameter.HostIPv4 + ":" + strconv.Itoa(abmfDiameter.Port)
-	conn, err := ue.AbmfClient.DialNetworkTLS(abmfDiameter.Protocol, addr, abmfDiameter.Tls.Pem, abmfDiameter.Tls.Key)
-	// conn, err := ue.AbmfClient.DialNetwork(abmfDiameter.Protocol, addr)
-	if err != nil {
-		return nil, err
-	}
-
-	meta, ok := smpeer.FromContext(conn.Context())
-	if !ok {
-		return nil, fmt.Errorf("peer metadata unavailable")
+func SendAccountDebitRequest(ccr *charging_datatype.AccountDebitRequest) (*charging_datatype.AccountDebitResponse, error) {
+	router := chf_context.CHF_Self().AbmfRouter
+	session := routerSessionOf(ccr)
+	if ccr.CcRequestType == charging_datatype.TERMINATION_REQUEST || ccr.CcRequestType == charging_datatype.EVENT_REQUEST {
+		defer router.EndSession(session)
 	}
 
-	ccr.DestinationRealm = datatype.DiameterIdentity(meta.OriginRealm)
-	ccr.DestinationHost = datatype.DiameterIdentity(meta.OriginHost)
-
-	msg := diam.NewRequest(charging_code.ABMF_CreditControl, charging_code.Re_interface, dict.Default)
+	m, err := router.Send(session, string(ccr.DestinationRealm), func(meta *smpeer.Metadata) (*diam.Message, error) {
+		ccr.DestinationRealm = datatype.DiameterIdentity(meta.OriginRealm)
+		ccr.DestinationHost = datatype.DiameterIdentity(meta.OriginHost)
 
-	err = msg.Marshal(ccr)
+		msg := diam.NewRequest(charging_code.ABMF_CreditControl, charging_code.Re_interface, dict.Default)
+		if err := msg.Marshal(ccr); err != nil {
+			return nil, fmt.Errorf("Marshal CCR Failed: %s\n", err)
+		}
+		return msg, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Marshal CCR Failed: %s\n", err)
+		return nil, err
 	}
 
-	_, err = msg.WriteTo(conn)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to send message from %s: %s\n",
-			conn.RemoteAddr(), err)
+	var cca charging_datatype.AccountDebitResponse
+	if err := m.Unmarshal(&cca); err != nil {
+		return nil, fmt.Errorf("Failed to parse message from %v", err)
 	}
-
-	select {
-	case m := <-ue.AcctChan:
-		var cca charging_datatype.AccountDebitResponse
-		if err := m.Unmarshal(&cca); err != nil {
-			return nil, fmt.Errorf("Failed to parse message from %v", err)
-		}
-
-		return &cca, nil
-	case <-time.After(5 * time.Second):
-		return nil, fmt.Errorf("timeout: no rate answer received")
+	if cca.ResultCode != datatype.Unsigned32(diam.Success) {
+		return nil, fmt.Errorf("account debit rejected: result code %d", cca.ResultCode)
 	}
-}
 
-func HandleCCA(abmfChan chan *diam.Message) diam.HandlerFunc {
-	return func(c diam.Conn, m *diam.Message) {
-		logger.AcctLog.Tracef("Received CCA from %s", c.RemoteAddr())
+	return &cca, nil
+}
 
-		abmfChan <- m
+// The Session-Id is shared by every rating group of the UE, whose requests are numbered
+// and terminated on their own, so each rating group stays on its peer on its own
+func routerSessionOf(ccr *charging_datatype.AccountDebitRequest) string {
+	if ccr.MultipleServicesCreditControl == nil {
+		return string(ccr.SessionId)
 	}
+	return fmt.Sprintf("%s;%d", ccr.SessionId, ccr.MultipleServicesCreditControl.RatingGroup)
 }
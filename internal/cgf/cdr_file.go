@@ -0,0 +1,306 @@
+package cgf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/free5gc/chf/cdr/cdrFile"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+// 32.297 6.1.1.1: fixed part of the CDR file header and the CDR header
+const (
+	cdrFileHeaderLength = 54
+	cdrHeaderLength     = 5
+	// the CDR length of the CDR header is two octets
+	maxCdrLength = math.MaxUint16
+)
+
+// CdrFileManager appends the CDRs of all subscribers to the open CDR file,
+// and closes the file when the size, open time or CDR number limit is reached
+type CdrFileManager struct {
+	lock sync.Mutex
+
+	path        string
+	nodeId      string
+	nodeIp      [20]byte
+	maxFileSize uint32
+	maxOpenTime time.Duration
+	maxCdrNum   uint32
+
+	file           *cdrFile.CDRFile
+	fileName       string
+	fd             *os.File
+	timer          *time.Timer
+	sequenceNumber uint32
+}
+
+var cdrFileManager *CdrFileManager
+
+func NewCdrFileManager(cfg *factory.CdrFile, nodeIp string) *CdrFileManager {
+	m := &CdrFileManager{
+		path:        factory.CdrFileDefaultPath,
+		nodeId:      "CHF",
+		maxFileSize: factory.CdrFileDefaultMaxSize,
+		maxOpenTime: factory.CdrFileDefaultMaxOpenTime * time.Second,
+		maxCdrNum:   factory.CdrFileDefaultMaxCdrNum,
+	}
+
+	if cfg != nil {
+		if cfg.Path != "" {
+			m.path = cfg.Path
+		}
+		if cfg.NodeId != "" {
+			m.nodeId = cfg.NodeId
+		}
+		if cfg.MaxFileSize != 0 {
+			m.maxFileSize = cfg.MaxFileSize
+		}
+		if cfg.MaxOpenTime != 0 {
+			m.maxOpenTime = time.Duration(cfg.MaxOpenTime) * time.Second
+		}
+		if cfg.MaxCdrNum != 0 {
+			m.maxCdrNum = cfg.MaxCdrNum
+		}
+	}
+
+	// IPv4 address is encoded in the IPv4-mapped IPv6 format, right aligned
+	if ip := net.ParseIP(nodeIp); ip != nil {
+		copy(m.nodeIp[4:], ip.To16())
+	}
+
+	if err := os.MkdirAll(m.path, 0o755); err != nil {
+		logger.CgfLog.Errorf("Create CDR file directory %s failed: %+v", m.path, err)
+	}
+	m.sequenceNumber = m.lastSequenceNumber()
+
+	return m
+}
+
+// Continue the file sequence number from the CDR files left by the previous run
+func (m *CdrFileManager) lastSequenceNumber() uint32 {
+	var last uint32
+
+	files, err := filepath.Glob(filepath.Join(m.path, m.nodeId+"_-_*"))
+	if err != nil {
+		return 0
+	}
+	for _, file := range files {
+		rc := strings.TrimPrefix(filepath.Base(file), m.nodeId+"_-_")
+		rc = strings.SplitN(rc, ".", 2)[0]
+		if seq, err := strconv.ParseUint(rc, 10, 32); err == nil && uint32(seq) > last {
+			last = uint32(seq)
+		}
+	}
+	return last
+}
+
+// 32.297 6.1.1.2: <node ID>_-_<RC>.<YYYYMMDD>_-_<hhmm><+/-hhmm>
+func (m *CdrFileManager) newFileName(t time.Time) string {
+	return fmt.Sprintf("%s_-_%d.%s_-_%s", m.nodeId, m.sequenceNumber,
+		t.Format("20060102"), t.Format("1504-0700"))
+}
+
+// open creates the CDR file with its header, the CDRs are appended to it
+func (m *CdrFileManager) open() error {
+	now := time.Now()
+
+	m.sequenceNumber++
+	if m.sequenceNumber == 0 {
+		m.sequenceNumber = 1
+	}
+
+	m.file = &cdrFile.CDRFile{
+		Hdr: cdrFile.CdrFileHeader{
+			HeaderLength:                          cdrFileHeaderLength,
+			FileLength:                            cdrFileHeaderLength,
+			FileOpeningTimestamp:                  cdrFile.NewCdrHdrTimeStamp(now),
+			TimestampWhenLastCdrWasAppendedToFIle: cdrFile.NewCdrHdrTimeStamp(now),
+			FileSequenceNumber:                    m.sequenceNumber,
+			IpAddressOfNodeThatGeneratedFile:      m.nodeIp,
+		},
+	}
+	m.fileName = m.newFileName(now)
+
+	fd, err := os.OpenFile(filepath.Join(m.path, m.fileName), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		m.file = nil
+		return err
+	}
+	m.fd = fd
+	if err := m.writeHeader(); err != nil {
+		m.closeFd()
+		m.file = nil
+		return err
+	}
+
+	file := m.file
+	m.timer = time.AfterFunc(m.maxOpenTime, func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		if m.file == file {
+			m.closeFile(cdrFile.FileOpentimeLimitedReached)
+		}
+	})
+
+	logger.CgfLog.Infof("Open CDR file %s", m.fileName)
+	return nil
+}
+
+// The file header is rewritten in place, the CDRs written already are left as is
+func (m *CdrFileManager) writeHeader() error {
+	_, err := m.fd.WriteAt(m.file.Hdr.Encoding(), 0)
+	return err
+}
+
+// The CDR is written with its header at the end of the file
+func (m *CdrFileManager) writeCdr(cdrBytes []byte) error {
+	hdr := cdrFile.CdrHeader{
+		CdrLength:        uint16(len(cdrBytes)),
+		DataRecordFormat: cdrFile.BasicEncodingRules,
+	}
+	record := append(hdr.Encoding(), cdrBytes...)
+	_, err := m.fd.WriteAt(record, int64(m.file.Hdr.FileLength))
+	return err
+}
+
+func (m *CdrFileManager) closeFd() {
+	if err := m.fd.Close(); err != nil {
+		logger.CgfLog.Errorf("Close CDR file %s failed: %+v", m.fileName, err)
+	}
+	m.fd = nil
+}
+
+// closeFile writes the closure reason and transfers the file, the caller should hold the lock
+func (m *CdrFileManager) closeFile(reason cdrFile.FileClosureTriggerReasonType) {
+	if m.file == nil {
+		return
+	}
+
+	m.timer.Stop()
+	m.file.Hdr.FileClosureTriggerReason = reason
+	err := m.writeHeader()
+	m.closeFd()
+	if err != nil {
+		logger.CgfLog.Errorf("Write CDR file %s failed: %+v", m.fileName, err)
+	} else {
+		logger.CgfLog.Infof("Close CDR file %s, reason %d", m.fileName, reason)
+		fileName := m.fileName
+		go func() {
+			if err := transferCdrFile(filepath.Join(m.path, fileName), fileName); err != nil {
+				logger.CgfLog.Errorf("Transfer CDR file %s failed: %+v", fileName, err)
+			}
+		}()
+	}
+
+	m.file = nil
+	m.fileName = ""
+	m.timer = nil
+}
+
+// Append the BER encoded CDRs to the open CDR file, the CDR longer than the CDR length of
+// the CDR header is not written
+func (m *CdrFileManager) Append(cdrs [][]byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var rejected int
+	for _, cdrBytes := range cdrs {
+		if len(cdrBytes) > maxCdrLength {
+			logger.CgfLog.Errorf("CDR of %d octets exceeds the CDR length of %d octets", len(cdrBytes), maxCdrLength)
+			rejected++
+			continue
+		}
+		length := uint32(len(cdrBytes)) + cdrHeaderLength
+
+		if m.file != nil && m.file.Hdr.NumberOfCdrsInFile > 0 &&
+			m.file.Hdr.FileLength+length > m.maxFileSize {
+			m.closeFile(cdrFile.FileSizeLimitReached)
+		}
+		if m.file == nil {
+			if err := m.open(); err != nil {
+				return err
+			}
+		}
+
+		if err := m.writeCdr(cdrBytes); err != nil {
+			return err
+		}
+		m.file.Hdr.FileLength += length
+		m.file.Hdr.NumberOfCdrsInFile++
+		m.file.Hdr.TimestampWhenLastCdrWasAppendedToFIle = cdrFile.NewCdrHdrTimeStamp(time.Now())
+
+		if m.file.Hdr.NumberOfCdrsInFile >= m.maxCdrNum {
+			m.closeFile(cdrFile.MaximumNumberOfCdrsInFileReached)
+		}
+	}
+
+	if m.file != nil {
+		if err := m.writeHeader(); err != nil {
+			return err
+		}
+	}
+	if rejected != 0 {
+		return fmt.Errorf("%d CDR(s) exceed the CDR length of %d octets", rejected, maxCdrLength)
+	}
+	return nil
+}
+
+// Close the open CDR file, e.g. at CHF termination or by the operator
+func (m *CdrFileManager) Close(reason cdrFile.FileClosureTriggerReasonType) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.closeFile(reason)
+}
+
+func AppendCDRs(cdrs [][]byte) error {
+	if cdrFileManager == nil {
+		return fmt.Errorf("CDR file manager is not initialized")
+	}
+	return cdrFileManager.Append(cdrs)
+}
+
+func CloseCdrFile(reason cdrFile.FileClosureTriggerReasonType) {
+	if cdrFileManager != nil {
+		cdrFileManager.Close(reason)
+	}
+}
+
+// Transfer the closed CDR file to the billing domain
+func transferCdrFile(path string, fileName string) error {
+	if cgf == nil {
+		return fmt.Errorf("CGF is not started")
+	}
+
+	cgf.connLock.Lock()
+	defer cgf.connLock.Unlock()
+
+	if cgf.conn == nil {
+		if err := Login(); err != nil {
+			return err
+		}
+		logger.CgfLog.Infof("FTP Re-Login Success")
+	}
+
+	cdrByte, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := cgf.conn.Stor(fileName, bytes.NewReader(cdrByte)); err != nil {
+		cgf.conn = nil
+		return err
+	}
+	return nil
+}
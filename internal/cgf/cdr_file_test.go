@@ -0,0 +1,68 @@
+package cgf
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/cdr/cdrFile"
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+func TestCdrFileManagerRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	m := NewCdrFileManager(&factory.CdrFile{
+		Path:      dir,
+		NodeId:    "CHF",
+		MaxCdrNum: 2,
+	}, "127.0.0.113")
+
+	require.NoError(t, m.Append([][]byte{[]byte("abc"), []byte("defg"), []byte("hi")}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "CHF_-_*"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	closed, err := filepath.Glob(filepath.Join(dir, "CHF_-_1.*"))
+	require.NoError(t, err)
+	require.Len(t, closed, 1)
+
+	var file cdrFile.CDRFile
+	file.Decoding(closed[0])
+	require.Equal(t, uint32(2), file.Hdr.NumberOfCdrsInFile)
+	require.Equal(t, uint32(1), file.Hdr.FileSequenceNumber)
+	require.Equal(t, cdrFile.MaximumNumberOfCdrsInFileReached, file.Hdr.FileClosureTriggerReason)
+	require.Equal(t, uint32(cdrFileHeaderLength+3+4+2*cdrHeaderLength), file.Hdr.FileLength)
+
+	m.Close(cdrFile.NormalClosure)
+
+	// the sequence number continues from the files left in the directory
+	require.Equal(t, uint32(2), NewCdrFileManager(&factory.CdrFile{Path: dir, NodeId: "CHF"}, "").sequenceNumber)
+}
+
+func TestCdrFileManagerAppend(t *testing.T) {
+	dir := t.TempDir()
+	m := NewCdrFileManager(&factory.CdrFile{Path: dir, NodeId: "CHF"}, "")
+	defer m.Close(cdrFile.NormalClosure)
+
+	// The open file is complete after each append, the CDRs are appended to it
+	require.NoError(t, m.Append([][]byte{[]byte("abc")}))
+	require.NoError(t, m.Append([][]byte{[]byte("defg")}))
+
+	var file cdrFile.CDRFile
+	file.Decoding(filepath.Join(dir, m.fileName))
+	require.Equal(t, uint32(2), file.Hdr.NumberOfCdrsInFile)
+	require.Equal(t, uint32(cdrFileHeaderLength+3+4+2*cdrHeaderLength), file.Hdr.FileLength)
+	require.Len(t, file.CdrList, 2)
+	require.Equal(t, []byte("defg"), file.CdrList[1].CdrByte)
+
+	// The CDR over the CDR length is rejected, the others are written
+	err := m.Append([][]byte{make([]byte, maxCdrLength+1), []byte("hi")})
+	require.Error(t, err)
+	file = cdrFile.CDRFile{}
+	file.Decoding(filepath.Join(dir, m.fileName))
+	require.Equal(t, uint32(3), file.Hdr.NumberOfCdrsInFile)
+	require.Equal(t, []byte("hi"), file.CdrList[2].CdrByte)
+}
@@ -2,7 +2,6 @@
 package cgf
 
 import (
-	"bytes"
 	"encoding/json"
 	"os"
 	"strconv"
@@ -21,6 +20,7 @@ type Cgf struct {
 	ftpServer *ftpserver.FtpServer
 	driver    *server.Server
 	conn      *ftp.ServerConn
+	connLock  sync.Mutex
 	addr      string
 	ftpConfig FtpConfig
 }
@@ -47,6 +47,8 @@ func OpenServer(wg *sync.WaitGroup) *Cgf {
 	cgfConfig := factory.ChfConfig.Configuration.Cgf
 	cgf.addr = cgfConfig.HostIPv4 + ":" + strconv.Itoa(cgfConfig.Port)
 
+	cdrFileManager = NewCdrFileManager(cgfConfig.CdrFile, factory.ChfConfig.Configuration.Sbi.RegisterIPv4)
+
 	cgf.ftpConfig = FtpConfig{
 		Version: 1,
 		Accesses: []Access{
@@ -123,29 +125,6 @@ func Login() error {
 	return err
 }
 
-func SendCDR(supi string) error {
-	if cgf.conn == nil {
-		err := Login()
-
-		if err != nil {
-			return err
-		}
-		logger.CgfLog.Infof("FTP Re-Login Success")
-
-	}
-
-	fileName := supi + ".cdr"
-	cdrByte, err := os.ReadFile("/tmp/" + fileName)
-	if err != nil {
-		return err
-	}
-
-	cdrReader := bytes.NewReader(cdrByte)
-	cgf.conn.Stor(fileName, cdrReader)
-
-	return nil
-}
-
 func (f *Cgf) Serve(wg *sync.WaitGroup) {
 	defer func() {
 		logger.CgfLog.Error("FTP server stopped")
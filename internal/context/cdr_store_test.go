@@ -0,0 +1,103 @@
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/cdr/cdrType"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/sbi/producer"
+	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestRestoreChfUeCdr(t *testing.T) {
+	factory.ChfConfig.Configuration = &factory.Configuration{}
+	self := chf_context.CHF_Self()
+
+	ue, err := self.NewCHFUe("imsi-208930000000002")
+	require.NoError(t, err)
+	defer self.UePool.Delete(ue.Supi)
+
+	triggerTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	chargingData := models.ChargingDataRequest{
+		ChargingId: 7,
+		NfConsumerIdentification: &models.NfIdentification{
+			NodeFunctionality: models.NodeFunctionality_SMF,
+			NFName:            "smf",
+		},
+		PDUSessionChargingInformation: &models.PduSessionChargingInformation{ChargingId: 7},
+	}
+	record, err := producer.OpenCDR(chargingData, ue, "ref", false)
+	require.NoError(t, err)
+	ue.Cdr["ref"] = record
+
+	chargingData.MultipleUnitUsage = []models.MultipleUnitUsage{{
+		RatingGroup: 1,
+		UPFID:       "upf",
+		UsedUnitContainer: []models.UsedUnitContainer{{
+			LocalSequenceNumber: 1,
+			Time:                30,
+			UplinkVolume:        100,
+			DownlinkVolume:      200,
+			TotalVolume:         300,
+			Triggers:            []models.Trigger{{TriggerType: models.TriggerType_QOS_CHANGE}},
+			TriggerTimestamp:    &triggerTime,
+			EventTimeStamps:     []*time.Time{&triggerTime},
+		}},
+	}}
+	require.NoError(t, producer.UpdateCDR(record, chargingData))
+
+	// The reopened partial record is numbered
+	record, err = producer.OpenCDR(chargingData, ue, "ref", true)
+	require.NoError(t, err)
+	require.NoError(t, producer.UpdateCDR(record, chargingData))
+
+	data, err := chf_context.MarshalChfUe(ue)
+	require.NoError(t, err)
+	restoredUe, err := chf_context.UnmarshalChfUe(data)
+	require.NoError(t, err)
+
+	require.Contains(t, restoredUe.Cdr, "ref")
+	want := record.ChargingFunctionRecord
+	got := restoredUe.Cdr["ref"].ChargingFunctionRecord
+	require.Equal(t, record.Present, restoredUe.Cdr["ref"].Present)
+
+	// The ASN.1 wrappers
+	require.Equal(t, want.RecordType, got.RecordType)
+	require.Equal(t, want.RecordingNetworkFunctionID, got.RecordingNetworkFunctionID)
+	require.Equal(t, want.RecordOpeningTime, got.RecordOpeningTime)
+	require.Equal(t, want.Duration, got.Duration)
+	require.Equal(t, want.LocalRecordSequenceNumber, got.LocalRecordSequenceNumber)
+	require.Equal(t, want.SubscriberIdentifier, got.SubscriberIdentifier)
+	require.Equal(t, want.ChargingSessionIdentifier, got.ChargingSessionIdentifier)
+	require.Equal(t, want.ChargingID, got.ChargingID)
+	require.Equal(t, want.NFunctionConsumerInformation, got.NFunctionConsumerInformation)
+	require.Equal(t, want.PDUSessionChargingInformation, got.PDUSessionChargingInformation)
+
+	// The partial record number is a pointer, restored with its value
+	require.NotNil(t, got.RecordSequenceNumber)
+	require.Equal(t, int64(1), *got.RecordSequenceNumber)
+
+	// The used unit containers
+	require.Len(t, got.ListOfMultipleUnitUsage, 1)
+	usage := got.ListOfMultipleUnitUsage[0]
+	require.Equal(t, want.ListOfMultipleUnitUsage[0].RatingGroup, usage.RatingGroup)
+	require.Equal(t, want.ListOfMultipleUnitUsage[0].UPFID, usage.UPFID)
+	require.Len(t, usage.UsedUnitContainers, 1)
+	wantUsedUnit := want.ListOfMultipleUnitUsage[0].UsedUnitContainers[0]
+	usedUnit := usage.UsedUnitContainers[0]
+	require.Equal(t, wantUsedUnit.LocalSequenceNumber, usedUnit.LocalSequenceNumber)
+	require.Equal(t, &cdrType.CallDuration{Value: 30}, usedUnit.Time)
+	require.Equal(t, wantUsedUnit.DataVolumeUplink, usedUnit.DataVolumeUplink)
+	require.Equal(t, wantUsedUnit.DataVolumeDownlink, usedUnit.DataVolumeDownlink)
+	require.Equal(t, wantUsedUnit.DataTotalVolume, usedUnit.DataTotalVolume)
+	require.Equal(t, wantUsedUnit.Triggers, usedUnit.Triggers)
+	require.Equal(t, wantUsedUnit.TriggerTimeStamp, usedUnit.TriggerTimeStamp)
+	require.Equal(t, wantUsedUnit.EventTimeStamp, usedUnit.EventTimeStamp)
+
+	// Nothing else is lost on the way
+	require.Equal(t, want, got)
+}
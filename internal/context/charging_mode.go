@@ -0,0 +1,52 @@
+package context
+
+import (
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+// ChargingMode decides whether the CHF performs quota management for the usage
+type ChargingMode string
+
+const (
+	// Quota is granted for all the usage
+	ChargingModeOnline ChargingMode = "online"
+	// No quota is granted, only CDRs are generated
+	ChargingModeOffline ChargingMode = "offline"
+	// Quota is granted as indicated by QuotaManagementIndicator of the used unit container
+	ChargingModeConverged ChargingMode = "converged"
+)
+
+// Resolve the charging mode from the rule of the subscriber and the DNN, then the subscriber rule,
+// then the DNN rule, then the default mode. A rule matches when all of its fields do.
+func (c *CHFContext) ChargingModeOf(supi string, dnn string) ChargingMode {
+	policy := factory.ChfConfig.Configuration.ChargingPolicy
+	if policy == nil {
+		return ChargingModeConverged
+	}
+
+	var subscriberRule, dnnRule *factory.ChargingModeRule
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		switch {
+		case rule.Supi != "" && rule.Supi != supi, rule.Dnn != "" && rule.Dnn != dnn:
+			continue
+		case rule.Supi != "" && rule.Dnn != "":
+			return ChargingMode(rule.Mode)
+		case rule.Supi != "" && subscriberRule == nil:
+			subscriberRule = rule
+		case rule.Dnn != "" && dnnRule == nil:
+			dnnRule = rule
+		}
+	}
+	if subscriberRule != nil {
+		return ChargingMode(subscriberRule.Mode)
+	}
+	if dnnRule != nil {
+		return ChargingMode(dnnRule.Mode)
+	}
+
+	if policy.DefaultMode != "" {
+		return ChargingMode(policy.DefaultMode)
+	}
+	return ChargingModeConverged
+}
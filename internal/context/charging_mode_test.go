@@ -0,0 +1,31 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+func TestChargingModeOf(t *testing.T) {
+	factory.ChfConfig.Configuration = &factory.Configuration{
+		ChargingPolicy: &factory.ChargingPolicy{
+			DefaultMode: string(ChargingModeOnline),
+			Rules: []factory.ChargingModeRule{
+				{Supi: "imsi-208930000000001", Dnn: "ims", Mode: string(ChargingModeOffline)},
+				{Dnn: "internet", Mode: string(ChargingModeConverged)},
+				{Supi: "imsi-208930000000002", Mode: string(ChargingModeOffline)},
+			},
+		},
+	}
+
+	// The rule of the subscriber and the DNN applies to that DNN only
+	require.Equal(t, ChargingModeOffline, chfCtx.ChargingModeOf("imsi-208930000000001", "ims"))
+	require.Equal(t, ChargingModeConverged, chfCtx.ChargingModeOf("imsi-208930000000001", "internet"))
+	require.Equal(t, ChargingModeOnline, chfCtx.ChargingModeOf("imsi-208930000000001", ""))
+
+	// The subscriber rule takes precedence over the DNN rule
+	require.Equal(t, ChargingModeOffline, chfCtx.ChargingModeOf("imsi-208930000000002", "internet"))
+	require.Equal(t, ChargingModeConverged, chfCtx.ChargingModeOf("imsi-208930000000003", "internet"))
+}
@@ -0,0 +1,220 @@
+package context
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/free5gc/openapi/models"
+)
+
+// The released session is remembered for a while, the retransmitted release is answered again
+const releasedSessionRetention = time.Minute
+
+type InvocationCheck int
+
+const (
+	InvocationNew InvocationCheck = iota
+	InvocationRetransmitted
+	InvocationOutOfOrder
+)
+
+// ChargingSession binds a ChargingDataRef to the UE owning the charging data resource
+type ChargingSession struct {
+	ChargingDataRef string
+	Supi            string
+	CreatedAt       time.Time
+	ChargingMode    ChargingMode
+
+	// Set when the CHF has asked the NF consumer to terminate the session
+	TerminationRequested bool
+	TerminationCause     string
+
+	// The last invocation of the NF consumer and its response, guarded by the lock of the UE
+	lastInvocation int32
+	lastResponse   *models.ChargingDataResponse
+	// the release of the last invocation has released the reservations
+	releasing bool
+
+	timer     *time.Timer
+	timerLock sync.Mutex
+}
+
+// StartTimer replaces the running timer of the session, f is called once d expires
+func (s *ChargingSession) StartTimer(d time.Duration, f func()) {
+	s.timerLock.Lock()
+	defer s.timerLock.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(d, f)
+}
+
+func (s *ChargingSession) StopTimer() {
+	s.timerLock.Lock()
+	defer s.timerLock.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// CheckInvocation compares the InvocationSequenceNumber of the request with the last one of the session,
+// 32.291 6.1.6.2.2.1: the number increases with each request of the session. The retransmitted request
+// has the number of the last one and gets its response again, the consumer not numbering its requests
+// always sends 0.
+func (s *ChargingSession) CheckInvocation(sequenceNumber int32) (InvocationCheck, *models.ChargingDataResponse) {
+	switch {
+	case sequenceNumber < s.lastInvocation:
+		return InvocationOutOfOrder, nil
+	case sequenceNumber == s.lastInvocation && sequenceNumber != 0 && s.lastResponse != nil:
+		return InvocationRetransmitted, s.lastResponse
+	}
+	return InvocationNew, nil
+}
+
+// SaveInvocation records the request answered with the response
+func (s *ChargingSession) SaveInvocation(sequenceNumber int32, response *models.ChargingDataResponse) {
+	s.lastInvocation = sequenceNumber
+	s.lastResponse = response
+}
+
+// SaveRelease records the release of the session charged, its CDR is not closed yet
+func (s *ChargingSession) SaveRelease(sequenceNumber int32) {
+	s.lastInvocation = sequenceNumber
+	s.lastResponse = nil
+	s.releasing = true
+}
+
+// IsReleasing tells whether the release of the sequence number has been charged already
+func (s *ChargingSession) IsReleasing(sequenceNumber int32) bool {
+	return s.releasing && sequenceNumber == s.lastInvocation
+}
+
+func (s *ChargingSession) LastInvocation() int32 {
+	return s.lastInvocation
+}
+
+// Allocate a globally unique ChargingDataRef for the UE and register it
+func (c *CHFContext) NewChargingSession(supi string) *ChargingSession {
+	for {
+		session := &ChargingSession{
+			ChargingDataRef: uuid.New().String(),
+			Supi:            supi,
+			CreatedAt:       time.Now(),
+		}
+		if _, loaded := c.ChargingSessions.LoadOrStore(session.ChargingDataRef, session); !loaded {
+			return session
+		}
+	}
+}
+
+// AddChargingSession registers the charging session restored with its state, if it has been stored
+func (c *CHFContext) AddChargingSession(chargingDataRef string, supi string, state *chargingSessionState) {
+	session := &ChargingSession{
+		ChargingDataRef: chargingDataRef,
+		Supi:            supi,
+		CreatedAt:       time.Now(),
+	}
+	if state != nil {
+		session.ChargingMode = state.ChargingMode
+		session.lastInvocation = state.LastInvocation
+		session.lastResponse = state.LastResponse
+	}
+	c.ChargingSessions.Store(chargingDataRef, session)
+}
+
+func (c *CHFContext) ChargingSessionFindByRef(chargingDataRef string) (*ChargingSession, bool) {
+	if value, ok := c.ChargingSessions.Load(chargingDataRef); ok {
+		return value.(*ChargingSession), ok
+	}
+	return nil, false
+}
+
+// Find the UE owning the charging data resource, regardless of the SUPI carried in request
+func (c *CHFContext) ChfUeFindByChargingDataRef(chargingDataRef string) (*ChfUe, bool) {
+	session, ok := c.ChargingSessionFindByRef(chargingDataRef)
+	if !ok {
+		return nil, false
+	}
+	return c.ChfUeFindBySupi(session.Supi)
+}
+
+func (c *CHFContext) DeleteChargingSession(chargingDataRef string) {
+	if session, ok := c.ChargingSessionFindByRef(chargingDataRef); ok {
+		session.StopTimer()
+		c.ChargingSessions.Delete(chargingDataRef)
+	}
+}
+
+// ReleaseChargingSession deletes the session released by the request of the InvocationSequenceNumber
+func (c *CHFContext) ReleaseChargingSession(chargingDataRef string, sequenceNumber int32) {
+	c.DeleteChargingSession(chargingDataRef)
+	c.ReleasedChargingSessions.Store(chargingDataRef, sequenceNumber)
+	time.AfterFunc(releasedSessionRetention, func() {
+		c.ReleasedChargingSessions.Delete(chargingDataRef)
+	})
+}
+
+// IsReleaseRetransmitted tells whether the release of the session is a retransmission of the release
+func (c *CHFContext) IsReleaseRetransmitted(chargingDataRef string, sequenceNumber int32) bool {
+	value, ok := c.ReleasedChargingSessions.Load(chargingDataRef)
+	return ok && value.(int32) == sequenceNumber
+}
+
+// The one time event of the consumer is identified by its invocation, the sequence number and time stamp
+type oneTimeEventKey struct {
+	supi           string
+	consumer       string
+	sequenceNumber int32
+	invocationTime int64
+}
+
+// The one time event without invocation sequence number nor time stamp can not be told from another
+func oneTimeEventKeyOf(request *models.ChargingDataRequest) (oneTimeEventKey, bool) {
+	key := oneTimeEventKey{
+		supi:           request.SubscriberIdentifier,
+		sequenceNumber: request.InvocationSequenceNumber,
+	}
+	if consumer := request.NfConsumerIdentification; consumer != nil {
+		key.consumer = consumer.NFName + "/" + consumer.NFIPv4Address + "/" + consumer.NFFqdn
+	}
+	if request.InvocationTimeStamp != nil {
+		key.invocationTime = request.InvocationTimeStamp.UnixNano()
+	}
+	return key, key.sequenceNumber != 0 || key.invocationTime != 0
+}
+
+// OneTimeEventResponse returns the response of the one time event charged already,
+// the retransmitted event is answered again without being charged twice
+func (c *CHFContext) OneTimeEventResponse(request *models.ChargingDataRequest) (*models.ChargingDataResponse, bool) {
+	key, ok := oneTimeEventKeyOf(request)
+	if !ok {
+		return nil, false
+	}
+	if value, ok := c.ChargedOneTimeEvents.Load(key); ok {
+		return value.(*models.ChargingDataResponse), true
+	}
+	return nil, false
+}
+
+// SaveOneTimeEvent records the one time event charged with its response for a while
+func (c *CHFContext) SaveOneTimeEvent(request *models.ChargingDataRequest, response *models.ChargingDataResponse) {
+	key, ok := oneTimeEventKeyOf(request)
+	if !ok {
+		return
+	}
+	c.ChargedOneTimeEvents.Store(key, response)
+	time.AfterFunc(releasedSessionRetention, func() {
+		c.ChargedOneTimeEvents.Delete(key)
+	})
+}
+
+// 32.298 5.1.5.1.5 Local Record Sequence Number, increasing for each CDR generated by this CHF
+func (c *CHFContext) AllocateLocalRecordSequenceNumber() uint64 {
+	return atomic.AddUint64(&c.LocalRecordSequenceNumber, 1)
+}
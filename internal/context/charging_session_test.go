@@ -0,0 +1,38 @@
+package context
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func TestOneTimeEventResponse(t *testing.T) {
+	invocationTime := time.Date(2023, 5, 3, 12, 0, 0, 0, time.UTC)
+	request := &models.ChargingDataRequest{
+		SubscriberIdentifier:     "imsi-208930000000001",
+		NfConsumerIdentification: &models.NfIdentification{NFName: "smsf"},
+		InvocationTimeStamp:      &invocationTime,
+		InvocationSequenceNumber: 1,
+		OneTimeEvent:             true,
+	}
+	_, ok := chfCtx.OneTimeEventResponse(request)
+	require.False(t, ok)
+
+	// The retransmitted event gets the response of the event
+	response := &models.ChargingDataResponse{InvocationSequenceNumber: 1}
+	chfCtx.SaveOneTimeEvent(request, response)
+	retransmitted := *request
+	retransmitted.RetransmissionIndicator = true
+	found, ok := chfCtx.OneTimeEventResponse(&retransmitted)
+	require.True(t, ok)
+	require.Same(t, response, found)
+
+	// The next event of the consumer is charged
+	next := *request
+	next.InvocationSequenceNumber = 2
+	_, ok = chfCtx.OneTimeEventResponse(&next)
+	require.False(t, ok)
+}
@@ -8,8 +8,10 @@ import (
 	"sync"
 
 	"github.com/fiorix/go-diameter/diam/sm"
+	"github.com/free5gc/chf/internal/diameter"
 	"github.com/free5gc/chf/internal/logger"
 	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/chf/pkg/identity"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/util/idgenerator"
 )
@@ -21,8 +23,16 @@ func init() {
 	chfCtx.Name = "chf"
 	chfCtx.UriScheme = models.UriScheme_HTTPS
 	chfCtx.NfService = make(map[models.ServiceName]models.NfService)
+	chfCtx.SessionStore = NullSessionStore{}
 	chfCtx.RatingSessionIdGenerator = idgenerator.NewGenerator(1, math.MaxUint32)
 	chfCtx.AccountSessionIdGenerator = idgenerator.NewGenerator(1, math.MaxUint32)
+	chfCtx.SpendingLimitIdGenerator = idgenerator.NewGenerator(1, math.MaxUint32)
+}
+
+// API versions of the services provided by CHF, refer to TS 32.291 and TS 29.594
+var serviceApiVersion = map[models.ServiceName]string{
+	models.ServiceName_NCHF_CONVERGEDCHARGING:    "3.0.3",
+	models.ServiceName_NCHF_SPENDINGLIMITCONTROL: "1.0.3",
 }
 
 type CHFContext struct {
@@ -33,16 +43,31 @@ type CHFContext struct {
 	RegisterIPv4              string
 	SBIPort                   int
 	NfService                 map[models.ServiceName]models.NfService
-	RecordSequenceNumber      map[string]int64
 	LocalRecordSequenceNumber uint64
 	NrfUri                    string
 	UePool                    sync.Map
+	SessionStore              SessionStore
+
+	// Charging data resources, keyed by ChargingDataRef
+	ChargingSessions sync.Map
+	// ChargingDataRef -> InvocationSequenceNumber of the release
+	ReleasedChargingSessions sync.Map
+	// one time events charged recently -> their responses
+	ChargedOneTimeEvents sync.Map
+
+	// Nchf_SpendingLimitControl subscriptions, keyed by subscription id
+	SpendingLimitSubscriptions sync.Map
 
 	RatingCfg *sm.Settings
 	AbmfCfg   *sm.Settings
 
+	// Diameter peers shared by the charging sessions
+	RatingRouter *diameter.Router
+	AbmfRouter   *diameter.Router
+
 	RatingSessionIdGenerator  *idgenerator.IDGenerator
 	AccountSessionIdGenerator *idgenerator.IDGenerator
+	SpendingLimitIdGenerator  *idgenerator.IDGenerator
 }
 
 // Create new CHF context
@@ -56,16 +81,20 @@ func (c *CHFContext) GetIPv4Uri() string {
 
 // Init NfService with supported service list ,and version of services
 func (c *CHFContext) InitNFService(serviceList []factory.Service, version string) {
-	tmpVersion := strings.Split(version, ".")
-	versionUri := "v" + tmpVersion[0]
 	for index, service := range serviceList {
 		name := models.ServiceName(service.ServiceName)
+		apiVersion := version
+		if v, ok := serviceApiVersion[name]; ok {
+			apiVersion = v
+		}
+		tmpVersion := strings.Split(apiVersion, ".")
+		versionUri := "v" + tmpVersion[0]
 		c.NfService[name] = models.NfService{
 			ServiceInstanceId: strconv.Itoa(index),
 			ServiceName:       name,
 			Versions: &[]models.NfServiceVersion{
 				{
-					ApiFullVersion:  version,
+					ApiFullVersion:  apiVersion,
 					ApiVersionInUri: versionUri,
 				},
 			},
@@ -97,18 +126,17 @@ func (context *CHFContext) NewCHFUe(supi string) (*ChfUe, error) {
 	if ue, ok := context.ChfUeFindBySupi(supi); ok {
 		return ue, nil
 	}
-	if strings.HasPrefix(supi, "imsi-") {
-		ue := ChfUe{}
-		ue.init()
+	// The subscriber is identified by its SUPI, or its GPSI
+	if err := identity.Validate(supi); err != nil {
+		return nil, fmt.Errorf("add Ue context of %q fail: %w", supi, err)
+	}
 
-		if supi != "" {
-			context.AddChfUeToUePool(&ue, supi)
-		}
+	ue := ChfUe{}
+	ue.init()
+	ue.allocateSessionIds()
+	context.AddChfUeToUePool(&ue, supi)
 
-		return &ue, nil
-	} else {
-		return nil, fmt.Errorf(" add Ue context fail ")
-	}
+	return &ue, nil
 }
 
 func (context *CHFContext) ChfUeFindBySupi(supi string) (*ChfUe, bool) {
@@ -131,3 +159,34 @@ func GenerateAccountSessionId() uint32 {
 	}
 	return 0
 }
+
+// FreeAccountSessionId releases the id of the ABMF session ended
+func FreeAccountSessionId(id uint32) {
+	chfCtx.AccountSessionIdGenerator.FreeID(int64(id))
+}
+
+// RatingSessionId is the Session-Id of the rating session with the id allocated
+func RatingSessionId(id uint32) string {
+	return diameterSessionId(chfCtx.RatingCfg, id)
+}
+
+// AccountSessionId is the Session-Id of the ABMF session with the id allocated
+func AccountSessionId(id uint32) string {
+	return diameterSessionId(chfCtx.AbmfCfg, id)
+}
+
+// The Session-Id of RFC 6733 8.8, <DiameterIdentity>;<high 32 bits>;<low 32 bits>: the Origin-State-Id,
+// the boot time of the CHF, keeps the ids allocated again after a restart unique.
+func diameterSessionId(settings *sm.Settings, id uint32) string {
+	if settings == nil {
+		return fmt.Sprintf("%s;0;%d", factory.DiameterClientDefaultOriginHost, id)
+	}
+	return fmt.Sprintf("%s;%d;%d", settings.OriginHost, settings.OriginStateID, id)
+}
+
+func GenerateSpendingLimitSubscriptionId() string {
+	if id, err := chfCtx.SpendingLimitIdGenerator.Allocate(); err == nil {
+		return strconv.FormatInt(id, 10)
+	}
+	return ""
+}
@@ -0,0 +1,7 @@
+package context
+
+// The stored form of the UE, for the tests building its charging state with the producer
+var (
+	MarshalChfUe   = marshalChfUe
+	UnmarshalChfUe = unmarshalChfUe
+)
@@ -0,0 +1,270 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/mongoapi"
+)
+
+const (
+	SessionStoreMongoDB = "mongodb"
+	SessionStoreNone    = "none"
+
+	chfSessionColl = "chfSessions"
+)
+
+// SessionStore keeps the charging state of ChfUe outside the process,
+// so that open CDRs and reservations survive a CHF restart
+type SessionStore interface {
+	Save(ue *ChfUe) error
+	Delete(supi string) error
+	LoadAll() ([]*ChfUe, error)
+}
+
+// chfUeSession is the persisted part of ChfUe, diameter clients are rebuilt on load.
+// The Diameter sessions and the charging sessions are continued by the restored UE,
+// the RF and the ABMF see the same Session-Id and CC-Request-Numbers.
+type chfUeSession struct {
+	Supi                 string                                     `json:"supi"`
+	AcctSessionId        string                                     `json:"acctSessionId,omitempty"`
+	RateSessionId        string                                     `json:"rateSessionId,omitempty"`
+	Sessions             map[string]*chargingSessionState           `json:"sessions,omitempty"`
+	RatingGroups         []int32                                    `json:"ratingGroups,omitempty"`
+	NotifyUri            string                                     `json:"notifyUri,omitempty"`
+	RecordSequenceNumber int64                                      `json:"recordSequenceNumber,omitempty"`
+	ReservedQuota        map[int32]monetary.Value                   `json:"reservedQuota,omitempty"`
+	UnitCost             map[int32]monetary.Value                   `json:"unitCost,omitempty"`
+	UnitType             map[int32]charging_datatype.CCUnitType     `json:"unitType,omitempty"`
+	TariffSwitchTime     map[int32]time.Time                        `json:"tariffSwitchTime,omitempty"`
+	NextUnitCost         map[int32]monetary.Value                   `json:"nextUnitCost,omitempty"`
+	ValidUnits           map[int32]uint32                           `json:"validUnits,omitempty"`
+	UnitCostAfterValid   map[int32]monetary.Value                   `json:"unitCostAfterValidUnits,omitempty"`
+	AcctRequestNum       map[int32]uint32                           `json:"acctRequestNum,omitempty"`
+	RatingType           map[int32]charging_datatype.RequestSubType `json:"ratingType,omitempty"`
+	Cdr                  map[string]*cdrType.CHFRecord              `json:"cdr,omitempty"`
+	LastActivity         time.Time                                  `json:"lastActivity"`
+}
+
+// chargingSessionState is the persisted part of ChargingSession
+type chargingSessionState struct {
+	ChargingMode   ChargingMode                 `json:"chargingMode,omitempty"`
+	LastInvocation int32                        `json:"lastInvocation,omitempty"`
+	LastResponse   *models.ChargingDataResponse `json:"lastResponse,omitempty"`
+}
+
+func newChfUeSession(ue *ChfUe) *chfUeSession {
+	sessions := make(map[string]*chargingSessionState)
+	for chargingDataRef := range ue.Cdr {
+		if session, ok := chfCtx.ChargingSessionFindByRef(chargingDataRef); ok {
+			sessions[chargingDataRef] = &chargingSessionState{
+				ChargingMode:   session.ChargingMode,
+				LastInvocation: session.lastInvocation,
+				LastResponse:   session.lastResponse,
+			}
+		}
+	}
+
+	return &chfUeSession{
+		Supi:                 ue.Supi,
+		AcctSessionId:        ue.AcctSessionId,
+		RateSessionId:        ue.RateSessionId,
+		Sessions:             sessions,
+		RatingGroups:         ue.RatingGroups,
+		NotifyUri:            ue.NotifyUri,
+		RecordSequenceNumber: ue.RecordSequenceNumber,
+		ReservedQuota:        ue.ReservedQuota,
+		UnitCost:             ue.UnitCost,
+		UnitType:             ue.UnitType,
+		TariffSwitchTime:     ue.TariffSwitchTime,
+		NextUnitCost:         ue.NextUnitCost,
+		ValidUnits:           ue.ValidUnits,
+		UnitCostAfterValid:   ue.UnitCostAfterValidUnits,
+		AcctRequestNum:       ue.AcctRequestNum,
+		RatingType:           ue.RatingType,
+		Cdr:                  ue.Cdr,
+		LastActivity:         ue.LastActivity,
+	}
+}
+
+func (s *chfUeSession) restore() *ChfUe {
+	ue := &ChfUe{}
+	ue.init()
+
+	ue.Supi = s.Supi
+	// The session stored before the Session-Ids were kept gets new ones
+	ue.AcctSessionId = s.AcctSessionId
+	ue.RateSessionId = s.RateSessionId
+	ue.allocateSessionIds()
+	ue.restoredSessions = s.Sessions
+	ue.RatingGroups = s.RatingGroups
+	ue.NotifyUri = s.NotifyUri
+	ue.RecordSequenceNumber = s.RecordSequenceNumber
+	ue.LastActivity = s.LastActivity
+	for rg, quota := range s.ReservedQuota {
+		ue.ReservedQuota[rg] = quota
+	}
+	for rg, cost := range s.UnitCost {
+		ue.UnitCost[rg] = cost
+	}
+	for rg, unitType := range s.UnitType {
+		ue.UnitType[rg] = unitType
+	}
+	for rg, switchTime := range s.TariffSwitchTime {
+		ue.TariffSwitchTime[rg] = switchTime
+	}
+	for rg, cost := range s.NextUnitCost {
+		ue.NextUnitCost[rg] = cost
+	}
+	for rg, units := range s.ValidUnits {
+		ue.ValidUnits[rg] = units
+	}
+	for rg, cost := range s.UnitCostAfterValid {
+		ue.UnitCostAfterValidUnits[rg] = cost
+	}
+	for rg, num := range s.AcctRequestNum {
+		ue.AcctRequestNum[rg] = num
+	}
+	for rg, ratingType := range s.RatingType {
+		ue.RatingType[rg] = ratingType
+	}
+	for sessionId, cdr := range s.Cdr {
+		ue.Cdr[sessionId] = cdr
+	}
+
+	return ue
+}
+
+// The stored form of the UE is the JSON of its persisted part
+func marshalChfUe(ue *ChfUe) (string, error) {
+	session, err := json.Marshal(newChfUeSession(ue))
+	if err != nil {
+		return "", err
+	}
+	return string(session), nil
+}
+
+func unmarshalChfUe(data string) (*ChfUe, error) {
+	var session chfUeSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	return session.restore(), nil
+}
+
+// MongoSessionStore stores each ChfUe as one document of the chfSessions collection
+type MongoSessionStore struct{}
+
+func (MongoSessionStore) Save(ue *ChfUe) error {
+	session, err := marshalChfUe(ue)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"supi": ue.Supi}
+	data := map[string]interface{}{
+		"supi":    ue.Supi,
+		"session": session,
+	}
+	if _, err = mongoapi.RestfulAPIPutOne(chfSessionColl, filter, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (MongoSessionStore) Delete(supi string) error {
+	return mongoapi.RestfulAPIDeleteOne(chfSessionColl, bson.M{"supi": supi})
+}
+
+func (MongoSessionStore) LoadAll() ([]*ChfUe, error) {
+	docs, err := mongoapi.RestfulAPIGetMany(chfSessionColl, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	ues := make([]*ChfUe, 0, len(docs))
+	for _, doc := range docs {
+		data, ok := doc["session"].(string)
+		if !ok {
+			logger.CtxLog.Warnf("Skip malformed charging session of %v", doc["supi"])
+			continue
+		}
+
+		ue, err := unmarshalChfUe(data)
+		if err != nil {
+			logger.CtxLog.Warnf("Skip charging session of %v: %+v", doc["supi"], err)
+			continue
+		}
+		ues = append(ues, ue)
+	}
+	return ues, nil
+}
+
+// NullSessionStore keeps the sessions in memory only
+type NullSessionStore struct{}
+
+func (NullSessionStore) Save(ue *ChfUe) error { return nil }
+
+func (NullSessionStore) Delete(supi string) error { return nil }
+
+func (NullSessionStore) LoadAll() ([]*ChfUe, error) { return nil, nil }
+
+func (c *CHFContext) InitSessionStore(storeType string) error {
+	switch storeType {
+	case "", SessionStoreMongoDB:
+		c.SessionStore = MongoSessionStore{}
+	case SessionStoreNone:
+		c.SessionStore = NullSessionStore{}
+	default:
+		return fmt.Errorf("unsupported session store: %s", storeType)
+	}
+	return nil
+}
+
+// Persist the charging session of the UE, the caller should hold ue.CULock
+func (c *CHFContext) SaveChfUe(ue *ChfUe) {
+	ue.LastActivity = time.Now()
+	if len(ue.Cdr) == 0 {
+		if err := c.SessionStore.Delete(ue.Supi); err != nil {
+			logger.CtxLog.Errorf("Delete charging session of %s failed: %+v", ue.Supi, err)
+		}
+		return
+	}
+	if err := c.SessionStore.Save(ue); err != nil {
+		logger.CtxLog.Errorf("Save charging session of %s failed: %+v", ue.Supi, err)
+	}
+}
+
+// Rehydrate the UE pool from the session store and returns the restored UEs
+func (c *CHFContext) RestoreChfUes() []*ChfUe {
+	ues, err := c.SessionStore.LoadAll()
+	if err != nil {
+		logger.CtxLog.Errorf("Load charging sessions failed: %+v", err)
+		return nil
+	}
+
+	for _, ue := range ues {
+		for chargingDataRef, cdr := range ue.Cdr {
+			if chargingDataRef != "" {
+				c.AddChargingSession(chargingDataRef, ue.Supi, ue.restoredSessions[chargingDataRef])
+			}
+			// keep the local record sequence number increasing across restart
+			if seq := cdr.ChargingFunctionRecord.LocalRecordSequenceNumber; seq != nil &&
+				uint64(seq.Value) > c.LocalRecordSequenceNumber {
+				c.LocalRecordSequenceNumber = uint64(seq.Value)
+			}
+		}
+		ue.restoredSessions = nil
+		c.UePool.Store(ue.Supi, ue)
+		logger.CtxLog.Infof("Restore charging session of %s with %d CDR(s)", ue.Supi, len(ue.Cdr))
+	}
+	return ues
+}
@@ -0,0 +1,46 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestRestoreChfUeSession(t *testing.T) {
+	factory.ChfConfig.Configuration = &factory.Configuration{}
+
+	ue := &ChfUe{Supi: "imsi-208930000000001"}
+	ue.init()
+	ue.allocateSessionIds()
+	ue.AcctRequestNum[1] = 3
+
+	session := chfCtx.NewChargingSession(ue.Supi)
+	defer chfCtx.DeleteChargingSession(session.ChargingDataRef)
+	session.ChargingMode = ChargingModeOnline
+	session.SaveInvocation(2, &models.ChargingDataResponse{InvocationSequenceNumber: 2})
+	ue.Cdr[session.ChargingDataRef] = &cdrType.CHFRecord{}
+
+	data, err := marshalChfUe(ue)
+	require.NoError(t, err)
+
+	// The restored UE continues its Diameter sessions
+	restored, err := unmarshalChfUe(data)
+	require.NoError(t, err)
+	require.Equal(t, ue.AcctSessionId, restored.AcctSessionId)
+	require.Equal(t, ue.RateSessionId, restored.RateSessionId)
+	require.Equal(t, uint32(3), restored.AcctRequestNum[1])
+
+	// The restored charging session answers the retransmission of the last invocation
+	chfCtx.DeleteChargingSession(session.ChargingDataRef)
+	chfCtx.AddChargingSession(session.ChargingDataRef, ue.Supi, restored.restoredSessions[session.ChargingDataRef])
+	session, ok := chfCtx.ChargingSessionFindByRef(session.ChargingDataRef)
+	require.True(t, ok)
+	require.Equal(t, ChargingModeOnline, session.ChargingMode)
+	check, response := session.CheckInvocation(2)
+	require.Equal(t, InvocationRetransmitted, check)
+	require.Equal(t, int32(2), response.InvocationSequenceNumber)
+}
@@ -0,0 +1,80 @@
+package context
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/free5gc/chf/internal/logger"
+)
+
+// SpendingLimitSubscription is an individual Nchf_SpendingLimitControl subscription of a PCF, refer to TS 29.594
+type SpendingLimitSubscription struct {
+	SubscriptionId    string
+	Supi              string
+	Gpsi              string
+	NotifUri          string
+	NotifId           string
+	SupportedFeatures string
+	Expiry            *time.Time
+	// Empty means all the policy counters of the subscriber
+	PolicyCounterIds []string
+	// Last policy counter status reported to the PCF, keyed by policy counter id
+	ReportedStatus map[string]string
+
+	Lock sync.Mutex
+}
+
+func (s *SpendingLimitSubscription) Expired() bool {
+	return s.Expiry != nil && time.Now().After(*s.Expiry)
+}
+
+// NewSpendingLimitSubscription allocates the subscription, it fails once the subscription ids are used up.
+// The subscription is found by the notifications once added, after it is filled in.
+func (context *CHFContext) NewSpendingLimitSubscription(supi string) (*SpendingLimitSubscription, error) {
+	subscriptionId := GenerateSpendingLimitSubscriptionId()
+	if subscriptionId == "" {
+		return nil, fmt.Errorf("no spending limit subscription id available for UE[%s]", supi)
+	}
+
+	subscription := &SpendingLimitSubscription{
+		SubscriptionId: subscriptionId,
+		Supi:           supi,
+		ReportedStatus: make(map[string]string),
+	}
+	logger.CtxLog.Tracef("New spending limit subscription[%s] for UE[%s]", subscription.SubscriptionId, supi)
+
+	return subscription, nil
+}
+
+func (context *CHFContext) AddSpendingLimitSubscription(subscription *SpendingLimitSubscription) {
+	context.SpendingLimitSubscriptions.Store(subscription.SubscriptionId, subscription)
+}
+
+func (context *CHFContext) SpendingLimitSubscriptionFindById(subscriptionId string) (*SpendingLimitSubscription, bool) {
+	if value, ok := context.SpendingLimitSubscriptions.Load(subscriptionId); ok {
+		return value.(*SpendingLimitSubscription), ok
+	}
+	return nil, false
+}
+
+func (context *CHFContext) SpendingLimitSubscriptionsFindBySupi(supi string) []*SpendingLimitSubscription {
+	var subscriptions []*SpendingLimitSubscription
+
+	context.SpendingLimitSubscriptions.Range(func(key, value interface{}) bool {
+		subscription := value.(*SpendingLimitSubscription)
+		if subscription.Supi == supi {
+			subscriptions = append(subscriptions, subscription)
+		}
+		return true
+	})
+	return subscriptions
+}
+
+func (context *CHFContext) DeleteSpendingLimitSubscription(subscriptionId string) {
+	context.SpendingLimitSubscriptions.Delete(subscriptionId)
+	if id, err := strconv.ParseInt(subscriptionId, 10, 64); err == nil {
+		context.SpendingLimitIdGenerator.FreeID(id)
+	}
+}
@@ -0,0 +1,21 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpendingLimitSubscription(t *testing.T) {
+	subscription, err := chfCtx.NewSpendingLimitSubscription("imsi-208930000000001")
+	require.NoError(t, err)
+	defer chfCtx.DeleteSpendingLimitSubscription(subscription.SubscriptionId)
+
+	// The notifications do not find the subscription before it is filled in and added
+	require.Empty(t, chfCtx.SpendingLimitSubscriptionsFindBySupi("imsi-208930000000001"))
+	subscription.NotifUri = "http://pcf"
+	chfCtx.AddSpendingLimitSubscription(subscription)
+	found, ok := chfCtx.SpendingLimitSubscriptionFindById(subscription.SubscriptionId)
+	require.True(t, ok)
+	require.Equal(t, "http://pcf", found.NotifUri)
+}
@@ -4,14 +4,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/fiorix/go-diameter/diam"
-	"github.com/fiorix/go-diameter/diam/avp"
-	"github.com/fiorix/go-diameter/diam/datatype"
-	"github.com/fiorix/go-diameter/diam/dict"
-	"github.com/fiorix/go-diameter/diam/sm"
 	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
 	"github.com/free5gc/chf/cdr/cdrType"
 	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/chf/pkg/monetary"
 
 	"github.com/juju/fslock"
 )
@@ -21,27 +17,38 @@ type ChfUe struct {
 	RatingGroups []int32
 
 	QuotaValidityTime    int32
+	TimeLimit            int32
 	VolumeLimit          int32
 	VolumeLimitPDU       int32
 	VolumeThresholdRate  float32
+	TimeThresholdRate    float32
 	NotifyUri            string
 	RecordSequenceNumber int64
 
-	// ABMF
-	ReservedQuota  map[int32]int64
-	UnitCost       map[int32]uint32
+	// ABMF, the reserved quota is in the currency of the account and the unit cost in the currency of the tariff
+	ReservedQuota  map[int32]monetary.Value
+	UnitCost       map[int32]monetary.Value
+	UnitType       map[int32]charging_datatype.CCUnitType
 	AcctRequestNum map[int32]uint32
-	AbmfClient     *sm.Client
-	AbmfMux        *sm.StateMachine
-	AcctChan       chan *diam.Message
-	AcctSessionId  uint32
+	AcctSessionId  string
+
+	// the unit cost applied from the tariff switch time on
+	TariffSwitchTime map[int32]time.Time
+	NextUnitCost     map[int32]monetary.Value
+
+	// the unit cost applied once the valid units of the tariff are used, the free allowance or the tier
+	ValidUnits              map[int32]uint32
+	UnitCostAfterValidUnits map[int32]monetary.Value
 
 	// Rating
-	RatingClient  *sm.Client
-	RatingMux     *sm.StateMachine
-	RatingChan    chan *diam.Message
 	RatingType    map[int32]charging_datatype.RequestSubType
-	RateSessionId uint32
+	RateSessionId string
+
+	// time of the last charging data request, used to detect orphaned reservations
+	LastActivity time.Time
+
+	// the charging sessions loaded from the session store, until they are registered
+	restoredSessions map[string]*chargingSessionState
 
 	// lock
 	Cdr         map[string]*cdrType.CHFRecord
@@ -64,48 +71,31 @@ func (ue *ChfUe) init() {
 	ue.VolumeLimit = config.Configuration.VolumeLimit
 	ue.VolumeLimitPDU = config.Configuration.VolumeLimitPDU
 	ue.QuotaValidityTime = config.Configuration.QuotaValidityTime
+	ue.TimeLimit = config.Configuration.TimeLimit
 	ue.VolumeThresholdRate = config.Configuration.VolumeThresholdRate
+	// The configuration without a time threshold rate applies the volume one to the time quota
+	ue.TimeThresholdRate = config.Configuration.TimeThresholdRate
+	if ue.TimeThresholdRate == 0 {
+		ue.TimeThresholdRate = ue.VolumeThresholdRate
+	}
 	ue.AcctRequestNum = make(map[int32]uint32)
-	// This needed to be added if rating server do not locate in the same machine
-	// err := dict.Default.Load(bytes.NewReader([]byte(charging_dict.RateDictionary)))
-	// if err != nil {
-	// 	log.Fatal(err)
-	// }
-	ue.ReservedQuota = make(map[int32]int64)
-	ue.UnitCost = make(map[int32]uint32)
-
-	ue.RatingChan = make(chan *diam.Message)
-	ue.AcctChan = make(chan *diam.Message)
+	ue.ReservedQuota = make(map[int32]monetary.Value)
+	ue.UnitCost = make(map[int32]monetary.Value)
+	ue.UnitType = make(map[int32]charging_datatype.CCUnitType)
+	ue.TariffSwitchTime = make(map[int32]time.Time)
+	ue.NextUnitCost = make(map[int32]monetary.Value)
+	ue.ValidUnits = make(map[int32]uint32)
+	ue.UnitCostAfterValidUnits = make(map[int32]monetary.Value)
+
 	ue.RatingType = make(map[int32]charging_datatype.RequestSubType)
-	// Create the state machine (it's a diam.ServeMux) and client.
-	ue.RatingMux = sm.New(chfCtx.RatingCfg)
-	ue.RatingClient = &sm.Client{
-		Dict:               dict.Default,
-		Handler:            ue.RatingMux,
-		MaxRetransmits:     3,
-		RetransmitInterval: time.Second,
-		EnableWatchdog:     true,
-		WatchdogInterval:   5 * time.Second,
-		AuthApplicationID: []*diam.AVP{
-			// Advertise support for credit control application
-			diam.NewAVP(avp.AuthApplicationID, avp.Mbit, 0, datatype.Unsigned32(4)), // RFC 4006
-		},
-	}
+}
 
-	ue.AbmfMux = sm.New(chfCtx.AbmfCfg)
-	ue.AbmfClient = &sm.Client{
-		Dict:               dict.Default,
-		Handler:            ue.AbmfMux,
-		MaxRetransmits:     3,
-		RetransmitInterval: time.Second,
-		EnableWatchdog:     true,
-		WatchdogInterval:   5 * time.Second,
-		AuthApplicationID: []*diam.AVP{
-			// Advertise support for credit control application
-			diam.NewAVP(avp.AuthApplicationID, avp.Mbit, 0, datatype.Unsigned32(4)), // RFC 4006
-		},
+// The Diameter sessions of the UE towards the RF and the ABMF, kept by the restored UE
+func (ue *ChfUe) allocateSessionIds() {
+	if ue.RateSessionId == "" {
+		ue.RateSessionId = RatingSessionId(GenerateRatingSessionId())
+	}
+	if ue.AcctSessionId == "" {
+		ue.AcctSessionId = AccountSessionId(GenerateAccountSessionId())
 	}
-
-	ue.RateSessionId = GenerateRatingSessionId()
-	ue.AcctSessionId = GenerateAccountSessionId()
 }
@@ -0,0 +1,223 @@
+// Package diameter keeps the long-lived Diameter connections of the CHF to its peers, the RF and the ABMF
+package diameter
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/fiorix/go-diameter/diam/avp"
+	"github.com/fiorix/go-diameter/diam/datatype"
+	"github.com/fiorix/go-diameter/diam/dict"
+	"github.com/fiorix/go-diameter/diam/sm"
+	"github.com/fiorix/go-diameter/diam/sm/smpeer"
+
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+const reconnectInterval = 3 * time.Second
+
+type PeerState string
+
+const (
+	PeerStateDown       PeerState = "DOWN"
+	PeerStateConnecting PeerState = "CONNECTING"
+	PeerStateOpen       PeerState = "OPEN"
+)
+
+// Peer is a Diameter peer of the router, its requests are spread over a pool of connections,
+// each watched by the device watchdog and redialled once lost
+type Peer struct {
+	router   *Router
+	addr     string
+	realm    string
+	priority int
+
+	conns []*peerConn
+	next  uint32
+
+	stateLock sync.Mutex
+	state     PeerState
+	open      int
+}
+
+// A connection of the pool, each has a client of its own as the client handshake
+// registers its handlers on the state machine at every dial
+type peerConn struct {
+	client *sm.Client
+	lock   sync.RWMutex
+	conn   diam.Conn
+}
+
+func newPeer(router *Router, cfg factory.DiameterPeer, poolSize int) *Peer {
+	p := &Peer{
+		router:   router,
+		addr:     cfg.HostIPv4 + ":" + strconv.Itoa(cfg.Port),
+		realm:    cfg.Realm,
+		priority: cfg.Priority,
+		state:    PeerStateConnecting,
+	}
+	for i := 0; i < poolSize; i++ {
+		p.conns = append(p.conns, &peerConn{client: p.newClient()})
+	}
+	return p
+}
+
+func (p *Peer) newClient() *sm.Client {
+	mux := sm.New(p.router.settings)
+	for _, answer := range p.router.answers {
+		mux.Handle(answer, p.router.handleAnswer())
+	}
+
+	return &sm.Client{
+		Dict:               dict.Default,
+		Handler:            mux,
+		MaxRetransmits:     3,
+		RetransmitInterval: time.Second,
+		EnableWatchdog:     true,
+		WatchdogInterval:   5 * time.Second,
+		AuthApplicationID: []*diam.AVP{
+			// Advertise support for credit control application
+			diam.NewAVP(avp.AuthApplicationID, avp.Mbit, 0, datatype.Unsigned32(4)), // RFC 4006
+		},
+	}
+}
+
+func (p *Peer) String() string {
+	return fmt.Sprintf("%s %s", p.router.name, p.addr)
+}
+
+func (p *Peer) start() {
+	for _, pc := range p.conns {
+		p.router.wg.Add(1)
+		go p.maintain(pc)
+	}
+}
+
+// The next live connection of the pool in round robin
+func (p *Peer) conn() (diam.Conn, *smpeer.Metadata, bool) {
+	start := atomic.AddUint32(&p.next, 1)
+	for i := 0; i < len(p.conns); i++ {
+		pc := p.conns[(int(start)+i)%len(p.conns)]
+		pc.lock.RLock()
+		conn := pc.conn
+		pc.lock.RUnlock()
+		if conn == nil {
+			continue
+		}
+		if meta, ok := smpeer.FromContext(conn.Context()); ok {
+			return conn, meta, true
+		}
+	}
+	return nil, nil, false
+}
+
+// servesRealm tells whether the peer serves the realm, the realm of a peer without
+// configured realm is the Origin-Realm of its CEA
+func (p *Peer) servesRealm(realm string, meta *smpeer.Metadata) bool {
+	if realm == "" {
+		return true
+	}
+	if p.realm != "" {
+		return p.realm == realm
+	}
+	return string(meta.OriginRealm) == realm
+}
+
+// Keep the connection up, the watchdog closes it when the peer stops answering the DWR
+func (p *Peer) maintain(pc *peerConn) {
+	defer p.router.wg.Done()
+
+	for {
+		conn, err := p.dial(pc.client)
+		if err != nil {
+			p.router.log.Debugf("Dial %s failed: %+v", p, err)
+			p.dialFailed()
+			select {
+			case <-p.router.stop:
+				return
+			case <-time.After(reconnectInterval):
+				continue
+			}
+		}
+		pc.set(conn)
+		p.opened()
+
+		select {
+		case <-conn.(diam.CloseNotifier).CloseNotify():
+			pc.set(nil)
+			p.lost()
+		case <-p.router.stop:
+			pc.set(nil)
+			conn.Close()
+			p.lost()
+			return
+		}
+	}
+}
+
+// Dial over the protocol of the configuration, the TLS client certificate is optional
+func (p *Peer) dial(client *sm.Client) (diam.Conn, error) {
+	cfg := p.router.cfg
+	if !cfg.UseTls() {
+		return client.DialNetwork(cfg.Network(), p.addr)
+	}
+
+	var certFile, keyFile string
+	if cfg.Tls != nil {
+		certFile, keyFile = cfg.Tls.Pem, cfg.Tls.Key
+	}
+	return client.DialNetworkTLS(cfg.Network(), p.addr, certFile, keyFile)
+}
+
+// The peer is open while one of its connections is
+func (p *Peer) opened() {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.open++
+	p.setState(PeerStateOpen)
+}
+
+func (p *Peer) lost() {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.open--
+	if p.open == 0 {
+		p.setState(PeerStateDown)
+	}
+}
+
+func (p *Peer) dialFailed() {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	if p.open == 0 {
+		p.setState(PeerStateDown)
+	}
+}
+
+func (p *Peer) setState(state PeerState) {
+	if p.state == state {
+		return
+	}
+	if state == PeerStateDown {
+		p.router.log.Warnf("Peer %s state %s -> %s", p, p.state, state)
+	} else {
+		p.router.log.Infof("Peer %s state %s -> %s", p, p.state, state)
+	}
+	p.state = state
+}
+
+func (p *Peer) State() PeerState {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	return p.state
+}
+
+func (pc *peerConn) set(conn diam.Conn) {
+	pc.lock.Lock()
+	pc.conn = conn
+	pc.lock.Unlock()
+}
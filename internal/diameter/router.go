@@ -0,0 +1,322 @@
+package diameter
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/fiorix/go-diameter/diam/avp"
+	"github.com/fiorix/go-diameter/diam/datatype"
+	"github.com/fiorix/go-diameter/diam/sm"
+	"github.com/fiorix/go-diameter/diam/sm/smpeer"
+	"github.com/sirupsen/logrus"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+var answerTimeout = 5 * time.Second
+
+// The session without request that long is forgotten, e.g. the session never terminated as its
+// consumer is gone, its next request is routed as the one of a new session
+const sessionIdleTimeout = time.Hour
+
+// Router sends the requests of a Diameter application, e.g. the RF, to its peers.
+// A request goes to the open peer of the lowest priority value serving its Destination-Realm,
+// and the answers are correlated to their requests by the hop-by-hop and end-to-end identifiers,
+// RFC 6733 3. The requests of a session stay on the peer of the session and fail over to another
+// peer only when the session supports it, RFC 4006 5.7.
+type Router struct {
+	name     string
+	cfg      *factory.Diameter
+	settings *sm.Settings
+	answers  []string
+	log      *logrus.Entry
+
+	peers    []*Peer
+	hopByHop uint32
+	endToEnd uint32
+
+	pendingLock sync.Mutex
+	pending     map[transactionId]chan *diam.Message
+
+	sessionLock sync.Mutex
+	sessions    map[string]*session
+	lastSweep   time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type transactionId struct {
+	hopByHop uint32
+	endToEnd uint32
+}
+
+type session struct {
+	peer     *Peer
+	failover bool
+	lastUsed time.Time
+}
+
+// NewRouter creates the router of the configuration, the answers are the names of the
+// answer commands of the requests sent to the peers, e.g. "SUA"
+func NewRouter(name string, settings *sm.Settings, cfg *factory.Diameter, log *logrus.Entry,
+	answers ...string) *Router {
+	poolSize := cfg.PoolSize
+	if poolSize <= 0 {
+		poolSize = factory.DiameterDefaultPoolSize
+	}
+
+	r := &Router{
+		name:     name,
+		cfg:      cfg,
+		settings: settings,
+		answers:  answers,
+		log:      log,
+		pending:  make(map[transactionId]chan *diam.Message),
+		sessions: make(map[string]*session),
+		stop:     make(chan struct{}),
+		hopByHop: rand.Uint32(),
+		// RFC 6733 3: the high order 12 bits hold the low order bits of the time
+		endToEnd: uint32(time.Now().Unix()&0xfff)<<20 | rand.Uint32()&0xfffff,
+	}
+
+	peers := cfg.Peers
+	if len(peers) == 0 {
+		peers = []factory.DiameterPeer{{HostIPv4: cfg.HostIPv4, Port: cfg.Port}}
+	}
+	for _, peerCfg := range peers {
+		r.peers = append(r.peers, newPeer(r, peerCfg, poolSize))
+	}
+	sort.SliceStable(r.peers, func(i, j int) bool {
+		return r.peers[i].priority < r.peers[j].priority
+	})
+	return r
+}
+
+// Start dials the peers and keeps their connections up until Stop
+func (r *Router) Start() {
+	for _, peer := range r.peers {
+		peer.start()
+	}
+}
+
+// Stop closes the connections to the peers, the pending requests fail
+func (r *Router) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// Send sends the request of the session built by newRequest for the peer and waits for its answer.
+// The session is the key the requests stay on their peer with, e.g. the Session-Id and the rating group
+// of a credit control session numbering the requests of each rating group on their own.
+// A request without session may go to any peer and always fails over.
+// The request failing on its peer is sent again to the next peer with the T flag when the session
+// supports failover.
+func (r *Router) Send(sessionId, realm string,
+	newRequest func(meta *smpeer.Metadata) (*diam.Message, error)) (*diam.Message, error) {
+	if realm == "" {
+		realm = r.cfg.Realm
+	}
+
+	s := r.session(sessionId)
+	var endToEnd uint32
+	var tried []*Peer
+	var busyAnswer *diam.Message
+	for {
+		peer, conn, meta, err := r.route(s, realm, tried)
+		if err != nil {
+			if busyAnswer != nil {
+				return busyAnswer, nil
+			}
+			return nil, err
+		}
+
+		msg, err := newRequest(meta)
+		if err != nil {
+			return nil, err
+		}
+		msg.Header.HopByHopID = atomic.AddUint32(&r.hopByHop, 1)
+		if endToEnd == 0 {
+			endToEnd = atomic.AddUint32(&r.endToEnd, 1)
+		} else {
+			// RFC 6733 3: the request failed over keeps its end-to-end identifier
+			msg.Header.CommandFlags |= diam.RetransmittedFlag
+		}
+		msg.Header.EndToEndID = endToEnd
+
+		answer, err := r.exchange(conn, msg)
+		if err == nil && !(s.failover && unavailable(answer)) {
+			r.answered(sessionId, s, peer, answer)
+			return answer, nil
+		}
+
+		tried = append(tried, peer)
+		if err == nil {
+			// RFC 4006 5.7: the peer unable to deliver or too busy is failed over as well
+			busyAnswer = answer
+			err = fmt.Errorf("peer %s unavailable", peer)
+		} else if !s.failover {
+			return nil, err
+		}
+		r.log.Warnf("Request to %s failed, failing over: %+v", peer, err)
+	}
+}
+
+// EndSession forgets the peer of the terminated session
+func (r *Router) EndSession(sessionId string) {
+	r.sessionLock.Lock()
+	delete(r.sessions, sessionId)
+	r.sessionLock.Unlock()
+}
+
+// A copy of the state of the session, the configured one for a new session
+func (r *Router) session(sessionId string) session {
+	if sessionId == "" {
+		return session{failover: true}
+	}
+
+	r.sessionLock.Lock()
+	defer r.sessionLock.Unlock()
+	if s, ok := r.sessions[sessionId]; ok && time.Since(s.lastUsed) < sessionIdleTimeout {
+		return *s
+	}
+	return session{failover: r.cfg.SessionFailover}
+}
+
+// The session follows the peer answering it, the CC-Session-Failover of the answer overrides the configured one
+func (r *Router) answered(sessionId string, s session, peer *Peer, answer *diam.Message) {
+	if sessionId == "" {
+		return
+	}
+
+	s.peer = peer
+	if a, err := answer.FindAVP(avp.CCSessionFailover, 0); err == nil && a != nil {
+		if failover, ok := a.Data.(datatype.Enumerated); ok {
+			s.failover = charging_datatype.CcSessionFailover(failover) == charging_datatype.FAILOVER_SUPPORTED
+		}
+	}
+
+	now := time.Now()
+	s.lastUsed = now
+	r.sessionLock.Lock()
+	r.sessions[sessionId] = &s
+	r.sweepSessions(now)
+	r.sessionLock.Unlock()
+}
+
+// The idle sessions are removed lazily, at most once per idle timeout
+func (r *Router) sweepSessions(now time.Time) {
+	if now.Sub(r.lastSweep) < sessionIdleTimeout {
+		return
+	}
+	r.lastSweep = now
+	for sessionId, s := range r.sessions {
+		if now.Sub(s.lastUsed) >= sessionIdleTimeout {
+			delete(r.sessions, sessionId)
+		}
+	}
+}
+
+// The peer of the session while open, else the open peer of the lowest priority value serving the realm
+func (r *Router) route(s session, realm string, tried []*Peer) (*Peer, diam.Conn, *smpeer.Metadata, error) {
+	if s.peer != nil && len(tried) == 0 {
+		if conn, meta, ok := s.peer.conn(); ok {
+			return s.peer, conn, meta, nil
+		}
+		if !s.failover {
+			return nil, nil, nil, fmt.Errorf("peer %s of the session is down", s.peer)
+		}
+		tried = append(tried, s.peer)
+	}
+
+	for _, peer := range r.peers {
+		if containsPeer(tried, peer) {
+			continue
+		}
+		conn, meta, ok := peer.conn()
+		if !ok || !peer.servesRealm(realm, meta) {
+			continue
+		}
+		return peer, conn, meta, nil
+	}
+
+	if realm != "" {
+		return nil, nil, nil, fmt.Errorf("no %s peer available for realm %s", r.name, realm)
+	}
+	return nil, nil, nil, fmt.Errorf("no %s peer available", r.name)
+}
+
+func (r *Router) exchange(conn diam.Conn, msg *diam.Message) (*diam.Message, error) {
+	id := transactionId{hopByHop: msg.Header.HopByHopID, endToEnd: msg.Header.EndToEndID}
+	answerChan := make(chan *diam.Message, 1)
+	r.pendingLock.Lock()
+	r.pending[id] = answerChan
+	r.pendingLock.Unlock()
+	defer func() {
+		r.pendingLock.Lock()
+		delete(r.pending, id)
+		r.pendingLock.Unlock()
+	}()
+
+	if _, err := msg.WriteTo(conn); err != nil {
+		return nil, fmt.Errorf("Failed to send message to %s: %s", conn.RemoteAddr(), err)
+	}
+
+	select {
+	case m := <-answerChan:
+		return m, nil
+	case <-conn.(diam.CloseNotifier).CloseNotify():
+		return nil, fmt.Errorf("connection to %s lost", conn.RemoteAddr())
+	case <-time.After(answerTimeout):
+		return nil, fmt.Errorf("timeout: no answer received from %s", conn.RemoteAddr())
+	case <-r.stop:
+		return nil, fmt.Errorf("connection to %s closed", r.name)
+	}
+}
+
+func (r *Router) handleAnswer() diam.HandlerFunc {
+	return func(c diam.Conn, m *diam.Message) {
+		r.log.Tracef("Received answer %d from %s", m.Header.CommandCode, c.RemoteAddr())
+
+		id := transactionId{hopByHop: m.Header.HopByHopID, endToEnd: m.Header.EndToEndID}
+		r.pendingLock.Lock()
+		answerChan, ok := r.pending[id]
+		r.pendingLock.Unlock()
+		if !ok {
+			// The request has timed out or failed over
+			r.log.Warnf("Unexpected answer from %s: hop-by-hop %d, end-to-end %d",
+				c.RemoteAddr(), id.hopByHop, id.endToEnd)
+			return
+		}
+		select {
+		case answerChan <- m:
+		default:
+			r.log.Warnf("Duplicate answer from %s: hop-by-hop %d, end-to-end %d",
+				c.RemoteAddr(), id.hopByHop, id.endToEnd)
+		}
+	}
+}
+
+func unavailable(answer *diam.Message) bool {
+	a, err := answer.FindAVP(avp.ResultCode, 0)
+	if err != nil || a == nil {
+		return false
+	}
+	resultCode, ok := a.Data.(datatype.Unsigned32)
+	return ok && (resultCode == diam.UnableToDeliver || resultCode == diam.TooBusy)
+}
+
+func containsPeer(peers []*Peer, peer *Peer) bool {
+	for _, p := range peers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
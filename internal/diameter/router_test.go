@@ -0,0 +1,357 @@
+package diameter
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/fiorix/go-diameter/diam/avp"
+	"github.com/fiorix/go-diameter/diam/datatype"
+	"github.com/fiorix/go-diameter/diam/diamtest"
+	"github.com/fiorix/go-diameter/diam/dict"
+	"github.com/fiorix/go-diameter/diam/sm"
+	"github.com/fiorix/go-diameter/diam/sm/smpeer"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+// testPeer is a Diameter server answering the CCR with handle, by default with DIAMETER_SUCCESS
+type testPeer struct {
+	name string
+	srv  *diamtest.Server
+
+	lock     sync.Mutex
+	handle   func(c diam.Conn, m *diam.Message)
+	requests []*diam.Message
+}
+
+func newTestPeer(t *testing.T, name string) *testPeer {
+	p := &testPeer{name: name}
+	p.handle = func(c diam.Conn, m *diam.Message) {
+		p.answer(c, m, diam.Success)
+	}
+
+	mux := sm.New(&sm.Settings{
+		OriginHost:  datatype.DiameterIdentity(name),
+		OriginRealm: datatype.DiameterIdentity(name + ".realm"),
+		VendorID:    13,
+		ProductName: "peer",
+	})
+	mux.HandleFunc("CCR", func(c diam.Conn, m *diam.Message) {
+		p.lock.Lock()
+		p.requests = append(p.requests, m)
+		handle := p.handle
+		p.lock.Unlock()
+		handle(c, m)
+	})
+	p.srv = diamtest.NewServer(mux, dict.Default)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func (p *testPeer) setHandle(handle func(c diam.Conn, m *diam.Message)) {
+	p.lock.Lock()
+	p.handle = handle
+	p.lock.Unlock()
+}
+
+func (p *testPeer) received() []*diam.Message {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*diam.Message(nil), p.requests...)
+}
+
+// The answer carries the Origin-Host of the peer and the Session-Id of the request
+func (p *testPeer) answer(c diam.Conn, m *diam.Message, resultCode uint32, avps ...*diam.AVP) {
+	a := m.Answer(resultCode)
+	if sessionId, err := m.FindAVP(avp.SessionID, 0); err == nil {
+		a.AddAVP(sessionId)
+	}
+	a.NewAVP(avp.OriginHost, avp.Mbit, 0, datatype.DiameterIdentity(p.name))
+	for _, answerAVP := range avps {
+		a.AddAVP(answerAVP)
+	}
+	_, _ = a.WriteTo(c)
+}
+
+func (p *testPeer) config(priority int, realm string) factory.DiameterPeer {
+	host, port := splitAddr(p.srv.Addr)
+	return factory.DiameterPeer{HostIPv4: host, Port: port, Priority: priority, Realm: realm}
+}
+
+func splitAddr(addr string) (string, int) {
+	for i := len(addr) - 1; i >= 0; i-- {
+		if addr[i] == ':' {
+			port, _ := strconv.Atoi(addr[i+1:])
+			return addr[:i], port
+		}
+	}
+	return addr, 0
+}
+
+func newTestRouter(t *testing.T, sessionFailover bool, peers ...factory.DiameterPeer) *Router {
+	cfg := &factory.Diameter{
+		Protocol:        factory.DiameterProtocolTcp,
+		PoolSize:        1,
+		SessionFailover: sessionFailover,
+		Peers:           peers,
+	}
+	settings := &sm.Settings{
+		OriginHost:  "chf",
+		OriginRealm: "chf.realm",
+		VendorID:    13,
+		ProductName: "chf",
+	}
+	r := NewRouter("test", settings, cfg, logrus.NewEntry(logrus.New()), "CCA")
+	r.Start()
+	t.Cleanup(r.Stop)
+
+	require.Eventually(t, func() bool {
+		for _, peer := range r.peers {
+			if peer.State() != PeerStateOpen {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return r
+}
+
+func send(r *Router, sessionId, realm string) (*diam.Message, error) {
+	return r.Send(sessionId, realm, func(meta *smpeer.Metadata) (*diam.Message, error) {
+		m := diam.NewRequest(diam.CreditControl, 4, dict.Default)
+		m.NewAVP(avp.SessionID, avp.Mbit, 0, datatype.UTF8String(sessionId))
+		return m, nil
+	})
+}
+
+func originHostOf(t *testing.T, m *diam.Message) string {
+	a, err := m.FindAVP(avp.OriginHost, 0)
+	require.NoError(t, err)
+	return string(a.Data.(datatype.DiameterIdentity))
+}
+
+func resultCodeOf(t *testing.T, m *diam.Message) uint32 {
+	a, err := m.FindAVP(avp.ResultCode, 0)
+	require.NoError(t, err)
+	return uint32(a.Data.(datatype.Unsigned32))
+}
+
+func TestRouterAnswerCorrelation(t *testing.T) {
+	peer := newTestPeer(t, "peer")
+	// The first request is answered after the second one
+	peer.setHandle(func(c diam.Conn, m *diam.Message) {
+		if sessionId, err := m.FindAVP(avp.SessionID, 0); err == nil &&
+			sessionId.Data.(datatype.UTF8String) == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		peer.answer(c, m, diam.Success)
+	})
+	r := newTestRouter(t, false, peer.config(0, ""))
+
+	sessionIds := []string{"slow", "fast"}
+	answers := make([]*diam.Message, len(sessionIds))
+	errs := make([]error, len(sessionIds))
+	var wg sync.WaitGroup
+	for i, sessionId := range sessionIds {
+		wg.Add(1)
+		go func(i int, sessionId string) {
+			defer wg.Done()
+			answers[i], errs[i] = send(r, sessionId, "")
+		}(i, sessionId)
+		time.Sleep(50 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for i, sessionId := range sessionIds {
+		require.NoError(t, errs[i])
+		a, err := answers[i].FindAVP(avp.SessionID, 0)
+		require.NoError(t, err)
+		require.Equal(t, datatype.UTF8String(sessionId), a.Data)
+	}
+}
+
+func TestRouterDuplicateAnswer(t *testing.T) {
+	peer := newTestPeer(t, "peer")
+	peer.setHandle(func(c diam.Conn, m *diam.Message) {
+		peer.answer(c, m, diam.Success)
+		peer.answer(c, m, diam.TooBusy)
+	})
+	r := newTestRouter(t, false, peer.config(0, ""))
+
+	// The duplicate answer is dropped, the next request gets its own answer
+	for i := 0; i < 2; i++ {
+		answer, err := send(r, "session", "")
+		require.NoError(t, err)
+		require.Equal(t, uint32(diam.Success), resultCodeOf(t, answer))
+	}
+}
+
+func TestRouterPriorityAndRealm(t *testing.T) {
+	secondary := newTestPeer(t, "secondary")
+	primary := newTestPeer(t, "primary")
+	other := newTestPeer(t, "other")
+	r := newTestRouter(t, false,
+		secondary.config(2, "home"), primary.config(1, "home"), other.config(0, "visited"))
+
+	// The open peer of the lowest priority value serving the realm
+	answer, err := send(r, "home-session", "home")
+	require.NoError(t, err)
+	require.Equal(t, "primary", originHostOf(t, answer))
+
+	answer, err = send(r, "visited-session", "visited")
+	require.NoError(t, err)
+	require.Equal(t, "other", originHostOf(t, answer))
+
+	// The realm of a peer without configured realm is the Origin-Realm of its CEA
+	r = newTestRouter(t, false, secondary.config(0, ""))
+	answer, err = send(r, "session", "secondary.realm")
+	require.NoError(t, err)
+	require.Equal(t, "secondary", originHostOf(t, answer))
+
+	_, err = send(r, "other-session", "unknown")
+	require.Error(t, err)
+}
+
+// closeConn closes the connection of the request without answering it. go-diameter notices the lost
+// connection once it has read a message after the handshake, the peer answers a request before.
+func closeConn(c diam.Conn, m *diam.Message) {
+	c.Close()
+}
+
+func TestRouterFailover(t *testing.T) {
+	primary := newTestPeer(t, "primary")
+	secondary := newTestPeer(t, "secondary")
+	r := newTestRouter(t, true, primary.config(1, ""), secondary.config(2, ""))
+
+	answer, err := send(r, "session", "")
+	require.NoError(t, err)
+	require.Equal(t, "primary", originHostOf(t, answer))
+
+	// The request lost with its connection is sent again to the next peer with the T flag
+	primary.setHandle(closeConn)
+	answer, err = send(r, "session", "")
+	require.NoError(t, err)
+	require.Equal(t, "secondary", originHostOf(t, answer))
+
+	sent := primary.received()[1]
+	resent := secondary.received()[0]
+	require.Zero(t, sent.Header.CommandFlags&diam.RetransmittedFlag)
+	require.NotZero(t, resent.Header.CommandFlags&diam.RetransmittedFlag)
+	require.Equal(t, sent.Header.EndToEndID, resent.Header.EndToEndID)
+	require.NotEqual(t, sent.Header.HopByHopID, resent.Header.HopByHopID)
+
+	// The session stays on the peer answering it
+	answer, err = send(r, "session", "")
+	require.NoError(t, err)
+	require.Equal(t, "secondary", originHostOf(t, answer))
+	require.Len(t, primary.received(), 2)
+}
+
+func TestRouterSessionFailover(t *testing.T) {
+	primary := newTestPeer(t, "primary")
+	secondary := newTestPeer(t, "secondary")
+	r := newTestRouter(t, false, primary.config(1, ""), secondary.config(2, ""))
+
+	// The session without failover fails with its peer
+	_, err := send(r, "session", "")
+	require.NoError(t, err)
+	primary.setHandle(closeConn)
+	_, err = send(r, "session", "")
+	require.Error(t, err)
+	require.Empty(t, secondary.received())
+
+	// The CC-Session-Failover of the answer overrides the configured one
+	primary = newTestPeer(t, "primary")
+	secondary = newTestPeer(t, "secondary")
+	r = newTestRouter(t, false, primary.config(1, ""), secondary.config(2, ""))
+	primary.setHandle(func(c diam.Conn, m *diam.Message) {
+		primary.answer(c, m, diam.Success, diam.NewAVP(avp.CCSessionFailover, avp.Mbit, 0,
+			datatype.Enumerated(charging_datatype.FAILOVER_SUPPORTED)))
+	})
+	_, err = send(r, "session", "")
+	require.NoError(t, err)
+	primary.setHandle(closeConn)
+	answer, err := send(r, "session", "")
+	require.NoError(t, err)
+	require.Equal(t, "secondary", originHostOf(t, answer))
+
+	// The terminated session forgets its peer and failover, a request without session id always fails over
+	r.EndSession("session")
+	require.Equal(t, session{failover: false}, r.session("session"))
+	require.Equal(t, session{failover: true}, r.session(""))
+}
+
+func TestRouterSessionIdle(t *testing.T) {
+	primary := newTestPeer(t, "primary")
+	r := newTestRouter(t, false, primary.config(1, ""))
+
+	_, err := send(r, "session", "")
+	require.NoError(t, err)
+	require.Equal(t, r.peers[0], r.session("session").peer)
+
+	// The idle session is forgotten, and removed with the next answer
+	r.sessionLock.Lock()
+	r.sessions["session"].lastUsed = time.Now().Add(-sessionIdleTimeout)
+	r.lastSweep = time.Time{}
+	r.sessionLock.Unlock()
+	require.Equal(t, session{failover: false}, r.session("session"))
+
+	_, err = send(r, "other", "")
+	require.NoError(t, err)
+	r.sessionLock.Lock()
+	require.NotContains(t, r.sessions, "session")
+	require.Contains(t, r.sessions, "other")
+	r.sessionLock.Unlock()
+}
+
+func TestRouterBusyAnswer(t *testing.T) {
+	primary := newTestPeer(t, "primary")
+	secondary := newTestPeer(t, "secondary")
+	r := newTestRouter(t, true, primary.config(1, ""), secondary.config(2, ""))
+
+	// The busy peer is failed over
+	primary.setHandle(func(c diam.Conn, m *diam.Message) {
+		primary.answer(c, m, diam.TooBusy)
+	})
+	answer, err := send(r, "session", "")
+	require.NoError(t, err)
+	require.Equal(t, "secondary", originHostOf(t, answer))
+	require.Equal(t, uint32(diam.Success), resultCodeOf(t, answer))
+
+	// The busy answer is the answer when no peer is left
+	secondary.setHandle(func(c diam.Conn, m *diam.Message) {
+		secondary.answer(c, m, diam.UnableToDeliver)
+	})
+	answer, err = send(r, "", "")
+	require.NoError(t, err)
+	require.Equal(t, uint32(diam.UnableToDeliver), resultCodeOf(t, answer))
+}
+
+func TestRouterTimeout(t *testing.T) {
+	timeout := answerTimeout
+	answerTimeout = 100 * time.Millisecond
+	defer func() {
+		answerTimeout = timeout
+	}()
+
+	peer := newTestPeer(t, "peer")
+	peer.setHandle(func(c diam.Conn, m *diam.Message) {})
+	r := newTestRouter(t, false, peer.config(0, ""))
+
+	_, err := send(r, "session", "")
+	require.ErrorContains(t, err, "timeout")
+
+	// The session goes on once the peer answers again
+	peer.setHandle(func(c diam.Conn, m *diam.Message) {
+		peer.answer(c, m, diam.Success)
+	})
+	answer, err := send(r, "session", "")
+	require.NoError(t, err)
+	require.Equal(t, uint32(diam.Success), resultCodeOf(t, answer))
+}
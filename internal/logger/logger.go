@@ -22,6 +22,7 @@ var (
 	GinLog              *logrus.Entry
 	ChargingdataPostLog *logrus.Entry
 	NotifyEventLog      *logrus.Entry
+	SpendingLimitLog    *logrus.Entry
 	RechargingLog       *logrus.Entry
 	RatingLog           *logrus.Entry
 	AcctLog             *logrus.Entry
@@ -52,6 +53,7 @@ func init() {
 	GinLog = log.WithFields(logrus.Fields{"component": "CHF", "category": "GIN"})
 	ChargingdataPostLog = log.WithFields(logrus.Fields{"component": "CHF", "category": "ChargingdataPost"})
 	NotifyEventLog = log.WithFields(logrus.Fields{"component": "CHF", "category": "NotifyEvent"})
+	SpendingLimitLog = log.WithFields(logrus.Fields{"component": "CHF", "category": "SpendingLimit"})
 	RechargingLog = log.WithFields(logrus.Fields{"component": "CHF", "category": "Recharging"})
 	CgfLog = log.WithFields(logrus.Fields{"component": "CHF", "category": "Cgf"})
 	RatingLog = log.WithFields(logrus.Fields{"component": "CHF", "category": "Rating"})
@@ -2,11 +2,6 @@ package rating
 
 import (
 	"fmt"
-	"strconv"
-	"time"
-
-	chf_context "github.com/free5gc/chf/internal/context"
-	"github.com/free5gc/chf/pkg/factory"
 
 	"github.com/fiorix/go-diameter/diam"
 	"github.com/fiorix/go-diameter/diam/datatype"
@@ -14,54 +9,32 @@ import (
 	"github.com/fiorix/go-diameter/diam/sm/smpeer"
 	charging_code "github.com/free5gc/chf/ccs_diameter/code"
 	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
-	"github.com/free5gc/chf/internal/logger"
+	chf_context "github.com/free5gc/chf/internal/context"
 )
 
-func SendServiceUsageRequest(ue *chf_context.ChfUe, sur *charging_datatype.ServiceUsageRequest) (*charging_datatype.ServiceUsageResponse, error) {
-	ue.RatingMux.Handle("SUA", HandleSUA(ue.RatingChan))
-	rfDiameter := factory.ChfConfig.Configuration.RfDiameter
-	addr := rfDiameter.HostIPv4 + ":" + strconv.Itoa(rfDiameter.Port)
-	conn, err := ue.RatingClient.DialNetworkTLS(rfDiameter.Protocol, addr, rfDiameter.Tls.Pem, rfDiameter.Tls.Key)
-	if err != nil {
-		return nil, err
-	}
-
-	meta, ok := smpeer.FromContext(conn.Context())
-	if !ok {
-		return nil, fmt.Errorf("peer metadata unavailable")
-	}
-
-	sur.DestinationRealm = datatype.DiameterIdentity(meta.OriginRealm)
-	sur.DestinationHost = datatype.DiameterIdentity(meta.OriginHost)
+func SendServiceUsageRequest(sur *charging_datatype.ServiceUsageRequest) (*charging_datatype.ServiceUsageResponse, error) {
+	// The rating is stateless, every request may go to any RF
+	m, err := chf_context.CHF_Self().RatingRouter.Send("", string(sur.DestinationRealm), func(meta *smpeer.Metadata) (*diam.Message, error) {
+		sur.DestinationRealm = datatype.DiameterIdentity(meta.OriginRealm)
+		sur.DestinationHost = datatype.DiameterIdentity(meta.OriginHost)
 
-	msg := diam.NewRequest(charging_code.ServiceUsageMessage, charging_code.Re_interface, dict.Default)
-	err = msg.Marshal(sur)
+		msg := diam.NewRequest(charging_code.ServiceUsageMessage, charging_code.Re_interface, dict.Default)
+		if err := msg.Marshal(sur); err != nil {
+			return nil, fmt.Errorf("Marshal SUR Failed: %s\n", err)
+		}
+		return msg, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Marshal SUR Failed: %s\n", err)
+		return nil, err
 	}
 
-	_, err = msg.WriteTo(conn)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to send message from %s: %s\n",
-			conn.RemoteAddr(), err)
+	var sua charging_datatype.ServiceUsageResponse
+	if err := m.Unmarshal(&sua); err != nil {
+		return nil, fmt.Errorf("Failed to parse message from %v", err)
 	}
-
-	select {
-	case m := <-ue.RatingChan:
-		var sua charging_datatype.ServiceUsageResponse
-		if err := m.Unmarshal(&sua); err != nil {
-			return nil, fmt.Errorf("Failed to parse message from %v", err)
-		}
-		return &sua, nil
-	case <-time.After(5 * time.Second):
-		return nil, fmt.Errorf("timeout: no rate answer received")
-	}
-}
-
-func HandleSUA(rgChan chan *diam.Message) diam.HandlerFunc {
-	return func(c diam.Conn, m *diam.Message) {
-		logger.RatingLog.Tracef("Received SUA from %s", c.RemoteAddr())
-
-		rgChan <- m
+	// The RF answers without service rating when it fails to rate the usage
+	if sua.ServiceRating == nil {
+		return nil, fmt.Errorf("no service rating in SUA")
 	}
+	return &sua, nil
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/free5gc/chf/internal/logger"
 	"github.com/free5gc/chf/internal/sbi/producer"
+	"github.com/free5gc/openapi/models"
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,14 +15,31 @@ func RechargeGet(c *gin.Context) {
 	c.String(http.StatusOK, "recharge")
 }
 
+// RechargePut notifies the charging sessions of the recharged rating group, the recharging info is <ueId>_<rg>.
+// The balance itself is topped up through the account API.
 func RechargePut(c *gin.Context) {
 	rechargingInfo := c.Param("rechargingInfo")
-	ueIdRatingGroup := strings.Split(rechargingInfo, "_")
-	ueId := ueIdRatingGroup[0]
-	rgStr := ueIdRatingGroup[1]
-	rg, err := strconv.Atoi(rgStr)
+	sep := strings.LastIndex(rechargingInfo, "_")
+	if sep == -1 {
+		logger.RechargingLog.Errorf("Invalid recharging info %s", rechargingInfo)
+		c.JSON(http.StatusBadRequest, models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_INCORRECT",
+			Detail: "the recharging info is <ueId>_<ratingGroup>",
+		})
+		return
+	}
+	ueId := rechargingInfo[:sep]
+	rgStr := rechargingInfo[sep+1:]
+	rg, err := strconv.ParseInt(rgStr, 10, 32)
 	if err != nil {
-		logger.RechargingLog.Error("UE[%s] fail to recharge for rating group %s", ueId, rgStr)
+		logger.RechargingLog.Errorf("UE[%s] fail to recharge for rating group %s", ueId, rgStr)
+		c.JSON(http.StatusBadRequest, models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_INCORRECT",
+			Detail: "invalid rating group " + rgStr,
+		})
+		return
 	}
 
 	logger.RechargingLog.Warnf("UE[%s] Recharg for rating group %d", ueId, rg)
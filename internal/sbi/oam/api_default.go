@@ -0,0 +1,185 @@
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/internal/sbi/producer"
+	"github.com/free5gc/chf/pkg/account"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/httpwrapper"
+)
+
+// ChargingSessionGet - retrieve the charging session by ChargingDataRef
+func ChargingSessionGet(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["ChargingDataRef"] = c.Param("ChargingDataRef")
+
+	rsp := producer.HandleGetChargingSession(req)
+	sendResponse(c, rsp)
+}
+
+// ChargingSessionDelete - force terminate the charging session by management intervention
+func ChargingSessionDelete(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["ChargingDataRef"] = c.Param("ChargingDataRef")
+
+	rsp := producer.HandleTerminateChargingSession(req)
+	sendResponse(c, rsp)
+}
+
+// BalanceGet - check the account balance of the rating group
+func BalanceGet(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["supi"] = c.Param("supi")
+	req.Params["ratingGroup"] = c.Param("ratingGroup")
+
+	rsp := producer.HandleGetBalance(req)
+	sendResponse(c, rsp)
+}
+
+// PriceEnquiryGet - advice of charge of the units of the rating group
+func PriceEnquiryGet(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["supi"] = c.Param("supi")
+	req.Params["ratingGroup"] = c.Param("ratingGroup")
+
+	rsp := producer.HandleGetPriceEnquiry(req)
+	sendResponse(c, rsp)
+}
+
+// AccountPost - create the account with its balances
+func AccountPost(c *gin.Context) {
+	var acct account.Account
+	if !deserializeBody(c, &acct) {
+		return
+	}
+
+	req := httpwrapper.NewRequest(c.Request, acct)
+	rsp := producer.HandleCreateAccount(req)
+	sendResponse(c, rsp)
+}
+
+// AccountGet - retrieve the account with its balances
+func AccountGet(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["supi"] = c.Param("supi")
+
+	rsp := producer.HandleGetAccount(req)
+	sendResponse(c, rsp)
+}
+
+// AccountDelete - delete the account with its balances and transaction history
+func AccountDelete(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["supi"] = c.Param("supi")
+
+	rsp := producer.HandleDeleteAccount(req)
+	sendResponse(c, rsp)
+}
+
+// AccountBalancePost - add the balance of a rating group to the account
+func AccountBalancePost(c *gin.Context) {
+	var balance account.Balance
+	if !deserializeBody(c, &balance) {
+		return
+	}
+
+	req := httpwrapper.NewRequest(c.Request, balance)
+	req.Params["supi"] = c.Param("supi")
+
+	rsp := producer.HandleAddBalance(req)
+	sendResponse(c, rsp)
+}
+
+// AccountBalanceDelete - remove the balance of the rating group from the account
+func AccountBalanceDelete(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["supi"] = c.Param("supi")
+	req.Params["ratingGroup"] = c.Param("ratingGroup")
+
+	rsp := producer.HandleDeleteBalance(req)
+	sendResponse(c, rsp)
+}
+
+// AccountTopUpPost - top up the balance of the rating group
+func AccountTopUpPost(c *gin.Context) {
+	var topUpRequest producer.TopUpRequest
+	if !deserializeBody(c, &topUpRequest) {
+		return
+	}
+
+	req := httpwrapper.NewRequest(c.Request, topUpRequest)
+	req.Params["supi"] = c.Param("supi")
+	req.Params["ratingGroup"] = c.Param("ratingGroup")
+
+	rsp := producer.HandleTopUp(req)
+	sendResponse(c, rsp)
+}
+
+// AccountTransactionsGet - retrieve the transaction history of the account
+func AccountTransactionsGet(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["supi"] = c.Param("supi")
+
+	rsp := producer.HandleGetTransactions(req)
+	sendResponse(c, rsp)
+}
+
+// AccountReservationsGet - retrieve the outstanding reservations of the account
+func AccountReservationsGet(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["supi"] = c.Param("supi")
+
+	rsp := producer.HandleGetReservations(req)
+	sendResponse(c, rsp)
+}
+
+func deserializeBody(c *gin.Context, body interface{}) bool {
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.GinLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return false
+	}
+
+	if err := openapi.Deserialize(body, requestBody, "application/json"); err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.GinLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return false
+	}
+	return true
+}
+
+func sendResponse(c *gin.Context, rsp *httpwrapper.Response) {
+	for key, value := range rsp.Header {
+		c.Header(key, value[0])
+	}
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.GinLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
@@ -0,0 +1,34 @@
+package oam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/sbi/producer"
+)
+
+func TestChargingSessionGet(t *testing.T) {
+	self := chf_context.CHF_Self()
+	session := self.NewChargingSession("imsi-208930000000001")
+	defer self.DeleteChargingSession(session.ChargingDataRef)
+	router := NewRouter()
+
+	// The session is looked up by its ChargingDataRef
+	rsp := httptest.NewRecorder()
+	router.ServeHTTP(rsp, httptest.NewRequest(http.MethodGet,
+		"/nchf-oam/v1/charging-sessions/"+session.ChargingDataRef, nil))
+	require.Equal(t, http.StatusOK, rsp.Code)
+	var info producer.ChargingSessionInfo
+	require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &info))
+	require.Equal(t, session.ChargingDataRef, info.ChargingDataRef)
+	require.Equal(t, "imsi-208930000000001", info.Supi)
+
+	rsp = httptest.NewRecorder()
+	router.ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/nchf-oam/v1/charging-sessions/unknown", nil))
+	require.Equal(t, http.StatusNotFound, rsp.Code)
+}
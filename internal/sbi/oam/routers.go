@@ -0,0 +1,151 @@
+package oam
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/chf/internal/logger"
+	logger_util "github.com/free5gc/util/logger"
+)
+
+// Route is the information for every URI.
+type Route struct {
+	// Name is the name of this Route.
+	Name string
+	// Method is the string for the HTTP method. ex) GET, POST etc..
+	Method string
+	// Pattern is the pattern of the URI.
+	Pattern string
+	// HandlerFunc is the handler function of this route.
+	HandlerFunc gin.HandlerFunc
+}
+
+// Routes is the list of the generated Route.
+type Routes []Route
+
+// NewRouter returns a new router.
+func NewRouter() *gin.Engine {
+	router := logger_util.NewGinWithLogrus(logger.GinLog)
+	AddService(router)
+	return router
+}
+
+func AddService(engine *gin.Engine) *gin.RouterGroup {
+	group := engine.Group("/nchf-oam/v1")
+
+	for _, route := range routes {
+		switch route.Method {
+		case "GET":
+			group.GET(route.Pattern, route.HandlerFunc)
+		case "POST":
+			group.POST(route.Pattern, route.HandlerFunc)
+		case "PUT":
+			group.PUT(route.Pattern, route.HandlerFunc)
+		case "DELETE":
+			group.DELETE(route.Pattern, route.HandlerFunc)
+		case "PATCH":
+			group.PATCH(route.Pattern, route.HandlerFunc)
+		}
+	}
+	return group
+}
+
+// Index is the index handler.
+func Index(c *gin.Context) {
+	c.String(http.StatusOK, "Hello World!")
+}
+
+var routes = Routes{
+	{
+		"Index",
+		"GET",
+		"/",
+		Index,
+	},
+
+	{
+		"ChargingSessionGet",
+		strings.ToUpper("Get"),
+		"/charging-sessions/:ChargingDataRef",
+		ChargingSessionGet,
+	},
+
+	{
+		"ChargingSessionDelete",
+		strings.ToUpper("Delete"),
+		"/charging-sessions/:ChargingDataRef",
+		ChargingSessionDelete,
+	},
+
+	{
+		"BalanceGet",
+		strings.ToUpper("Get"),
+		"/balances/:supi/:ratingGroup",
+		BalanceGet,
+	},
+
+	{
+		"PriceEnquiryGet",
+		strings.ToUpper("Get"),
+		"/price-enquiry/:supi/:ratingGroup",
+		PriceEnquiryGet,
+	},
+
+	{
+		"AccountPost",
+		strings.ToUpper("Post"),
+		"/accounts",
+		AccountPost,
+	},
+
+	{
+		"AccountGet",
+		strings.ToUpper("Get"),
+		"/accounts/:supi",
+		AccountGet,
+	},
+
+	{
+		"AccountDelete",
+		strings.ToUpper("Delete"),
+		"/accounts/:supi",
+		AccountDelete,
+	},
+
+	{
+		"AccountBalancePost",
+		strings.ToUpper("Post"),
+		"/accounts/:supi/balances",
+		AccountBalancePost,
+	},
+
+	{
+		"AccountBalanceDelete",
+		strings.ToUpper("Delete"),
+		"/accounts/:supi/balances/:ratingGroup",
+		AccountBalanceDelete,
+	},
+
+	{
+		"AccountTopUpPost",
+		strings.ToUpper("Post"),
+		"/accounts/:supi/balances/:ratingGroup/top-ups",
+		AccountTopUpPost,
+	},
+
+	{
+		"AccountTransactionsGet",
+		strings.ToUpper("Get"),
+		"/accounts/:supi/transactions",
+		AccountTransactionsGet,
+	},
+
+	{
+		"AccountReservationsGet",
+		strings.ToUpper("Get"),
+		"/accounts/:supi/reservations",
+		AccountReservationsGet,
+	},
+}
@@ -0,0 +1,171 @@
+package producer
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/account"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/httpwrapper"
+)
+
+// TopUpRequest is the money added to a balance, the expiry date replaces the one of the balance
+type TopUpRequest struct {
+	Amount       string     `json:"amount"`
+	CurrencyCode uint32     `json:"currencyCode,omitempty"`
+	ExpiryDate   *time.Time `json:"expiryDate,omitempty"`
+}
+
+func HandleCreateAccount(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleCreateAccount")
+	acct := request.Body.(account.Account)
+
+	if err := account.Create(&acct); err != nil {
+		return accountErrorResponse(err)
+	}
+	header := http.Header{"Location": {"/nchf-oam/v1/accounts/" + acct.Supi}}
+	return httpwrapper.NewResponse(http.StatusCreated, header, acct)
+}
+
+func HandleGetAccount(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleGetAccount")
+
+	acct, err := account.Get(request.Params["supi"])
+	if err != nil {
+		return accountErrorResponse(err)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, acct)
+}
+
+func HandleDeleteAccount(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleDeleteAccount")
+
+	if err := account.Delete(request.Params["supi"]); err != nil {
+		return accountErrorResponse(err)
+	}
+	return httpwrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+func HandleAddBalance(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleAddBalance")
+	balance := request.Body.(account.Balance)
+
+	if err := account.AddBalance(request.Params["supi"], &balance); err != nil {
+		return accountErrorResponse(err)
+	}
+	return httpwrapper.NewResponse(http.StatusCreated, nil, balance)
+}
+
+func HandleDeleteBalance(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleDeleteBalance")
+	ratingGroup, err := strconv.ParseUint(request.Params["ratingGroup"], 10, 32)
+	if err != nil {
+		return badRequest("invalid rating group")
+	}
+
+	if err := account.DeleteBalance(request.Params["supi"], uint32(ratingGroup)); err != nil {
+		return accountErrorResponse(err)
+	}
+	return httpwrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+// HandleTopUp adds the money to the balance, the charging sessions of the subscriber
+// using the rating group are reauthorized to get quota from the new balance
+func HandleTopUp(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleTopUp")
+	supi := request.Params["supi"]
+	topUpRequest := request.Body.(TopUpRequest)
+	ratingGroup, err := strconv.ParseUint(request.Params["ratingGroup"], 10, 32)
+	if err != nil {
+		return badRequest("invalid rating group")
+	}
+
+	currencyCode := topUpRequest.CurrencyCode
+	if currencyCode == 0 {
+		currencyCode = monetary.DefaultCurrencyCode
+	}
+	amount, err := monetary.Parse(topUpRequest.Amount, currencyCode)
+	if err != nil {
+		return badRequest("invalid amount")
+	}
+
+	balance, err := account.TopUp(supi, uint32(ratingGroup), amount, topUpRequest.ExpiryDate)
+	if err != nil {
+		return accountErrorResponse(err)
+	}
+	logger.RechargingLog.Infof("UE[%s] topped up %s for rating group %d, balance %s",
+		supi, amount, ratingGroup, balance.Balance)
+
+	notifyTopUp(supi, int32(ratingGroup))
+	return httpwrapper.NewResponse(http.StatusOK, nil, balance)
+}
+
+func HandleGetTransactions(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleGetTransactions")
+
+	transactions, err := account.Transactions(request.Params["supi"])
+	if err != nil {
+		return accountErrorResponse(err)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, transactions)
+}
+
+// HandleGetReservations lists the money reserved by the charging sessions of the subscriber
+func HandleGetReservations(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.RechargingLog.Infof("HandleGetReservations")
+
+	reservations, err := account.Reservations(request.Params["supi"])
+	if err != nil {
+		return accountErrorResponse(err)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, reservations)
+}
+
+// Only the subscriber with a charging session of the rating group is reauthorized
+func notifyTopUp(supi string, ratingGroup int32) {
+	ue, ok := chf_context.CHF_Self().ChfUeFindBySupi(supi)
+	if !ok {
+		return
+	}
+
+	ue.CULock.Lock()
+	active := false
+	for _, rg := range ue.RatingGroups {
+		if rg == ratingGroup {
+			active = true
+			break
+		}
+	}
+	ue.CULock.Unlock()
+
+	if active {
+		go NotifyRecharge(supi, ratingGroup)
+	}
+}
+
+func accountErrorResponse(err error) *httpwrapper.Response {
+	problemDetails := &models.ProblemDetails{
+		Status: http.StatusInternalServerError,
+		Cause:  "SYSTEM_FAILURE",
+		Detail: err.Error(),
+	}
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound), errors.Is(err, account.ErrBalanceNotFound):
+		problemDetails.Status = http.StatusNotFound
+		problemDetails.Cause = "CONTEXT_NOT_FOUND"
+	case errors.Is(err, account.ErrAccountExists), errors.Is(err, account.ErrBalanceExists):
+		problemDetails.Status = http.StatusConflict
+		problemDetails.Cause = "CONTEXT_ALREADY_EXISTS"
+	case errors.Is(err, account.ErrInvalidRequest), errors.Is(err, account.ErrExpiryDateRequired):
+		problemDetails.Status = http.StatusBadRequest
+		problemDetails.Cause = "MANDATORY_IE_INCORRECT"
+	default:
+		logger.RechargingLog.Errorf("Account error: %+v", err)
+	}
+	return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+}
@@ -0,0 +1,216 @@
+package producer
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam/datatype"
+	charging_code "github.com/free5gc/chf/ccs_diameter/code"
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/internal/abmf"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/identity"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/httpwrapper"
+)
+
+// BalanceInfo is the account balance of the rating group exposed by the OAM API
+type BalanceInfo struct {
+	Supi         string `json:"supi"`
+	RatingGroup  int32  `json:"ratingGroup"`
+	Balance      string `json:"balance"`
+	CurrencyCode uint32 `json:"currencyCode"`
+	// Whether the balance covers the amount of the balance check, if any
+	Sufficient *bool `json:"sufficient,omitempty"`
+}
+
+// PriceInfo is the advice of charge of the units of the rating group exposed by the OAM API
+type PriceInfo struct {
+	Supi         string `json:"supi"`
+	RatingGroup  int32  `json:"ratingGroup"`
+	Units        uint64 `json:"units"`
+	Price        string `json:"price"`
+	CurrencyCode uint32 `json:"currencyCode"`
+}
+
+func HandleGetBalance(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ChargingdataPostLog.Infof("HandleGetBalance")
+	supi := request.Params["supi"]
+	ratingGroup, err := strconv.ParseInt(request.Params["ratingGroup"], 10, 32)
+	if err != nil {
+		return badRequest("invalid rating group")
+	}
+
+	var amount *monetary.Value
+	if amountStr := request.Query.Get("amount"); amountStr != "" {
+		currencyCode := uint32(monetary.DefaultCurrencyCode)
+		if currencyStr := request.Query.Get("currencyCode"); currencyStr != "" {
+			code, err := strconv.ParseUint(currencyStr, 10, 32)
+			if err != nil {
+				return badRequest("invalid currency code")
+			}
+			currencyCode = uint32(code)
+		}
+		value, err := monetary.Parse(amountStr, currencyCode)
+		if err != nil {
+			return badRequest("invalid amount")
+		}
+		amount = &value
+	}
+
+	response, problemDetails := CheckBalance(supi, int32(ratingGroup), amount)
+	if response != nil {
+		return httpwrapper.NewResponse(http.StatusOK, nil, response)
+	}
+	return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+}
+
+func HandleGetPriceEnquiry(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ChargingdataPostLog.Infof("HandleGetPriceEnquiry")
+	supi := request.Params["supi"]
+	ratingGroup, err := strconv.ParseInt(request.Params["ratingGroup"], 10, 32)
+	if err != nil {
+		return badRequest("invalid rating group")
+	}
+	units, err := strconv.ParseUint(request.Query.Get("units"), 10, 32)
+	if err != nil {
+		return badRequest("invalid units")
+	}
+
+	response, problemDetails := EnquirePrice(supi, int32(ratingGroup), units)
+	if response != nil {
+		return httpwrapper.NewResponse(http.StatusOK, nil, response)
+	}
+	return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+}
+
+// CheckBalance asks the ABMF for the balance of the rating group with a balance check event,
+// RFC 4006 5.3.2, the balance is left as is
+func CheckBalance(supi string, ratingGroup int32, amount *monetary.Value) (*BalanceInfo, *models.ProblemDetails) {
+	mscc := &charging_datatype.MultipleServicesCreditControl{
+		RatingGroup: datatype.Unsigned32(ratingGroup),
+	}
+	if amount != nil {
+		mscc.RequestedServiceUnit = &charging_datatype.RequestedServiceUnit{
+			CCMoney: amount.CCMoney(),
+		}
+	}
+
+	cca, problemDetails := sendEventRequest(supi, charging_datatype.CHECK_BALANCE, mscc)
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+	if cca.RemainingBalance == nil {
+		return nil, &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: "no remaining balance in the answer of the ABMF",
+		}
+	}
+
+	balance := monetary.FromCCMoney(&charging_datatype.CCMoney{
+		UnitValue:    cca.RemainingBalance.UnitValue,
+		CurrencyCode: cca.RemainingBalance.CurrencyCode,
+	})
+	info := &BalanceInfo{
+		Supi:         supi,
+		RatingGroup:  ratingGroup,
+		Balance:      balance.String(),
+		CurrencyCode: balance.CurrencyCode,
+	}
+	if amount != nil && cca.MultipleServicesCreditControl != nil {
+		sufficient := cca.MultipleServicesCreditControl.ResultCode != charging_code.CreditLimitReached
+		info.Sufficient = &sufficient
+	}
+	return info, nil
+}
+
+// EnquirePrice asks the ABMF for the price of the units of the rating group with a price enquiry event,
+// RFC 4006 5.3.3, the ABMF consults the rating function and the account is not debited
+func EnquirePrice(supi string, ratingGroup int32, units uint64) (*PriceInfo, *models.ProblemDetails) {
+	mscc := &charging_datatype.MultipleServicesCreditControl{
+		RatingGroup: datatype.Unsigned32(ratingGroup),
+		RequestedServiceUnit: &charging_datatype.RequestedServiceUnit{
+			CCServiceSpecificUnits: datatype.Unsigned64(units),
+		},
+	}
+
+	cca, problemDetails := sendEventRequest(supi, charging_datatype.PRICE_ENQUIRY, mscc)
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+	if cca.CostInformation == nil {
+		return nil, &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: "no cost information in the answer of the ABMF",
+		}
+	}
+
+	price := monetary.FromCCMoney(&charging_datatype.CCMoney{
+		UnitValue:    cca.CostInformation.UnitValue,
+		CurrencyCode: cca.CostInformation.CurrencyCode,
+	})
+	return &PriceInfo{
+		Supi:         supi,
+		RatingGroup:  ratingGroup,
+		Units:        units,
+		Price:        price.String(),
+		CurrencyCode: price.CurrencyCode,
+	}, nil
+}
+
+// The balance check and the price enquiry are one time events of a session of their own
+func sendEventRequest(supi string, action charging_datatype.RequestedAction,
+	mscc *charging_datatype.MultipleServicesCreditControl) (*charging_datatype.AccountDebitResponse,
+	*models.ProblemDetails) {
+	self := chf_context.CHF_Self()
+
+	subscriberIdentifier := identity.SubscriptionId(supi)
+	if subscriberIdentifier == nil {
+		return nil, &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_INCORRECT",
+			Detail: "unsupported SUPI " + supi,
+		}
+	}
+
+	// The event is a session of its own, its id is released once answered
+	id := chf_context.GenerateAccountSessionId()
+	defer chf_context.FreeAccountSessionId(id)
+	sessionId := chf_context.AccountSessionId(id)
+	ccr := &charging_datatype.AccountDebitRequest{
+		SessionId:                     datatype.UTF8String(sessionId),
+		OriginHost:                    datatype.DiameterIdentity(self.AbmfCfg.OriginHost),
+		OriginRealm:                   datatype.DiameterIdentity(self.AbmfCfg.OriginRealm),
+		EventTimestamp:                datatype.Time(time.Now()),
+		SubscriptionId:                subscriberIdentifier,
+		UserName:                      datatype.OctetString(self.Name),
+		CcRequestType:                 charging_datatype.EVENT_REQUEST,
+		RequestedAction:               action,
+		MultipleServicesCreditControl: mscc,
+	}
+
+	cca, err := abmf.SendAccountDebitRequest(ccr)
+	if err != nil {
+		logger.ChargingdataPostLog.Errorf("SendAccountDebitRequest err: %+v", err)
+		return nil, &models.ProblemDetails{
+			Status: http.StatusServiceUnavailable,
+			Cause:  "CHARGING_FAILED",
+			Detail: err.Error(),
+		}
+	}
+	return cca, nil
+}
+
+func badRequest(detail string) *httpwrapper.Response {
+	problemDetails := &models.ProblemDetails{
+		Status: http.StatusBadRequest,
+		Cause:  "INVALID_QUERY_PARAM",
+		Detail: detail,
+	}
+	return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+}
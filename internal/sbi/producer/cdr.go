@@ -1,15 +1,15 @@
 package producer
 
 import (
-	"strings"
 	"time"
 
 	"github.com/free5gc/chf/cdr/asn"
 	"github.com/free5gc/chf/cdr/cdrConvert"
-	"github.com/free5gc/chf/cdr/cdrFile"
 	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/chf/internal/cgf"
 	chf_context "github.com/free5gc/chf/internal/context"
 	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/identity"
 	"github.com/free5gc/openapi/models"
 )
 
@@ -22,12 +22,28 @@ func OpenCDR(chargingData models.ChargingDataRequest, ue *chf_context.ChfUe, ses
 
 	// Record Sequence Number(Conditional IE): Partial record sequence number, only present in case of partial records.
 	// Partial CDR: Fragments of CDR, for long session charging
+	// The CDR of the session is reopened as the next partial record,
+	// the usage of the closed partial record has been written to the CDR file
 	if partialRecord {
-		// TODO partial record
 		cdr := ue.Cdr[sessionId]
-		partialRecordSeqNum := self.RecordSequenceNumber[sessionId]
-		partialRecordSeqNum++
-		cdr.ChargingFunctionRecord.RecordSequenceNumber = &(partialRecordSeqNum)
+		partialCdr := cdr.ChargingFunctionRecord
+
+		recordSequenceNumber := int64(1)
+		if partialCdr.RecordSequenceNumber != nil {
+			recordSequenceNumber = *partialCdr.RecordSequenceNumber + 1
+		}
+		partialCdr.RecordSequenceNumber = &recordSequenceNumber
+
+		t := time.Now()
+		partialCdr.RecordOpeningTime = cdrConvert.TimeStampToCdr(&t)
+		partialCdr.Duration = cdrType.CallDuration{Value: 0}
+		partialCdr.CauseForRecClosing = cdrType.CauseForRecClosing{}
+		partialCdr.Diagnostics = nil
+		partialCdr.Triggers = nil
+		partialCdr.ListOfMultipleUnitUsage = nil
+		partialCdr.LocalRecordSequenceNumber = &cdrType.LocalSequenceNumber{
+			Value: int64(self.AllocateLocalRecordSequenceNumber()),
+		}
 
 		return cdr, nil
 	}
@@ -52,36 +68,12 @@ func OpenCDR(chargingData models.ChargingDataRequest, ue *chf_context.ChfUe, ses
 	}
 
 	// 32.298 5.1.5.1.5 Local Record Sequence Number
-	// TODO determine local record sequnece number
-	self.LocalRecordSequenceNumber++
 	chfCdr.LocalRecordSequenceNumber = &cdrType.LocalSequenceNumber{
-		Value: int64(self.LocalRecordSequenceNumber),
+		Value: int64(self.AllocateLocalRecordSequenceNumber()),
 	}
 	// Skip Record Extensions: operator/manufacturer specific extensions
 
-	supiType := strings.Split(ue.Supi, "-")[0]
-	switch supiType {
-	case "imsi":
-		chfCdr.SubscriberIdentifier = &cdrType.SubscriptionID{
-			SubscriptionIDType: cdrType.SubscriptionIDType{Value: cdrType.SubscriptionIDTypePresentENDUSERIMSI},
-			SubscriptionIDData: asn.UTF8String(ue.Supi[5:]),
-		}
-	case "nai":
-		chfCdr.SubscriberIdentifier = &cdrType.SubscriptionID{
-			SubscriptionIDType: cdrType.SubscriptionIDType{Value: cdrType.SubscriptionIDTypePresentENDUSERNAI},
-			SubscriptionIDData: asn.UTF8String(ue.Supi[4:]),
-		}
-	case "gci":
-		chfCdr.SubscriberIdentifier = &cdrType.SubscriptionID{
-			SubscriptionIDType: cdrType.SubscriptionIDType{Value: cdrType.SubscriptionIDTypePresentENDUSERNAI},
-			SubscriptionIDData: asn.UTF8String(ue.Supi[4:]),
-		}
-	case "gli":
-		chfCdr.SubscriberIdentifier = &cdrType.SubscriptionID{
-			SubscriptionIDType: cdrType.SubscriptionIDType{Value: cdrType.SubscriptionIDTypePresentENDUSERNAI},
-			SubscriptionIDData: asn.UTF8String(ue.Supi[4:]),
-		}
-	}
+	chfCdr.SubscriberIdentifier = identity.CdrSubscriptionId(ue.Supi)
 
 	if sessionId != "" {
 		chfCdr.ChargingSessionIdentifier = &cdrType.ChargingSessionIdentifier{
@@ -93,61 +85,17 @@ func OpenCDR(chargingData models.ChargingDataRequest, ue *chf_context.ChfUe, ses
 		Value: int64(chargingData.ChargingId),
 	}
 
-	var consumerInfo cdrType.NetworkFunctionInformation
-	if consumerName := chargingData.NfConsumerIdentification.NFName; consumerName != "" {
-		consumerInfo.NetworkFunctionName = &cdrType.NetworkFunctionName{
-			Value: asn.IA5String(chargingData.NfConsumerIdentification.NFName),
-		}
-	}
-	if consumerV4Addr := chargingData.NfConsumerIdentification.NFIPv4Address; consumerV4Addr != "" {
-		consumerInfo.NetworkFunctionIPv4Address = &cdrType.IPAddress{
-			Present:         3,
-			IPTextV4Address: (*asn.IA5String)(&consumerV4Addr),
-		}
-	}
-	if consumerV6Addr := chargingData.NfConsumerIdentification.NFIPv6Address; consumerV6Addr != "" {
-		consumerInfo.NetworkFunctionIPv6Address = &cdrType.IPAddress{
-			Present:         4,
-			IPTextV6Address: (*asn.IA5String)(&consumerV6Addr),
-		}
-	}
-	if consumerFqdn := chargingData.NfConsumerIdentification.NFFqdn; consumerFqdn != "" {
-		consumerInfo.NetworkFunctionFQDN = &cdrType.NodeAddress{
-			Present:    2,
-			DomainName: (*asn.GraphicString)(&consumerFqdn),
+	// 32.298 5.1.5.1.x Partial Record Method, the partial records of the session follow it
+	if method := partialRecordMethodOf(chargingData); method != nil {
+		chfCdr.RoamingQBCInformation = &cdrType.RoamingQBCInformation{
+			RoamingChargingProfile: &cdrType.RoamingChargingProfile{
+				PartialRecordMethod: method,
+			},
 		}
 	}
-	if consumerPlmnId := chargingData.NfConsumerIdentification.NFPLMNID; consumerPlmnId != nil {
-		plmnIdByte := cdrConvert.PlmnIdToCdr(*consumerPlmnId)
-		consumerInfo.NetworkFunctionPLMNIdentifier = &cdrType.PLMNId{
-			Value: plmnIdByte.Value,
-		}
 
-	}
 	logger.ChargingdataPostLog.Infof("%s charging event", chargingData.NfConsumerIdentification.NodeFunctionality)
-	switch chargingData.NfConsumerIdentification.NodeFunctionality {
-	case "SMF":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentSMF
-	case "AMF":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentAMF
-	case "SMSF":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentSMSF
-	case "PGW_C_SMF":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentPGWCSMF
-	case "NEF":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentNEF
-	case "SGW":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentSGW
-	case "I_SMF":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentISMF
-	case "ePDG":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentEPDG
-	case "CEF":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentCEF
-	case "MnS_Producer":
-		consumerInfo.NetworkFunctionality.Value = cdrType.NetworkFunctionalityPresentMnSProducer
-	}
-	chfCdr.NFunctionConsumerInformation = consumerInfo
+	chfCdr.NFunctionConsumerInformation = cdrConvert.NfIdentificationToCdr(chargingData.NfConsumerIdentification)
 
 	if serviceSpecInfo := asn.OctetString(chargingData.ServiceSpecificationInfo); len(serviceSpecInfo) != 0 {
 		chfCdr.ServiceSpecificationInformation = &serviceSpecInfo
@@ -162,14 +110,26 @@ func OpenCDR(chargingData models.ChargingDataRequest, ue *chf_context.ChfUe, ses
 	}
 	if pduSessionInfo := chargingData.PDUSessionChargingInformation; pduSessionInfo != nil {
 		logger.ChargingdataPostLog.Debugln("PDU Session Charging Event")
-		chfCdr.PDUSessionChargingInformation = &cdrType.PDUSessionChargingInformation{
-			PDUSessionChargingID: cdrType.ChargingID{
-				Value: int64(pduSessionInfo.ChargingId),
-			},
-			PDUSessionId: cdrType.PDUSessionId{
-				Value: int64(pduSessionInfo.PduSessionInformation.PduSessionID),
-			},
+		chfCdr.PDUSessionChargingInformation = &cdrType.PDUSessionChargingInformation{}
+		cdrConvert.PduSessionChargingInformationToCdr(pduSessionInfo, chfCdr.PDUSessionChargingInformation)
+	}
+	// The subscriber identified by its GPSI is the user of the service, unless the NF consumer reports one
+	if identity.IsGpsi(ue.Supi) {
+		if info := chfCdr.RegistrationChargingInformation; info != nil && info.UserIdentifier == nil {
+			info.UserIdentifier = cdrConvert.GpsiToCdr(ue.Supi)
 		}
+		if info := chfCdr.PDUSessionChargingInformation; info != nil && info.UserIdentifier == nil {
+			info.UserIdentifier = cdrConvert.GpsiToCdr(ue.Supi)
+		}
+	}
+
+	if smsInfo := chargingData.SMSChargingInformation; smsInfo != nil {
+		logger.ChargingdataPostLog.Debugln("SMS Charging Event")
+		chfCdr.SMSChargingInformation = cdrConvert.SmsChargingInformationToCdr(smsInfo, chargingData.InvocationTimeStamp)
+	}
+	if nefInfo := chargingData.NEFChargingInformation; nefInfo != nil {
+		logger.ChargingdataPostLog.Debugln("NEF Charging Event")
+		chfCdr.ExposureFunctionAPIInformation = cdrConvert.NefChargingInformationToCdr(nefInfo)
 	}
 
 	cdr := cdrType.CHFRecord{
@@ -195,6 +155,14 @@ func UpdateCDR(record *cdrType.CHFRecord, chargingData models.ChargingDataReques
 		chfCdr.Triggers = append(chfCdr.Triggers, triggers...)
 	}
 
+	// location, QoS and the other session information change during the session
+	if pduSessionInfo := chargingData.PDUSessionChargingInformation; pduSessionInfo != nil {
+		if chfCdr.PDUSessionChargingInformation == nil {
+			chfCdr.PDUSessionChargingInformation = &cdrType.PDUSessionChargingInformation{}
+		}
+		cdrConvert.PduSessionChargingInformationToCdr(pduSessionInfo, chfCdr.PDUSessionChargingInformation)
+	}
+
 	// chfCdrstring, err := json.Marshal(chfCdr)
 	// if err != nil {
 	// 	fmt.Println(err)
@@ -205,69 +173,91 @@ func UpdateCDR(record *cdrType.CHFRecord, chargingData models.ChargingDataReques
 	return nil
 }
 
-func CloseCDR(record *cdrType.CHFRecord, partial bool) error {
+// CloseCDR closes the record with the cause of 32.298 5.1.5.0.x Cause for Record Closing
+func CloseCDR(record *cdrType.CHFRecord, cause int64) error {
 	logger.ChargingdataPostLog.Infof("Close CDR")
 
 	chfCdr := record.ChargingFunctionRecord
+	closingTime := time.Now()
+
+	// Duration: from the record opening time to the closing of the record
+	if openingTime, err := cdrConvert.TimeStampFromCdr(chfCdr.RecordOpeningTime); err != nil {
+		logger.ChargingdataPostLog.Warnf("Compute CDR duration failed: %+v", err)
+	} else if duration := closingTime.Sub(openingTime); duration > 0 {
+		chfCdr.Duration = cdrType.CallDuration{
+			Value: int64(duration / time.Second),
+		}
+	}
 
-	// Initial Cause for record closing
-	// 	normalRelease  (0),
-	// partialRecord  (1),
-	// abnormalRelease  (4),
-	// cAMELInitCallRelease  (5),
-	// volumeLimit	 (16),
-	// timeLimit	 (17),
-	// servingNodeChange	 (18),
-	// maxChangeCond	 (19),
-	// managementIntervention	 (20),
-	// intraSGSNIntersystemChange	 (21),
-	// rATChange	 (22),
-	// mSTimeZoneChange	 (23),
-	// sGSNPLMNIDChange	 (24),
-	// sGWChange	 (25),
-	// aPNAMBRChange	 (26),
-	// mOExceptionDataCounterReceipt	 (27),
-	// unauthorizedRequestingNetwork	 (52),
-	// unauthorizedLCSClient	 (53),
-	// positionMethodFailure	 (54),
-	// unknownOrUnreachableLCSClient	 (58),
-	// listofDownstreamNodeChange	 (59)
-	if partial {
-		chfCdr.CauseForRecClosing = cdrType.CauseForRecClosing{Value: 1}
-	} else {
-		chfCdr.CauseForRecClosing = cdrType.CauseForRecClosing{Value: 0}
+	chfCdr.CauseForRecClosing = cdrType.CauseForRecClosing{Value: cause}
+
+	if pduSessionInfo := chfCdr.PDUSessionChargingInformation; pduSessionInfo != nil {
+		// The PDU session goes on after a partial record
+		if cause != cdrType.CauseForRecClosingPresentPartialRecord && pduSessionInfo.PDUSessionstopTime == nil {
+			stopTime := cdrConvert.TimeStampToCdr(&closingTime)
+			pduSessionInfo.PDUSessionstopTime = &stopTime
+		}
+		// 5GSM cause of the PDU session release reported by SMF
+		if chfCdr.Diagnostics == nil {
+			chfCdr.Diagnostics = pduSessionInfo.Diagnostics
+		}
 	}
 
 	return nil
 }
 
-func dumpCdrFile(ueid string, records []*cdrType.CHFRecord) error {
-	var cdrfile cdrFile.CDRFile
-	cdrfile.Hdr.LengthOfCdrRouteingFilter = 0
-	cdrfile.Hdr.LengthOfPrivateExtension = 0
-	cdrfile.Hdr.HeaderLength = uint32(54 + cdrfile.Hdr.LengthOfCdrRouteingFilter + cdrfile.Hdr.LengthOfPrivateExtension)
-	cdrfile.Hdr.NumberOfCdrsInFile = uint32(len(records))
-	cdrfile.Hdr.FileLength = cdrfile.Hdr.HeaderLength
+// The cause for record closing is derived from the triggers reported by the NF consumer,
+// abnormal release takes precedence over the other causes
+func causeForRecClosingOf(chargingData models.ChargingDataRequest, partial bool) int64 {
+	triggers := triggersOf(chargingData)
+
+	cause := cdrType.CauseForRecClosingPresentNormalRelease
+	if partial {
+		cause = cdrType.CauseForRecClosingPresentPartialRecord
+	}
+
+	found := false
+	for _, trigger := range triggers {
+		triggerCause, ok := causeForRecClosingOfTrigger[trigger.TriggerType]
+		if !ok {
+			continue
+		}
+		if triggerCause == cdrType.CauseForRecClosingPresentAbnormalRelease {
+			return triggerCause
+		}
+		if !found {
+			cause = triggerCause
+			found = true
+		}
+	}
+
+	return cause
+}
+
+var causeForRecClosingOfTrigger = map[models.TriggerType]int64{
+	models.TriggerType_ABNORMAL_RELEASE:                             cdrType.CauseForRecClosingPresentAbnormalRelease,
+	models.TriggerType_VOLUME_LIMIT:                                 cdrType.CauseForRecClosingPresentVolumeLimit,
+	models.TriggerType_TIME_LIMIT:                                   cdrType.CauseForRecClosingPresentTimeLimit,
+	models.TriggerType_SERVING_NODE_CHANGE:                          cdrType.CauseForRecClosingPresentServingNodeChange,
+	models.TriggerType_MANAGEMENT_INTERVENTION:                      cdrType.CauseForRecClosingPresentManagementIntervention,
+	models.TriggerType_RAT_CHANGE:                                   cdrType.CauseForRecClosingPresentRATChange,
+	models.TriggerType_UE_TIMEZONE_CHANGE:                           cdrType.CauseForRecClosingPresentMSTimeZoneChange,
+	models.TriggerType_PLMN_CHANGE:                                  cdrType.CauseForRecClosingPresentSGSNPLMNIDChange,
+	models.TriggerType_MAX_NUMBER_OF_CHANGES_IN_CHARGING_CONDITIONS: cdrType.CauseForRecClosingPresentMaxChangeCond,
+}
+
+// Encode the closed CDRs and append them to the CDR file of the CGF
+func dumpCdrFile(records []*cdrType.CHFRecord) error {
+	var cdrs [][]byte
 
 	for _, record := range records {
 		cdrBytes, err := asn.BerMarshalWithParams(&record, "explicit,choice")
 		if err != nil {
 			logger.ChargingdataPostLog.Errorln(err)
+			continue
 		}
-
-		var cdrHdr cdrFile.CdrHeader
-		cdrHdr.CdrLength = uint16(len(cdrBytes))
-		cdrHdr.DataRecordFormat = cdrFile.BasicEncodingRules
-		tmpCdr := cdrFile.CDR{
-			Hdr:     cdrHdr,
-			CdrByte: cdrBytes,
-		}
-		cdrfile.CdrList = append(cdrfile.CdrList, tmpCdr)
-
-		cdrfile.Hdr.FileLength += uint32(cdrHdr.CdrLength) + 5
+		cdrs = append(cdrs, cdrBytes)
 	}
 
-	cdrfile.Encoding("/tmp/" + ueid + ".cdr")
-
-	return nil
+	return cgf.AppendCDRs(cdrs)
 }
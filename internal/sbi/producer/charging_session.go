@@ -0,0 +1,68 @@
+package producer
+
+import (
+	"net/http"
+	"time"
+
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/httpwrapper"
+)
+
+// ChargingSessionInfo is the charging session exposed by the OAM API
+type ChargingSessionInfo struct {
+	ChargingDataRef      string    `json:"chargingDataRef"`
+	Supi                 string    `json:"supi"`
+	CreatedAt            time.Time `json:"createdAt"`
+	NotifyUri            string    `json:"notifyUri,omitempty"`
+	RatingGroups         []int32   `json:"ratingGroups,omitempty"`
+	TerminationRequested bool      `json:"terminationRequested"`
+	TerminationCause     string    `json:"terminationCause,omitempty"`
+}
+
+func HandleGetChargingSession(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ChargingdataPostLog.Infof("HandleGetChargingSession")
+	chargingDataRef := request.Params["ChargingDataRef"]
+
+	response, problemDetails := GetChargingSession(chargingDataRef)
+	if response != nil {
+		return httpwrapper.NewResponse(http.StatusOK, nil, response)
+	} else if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	problemDetails = &models.ProblemDetails{
+		Status: http.StatusForbidden,
+		Cause:  "UNSPECIFIED",
+	}
+	return httpwrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
+}
+
+func GetChargingSession(chargingDataRef string) (*ChargingSessionInfo, *models.ProblemDetails) {
+	self := chf_context.CHF_Self()
+
+	session, ok := self.ChargingSessionFindByRef(chargingDataRef)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return nil, problemDetails
+	}
+
+	info := &ChargingSessionInfo{
+		ChargingDataRef: session.ChargingDataRef,
+		Supi:            session.Supi,
+		CreatedAt:       session.CreatedAt,
+	}
+	if ue, ok := self.ChfUeFindBySupi(session.Supi); ok {
+		ue.CULock.Lock()
+		info.NotifyUri = ue.NotifyUri
+		info.RatingGroups = append(info.RatingGroups, ue.RatingGroups...)
+		info.TerminationRequested = session.TerminationRequested
+		info.TerminationCause = session.TerminationCause
+		ue.CULock.Unlock()
+	}
+
+	return info, nil
+}
@@ -2,10 +2,7 @@ package producer
 
 import (
 	"context"
-	"math"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
@@ -13,11 +10,12 @@ import (
 	"github.com/fiorix/go-diameter/diam/datatype"
 	"github.com/free5gc/chf/cdr/cdrType"
 	"github.com/free5gc/chf/internal/abmf"
-	"github.com/free5gc/chf/internal/cgf"
 	chf_context "github.com/free5gc/chf/internal/context"
 	"github.com/free5gc/chf/internal/logger"
 	"github.com/free5gc/chf/internal/rating"
 	"github.com/free5gc/chf/internal/util"
+	"github.com/free5gc/chf/pkg/identity"
+	"github.com/free5gc/chf/pkg/monetary"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/util/httpwrapper"
 )
@@ -33,16 +31,21 @@ func NotifyRecharge(ueId string, rg int32) {
 	}
 
 	// If it is previosly set to debit mode due to quota exhausted, need to reverse to the reserve mode
+	ue.CULock.Lock()
 	ue.RatingType[rg] = charging_datatype.REQ_SUBTYPE_RESERVE
+	notifyUri := ue.NotifyUri
+	ue.CULock.Unlock()
 	reauthorizationDetails = append(reauthorizationDetails, models.ReauthorizationDetails{
 		RatingGroup: rg,
 	})
 
 	notifyRequest := models.ChargingNotifyRequest{
+		NotificationType:       models.NotificationType_REAUTHORIZATION,
 		ReauthorizationDetails: reauthorizationDetails,
 	}
 
-	SendChargingNotification(ue.NotifyUri, notifyRequest)
+	SendChargingNotification(notifyUri, notifyRequest)
+	NotifySpendingLimitStatus(AccountPolicyCounters{}, ueId)
 }
 
 func SendChargingNotification(notifyUri string, notifyRequest models.ChargingNotifyRequest) {
@@ -141,7 +144,6 @@ func ChargingDataCreate(chargingData models.ChargingDataRequest) (*models.Chargi
 	// Open CDR
 	// ChargingDataRef(charging session id):
 	// A unique identifier for a charging data resource in a PLMN
-	// TODO determine charging session id(string type) supi+consumerid+localseq?
 	ue, err := self.NewCHFUe(ueId)
 	if err != nil {
 		logger.ChargingdataPostLog.Errorf("New CHFUe error %s", err)
@@ -154,44 +156,74 @@ func ChargingDataCreate(chargingData models.ChargingDataRequest) (*models.Chargi
 	ue.CULock.Lock()
 	defer ue.CULock.Unlock()
 
+	// The retransmitted one time event gets the response of the event, it is not charged again
+	if chargingData.OneTimeEvent {
+		if response, ok := self.OneTimeEventResponse(&chargingData); ok {
+			logger.ChargingdataPostLog.Infof("Retransmitted one time event %d of UE %s",
+				chargingData.InvocationSequenceNumber, ueId)
+			return response, self.GetIPv4Uri() + "/nchf-convergedcharging/v3/chargingdata/", nil
+		}
+	}
+
 	ue.NotifyUri = chargingData.NotifyUri
 
-	consumerId := chargingData.NfConsumerIdentification.NFName
+	mode := self.ChargingModeOf(ueId, dnnOf(chargingData))
 	if !chargingData.OneTimeEvent {
-		chargingSessionId = ueId + consumerId + strconv.Itoa(int(self.LocalRecordSequenceNumber))
+		session := self.NewChargingSession(ueId)
+		session.ChargingMode = mode
+		session.SaveInvocation(chargingData.InvocationSequenceNumber, nil)
+		chargingSessionId = session.ChargingDataRef
 	}
 	cdr, err := OpenCDR(chargingData, ue, chargingSessionId, false)
 	if err != nil {
+		self.DeleteChargingSession(chargingSessionId)
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusBadRequest,
 		}
 		return nil, "", problemDetails
 	}
 
+	// The one time event is charged before it is recorded, the rating groups not granted are not recorded.
+	// Post event charging only records the event in CDR.
+	granted := true
+	if chargingData.OneTimeEvent {
+		if chargingData.OneTimeEventType != models.OneTimeEventType_PEC && mode != chf_context.ChargingModeOffline {
+			responseBody.MultipleUnitInformation, granted = immediateEventCharging(ue, chargingData)
+			chargingData.MultipleUnitUsage = grantedUnitUsage(chargingData.MultipleUnitUsage,
+				responseBody.MultipleUnitInformation)
+		}
+		self.SaveOneTimeEvent(&chargingData, &responseBody)
+	}
+
 	err = UpdateCDR(cdr, chargingData)
 	if err != nil {
+		self.DeleteChargingSession(chargingSessionId)
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusBadRequest,
 		}
 		return nil, "", problemDetails
 	}
 
-	ue.Cdr[chargingSessionId] = cdr
-
 	if chargingData.OneTimeEvent {
-		err = CloseCDR(cdr, false)
+		// The CDR of one time event is closed at once, and written to the CDR file
+		err = CloseCDR(cdr, cdrType.CauseForRecClosingPresentNormalRelease)
 		if err != nil {
 			problemDetails := &models.ProblemDetails{
 				Status: http.StatusBadRequest,
 			}
 			return nil, "", problemDetails
 		}
-	}
 
-	// CDR Transfer
-	err = cgf.SendCDR(chargingData.SubscriberIdentifier)
-	if err != nil {
-		logger.ChargingdataPostLog.Errorf("Charging gateway fail to send CDR to billing domain %v", err)
+		// The denied event is not delivered, so it is not recorded
+		if granted {
+			err = dumpCdrFile([]*cdrType.CHFRecord{cdr})
+			if err != nil {
+				logger.ChargingdataPostLog.Errorf("Dump CDR of UE %s failed: %+v", ueId, err)
+			}
+		}
+	} else {
+		ue.Cdr[chargingSessionId] = cdr
+		self.SaveChfUe(ue)
 	}
 
 	logger.ChargingdataPostLog.Infof("Open CDR for UE %s", ueId)
@@ -203,32 +235,66 @@ func ChargingDataCreate(chargingData models.ChargingDataRequest) (*models.Chargi
 
 	responseBody.InvocationTimeStamp = &timeStamp
 	responseBody.InvocationSequenceNumber = chargingData.InvocationSequenceNumber
+	if mode == chf_context.ChargingModeOffline {
+		responseBody.Triggers = offlineChargingTriggers(ue)
+	}
 
 	return &responseBody, locationURI, nil
 }
 
 func ChargingDataUpdate(chargingData models.ChargingDataRequest, chargingSessionId string) (*models.ChargingDataResponse,
 	*models.ProblemDetails) {
-	var records []*cdrType.CHFRecord
-
 	self := chf_context.CHF_Self()
 	ueId := chargingData.SubscriberIdentifier
-	ue, ok := self.ChfUeFindBySupi(ueId)
+	ue, problemDetails := findChargingDataResource(chargingSessionId, ueId)
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+
+	ue.CULock.Lock()
+	defer ue.CULock.Unlock()
+
+	session, ok := self.ChargingSessionFindByRef(chargingSessionId)
 	if !ok {
-		logger.ChargingdataPostLog.Errorf("Do not find  CHFUe[%s] error", ueId)
 		problemDetails := &models.ProblemDetails{
-			Status: http.StatusBadRequest,
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
 		}
 		return nil, problemDetails
 	}
+	switch check, lastResponse := session.CheckInvocation(chargingData.InvocationSequenceNumber); check {
+	case chf_context.InvocationRetransmitted:
+		logger.ChargingdataPostLog.Infof("Retransmitted update %d of charging data resource[%s]",
+			chargingData.InvocationSequenceNumber, chargingSessionId)
+		return lastResponse, nil
+	case chf_context.InvocationOutOfOrder:
+		return nil, invocationOutOfOrder(session, chargingData.InvocationSequenceNumber)
+	}
 
-	ue.CULock.Lock()
-	defer ue.CULock.Unlock()
+	cdr, ok := ue.Cdr[chargingSessionId]
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return nil, problemDetails
+	}
+
+	chargingData.MultipleUnitUsage = splitUsageAtTariffSwitch(ue, chargingData.MultipleUnitUsage)
 
 	// Online charging: Rate, Account, Reservation
-	responseBody, partialRecord := BuildOnlineChargingDataUpdateResopone(chargingData)
+	mode := chargingModeOfSession(chargingSessionId, chargingData)
+	responseBody, partialRecord := BuildOnlineChargingDataUpdateResopone(chargingData, mode)
+	if mode == chf_context.ChargingModeOffline {
+		responseBody.Triggers = offlineChargingTriggers(ue)
+	}
+
+	// The usage is charged, the retransmission gets the response even if the CDR fails below
+	timeStamp := time.Now()
+	responseBody.InvocationTimeStamp = &timeStamp
+	responseBody.InvocationSequenceNumber = chargingData.InvocationSequenceNumber
+	session.SaveInvocation(chargingData.InvocationSequenceNumber, &responseBody)
 
-	cdr := ue.Cdr[chargingSessionId]
 	err := UpdateCDR(cdr, chargingData)
 	if err != nil {
 		problemDetails := &models.ProblemDetails{
@@ -237,11 +303,14 @@ func ChargingDataUpdate(chargingData models.ChargingDataRequest, chargingSession
 		return nil, problemDetails
 	}
 
-	if partialRecord {
-		ueId := chargingData.SubscriberIdentifier
-
-		CloseCDR(cdr, partialRecord)
-		err = dumpCdrFile(ueId, []*cdrType.CHFRecord{cdr})
+	if cause, partial := partialRecordCauseOf(cdr, chargingData, partialRecord); partial {
+		if err = closePartialRecord(cdr, cause); err != nil {
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusBadRequest,
+			}
+			return nil, problemDetails
+		}
+		err = dumpCdrFile([]*cdrType.CHFRecord{cdr})
 		if err != nil {
 			problemDetails := &models.ProblemDetails{
 				Status: http.StatusBadRequest,
@@ -249,41 +318,33 @@ func ChargingDataUpdate(chargingData models.ChargingDataRequest, chargingSession
 			return nil, problemDetails
 		}
 
-		OpenCDR(chargingData, ue, chargingSessionId, partialRecord)
+		if _, err = OpenCDR(chargingData, ue, chargingSessionId, true); err != nil {
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusBadRequest,
+			}
+			return nil, problemDetails
+		}
 		logger.ChargingdataPostLog.Tracef("CDR Record Sequence Number after Reopen %+v", *cdr.ChargingFunctionRecord.RecordSequenceNumber)
 	}
 
-	for _, cdr := range ue.Cdr {
-		records = append(records, cdr)
-	}
-	err = dumpCdrFile(ueId, records)
-	if err != nil {
-		problemDetails := &models.ProblemDetails{
-			Status: http.StatusBadRequest,
-		}
-		return nil, problemDetails
-	}
+	self.SaveChfUe(ue)
 
-	err = cgf.SendCDR(chargingData.SubscriberIdentifier)
-	if err != nil {
-		logger.ChargingdataPostLog.Errorf("Charging gateway fail to send CDR to billing domain %v", err)
+	if len(responseBody.MultipleUnitInformation) != 0 {
+		startValidityTimer(chargingSessionId, ue.QuotaValidityTime)
 	}
 
-	timeStamp := time.Now()
-	responseBody.InvocationTimeStamp = &timeStamp
-	responseBody.InvocationSequenceNumber = chargingData.InvocationSequenceNumber
-
 	return &responseBody, nil
 }
 
 func ChargingDataRelease(chargingData models.ChargingDataRequest, chargingSessionId string) *models.ProblemDetails {
 	self := chf_context.CHF_Self()
 	ueId := chargingData.SubscriberIdentifier
-	ue, ok := self.ChfUeFindBySupi(ueId)
-	if !ok {
-		logger.ChargingdataPostLog.Errorf("Do not find CHFUe[%s] error", ueId)
-		problemDetails := &models.ProblemDetails{
-			Status: http.StatusBadRequest,
+	ue, problemDetails := findChargingDataResource(chargingSessionId, ueId)
+	if problemDetails != nil {
+		// The release of the session is retransmitted as its answer is lost
+		if self.IsReleaseRetransmitted(chargingSessionId, chargingData.InvocationSequenceNumber) {
+			logger.ChargingdataPostLog.Infof("Retransmitted release of charging data resource[%s]", chargingSessionId)
+			return nil
 		}
 		return problemDetails
 	}
@@ -291,9 +352,38 @@ func ChargingDataRelease(chargingData models.ChargingDataRequest, chargingSessio
 	ue.CULock.Lock()
 	defer ue.CULock.Unlock()
 
-	sessionChargingReservation(chargingData)
+	session, ok := self.ChargingSessionFindByRef(chargingSessionId)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return problemDetails
+	}
+	cdr, ok := ue.Cdr[chargingSessionId]
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return problemDetails
+	}
+
+	chargingData.MultipleUnitUsage = splitUsageAtTariffSwitch(ue, chargingData.MultipleUnitUsage)
+
+	// The release retransmitted after the failure of its CDR completes the release, it is not charged again
+	if session.IsReleasing(chargingData.InvocationSequenceNumber) {
+		logger.ChargingdataPostLog.Infof("Retransmitted release of charging data resource[%s]", chargingSessionId)
+	} else {
+		// The release reusing the number of an update is not a retransmission of the release
+		check, _ := session.CheckInvocation(chargingData.InvocationSequenceNumber)
+		if check != chf_context.InvocationNew {
+			return invocationOutOfOrder(session, chargingData.InvocationSequenceNumber)
+		}
 
-	cdr := ue.Cdr[chargingSessionId]
+		sessionChargingReservation(chargingData, chargingModeOfSession(chargingSessionId, chargingData))
+		session.SaveRelease(chargingData.InvocationSequenceNumber)
+	}
 
 	err := UpdateCDR(cdr, chargingData)
 	if err != nil {
@@ -303,7 +393,12 @@ func ChargingDataRelease(chargingData models.ChargingDataRequest, chargingSessio
 		return problemDetails
 	}
 
-	err = CloseCDR(cdr, false)
+	// The session terminated by CHF is closed for management intervention
+	cause := causeForRecClosingOf(chargingData, false)
+	if session.TerminationRequested {
+		cause = cdrType.CauseForRecClosingPresentManagementIntervention
+	}
+	err = CloseCDR(cdr, cause)
 	if err != nil {
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusBadRequest,
@@ -311,7 +406,7 @@ func ChargingDataRelease(chargingData models.ChargingDataRequest, chargingSessio
 		return problemDetails
 	}
 
-	err = dumpCdrFile(ueId, []*cdrType.CHFRecord{cdr})
+	err = dumpCdrFile([]*cdrType.CHFRecord{cdr})
 	if err != nil {
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusBadRequest,
@@ -319,14 +414,62 @@ func ChargingDataRelease(chargingData models.ChargingDataRequest, chargingSessio
 		return problemDetails
 	}
 
+	delete(ue.Cdr, chargingSessionId)
+	self.ReleaseChargingSession(chargingSessionId, chargingData.InvocationSequenceNumber)
+	self.SaveChfUe(ue)
+
 	return nil
 }
 
-func BuildOnlineChargingDataCreateResopone(ue *chf_context.ChfUe, chargingData models.ChargingDataRequest) models.ChargingDataResponse {
+// 32.291 6.1.6.2.2.1: the InvocationSequenceNumber lower than the last one of the session is rejected
+func invocationOutOfOrder(session *chf_context.ChargingSession, sequenceNumber int32) *models.ProblemDetails {
+	logger.ChargingdataPostLog.Warnf("Invocation %d of charging data resource[%s] out of order, last %d",
+		sequenceNumber, session.ChargingDataRef, session.LastInvocation())
+	return &models.ProblemDetails{
+		Status: http.StatusBadRequest,
+		Cause:  "MANDATORY_IE_INCORRECT",
+		Detail: "InvocationSequenceNumber is out of order",
+		InvalidParams: []models.InvalidParam{{
+			Param:  "invocationSequenceNumber",
+			Reason: "lower than or equal to the last invocation of the charging data resource",
+		}},
+	}
+}
+
+// Find the UE owning the charging data resource identified by ChargingDataRef
+func findChargingDataResource(chargingDataRef string, supi string) (*chf_context.ChfUe, *models.ProblemDetails) {
+	self := chf_context.CHF_Self()
+
+	ue, ok := self.ChfUeFindByChargingDataRef(chargingDataRef)
+	if !ok {
+		logger.ChargingdataPostLog.Errorf("Do not find charging data resource[%s]", chargingDataRef)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+			Detail: "ChargingDataRef " + chargingDataRef + " does not exist",
+		}
+		return nil, problemDetails
+	}
+
+	if supi != "" && supi != ue.Supi {
+		logger.ChargingdataPostLog.Errorf("Charging data resource[%s] does not belong to %s", chargingDataRef, supi)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_INCORRECT",
+			Detail: "SubscriberIdentifier does not match the charging data resource",
+		}
+		return nil, problemDetails
+	}
+
+	return ue, nil
+}
+
+func BuildOnlineChargingDataCreateResopone(ue *chf_context.ChfUe, chargingData models.ChargingDataRequest,
+	mode chf_context.ChargingMode) models.ChargingDataResponse {
 	logger.ChargingdataPostLog.Info("In Build Online Charging Data Create Resopone")
 	ue.NotifyUri = chargingData.NotifyUri
 
-	multipleUnitInformation, _ := sessionChargingReservation(chargingData)
+	multipleUnitInformation, _ := sessionChargingReservation(chargingData, mode)
 
 	responseBody := models.ChargingDataResponse{
 		MultipleUnitInformation: multipleUnitInformation,
@@ -335,12 +478,13 @@ func BuildOnlineChargingDataCreateResopone(ue *chf_context.ChfUe, chargingData m
 	return responseBody
 }
 
-func BuildOnlineChargingDataUpdateResopone(chargingData models.ChargingDataRequest) (models.ChargingDataResponse, bool) {
+func BuildOnlineChargingDataUpdateResopone(chargingData models.ChargingDataRequest,
+	mode chf_context.ChargingMode) (models.ChargingDataResponse, bool) {
 	var partialRecord bool
 
 	logger.ChargingdataPostLog.Info("In BuildOnlineChargingDataUpdateResopone ")
 
-	multipleUnitInformation, partialRecord := sessionChargingReservation(chargingData)
+	multipleUnitInformation, partialRecord := sessionChargingReservation(chargingData, mode)
 
 	responseBody := models.ChargingDataResponse{
 		MultipleUnitInformation: multipleUnitInformation,
@@ -350,10 +494,10 @@ func BuildOnlineChargingDataUpdateResopone(chargingData models.ChargingDataReque
 }
 
 // 32.296 6.2.2.3.1: Service usage request method with reservation
-func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]models.MultipleUnitInformation, bool) {
+func sessionChargingReservation(chargingData models.ChargingDataRequest,
+	mode chf_context.ChargingMode) ([]models.MultipleUnitInformation, bool) {
 	var multipleUnitInformation []models.MultipleUnitInformation
-	var partialRecord bool
-	var subscriberIdentifier *charging_datatype.SubscriptionId
+	var partialRecord, balanceChanged bool
 
 	self := chf_context.CHF_Self()
 	supi := chargingData.SubscriberIdentifier
@@ -364,50 +508,53 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 		return nil, false
 	}
 
-	supiType := strings.Split(supi, "-")[0]
-	switch supiType {
-	case "imsi":
-		subscriberIdentifier = &charging_datatype.SubscriptionId{
-			SubscriptionIdType: charging_datatype.END_USER_IMSI,
-			SubscriptionIdData: datatype.UTF8String(supi[5:]),
-		}
-	case "nai":
-		subscriberIdentifier = &charging_datatype.SubscriptionId{
-			SubscriptionIdType: charging_datatype.END_USER_NAI,
-			SubscriptionIdData: datatype.UTF8String(supi[4:]),
-		}
-	case "gci":
-		subscriberIdentifier = &charging_datatype.SubscriptionId{
-			SubscriptionIdType: charging_datatype.END_USER_NAI,
-			SubscriptionIdData: datatype.UTF8String(supi[4:]),
+	// Offline charging: no credit control, the usage is only recorded in CDR
+	if mode == chf_context.ChargingModeOffline {
+		for _, unitUsage := range chargingData.MultipleUnitUsage {
+			if !ue.FindRatingGroup(unitUsage.RatingGroup) {
+				ue.RatingGroups = append(ue.RatingGroups, unitUsage.RatingGroup)
+			}
 		}
-	case "gli":
-		subscriberIdentifier = &charging_datatype.SubscriptionId{
-			SubscriptionIdType: charging_datatype.END_USER_NAI,
-			SubscriptionIdData: datatype.UTF8String(supi[4:]),
+		for _, trigger := range chargingData.Triggers {
+			if (trigger.TriggerType == models.TriggerType_VOLUME_LIMIT ||
+				trigger.TriggerType == models.TriggerType_TIME_LIMIT) &&
+				trigger.TriggerCategory == models.TriggerCategory_IMMEDIATE_REPORT {
+				partialRecord = true
+			}
 		}
+		return nil, partialRecord
 	}
 
+	subscriberIdentifier := identity.SubscriptionId(supi)
+
 	for unitUsageNum, unitUsage := range chargingData.MultipleUnitUsage {
-		var totalUsaedUnit uint32
+		var totalUsaedUnit, totalUsedTime, totalUsedAfterSwitch uint32
 		var finalUnitIndication models.FinalUnitIndication
-		offline := true
+		offline := mode != chf_context.ChargingModeOnline
 
 		rg := unitUsage.RatingGroup
 		if !ue.FindRatingGroup(rg) {
 			ue.RatingGroups = append(ue.RatingGroups, rg)
 			ue.RatingType[rg] = charging_datatype.REQ_SUBTYPE_RESERVE
 		}
+		unitType := unitTypeOf(ue, unitUsage)
+		requestedUnit := requestedUnitOf(unitUsage.RequestedUnit, unitType)
 
 		for _, useduint := range unitUsage.UsedUnitContainer {
-			switch useduint.QuotaManagementIndicator {
+			indicator := useduint.QuotaManagementIndicator
+			// Online mode performs quota management regardless of the indicator
+			if mode == chf_context.ChargingModeOnline && indicator == models.QuotaManagementIndicator_OFFLINE_CHARGING {
+				indicator = models.QuotaManagementIndicator_ONLINE_CHARGING
+			}
+			switch indicator {
 			case models.QuotaManagementIndicator_OFFLINE_CHARGING:
 				continue
 			case models.QuotaManagementIndicator_ONLINE_CHARGING:
 				offline = false
 				for _, trigger := range chargingData.Triggers {
 					// Check if partial record is needed
-					if trigger.TriggerType == models.TriggerType_VOLUME_LIMIT &&
+					if (trigger.TriggerType == models.TriggerType_VOLUME_LIMIT ||
+						trigger.TriggerType == models.TriggerType_TIME_LIMIT) &&
 						trigger.TriggerCategory == models.TriggerCategory_IMMEDIATE_REPORT {
 						partialRecord = true
 					}
@@ -415,8 +562,16 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 						ue.RatingType[rg] = charging_datatype.REQ_SUBTYPE_DEBIT
 					}
 				}
-				// calculate total used unit
-				totalUsaedUnit += uint32(useduint.TotalVolume)
+				// calculate total used unit, seconds for the time based tariff
+				usedUnit := uint32(useduint.TotalVolume)
+				if unitType == charging_datatype.TIME {
+					usedUnit = uint32(useduint.Time)
+				}
+				totalUsedTime += uint32(useduint.Time)
+				totalUsaedUnit += usedUnit
+				if switchTime, ok := ue.TariffSwitchTime[rg]; ok && afterTariffSwitch(useduint, switchTime) {
+					totalUsedAfterSwitch += usedUnit
+				}
 			case models.QuotaManagementIndicator_QUOTA_MANAGEMENT_SUSPENDED:
 				logger.ChargingdataPostLog.Errorf("Current do not support QUOTA MANAGEMENT SUSPENDED")
 			}
@@ -427,7 +582,7 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 		// Only online charging need to perform credit control
 
 		ccr := &charging_datatype.AccountDebitRequest{
-			SessionId:       datatype.UTF8String(strconv.Itoa(int(ue.AcctSessionId))),
+			SessionId:       datatype.UTF8String(ue.AcctSessionId),
 			OriginHost:      datatype.DiameterIdentity(self.AbmfCfg.OriginHost),
 			OriginRealm:     datatype.DiameterIdentity(self.AbmfCfg.OriginRealm),
 			EventTimestamp:  datatype.Time(time.Now()),
@@ -437,7 +592,7 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 		}
 
 		sur := &charging_datatype.ServiceUsageRequest{
-			SessionId:      datatype.UTF8String(strconv.Itoa(int(ue.RateSessionId))),
+			SessionId:      datatype.UTF8String(ue.RateSessionId),
 			OriginHost:     datatype.DiameterIdentity(self.RatingCfg.OriginHost),
 			OriginRealm:    datatype.DiameterIdentity(self.RatingCfg.OriginRealm),
 			ActualTime:     datatype.Time(time.Now()),
@@ -453,43 +608,86 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 
 		switch ue.RatingType[rg] {
 		case charging_datatype.REQ_SUBTYPE_RESERVE:
-			if ue.ReservedQuota[rg] == 0 {
+			if ue.ReservedQuota[rg].IsZero() {
+				// The tariff is unknown before the first reservation, the RF prices the requested units first.
+				// The price is in the currency of the tariff, the ABMF exchanges it into the one of the account.
+				sur.ServiceRating = &charging_datatype.ServiceRating{
+					ServiceIdentifier: datatype.Unsigned32(rg),
+					RequestSubType:    charging_datatype.REQ_SUBTYPE_AOC,
+					RequestedUnits:    datatype.Unsigned32(requestedUnit),
+				}
+				priceRsp, err := rating.SendServiceUsageRequest(sur)
+				if err != nil {
+					logger.ChargingdataPostLog.Errorf("Price requested unit of rating group %d err: %+v", rg, err)
+					continue
+				}
+
 				ccr.CcRequestType = charging_datatype.UPDATE_REQUEST
 				ccr.RequestedAction = charging_datatype.DIRECT_DEBITING
 				ccr.MultipleServicesCreditControl = &charging_datatype.MultipleServicesCreditControl{
 					RatingGroup: datatype.Unsigned32(rg),
 					RequestedServiceUnit: &charging_datatype.RequestedServiceUnit{
-						CCTotalOctets: datatype.Unsigned64(unitUsage.RequestedUnit.TotalVolume * 10),
+						CCMoney: monetary.FromCCMoney(priceRsp.ServiceRating.Price).CCMoney(),
 					},
+					// The ABMF keeps the reservation as long as the quota is valid
+					ValidityTime: datatype.Unsigned32(ue.QuotaValidityTime),
 				}
 			} else {
 				ccr.CcRequestType = charging_datatype.UPDATE_REQUEST
 				ccr.RequestedAction = charging_datatype.DIRECT_DEBITING
 				logger.ChargingdataPostLog.Tracef("UsedUnit %v UnitCost: %v", totalUsaedUnit, ue.UnitCost[rg])
 
-				prevReserved := ue.ReservedQuota[rg]
-				usedQuota := int64(totalUsaedUnit * ue.UnitCost[rg])
-				ue.ReservedQuota[rg] -= usedQuota
-				insufficient := usedQuota - prevReserved
+				usedQuota, err := usedQuotaOf(ue, rg, totalUsaedUnit, totalUsedAfterSwitch)
+				if err != nil {
+					logger.ChargingdataPostLog.Errorf("Price usage of rating group %d err: %+v", rg, err)
+					continue
+				}
+				if ue.ReservedQuota[rg], err = ue.ReservedQuota[rg].Sub(usedQuota); err != nil {
+					logger.ChargingdataPostLog.Errorf("Deduct usage of rating group %d err: %+v", rg, err)
+					continue
+				}
 
-				requestedQuota := int64(unitUsage.RequestedUnit.TotalVolume*int32(ue.UnitCost[rg])) + insufficient
+				requestedQuota, err := requestedQuotaOf(ue, rg, uint32(requestedUnit))
+				if err != nil {
+					logger.ChargingdataPostLog.Errorf("Price requested unit of rating group %d err: %+v", rg, err)
+					continue
+				}
 
+				// The usage of the reservation is reported for the reservation ledger of the ABMF
 				ccr.MultipleServicesCreditControl = &charging_datatype.MultipleServicesCreditControl{
 					RatingGroup: datatype.Unsigned32(rg),
 					RequestedServiceUnit: &charging_datatype.RequestedServiceUnit{
-						CCTotalOctets: datatype.Unsigned64(requestedQuota),
+						CCMoney: requestedQuota.CCMoney(),
 					},
+					UsedServiceUnit: &charging_datatype.UsedServiceUnit{
+						CCMoney: usedQuota.CCMoney(),
+					},
+					ValidityTime: datatype.Unsigned32(ue.QuotaValidityTime),
 				}
 			}
 
-			acctDebitRsp, err := abmf.SendAccountDebitRequest(ue, ccr)
+			if unitType == charging_datatype.TIME {
+				ccr.MultipleServicesCreditControl.RequestedServiceUnit.CCTime = datatype.Unsigned32(requestedUnit)
+				if ccr.MultipleServicesCreditControl.UsedServiceUnit == nil {
+					ccr.MultipleServicesCreditControl.UsedServiceUnit = &charging_datatype.UsedServiceUnit{}
+				}
+				ccr.MultipleServicesCreditControl.UsedServiceUnit.CCTime = datatype.Unsigned32(totalUsedTime)
+			}
+
+			// The number is used once sent, the ABMF answers the same number again as a retransmission
+			ue.AcctRequestNum[rg]++
+			acctDebitRsp, err := abmf.SendAccountDebitRequest(ccr)
 			if err != nil {
 				logger.ChargingdataPostLog.Errorf("SendAccountDebitRequest err: %+v", err)
 				continue
 			}
-			logger.ChargingdataPostLog.Tracef("reserved Unit: %d", acctDebitRsp.MultipleServicesCreditControl.GrantedServiceUnit.CCTotalOctets)
+			grantedQuota := monetary.FromCCMoney(acctDebitRsp.MultipleServicesCreditControl.GrantedServiceUnit.CCMoney)
+			logger.ChargingdataPostLog.Tracef("reserved quota: %v", grantedQuota)
 
-			ue.ReservedQuota[rg] += int64(acctDebitRsp.MultipleServicesCreditControl.GrantedServiceUnit.CCTotalOctets)
+			if ue.ReservedQuota[rg], err = ue.ReservedQuota[rg].Add(grantedQuota); err != nil {
+				logger.ChargingdataPostLog.Errorf("Reserve quota of rating group %d err: %+v", rg, err)
+				continue
+			}
 
 			// Deduict the reserved quota from the account
 			if acctDebitRsp.MultipleServicesCreditControl.FinalUnitIndication != nil {
@@ -505,35 +703,61 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 
 			sur.ServiceRating = &charging_datatype.ServiceRating{
 				ServiceIdentifier: datatype.Unsigned32(rg),
-				MonetaryQuota:     datatype.Unsigned32(ue.ReservedQuota[rg]),
+				MonetaryQuota:     ue.ReservedQuota[rg].CCMoney(),
 				RequestSubType:    charging_datatype.REQ_SUBTYPE_RESERVE,
+				RequestedUnits:    datatype.Unsigned32(requestedUnit),
+				// counted by the RF for the free allowance and the tiers of the tariff plan
+				ConsumedUnits:                  datatype.Unsigned32(totalUsaedUnit),
+				ConsumedUnitsAfterTariffSwitch: datatype.Unsigned32(totalUsedAfterSwitch),
 			}
 
 			// Retrieve and save the tarrif for pricing the next usage
-			serviceUsageRsp, err := rating.SendServiceUsageRequest(ue, sur)
+			serviceUsageRsp, err := rating.SendServiceUsageRequest(sur)
 			if err != nil {
 				logger.ChargingdataPostLog.Errorf("SendServiceUsageRequest err: %+v", err)
 				continue
 			}
 
-			ue.UnitCost[rg] = uint32(serviceUsageRsp.ServiceRating.MonetaryTariff.RateElement.UnitCost.ValueDigits) *
-				uint32(math.Pow10(int(serviceUsageRsp.ServiceRating.MonetaryTariff.RateElement.UnitCost.Exponent)))
+			monetaryTariff := serviceUsageRsp.ServiceRating.MonetaryTariff
+			rateElement := monetaryTariff.RateElement
+			ue.UnitCost[rg] = unitCostOf(monetaryTariff)
+			ue.UnitType[rg] = rateElement.CCUnitType
+			updateTariffSwitch(ue, rg, serviceUsageRsp.ServiceRating, time.Time(sur.ActualTime))
+			updateValidUnits(ue, rg, serviceUsageRsp.ServiceRating)
 
 			grantedUnit := uint32(serviceUsageRsp.ServiceRating.AllowedUnits)
 			logger.ChargingdataPostLog.Tracef("granted Unit: %d", grantedUnit)
 
-			if ue.RatingType[rg] == charging_datatype.REQ_SUBTYPE_RESERVE {
-				unitInformation.VolumeQuotaThreshold = int32(float32(grantedUnit) * ue.VolumeThresholdRate)
-			}
+			if rateElement.CCUnitType == charging_datatype.TIME {
+				if ue.RatingType[rg] == charging_datatype.REQ_SUBTYPE_RESERVE {
+					unitInformation.TimeQuotaThreshold = int32(float32(grantedUnit) * ue.TimeThresholdRate)
+				}
 
-			unitInformation.GrantedUnit = &models.GrantedUnit{
-				TotalVolume:    int32(grantedUnit),
-				DownlinkVolume: int32(grantedUnit),
-				UplinkVolume:   int32(grantedUnit),
+				unitInformation.GrantedUnit = &models.GrantedUnit{
+					Time: int32(grantedUnit),
+				}
+			} else {
+				if ue.RatingType[rg] == charging_datatype.REQ_SUBTYPE_RESERVE {
+					unitInformation.VolumeQuotaThreshold = int32(float32(grantedUnit) * ue.VolumeThresholdRate)
+				}
+
+				unitInformation.GrantedUnit = &models.GrantedUnit{
+					TotalVolume:    int32(grantedUnit),
+					DownlinkVolume: int32(grantedUnit),
+					UplinkVolume:   int32(grantedUnit),
+				}
 			}
 
-			// The timer of VolumeLimit is remain in SMF
-			if ue.VolumeLimit != 0 {
+			// The timer of TimeLimit and VolumeLimit is remain in SMF
+			if rateElement.CCUnitType == charging_datatype.TIME && ue.TimeLimit != 0 {
+				unitInformation.Triggers = append(unitInformation.Triggers,
+					models.Trigger{
+						TriggerType:     models.TriggerType_TIME_LIMIT,
+						TriggerCategory: models.TriggerCategory_DEFERRED_REPORT,
+						TimeLimit:       ue.TimeLimit,
+					},
+				)
+			} else if rateElement.CCUnitType != charging_datatype.TIME && ue.VolumeLimit != 0 {
 				unitInformation.Triggers = append(unitInformation.Triggers,
 					models.Trigger{
 						TriggerType:     models.TriggerType_VOLUME_LIMIT,
@@ -543,6 +767,10 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 				)
 			}
 
+			if switchTime, ok := ue.TariffSwitchTime[rg]; ok {
+				unitInformation.Triggers = append(unitInformation.Triggers, tariffTimeChangeTrigger(switchTime))
+			}
+
 			// VolumeLimit for PDU session only need to add once
 			if ue.VolumeLimitPDU != 0 && unitUsageNum == 0 {
 				unitInformation.Triggers = append(unitInformation.Triggers,
@@ -562,27 +790,41 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 		case charging_datatype.REQ_SUBTYPE_DEBIT:
 			logger.ChargingdataPostLog.Warnf("Debit mode, will not further grant unit")
 			// retrived tarrif for final pricing
+			// ConsumedUnits is the total usage, including the usage after the tariff switch
 			sur.ServiceRating = &charging_datatype.ServiceRating{
-				ServiceIdentifier: datatype.Unsigned32(rg),
-				ConsumedUnits:     datatype.Unsigned32(totalUsaedUnit),
-				RequestSubType:    charging_datatype.REQ_SUBTYPE_DEBIT,
+				ServiceIdentifier:              datatype.Unsigned32(rg),
+				ConsumedUnits:                  datatype.Unsigned32(totalUsaedUnit),
+				ConsumedUnitsAfterTariffSwitch: datatype.Unsigned32(totalUsedAfterSwitch),
+				RequestSubType:                 charging_datatype.REQ_SUBTYPE_DEBIT,
 			}
 
-			serviceUsageRsp, err := rating.SendServiceUsageRequest(ue, sur)
+			serviceUsageRsp, err := rating.SendServiceUsageRequest(sur)
 			if err != nil {
 				logger.ChargingdataPostLog.Errorf("SendServiceUsageRequest err: %+v", err)
 				continue
 			}
 
-			if int64(serviceUsageRsp.ServiceRating.Price) < ue.ReservedQuota[rg] {
+			// The price in the currency of the tariff is deducted from the reserved quota in the currency of the account
+			price, err := monetary.Exchange(monetary.FromCCMoney(serviceUsageRsp.ServiceRating.Price),
+				ue.ReservedQuota[rg].CurrencyCode)
+			if err != nil {
+				logger.ChargingdataPostLog.Errorf("Price of rating group %d err: %+v", rg, err)
+				continue
+			}
+			reservedRemained, err := ue.ReservedQuota[rg].Sub(price)
+			if err != nil {
+				logger.ChargingdataPostLog.Errorf("Deduct price of rating group %d err: %+v", rg, err)
+				continue
+			}
+
+			if reservedRemained.Sign() > 0 {
 				// The final consumed quota is smaller than the reserved quota
 				// Therefore, return the extra reserved quota back to the user account
-				reservedRemained := ue.ReservedQuota[rg] - int64(serviceUsageRsp.ServiceRating.Price)
 				ccr.RequestedAction = charging_datatype.REFUND_ACCOUNT
 				ccr.MultipleServicesCreditControl = &charging_datatype.MultipleServicesCreditControl{
 					RatingGroup: datatype.Unsigned32(rg),
 					RequestedServiceUnit: &charging_datatype.RequestedServiceUnit{
-						CCTotalOctets: datatype.Unsigned64(reservedRemained),
+						CCMoney: reservedRemained.CCMoney(),
 					},
 				}
 				// Typically, the reserved quota will be exhausted for the flow (or PDU session)
@@ -593,28 +835,97 @@ func sessionChargingReservation(chargingData models.ChargingDataRequest) ([]mode
 			} else {
 				// The final consumed quota exceed the reserved quota
 				// Deduct the extra consumed quota from the user account
-				extraConsumed := int64(serviceUsageRsp.ServiceRating.Price) - ue.ReservedQuota[rg]
+				extraConsumed := reservedRemained.Neg()
 				ccr.RequestedAction = charging_datatype.DIRECT_DEBITING
 				ccr.CcRequestType = charging_datatype.TERMINATION_REQUEST
 				ccr.MultipleServicesCreditControl = &charging_datatype.MultipleServicesCreditControl{
 					RatingGroup: datatype.Unsigned32(rg),
 					UsedServiceUnit: &charging_datatype.UsedServiceUnit{
-						CCTotalOctets: datatype.Unsigned64(extraConsumed),
+						CCMoney: extraConsumed.CCMoney(),
 					},
 				}
+				if unitType == charging_datatype.TIME {
+					ccr.MultipleServicesCreditControl.UsedServiceUnit.CCTime = datatype.Unsigned32(totalUsedTime)
+				}
 			}
 
-			_, err = abmf.SendAccountDebitRequest(ue, ccr)
+			ue.AcctRequestNum[rg]++
+			_, err = abmf.SendAccountDebitRequest(ccr)
 			if err != nil {
 				logger.ChargingdataPostLog.Errorf("SendAccountDebitRequest err: %+v", err)
 				continue
 			}
-			ue.ReservedQuota[rg] = 0
+			ue.ReservedQuota[rg] = monetary.Value{}
 		}
 		multipleUnitInformation = append(multipleUnitInformation, unitInformation)
+		balanceChanged = true
+	}
 
-		ue.AcctRequestNum[rg]++
+	// Policy counters are derived from the account balance, report the change to PCF
+	if balanceChanged {
+		go NotifySpendingLimitStatus(AccountPolicyCounters{}, supi)
 	}
 
 	return multipleUnitInformation, partialRecord
 }
+
+func dnnOf(chargingData models.ChargingDataRequest) string {
+	if info := chargingData.PDUSessionChargingInformation; info != nil && info.PduSessionInformation != nil {
+		return info.PduSessionInformation.DnnId
+	}
+	return ""
+}
+
+// The charging mode is decided when the charging data resource is created
+func chargingModeOfSession(chargingDataRef string, chargingData models.ChargingDataRequest) chf_context.ChargingMode {
+	self := chf_context.CHF_Self()
+
+	if session, ok := self.ChargingSessionFindByRef(chargingDataRef); ok && session.ChargingMode != "" {
+		return session.ChargingMode
+	}
+	return self.ChargingModeOf(chargingData.SubscriberIdentifier, dnnOf(chargingData))
+}
+
+// In offline charging no quota is granted, the NF consumer reports by the volume and time limit
+func offlineChargingTriggers(ue *chf_context.ChfUe) []models.Trigger {
+	var triggers []models.Trigger
+
+	if ue.VolumeLimitPDU != 0 {
+		triggers = append(triggers, models.Trigger{
+			TriggerType:     models.TriggerType_VOLUME_LIMIT,
+			TriggerCategory: models.TriggerCategory_IMMEDIATE_REPORT,
+			VolumeLimit:     ue.VolumeLimitPDU,
+		})
+	}
+	if ue.TimeLimit != 0 {
+		triggers = append(triggers, models.Trigger{
+			TriggerType:     models.TriggerType_TIME_LIMIT,
+			TriggerCategory: models.TriggerCategory_IMMEDIATE_REPORT,
+			TimeLimit:       ue.TimeLimit,
+		})
+	}
+
+	return triggers
+}
+
+// The unit the rating group is rated in, before the tariff is retrieved
+// the usage is considered time based if only the time is requested
+func unitTypeOf(ue *chf_context.ChfUe, unitUsage models.MultipleUnitUsage) charging_datatype.CCUnitType {
+	if unitType, ok := ue.UnitType[unitUsage.RatingGroup]; ok {
+		return unitType
+	}
+	if requested := unitUsage.RequestedUnit; requested != nil && requested.Time != 0 && requested.TotalVolume == 0 {
+		return charging_datatype.TIME
+	}
+	return charging_datatype.TOTALOCTETS
+}
+
+func requestedUnitOf(requestedUnit *models.RequestedUnit, unitType charging_datatype.CCUnitType) int32 {
+	if requestedUnit == nil {
+		return 0
+	}
+	if unitType == charging_datatype.TIME {
+		return requestedUnit.Time
+	}
+	return requestedUnit.TotalVolume
+}
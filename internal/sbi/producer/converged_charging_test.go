@@ -0,0 +1,244 @@
+package producer
+
+import (
+	"net"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/fiorix/go-diameter/diam/datatype"
+	"github.com/fiorix/go-diameter/diam/diamtest"
+	"github.com/fiorix/go-diameter/diam/dict"
+	"github.com/fiorix/go-diameter/diam/sm"
+	"github.com/stretchr/testify/require"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	charging_dict "github.com/free5gc/chf/ccs_diameter/dict"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/diameter"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/internal/rating"
+	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+// testCcs is the RF and the ABMF of the CHF, the RF rates in seconds at 1 per second
+// and the ABMF grants the requested money
+type testCcs struct {
+	lock sync.Mutex
+	surs []charging_datatype.ServiceUsageRequest
+	ccrs []charging_datatype.AccountDebitRequest
+}
+
+func newTestCcs(t *testing.T) *testCcs {
+	require.NoError(t, charging_dict.LoadRateDictionary())
+	require.NoError(t, charging_dict.LoadAbmfDictionary())
+
+	ccs := &testCcs{}
+	self := chf_context.CHF_Self()
+	ratingCfg, abmfCfg := self.RatingCfg, self.AbmfCfg
+	ratingRouter, abmfRouter := self.RatingRouter, self.AbmfRouter
+	t.Cleanup(func() {
+		self.RatingCfg, self.AbmfCfg = ratingCfg, abmfCfg
+		self.RatingRouter, self.AbmfRouter = ratingRouter, abmfRouter
+	})
+
+	self.RatingCfg = testSettings("chf")
+	self.AbmfCfg = testSettings("chf")
+	self.RatingRouter = newTestRouter(t, "RF", self.RatingCfg, newTestServer(t, "rf", "SUR", ccs.handleSUR), "SUA")
+	self.AbmfRouter = newTestRouter(t, "ABMF", self.AbmfCfg, newTestServer(t, "abmf", "CCR", ccs.handleCCR), "CCA")
+
+	// The RF answers once its peer is open
+	require.Eventually(t, func() bool {
+		_, err := rating.SendServiceUsageRequest(&charging_datatype.ServiceUsageRequest{
+			ServiceRating: &charging_datatype.ServiceRating{RequestSubType: charging_datatype.REQ_SUBTYPE_AOC},
+		})
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	ccs.lock.Lock()
+	ccs.surs = nil
+	ccs.lock.Unlock()
+	return ccs
+}
+
+func testSettings(name string) *sm.Settings {
+	return &sm.Settings{
+		OriginHost:  datatype.DiameterIdentity(name),
+		OriginRealm: datatype.DiameterIdentity(name + ".realm"),
+		VendorID:    13,
+		ProductName: datatype.UTF8String(name),
+	}
+}
+
+func newTestServer(t *testing.T, name, command string, handle diam.HandlerFunc) *diamtest.Server {
+	mux := sm.New(testSettings(name))
+	mux.HandleFunc(command, handle)
+	srv := diamtest.NewServer(mux, dict.Default)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestRouter(t *testing.T, name string, settings *sm.Settings, srv *diamtest.Server,
+	answer string) *diameter.Router {
+	host, portStr, err := net.SplitHostPort(srv.Addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	cfg := &factory.Diameter{
+		Protocol: factory.DiameterProtocolTcp,
+		PoolSize: 1,
+		Peers:    []factory.DiameterPeer{{HostIPv4: host, Port: port}},
+	}
+	r := diameter.NewRouter(name, settings, cfg, logger.CtxLog, answer)
+	r.Start()
+	t.Cleanup(r.Stop)
+	return r
+}
+
+func (ccs *testCcs) handleSUR(c diam.Conn, m *diam.Message) {
+	var sur charging_datatype.ServiceUsageRequest
+	if err := m.Unmarshal(&sur); err != nil {
+		return
+	}
+	ccs.lock.Lock()
+	ccs.surs = append(ccs.surs, sur)
+	ccs.lock.Unlock()
+
+	serviceRating := &charging_datatype.ServiceRating{
+		ServiceIdentifier: sur.ServiceRating.ServiceIdentifier,
+		MonetaryTariff: &charging_datatype.MonetaryTariff{
+			RateElement: &charging_datatype.RateElement{
+				CCUnitType: charging_datatype.TIME,
+				UnitCost:   &charging_datatype.UnitCost{ValueDigits: 1},
+			},
+		},
+	}
+	switch sur.ServiceRating.RequestSubType {
+	case charging_datatype.REQ_SUBTYPE_AOC:
+		serviceRating.Price = &charging_datatype.CCMoney{
+			UnitValue: &charging_datatype.UnitValue{ValueDigits: datatype.Integer64(sur.ServiceRating.RequestedUnits)},
+		}
+	case charging_datatype.REQ_SUBTYPE_RESERVE:
+		serviceRating.AllowedUnits = sur.ServiceRating.RequestedUnits
+	case charging_datatype.REQ_SUBTYPE_DEBIT:
+		serviceRating.Price = &charging_datatype.CCMoney{
+			UnitValue: &charging_datatype.UnitValue{ValueDigits: datatype.Integer64(sur.ServiceRating.ConsumedUnits)},
+		}
+	}
+
+	a := m.Answer(diam.Success)
+	_ = a.Marshal(&charging_datatype.ServiceUsageResponse{
+		SessionId:     sur.SessionId,
+		OriginHost:    "rf",
+		OriginRealm:   "rf.realm",
+		ServiceRating: serviceRating,
+	})
+	_, _ = a.WriteTo(c)
+}
+
+func (ccs *testCcs) handleCCR(c diam.Conn, m *diam.Message) {
+	var ccr charging_datatype.AccountDebitRequest
+	if err := m.Unmarshal(&ccr); err != nil {
+		return
+	}
+	ccs.lock.Lock()
+	ccs.ccrs = append(ccs.ccrs, ccr)
+	ccs.lock.Unlock()
+
+	var granted *charging_datatype.CCMoney
+	if requested := ccr.MultipleServicesCreditControl.RequestedServiceUnit; requested != nil {
+		granted = requested.CCMoney
+	}
+	a := m.Answer(diam.Success)
+	_ = a.Marshal(&charging_datatype.AccountDebitResponse{
+		SessionId:       ccr.SessionId,
+		ResultCode:      diam.Success,
+		OriginHost:      "abmf",
+		OriginRealm:     "abmf.realm",
+		CcRequestType:   ccr.CcRequestType,
+		CcRequestNumber: ccr.CcRequestNumber,
+		MultipleServicesCreditControl: &charging_datatype.MultipleServicesCreditControl{
+			RatingGroup:        ccr.MultipleServicesCreditControl.RatingGroup,
+			GrantedServiceUnit: &charging_datatype.GrantedServiceUnit{CCMoney: granted},
+		},
+	})
+	_, _ = a.WriteTo(c)
+}
+
+func (ccs *testCcs) lastRequests() (charging_datatype.ServiceUsageRequest, charging_datatype.AccountDebitRequest) {
+	ccs.lock.Lock()
+	defer ccs.lock.Unlock()
+	return ccs.surs[len(ccs.surs)-1], ccs.ccrs[len(ccs.ccrs)-1]
+}
+
+func TestTimeBasedCharging(t *testing.T) {
+	factory.ChfConfig.Configuration = &factory.Configuration{
+		VolumeThresholdRate: 0.8,
+		TimeThresholdRate:   0.5,
+		ChargingPolicy:      &factory.ChargingPolicy{DefaultMode: string(chf_context.ChargingModeOnline)},
+	}
+	self := chf_context.CHF_Self()
+	sessionStore := self.SessionStore
+	self.SessionStore = chf_context.NullSessionStore{}
+	defer func() { self.SessionStore = sessionStore }()
+	ccs := newTestCcs(t)
+
+	supi := "imsi-208930000000004"
+	chargingData := models.ChargingDataRequest{
+		SubscriberIdentifier:     supi,
+		NfConsumerIdentification: &models.NfIdentification{NodeFunctionality: models.NodeFunctionality_SMF},
+	}
+	_, locationURI, problemDetails := ChargingDataCreate(chargingData)
+	require.Nil(t, problemDetails)
+	chargingDataRef := path.Base(locationURI)
+	defer self.DeleteChargingSession(chargingDataRef)
+	defer self.UePool.Delete(supi)
+
+	// The time only request is granted seconds, with the time threshold
+	chargingData.InvocationSequenceNumber = 1
+	chargingData.MultipleUnitUsage = []models.MultipleUnitUsage{{
+		RatingGroup:   1,
+		RequestedUnit: &models.RequestedUnit{Time: 60},
+	}}
+	response, problemDetails := ChargingDataUpdate(chargingData, chargingDataRef)
+	require.Nil(t, problemDetails)
+	require.Len(t, response.MultipleUnitInformation, 1)
+	unitInformation := response.MultipleUnitInformation[0]
+	require.Equal(t, &models.GrantedUnit{Time: 60}, unitInformation.GrantedUnit)
+	require.Equal(t, int32(30), unitInformation.TimeQuotaThreshold)
+	require.Zero(t, unitInformation.VolumeQuotaThreshold)
+
+	_, ccr := ccs.lastRequests()
+	require.Equal(t, datatype.Unsigned32(60), ccr.MultipleServicesCreditControl.RequestedServiceUnit.CCTime)
+
+	// The used seconds are reported to the ABMF and the RF, and recorded in the CDR
+	chargingData.InvocationSequenceNumber = 2
+	chargingData.MultipleUnitUsage = []models.MultipleUnitUsage{{
+		RatingGroup:   1,
+		RequestedUnit: &models.RequestedUnit{Time: 60},
+		UsedUnitContainer: []models.UsedUnitContainer{{
+			QuotaManagementIndicator: models.QuotaManagementIndicator_ONLINE_CHARGING,
+			LocalSequenceNumber:      1,
+			Time:                     30,
+		}},
+	}}
+	response, problemDetails = ChargingDataUpdate(chargingData, chargingDataRef)
+	require.Nil(t, problemDetails)
+	require.Len(t, response.MultipleUnitInformation, 1)
+	require.Equal(t, &models.GrantedUnit{Time: 60}, response.MultipleUnitInformation[0].GrantedUnit)
+
+	sur, ccr := ccs.lastRequests()
+	require.Equal(t, datatype.Unsigned32(30), ccr.MultipleServicesCreditControl.UsedServiceUnit.CCTime)
+	require.Equal(t, datatype.Unsigned32(30), sur.ServiceRating.ConsumedUnits)
+
+	ue, ok := self.ChfUeFindBySupi(supi)
+	require.True(t, ok)
+	usage := ue.Cdr[chargingDataRef].ChargingFunctionRecord.ListOfMultipleUnitUsage
+	require.Len(t, usage, 2)
+	require.Len(t, usage[1].UsedUnitContainers, 1)
+	require.Equal(t, int64(30), usage[1].UsedUnitContainers[0].Time.Value)
+}
@@ -0,0 +1,147 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/fiorix/go-diameter/diam/datatype"
+	charging_code "github.com/free5gc/chf/ccs_diameter/code"
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/internal/abmf"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/internal/rating"
+	"github.com/free5gc/chf/pkg/identity"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/openapi/models"
+)
+
+// 32.290 5.2.2.2 Immediate event charging: the CHF prices the service specific units
+// of the one time event and debits them from the account at once.
+// The event is granted if at least one rating group is debited.
+func immediateEventCharging(ue *chf_context.ChfUe,
+	chargingData models.ChargingDataRequest) ([]models.MultipleUnitInformation, bool) {
+	var multipleUnitInformation []models.MultipleUnitInformation
+	var balanceChanged bool
+
+	self := chf_context.CHF_Self()
+	subscriberIdentifier := identity.SubscriptionId(ue.Supi)
+
+	granted := len(chargingData.MultipleUnitUsage) == 0
+	for _, unitUsage := range chargingData.MultipleUnitUsage {
+		rg := unitUsage.RatingGroup
+		units := eventUnitsOf(unitUsage)
+
+		unitInformation := models.MultipleUnitInformation{
+			RatingGroup: rg,
+			UPFID:       unitUsage.UPFID,
+		}
+
+		sur := &charging_datatype.ServiceUsageRequest{
+			SessionId:      datatype.UTF8String(ue.RateSessionId),
+			OriginHost:     datatype.DiameterIdentity(self.RatingCfg.OriginHost),
+			OriginRealm:    datatype.DiameterIdentity(self.RatingCfg.OriginRealm),
+			ActualTime:     datatype.Time(time.Now()),
+			SubscriptionId: subscriberIdentifier,
+			UserName:       datatype.OctetString(self.Name),
+			ServiceRating: &charging_datatype.ServiceRating{
+				ServiceIdentifier: datatype.Unsigned32(rg),
+				ConsumedUnits:     datatype.Unsigned32(units),
+				RequestSubType:    charging_datatype.REQ_SUBTYPE_DEBIT,
+			},
+		}
+
+		serviceUsageRsp, err := rating.SendServiceUsageRequest(sur)
+		if err != nil {
+			logger.ChargingdataPostLog.Errorf("SendServiceUsageRequest err: %+v", err)
+			unitInformation.ResultCode = models.ResultCode_RATING_FAILED
+			multipleUnitInformation = append(multipleUnitInformation, unitInformation)
+			continue
+		}
+		price := monetary.FromCCMoney(serviceUsageRsp.ServiceRating.Price)
+
+		ccr := &charging_datatype.AccountDebitRequest{
+			SessionId:       datatype.UTF8String(ue.AcctSessionId),
+			OriginHost:      datatype.DiameterIdentity(self.AbmfCfg.OriginHost),
+			OriginRealm:     datatype.DiameterIdentity(self.AbmfCfg.OriginRealm),
+			EventTimestamp:  datatype.Time(time.Now()),
+			SubscriptionId:  subscriberIdentifier,
+			UserName:        datatype.OctetString(self.Name),
+			CcRequestNumber: datatype.Unsigned32(ue.AcctRequestNum[rg]),
+			CcRequestType:   charging_datatype.EVENT_REQUEST,
+			RequestedAction: charging_datatype.DIRECT_DEBITING,
+			MultipleServicesCreditControl: &charging_datatype.MultipleServicesCreditControl{
+				RatingGroup: datatype.Unsigned32(rg),
+				UsedServiceUnit: &charging_datatype.UsedServiceUnit{
+					CCMoney:                price.CCMoney(),
+					CCServiceSpecificUnits: datatype.Unsigned64(units),
+				},
+			},
+		}
+		ue.AcctRequestNum[rg]++
+
+		acctDebitRsp, err := abmf.SendAccountDebitRequest(ccr)
+		if err != nil {
+			logger.ChargingdataPostLog.Errorf("SendAccountDebitRequest err: %+v", err)
+			unitInformation.ResultCode = models.ResultCode_END_USER_SERVICE_DENIED
+			multipleUnitInformation = append(multipleUnitInformation, unitInformation)
+			continue
+		}
+
+		if mscc := acctDebitRsp.MultipleServicesCreditControl; mscc == nil ||
+			mscc.ResultCode == charging_code.CreditLimitReached {
+			logger.ChargingdataPostLog.Warnf("UE %s rating group %d: credit limit reached, price %v", ue.Supi, rg, price)
+			unitInformation.ResultCode = models.ResultCode_QUOTA_LIMIT_REACHED
+			multipleUnitInformation = append(multipleUnitInformation, unitInformation)
+			continue
+		}
+
+		unitInformation.ResultCode = models.ResultCode_SUCCESS
+		unitInformation.GrantedUnit = &models.GrantedUnit{
+			ServiceSpecificUnits: int32(units),
+		}
+		multipleUnitInformation = append(multipleUnitInformation, unitInformation)
+		granted = true
+		balanceChanged = true
+	}
+
+	// Policy counters are derived from the account balance, report the change to PCF
+	if balanceChanged {
+		go NotifySpendingLimitStatus(AccountPolicyCounters{}, ue.Supi)
+	}
+
+	return multipleUnitInformation, granted
+}
+
+// The service specific units of the event, an event without units is charged as one unit
+func eventUnitsOf(unitUsage models.MultipleUnitUsage) uint32 {
+	var units uint32
+
+	if unitUsage.RequestedUnit != nil {
+		units = uint32(unitUsage.RequestedUnit.ServiceSpecificUnits)
+	}
+	if units == 0 {
+		for _, usedUnit := range unitUsage.UsedUnitContainer {
+			units += uint32(usedUnit.ServiceSpecificUnits)
+		}
+	}
+	if units == 0 {
+		units = 1
+	}
+	return units
+}
+
+// grantedUnitUsage is the usage of the rating groups granted by the immediate event charging
+func grantedUnitUsage(unitUsages []models.MultipleUnitUsage,
+	unitInformations []models.MultipleUnitInformation) []models.MultipleUnitUsage {
+	var granted []models.MultipleUnitUsage
+	for _, unitUsage := range unitUsages {
+		for _, unitInformation := range unitInformations {
+			if unitInformation.RatingGroup == unitUsage.RatingGroup &&
+				unitInformation.ResultCode == models.ResultCode_SUCCESS {
+				granted = append(granted, unitUsage)
+				break
+			}
+		}
+	}
+	return granted
+}
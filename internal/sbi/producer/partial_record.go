@@ -0,0 +1,156 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/free5gc/chf/cdr/cdrConvert"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+const (
+	PartialRecordMethodDefault    = "default"
+	PartialRecordMethodIndividual = "individual"
+)
+
+// partialRecordCauseOf decides whether the CDR of the charging session is closed as a partial record
+// once the usage of chargingData is added to it, and returns the cause for record closing.
+// reported tells the NF consumer reported an immediate volume or time limit.
+// The conditions are checked on each charging data request of the session, no timer is armed:
+// the time limit closes the record at the first update after it elapsed, or the record is closed
+// with the termination of the session.
+func partialRecordCauseOf(record *cdrType.CHFRecord, chargingData models.ChargingDataRequest,
+	reported bool) (int64, bool) {
+	cause := causeForRecClosingOf(chargingData, true)
+	if reported {
+		return cause, true
+	}
+
+	// Individual method: the container closed by a charging condition change of the NF consumer is kept
+	// in a partial record of its own. The default method keeps the containers until a condition below is met.
+	if method := partialRecordMethodOfRecord(record); method != nil &&
+		method.Value == cdrType.PartialRecordMethodPresentIndividual && containerClosedByTrigger(chargingData) {
+		return cause, true
+	}
+
+	conditions := factory.ChfConfig.Configuration.PartialRecord
+	if conditions == nil {
+		return cause, false
+	}
+
+	for _, trigger := range triggersOf(chargingData) {
+		switch {
+		case trigger.TriggerType == models.TriggerType_SERVING_NODE_CHANGE && conditions.ServingNodeChange:
+			return cdrType.CauseForRecClosingPresentServingNodeChange, true
+		case trigger.TriggerType == models.TriggerType_RAT_CHANGE && conditions.RatChange:
+			return cdrType.CauseForRecClosingPresentRATChange, true
+		}
+	}
+
+	chfCdr := record.ChargingFunctionRecord
+
+	var volume uint64
+	var chargingConditions int
+	for _, unitUsage := range chfCdr.ListOfMultipleUnitUsage {
+		for _, usedUnit := range unitUsage.UsedUnitContainers {
+			volume += usedVolumeOf(usedUnit)
+			chargingConditions++
+		}
+	}
+
+	if conditions.VolumeLimit != 0 && volume >= conditions.VolumeLimit {
+		return cdrType.CauseForRecClosingPresentVolumeLimit, true
+	}
+	if conditions.TimeLimit != 0 {
+		openingTime, err := cdrConvert.TimeStampFromCdr(chfCdr.RecordOpeningTime)
+		if err == nil && time.Since(openingTime) >= time.Duration(conditions.TimeLimit)*time.Second {
+			return cdrType.CauseForRecClosingPresentTimeLimit, true
+		}
+	}
+	if conditions.MaxChargingConditions != 0 && chargingConditions >= conditions.MaxChargingConditions {
+		return cdrType.CauseForRecClosingPresentMaxChangeCond, true
+	}
+
+	return cause, false
+}
+
+// partialRecordMethodOf is the Partial Record Method of the session, the one of the roaming charging profile
+// of the NF consumer, else the configured one. It is recorded in the roaming charging profile of the CDR.
+func partialRecordMethodOf(chargingData models.ChargingDataRequest) *cdrType.PartialRecordMethod {
+	var method models.PartialRecordMethod
+	if roaming := chargingData.RoamingQBCInformation; roaming != nil && roaming.RoamingChargingProfile != nil {
+		method = roaming.RoamingChargingProfile.PartialRecordMethod
+	}
+	if conditions := factory.ChfConfig.Configuration.PartialRecord; method == "" && conditions != nil {
+		switch conditions.Method {
+		case PartialRecordMethodDefault:
+			method = models.PartialRecordMethod_DEFAULT
+		case PartialRecordMethodIndividual:
+			method = models.PartialRecordMethod_INDIVIDUAL
+		}
+	}
+
+	switch method {
+	case models.PartialRecordMethod_DEFAULT:
+		return &cdrType.PartialRecordMethod{Value: cdrType.PartialRecordMethodPresentDefault}
+	case models.PartialRecordMethod_INDIVIDUAL:
+		return &cdrType.PartialRecordMethod{Value: cdrType.PartialRecordMethodPresentIndividual}
+	}
+	return nil
+}
+
+func partialRecordMethodOfRecord(record *cdrType.CHFRecord) *cdrType.PartialRecordMethod {
+	roaming := record.ChargingFunctionRecord.RoamingQBCInformation
+	if roaming == nil || roaming.RoamingChargingProfile == nil {
+		return nil
+	}
+	return roaming.RoamingChargingProfile.PartialRecordMethod
+}
+
+// The NF consumer closes the container at a charging condition change with its trigger
+func containerClosedByTrigger(chargingData models.ChargingDataRequest) bool {
+	for _, unitUsage := range chargingData.MultipleUnitUsage {
+		for _, usedUnit := range unitUsage.UsedUnitContainer {
+			if len(usedUnit.Triggers) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Close the CDR as a partial record, the first partial record of a session is numbered 1
+func closePartialRecord(record *cdrType.CHFRecord, cause int64) error {
+	if record.ChargingFunctionRecord.RecordSequenceNumber == nil {
+		recordSequenceNumber := int64(1)
+		record.ChargingFunctionRecord.RecordSequenceNumber = &recordSequenceNumber
+	}
+	return CloseCDR(record, cause)
+}
+
+func usedVolumeOf(usedUnit cdrType.UsedUnitContainer) uint64 {
+	if usedUnit.DataTotalVolume != nil && usedUnit.DataTotalVolume.Value != 0 {
+		return uint64(usedUnit.DataTotalVolume.Value)
+	}
+
+	var volume uint64
+	if usedUnit.DataVolumeUplink != nil {
+		volume += uint64(usedUnit.DataVolumeUplink.Value)
+	}
+	if usedUnit.DataVolumeDownlink != nil {
+		volume += uint64(usedUnit.DataVolumeDownlink.Value)
+	}
+	return volume
+}
+
+// The triggers of the request and of its used unit containers
+func triggersOf(chargingData models.ChargingDataRequest) []models.Trigger {
+	triggers := append([]models.Trigger{}, chargingData.Triggers...)
+	for _, unitUsage := range chargingData.MultipleUnitUsage {
+		for _, usedUnit := range unitUsage.UsedUnitContainer {
+			triggers = append(triggers, usedUnit.Triggers...)
+		}
+	}
+	return triggers
+}
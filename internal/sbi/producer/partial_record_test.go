@@ -0,0 +1,193 @@
+package producer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/cdr/cdrConvert"
+	"github.com/free5gc/chf/cdr/cdrType"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestPartialRecordMethod(t *testing.T) {
+	factory.ChfConfig.Configuration = &factory.Configuration{
+		PartialRecord: &factory.PartialRecord{Method: PartialRecordMethodDefault},
+	}
+
+	// The roaming charging profile of the NF consumer overrides the configured method
+	chargingData := models.ChargingDataRequest{
+		RoamingQBCInformation: &models.RoamingQbcInformation{
+			RoamingChargingProfile: &models.RoamingChargingProfile{
+				PartialRecordMethod: models.PartialRecordMethod_INDIVIDUAL,
+			},
+		},
+	}
+	method := partialRecordMethodOf(chargingData)
+	require.Equal(t, cdrType.PartialRecordMethodPresentIndividual, method.Value)
+
+	record := &cdrType.CHFRecord{
+		ChargingFunctionRecord: &cdrType.ChargingRecord{
+			RoamingQBCInformation: &cdrType.RoamingQBCInformation{
+				RoamingChargingProfile: &cdrType.RoamingChargingProfile{PartialRecordMethod: method},
+			},
+		},
+	}
+
+	// The usage report without a charging condition change is kept in the record
+	chargingData.MultipleUnitUsage = []models.MultipleUnitUsage{{
+		RatingGroup:       1,
+		UsedUnitContainer: []models.UsedUnitContainer{{TotalVolume: 100}},
+	}}
+	_, closed := partialRecordCauseOf(record, chargingData, false)
+	require.False(t, closed)
+
+	// The container closed by a charging condition change gets a partial record of its own
+	chargingData.MultipleUnitUsage[0].UsedUnitContainer[0].Triggers = []models.Trigger{
+		{TriggerType: models.TriggerType_QOS_CHANGE},
+	}
+	_, closed = partialRecordCauseOf(record, chargingData, false)
+	require.True(t, closed)
+
+	// The default method keeps the container until a partial record condition is met
+	record.ChargingFunctionRecord.RoamingQBCInformation.RoamingChargingProfile.PartialRecordMethod =
+		partialRecordMethodOf(models.ChargingDataRequest{})
+	_, closed = partialRecordCauseOf(record, chargingData, false)
+	require.False(t, closed)
+}
+
+func TestPartialRecordConditions(t *testing.T) {
+	openedAt := func(ago time.Duration) cdrType.TimeStamp {
+		openingTime := time.Now().Add(-ago)
+		return cdrConvert.TimeStampToCdr(&openingTime)
+	}
+	containers := func(n int, volume int64) []cdrType.MultipleUnitUsage {
+		usedUnits := make([]cdrType.UsedUnitContainer, n)
+		for i := range usedUnits {
+			usedUnits[i].DataTotalVolume = &cdrType.DataVolumeOctets{Value: volume}
+		}
+		return []cdrType.MultipleUnitUsage{{UsedUnitContainers: usedUnits}}
+	}
+	triggered := func(triggerType models.TriggerType) models.ChargingDataRequest {
+		return models.ChargingDataRequest{Triggers: []models.Trigger{{TriggerType: triggerType}}}
+	}
+
+	testCases := []struct {
+		name         string
+		conditions   factory.PartialRecord
+		record       cdrType.ChargingRecord
+		chargingData models.ChargingDataRequest
+		closed       bool
+		cause        int64
+	}{
+		{
+			name:       "volume below the limit",
+			conditions: factory.PartialRecord{VolumeLimit: 1000},
+			record:     cdrType.ChargingRecord{RecordOpeningTime: openedAt(0), ListOfMultipleUnitUsage: containers(1, 999)},
+		},
+		{
+			name:       "volume limit",
+			conditions: factory.PartialRecord{VolumeLimit: 1000},
+			record:     cdrType.ChargingRecord{RecordOpeningTime: openedAt(0), ListOfMultipleUnitUsage: containers(2, 500)},
+			closed:     true,
+			cause:      cdrType.CauseForRecClosingPresentVolumeLimit,
+		},
+		{
+			name:       "time below the limit",
+			conditions: factory.PartialRecord{TimeLimit: 60},
+			record:     cdrType.ChargingRecord{RecordOpeningTime: openedAt(30 * time.Second)},
+		},
+		{
+			name:       "time limit",
+			conditions: factory.PartialRecord{TimeLimit: 60},
+			record:     cdrType.ChargingRecord{RecordOpeningTime: openedAt(time.Minute)},
+			closed:     true,
+			cause:      cdrType.CauseForRecClosingPresentTimeLimit,
+		},
+		{
+			name:       "charging conditions below the maximum",
+			conditions: factory.PartialRecord{MaxChargingConditions: 3},
+			record:     cdrType.ChargingRecord{RecordOpeningTime: openedAt(0), ListOfMultipleUnitUsage: containers(2, 0)},
+		},
+		{
+			name:       "max charging conditions",
+			conditions: factory.PartialRecord{MaxChargingConditions: 3},
+			record:     cdrType.ChargingRecord{RecordOpeningTime: openedAt(0), ListOfMultipleUnitUsage: containers(3, 0)},
+			closed:     true,
+			cause:      cdrType.CauseForRecClosingPresentMaxChangeCond,
+		},
+		{
+			name:         "serving node change",
+			conditions:   factory.PartialRecord{ServingNodeChange: true},
+			record:       cdrType.ChargingRecord{RecordOpeningTime: openedAt(0)},
+			chargingData: triggered(models.TriggerType_SERVING_NODE_CHANGE),
+			closed:       true,
+			cause:        cdrType.CauseForRecClosingPresentServingNodeChange,
+		},
+		{
+			name:         "serving node change disabled",
+			record:       cdrType.ChargingRecord{RecordOpeningTime: openedAt(0)},
+			chargingData: triggered(models.TriggerType_SERVING_NODE_CHANGE),
+		},
+		{
+			name:         "RAT change",
+			conditions:   factory.PartialRecord{RatChange: true},
+			record:       cdrType.ChargingRecord{RecordOpeningTime: openedAt(0)},
+			chargingData: triggered(models.TriggerType_RAT_CHANGE),
+			closed:       true,
+			cause:        cdrType.CauseForRecClosingPresentRATChange,
+		},
+		{
+			name:         "RAT change disabled",
+			record:       cdrType.ChargingRecord{RecordOpeningTime: openedAt(0)},
+			chargingData: triggered(models.TriggerType_RAT_CHANGE),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conditions := tc.conditions
+			factory.ChfConfig.Configuration = &factory.Configuration{PartialRecord: &conditions}
+
+			record := tc.record
+			cause, closed := partialRecordCauseOf(&cdrType.CHFRecord{ChargingFunctionRecord: &record}, tc.chargingData, false)
+			require.Equal(t, tc.closed, closed)
+			if tc.closed {
+				require.Equal(t, tc.cause, cause)
+			}
+		})
+	}
+}
+
+func TestPartialRecordNumbering(t *testing.T) {
+	factory.ChfConfig.Configuration = &factory.Configuration{}
+
+	ue, err := chf_context.CHF_Self().NewCHFUe("imsi-208930000000003")
+	require.NoError(t, err)
+	defer chf_context.CHF_Self().UePool.Delete(ue.Supi)
+
+	chargingData := models.ChargingDataRequest{NfConsumerIdentification: &models.NfIdentification{}}
+	record, err := OpenCDR(chargingData, ue, "ref", false)
+	require.NoError(t, err)
+	ue.Cdr["ref"] = record
+	require.Nil(t, record.ChargingFunctionRecord.RecordSequenceNumber)
+
+	// Each partial record of the session is numbered from 1 and gets a local record sequence number of its own
+	localRecordSequenceNumbers := map[int64]bool{}
+	for recordSequenceNumber := int64(1); recordSequenceNumber <= 3; recordSequenceNumber++ {
+		require.NoError(t, closePartialRecord(record, cdrType.CauseForRecClosingPresentPartialRecord))
+		require.Equal(t, recordSequenceNumber, *record.ChargingFunctionRecord.RecordSequenceNumber)
+		localRecordSequenceNumber := record.ChargingFunctionRecord.LocalRecordSequenceNumber.Value
+		require.False(t, localRecordSequenceNumbers[localRecordSequenceNumber])
+		localRecordSequenceNumbers[localRecordSequenceNumber] = true
+
+		reopened, err := OpenCDR(chargingData, ue, "ref", true)
+		require.NoError(t, err)
+		require.Same(t, record, reopened)
+		require.Equal(t, recordSequenceNumber+1, *record.ChargingFunctionRecord.RecordSequenceNumber)
+		require.NotEqual(t, localRecordSequenceNumber, record.ChargingFunctionRecord.LocalRecordSequenceNumber.Value)
+	}
+}
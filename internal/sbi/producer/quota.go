@@ -0,0 +1,98 @@
+package producer
+
+import (
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/pkg/monetary"
+)
+
+// The unit cost of the tariff in the currency of the tariff
+func unitCostOf(tariff *charging_datatype.MonetaryTariff) monetary.Value {
+	if tariff.RateElement == nil {
+		return monetary.Value{CurrencyCode: uint32(tariff.CurrencyCode)}
+	}
+	return monetary.FromUnitCost(tariff.RateElement.UnitCost, uint32(tariff.CurrencyCode))
+}
+
+// updateValidUnits keeps the tariff of the rating answer applied after its ValidUnits,
+// 32.296 6.4.3: the tariff changes once the free allowance or the tier is used up
+func updateValidUnits(ue *chf_context.ChfUe, rg int32, serviceRating *charging_datatype.ServiceRating) {
+	afterTariff := serviceRating.MonetaryTariffAfterValidUnits
+	if afterTariff == nil || afterTariff.RateElement == nil {
+		delete(ue.ValidUnits, rg)
+		delete(ue.UnitCostAfterValidUnits, rg)
+		return
+	}
+
+	ue.ValidUnits[rg] = uint32(serviceRating.ValidUnits)
+	ue.UnitCostAfterValidUnits[rg] = unitCostOf((*charging_datatype.MonetaryTariff)(afterTariff))
+}
+
+// The money of the used units in the currency of the reserved quota, the usage after the tariff switch is
+// priced with the next unit cost. The usage beyond the valid units is priced with the unit cost after them,
+// the units before the tariff switch are used first.
+func usedQuotaOf(ue *chf_context.ChfUe, rg int32, usedUnit, usedUnitAfterSwitch uint32) (monetary.Value, error) {
+	if usedUnitAfterSwitch > usedUnit {
+		usedUnitAfterSwitch = usedUnit
+	}
+	usedUnitBeforeSwitch := usedUnit - usedUnitAfterSwitch
+
+	unitCostAfterValid, limited := ue.UnitCostAfterValidUnits[rg]
+	validUnits := ue.ValidUnits[rg]
+	// split the units into the ones within the valid units and the ones beyond
+	split := func(units uint32) (uint32, uint32) {
+		if !limited {
+			return units, 0
+		}
+		valid := units
+		if valid > validUnits {
+			valid = validUnits
+		}
+		validUnits -= valid
+		return valid, units - valid
+	}
+
+	var usedQuota monetary.Value
+	price := func(unitCost monetary.Value, units uint32) error {
+		quota, err := unitCost.Mul(uint64(units))
+		if err != nil {
+			return err
+		}
+		usedQuota, err = usedQuota.Add(quota)
+		return err
+	}
+
+	usedUnitBeforeSwitch, beyondBeforeSwitch := split(usedUnitBeforeSwitch)
+	usedUnitAfterSwitch, beyondAfterSwitch := split(usedUnitAfterSwitch)
+	if err := price(ue.UnitCost[rg], usedUnitBeforeSwitch); err != nil {
+		return monetary.Value{}, err
+	}
+	if err := price(ue.NextUnitCost[rg], usedUnitAfterSwitch); err != nil {
+		return monetary.Value{}, err
+	}
+	if err := price(unitCostAfterValid, beyondBeforeSwitch+beyondAfterSwitch); err != nil {
+		return monetary.Value{}, err
+	}
+	return monetary.Exchange(usedQuota, ue.ReservedQuota[rg].CurrencyCode)
+}
+
+// The money to reserve for the requested units besides the reserved quota,
+// a reserved quota short of the usage is requested as well
+func requestedQuotaOf(ue *chf_context.ChfUe, rg int32, requestedUnit uint32) (monetary.Value, error) {
+	reserved := ue.ReservedQuota[rg]
+
+	requestedQuota, err := ue.UnitCost[rg].Mul(uint64(requestedUnit))
+	if err != nil {
+		return monetary.Value{}, err
+	}
+	if requestedQuota, err = monetary.Exchange(requestedQuota, reserved.CurrencyCode); err != nil {
+		return monetary.Value{}, err
+	}
+	if requestedQuota, err = requestedQuota.Sub(reserved); err != nil {
+		return monetary.Value{}, err
+	}
+	if requestedQuota.Sign() < 0 {
+		return monetary.Value{CurrencyCode: requestedQuota.CurrencyCode}, nil
+	}
+	return requestedQuota, nil
+}
@@ -0,0 +1,41 @@
+package producer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/pkg/monetary"
+)
+
+func TestUsedQuotaAfterValidUnits(t *testing.T) {
+	cost := func(s string) monetary.Value {
+		value, err := monetary.Parse(s, monetary.DefaultCurrencyCode)
+		require.NoError(t, err)
+		return value
+	}
+	ue := &chf_context.ChfUe{
+		ReservedQuota:           map[int32]monetary.Value{1: cost("100")},
+		UnitCost:                map[int32]monetary.Value{1: cost("0")},
+		NextUnitCost:            map[int32]monetary.Value{1: cost("2")},
+		ValidUnits:              map[int32]uint32{1: 10},
+		UnitCostAfterValidUnits: map[int32]monetary.Value{1: cost("1")},
+	}
+
+	// The free allowance of 10 units is used, the 5 units beyond it are priced
+	usedQuota, err := usedQuotaOf(ue, 1, 15, 0)
+	require.NoError(t, err)
+	require.Equal(t, "5", usedQuota.String())
+
+	// The valid units are used before the tariff switch first
+	usedQuota, err = usedQuotaOf(ue, 1, 15, 8)
+	require.NoError(t, err)
+	require.Equal(t, "11", usedQuota.String())
+
+	// The tariff without valid units prices the whole usage
+	delete(ue.UnitCostAfterValidUnits, 1)
+	usedQuota, err = usedQuotaOf(ue, 1, 15, 0)
+	require.NoError(t, err)
+	require.Equal(t, "0", usedQuota.String())
+}
@@ -0,0 +1,129 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/fiorix/go-diameter/diam/datatype"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/cdr/cdrType"
+	"github.com/free5gc/chf/internal/abmf"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/identity"
+	"github.com/free5gc/chf/pkg/monetary"
+)
+
+const reconcileRetryInterval = 30 * time.Second
+
+// RecoverChargingSessions rehydrates the charging sessions persisted before the CHF restart.
+// The reservation of a restored session is kept until its quota validity time expires,
+// if the NF consumer does not report within that time the session is regarded as orphaned:
+// the reserved quota is refunded to the ABMF and the open CDRs are closed.
+func RecoverChargingSessions() {
+	self := chf_context.CHF_Self()
+
+	for _, ue := range self.RestoreChfUes() {
+		validity := time.Duration(ue.QuotaValidityTime) * time.Second
+		lastActivity := ue.LastActivity
+		wait := time.Until(lastActivity.Add(validity))
+		if wait < 0 {
+			wait = 0
+		}
+
+		restored := ue
+		time.AfterFunc(wait, func() {
+			reconcileOrphanedSession(restored, lastActivity)
+		})
+	}
+}
+
+func reconcileOrphanedSession(ue *chf_context.ChfUe, lastActivity time.Time) {
+	self := chf_context.CHF_Self()
+
+	ue.CULock.Lock()
+	defer ue.CULock.Unlock()
+
+	// The NF consumer has resumed the session after restart
+	if !ue.LastActivity.Equal(lastActivity) {
+		return
+	}
+
+	logger.ChargingdataPostLog.Warnf("Reconcile orphaned charging session of UE %s", ue.Supi)
+
+	refunded := refundReservedQuota(ue)
+
+	// Keep the session until all the reservations are returned to the ABMF
+	if !refunded {
+		// persist the refunded part without touching the last activity
+		if err := self.SessionStore.Save(ue); err != nil {
+			logger.ChargingdataPostLog.Errorf("Save charging session of %s failed: %+v", ue.Supi, err)
+		}
+		time.AfterFunc(reconcileRetryInterval, func() {
+			reconcileOrphanedSession(ue, lastActivity)
+		})
+		return
+	}
+
+	var records []*cdrType.CHFRecord
+	for sessionId, cdr := range ue.Cdr {
+		if err := CloseCDR(cdr, cdrType.CauseForRecClosingPresentAbnormalRelease); err != nil {
+			logger.ChargingdataPostLog.Errorf("Close CDR of orphaned session %s failed: %+v", sessionId, err)
+			continue
+		}
+		records = append(records, cdr)
+		delete(ue.Cdr, sessionId)
+		self.DeleteChargingSession(sessionId)
+	}
+
+	if len(records) != 0 {
+		if err := dumpCdrFile(records); err != nil {
+			logger.ChargingdataPostLog.Errorf("Dump CDR of UE %s failed: %+v", ue.Supi, err)
+		}
+	}
+
+	self.SaveChfUe(ue)
+}
+
+// Return the reserved quota of all rating groups back to the ABMF,
+// the caller should hold ue.CULock
+func refundReservedQuota(ue *chf_context.ChfUe) bool {
+	self := chf_context.CHF_Self()
+
+	refunded := true
+	for rg, reserved := range ue.ReservedQuota {
+		if reserved.Sign() <= 0 {
+			continue
+		}
+
+		ccr := &charging_datatype.AccountDebitRequest{
+			SessionId:       datatype.UTF8String(ue.AcctSessionId),
+			OriginHost:      datatype.DiameterIdentity(self.AbmfCfg.OriginHost),
+			OriginRealm:     datatype.DiameterIdentity(self.AbmfCfg.OriginRealm),
+			EventTimestamp:  datatype.Time(time.Now()),
+			SubscriptionId:  identity.SubscriptionId(ue.Supi),
+			UserName:        datatype.OctetString(self.Name),
+			CcRequestNumber: datatype.Unsigned32(ue.AcctRequestNum[rg]),
+			CcRequestType:   charging_datatype.TERMINATION_REQUEST,
+			RequestedAction: charging_datatype.REFUND_ACCOUNT,
+			MultipleServicesCreditControl: &charging_datatype.MultipleServicesCreditControl{
+				RatingGroup: datatype.Unsigned32(rg),
+				RequestedServiceUnit: &charging_datatype.RequestedServiceUnit{
+					CCMoney: reserved.CCMoney(),
+				},
+			},
+		}
+
+		ue.AcctRequestNum[rg]++
+		if _, err := abmf.SendAccountDebitRequest(ccr); err != nil {
+			logger.ChargingdataPostLog.Errorf("Refund reservation of UE %s rating group %d failed: %+v",
+				ue.Supi, rg, err)
+			refunded = false
+			continue
+		}
+		ue.ReservedQuota[rg] = monetary.Value{}
+		ue.RatingType[rg] = charging_datatype.REQ_SUBTYPE_RESERVE
+	}
+
+	return refunded
+}
@@ -0,0 +1,142 @@
+package producer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/free5gc/chf/cdr/cdrType"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/httpwrapper"
+)
+
+// Causes of the CHF initiated charging session termination
+const (
+	TerminationCauseManagementIntervention = "MANAGEMENT_INTERVENTION"
+	TerminationCauseValidityTimeExpired    = "VALIDITY_TIME_EXPIRED"
+)
+
+func HandleTerminateChargingSession(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ChargingdataPostLog.Infof("HandleTerminateChargingSession")
+	chargingDataRef := request.Params["ChargingDataRef"]
+
+	problemDetails := TerminateChargingSession(chargingDataRef, TerminationCauseManagementIntervention)
+	if problemDetails == nil {
+		return httpwrapper.NewResponse(http.StatusAccepted, nil, nil)
+	}
+	return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+}
+
+// TerminateChargingSession asks the NF consumer to abort the charging session,
+// if the session is not released before the termination timeout,
+// the CHF closes the CDR with managementIntervention by itself
+func TerminateChargingSession(chargingDataRef string, cause string) *models.ProblemDetails {
+	self := chf_context.CHF_Self()
+
+	session, ok := self.ChargingSessionFindByRef(chargingDataRef)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return problemDetails
+	}
+	ue, ok := self.ChfUeFindBySupi(session.Supi)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return problemDetails
+	}
+
+	logger.ChargingdataPostLog.Warnf("Terminate charging session %s of UE %s: %s", chargingDataRef, ue.Supi, cause)
+
+	ue.CULock.Lock()
+	session.TerminationRequested = true
+	session.TerminationCause = cause
+	notifyUri := ue.NotifyUri
+	ue.CULock.Unlock()
+
+	notifyRequest := models.ChargingNotifyRequest{
+		NotificationType: models.NotificationType_ABORT_CHARGING,
+	}
+	go SendChargingNotification(notifyUri, notifyRequest)
+
+	session.StartTimer(terminationTimeout(), func() {
+		forceReleaseChargingSession(chargingDataRef)
+	})
+
+	return nil
+}
+
+// Close the charging session the NF consumer failed to release in time
+func forceReleaseChargingSession(chargingDataRef string) {
+	self := chf_context.CHF_Self()
+
+	ue, ok := self.ChfUeFindByChargingDataRef(chargingDataRef)
+	if !ok {
+		return
+	}
+
+	ue.CULock.Lock()
+	defer ue.CULock.Unlock()
+
+	cdr, ok := ue.Cdr[chargingDataRef]
+	if !ok {
+		return
+	}
+
+	logger.ChargingdataPostLog.Warnf("Charging session %s is not released in time, close it", chargingDataRef)
+
+	// The reservation is shared by the sessions of the UE, only refund it with the last session
+	if len(ue.Cdr) == 1 {
+		refundReservedQuota(ue)
+	}
+
+	if err := CloseCDR(cdr, cdrType.CauseForRecClosingPresentManagementIntervention); err != nil {
+		logger.ChargingdataPostLog.Errorf("Close CDR of session %s failed: %+v", chargingDataRef, err)
+	}
+
+	if err := dumpCdrFile([]*cdrType.CHFRecord{cdr}); err != nil {
+		logger.ChargingdataPostLog.Errorf("Dump CDR of UE %s failed: %+v", ue.Supi, err)
+	}
+
+	delete(ue.Cdr, chargingDataRef)
+	self.DeleteChargingSession(chargingDataRef)
+	self.SaveChfUe(ue)
+}
+
+// Supervise the charging session with the quota validity time, the session is terminated if the NF consumer
+// does not report within it and the grace period: the consumer reports at the expiry of the validity time
+func startValidityTimer(chargingDataRef string, validityTime int32) {
+	self := chf_context.CHF_Self()
+
+	session, ok := self.ChargingSessionFindByRef(chargingDataRef)
+	if !ok || session.TerminationRequested || validityTime == 0 {
+		return
+	}
+
+	session.StartTimer(time.Duration(validityTime)*time.Second+validityGracePeriod(), func() {
+		if problemDetails := TerminateChargingSession(chargingDataRef,
+			TerminationCauseValidityTimeExpired); problemDetails != nil {
+			logger.ChargingdataPostLog.Warnf("Terminate charging session %s failed: %+v", chargingDataRef, problemDetails)
+		}
+	})
+}
+
+func validityGracePeriod() time.Duration {
+	if gracePeriod := factory.ChfConfig.Configuration.ValidityGracePeriod; gracePeriod > 0 {
+		return time.Duration(gracePeriod) * time.Second
+	}
+	return factory.ChfDefaultValidityGracePeriod * time.Second
+}
+
+func terminationTimeout() time.Duration {
+	if timeout := factory.ChfConfig.Configuration.TerminationTimeout; timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+	return factory.ChfDefaultTerminationTimeout * time.Second
+}
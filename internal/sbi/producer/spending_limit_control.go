@@ -0,0 +1,447 @@
+package producer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/account"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/httpwrapper"
+	"github.com/free5gc/util/mongoapi"
+)
+
+const chargingDatasColl = "chargingDatas"
+
+// Policy counter status derived from the ABMF balance of a rating group
+const (
+	PolicyCounterStatusValid   = "valid"
+	PolicyCounterStatusInvalid = "invalid"
+)
+
+// Subscription termination cause, refer to TS 29.594 5.6.3.3
+const TerminationCauseRemovedSubscriber = "REMOVED_SUBSCRIBER"
+
+// Data types of Nchf_SpendingLimitControl, refer to TS 29.594 5.6.2
+type SpendingLimitContext struct {
+	Supi              string     `json:"supi,omitempty" yaml:"supi" bson:"supi" mapstructure:"Supi"`
+	Gpsi              string     `json:"gpsi,omitempty" yaml:"gpsi" bson:"gpsi" mapstructure:"Gpsi"`
+	PolicyCounterIds  []string   `json:"policyCounterIds,omitempty" yaml:"policyCounterIds" bson:"policyCounterIds" mapstructure:"PolicyCounterIds"`
+	NotifUri          string     `json:"notifUri,omitempty" yaml:"notifUri" bson:"notifUri" mapstructure:"NotifUri"`
+	NotifId           string     `json:"notifId,omitempty" yaml:"notifId" bson:"notifId" mapstructure:"NotifId"`
+	Expiry            *time.Time `json:"expiry,omitempty" yaml:"expiry" bson:"expiry" mapstructure:"Expiry"`
+	SupportedFeatures string     `json:"supportedFeatures,omitempty" yaml:"supportedFeatures" bson:"supportedFeatures" mapstructure:"SupportedFeatures"`
+}
+
+type SpendingLimitStatus struct {
+	Supi              string                       `json:"supi,omitempty" yaml:"supi" bson:"supi" mapstructure:"Supi"`
+	NotifId           string                       `json:"notifId,omitempty" yaml:"notifId" bson:"notifId" mapstructure:"NotifId"`
+	StatusInfos       map[string]PolicyCounterInfo `json:"statusInfos,omitempty" yaml:"statusInfos" bson:"statusInfos" mapstructure:"StatusInfos"`
+	Expiry            *time.Time                   `json:"expiry,omitempty" yaml:"expiry" bson:"expiry" mapstructure:"Expiry"`
+	SupportedFeatures string                       `json:"supportedFeatures,omitempty" yaml:"supportedFeatures" bson:"supportedFeatures" mapstructure:"SupportedFeatures"`
+}
+
+type PolicyCounterInfo struct {
+	PolicyCounterId       string                       `json:"policyCounterId" yaml:"policyCounterId" bson:"policyCounterId" mapstructure:"PolicyCounterId"`
+	CurrentStatus         string                       `json:"currentStatus" yaml:"currentStatus" bson:"currentStatus" mapstructure:"CurrentStatus"`
+	PenPolCounterStatuses []PendingPolicyCounterStatus `json:"penPolCounterStatuses,omitempty" yaml:"penPolCounterStatuses" bson:"penPolCounterStatuses" mapstructure:"PenPolCounterStatuses"`
+}
+
+type PendingPolicyCounterStatus struct {
+	PolicyCounterStatus string     `json:"policyCounterStatus" yaml:"policyCounterStatus" bson:"policyCounterStatus" mapstructure:"PolicyCounterStatus"`
+	ActivationTime      *time.Time `json:"activationTime" yaml:"activationTime" bson:"activationTime" mapstructure:"ActivationTime"`
+}
+
+type SubscriptionTerminationInfo struct {
+	Supi      string `json:"supi" yaml:"supi" bson:"supi" mapstructure:"Supi"`
+	NotifId   string `json:"notifId,omitempty" yaml:"notifId" bson:"notifId" mapstructure:"NotifId"`
+	TermCause string `json:"termCause,omitempty" yaml:"termCause" bson:"termCause" mapstructure:"TermCause"`
+}
+
+func HandleSpendingLimitSubscribe(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.SpendingLimitLog.Infof("HandleSpendingLimitSubscribe")
+	spendingLimitContext := request.Body.(SpendingLimitContext)
+
+	response, locationURI, problemDetails := SpendingLimitSubscribe(AccountPolicyCounters{}, spendingLimitContext)
+	if response != nil {
+		respHeader := make(http.Header)
+		respHeader.Set("Location", locationURI)
+		return httpwrapper.NewResponse(http.StatusCreated, respHeader, response)
+	} else if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	problemDetails = &models.ProblemDetails{
+		Status: http.StatusForbidden,
+		Cause:  "UNSPECIFIED",
+	}
+	return httpwrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
+}
+
+func HandleSpendingLimitModify(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.SpendingLimitLog.Infof("HandleSpendingLimitModify")
+	spendingLimitContext := request.Body.(SpendingLimitContext)
+	subscriptionId := request.Params["SubscriptionId"]
+
+	response, problemDetails := SpendingLimitModify(AccountPolicyCounters{}, spendingLimitContext, subscriptionId)
+	if response != nil {
+		return httpwrapper.NewResponse(http.StatusOK, nil, response)
+	} else if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	problemDetails = &models.ProblemDetails{
+		Status: http.StatusForbidden,
+		Cause:  "UNSPECIFIED",
+	}
+	return httpwrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
+}
+
+func HandleSpendingLimitUnsubscribe(request *httpwrapper.Request) *httpwrapper.Response {
+	logger.SpendingLimitLog.Infof("HandleSpendingLimitUnsubscribe")
+	subscriptionId := request.Params["SubscriptionId"]
+
+	problemDetails := SpendingLimitUnsubscribe(subscriptionId)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	return httpwrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+// TS 29.594 5.2.2.2: initial spending limit retrieval
+func SpendingLimitSubscribe(policyCounters PolicyCounters, spendingLimitContext SpendingLimitContext) (
+	*SpendingLimitStatus, string, *models.ProblemDetails) {
+	self := chf_context.CHF_Self()
+	supi := spendingLimitContext.Supi
+
+	if supi == "" || spendingLimitContext.NotifUri == "" {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+		}
+		return nil, "", problemDetails
+	}
+
+	counters, problemDetails := retrievePolicyCounters(policyCounters, supi, spendingLimitContext.PolicyCounterIds)
+	if problemDetails != nil {
+		return nil, "", problemDetails
+	}
+
+	subscription, err := self.NewSpendingLimitSubscription(supi)
+	if err != nil {
+		logger.SpendingLimitLog.Errorf("Subscribe spending limit report error: %+v", err)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+		}
+		return nil, "", problemDetails
+	}
+
+	// The subscription is notified once it is complete
+	updateSpendingLimitSubscription(subscription, spendingLimitContext)
+	status := buildSpendingLimitStatus(subscription, counters)
+	self.AddSpendingLimitSubscription(subscription)
+
+	logger.SpendingLimitLog.Infof("UE[%s] subscribe spending limit report, subscription[%s]",
+		supi, subscription.SubscriptionId)
+	locationURI := self.GetIPv4Uri() + "/nchf-spendinglimitcontrol/v1/subscriptions/" + subscription.SubscriptionId
+
+	return &status, locationURI, nil
+}
+
+// TS 29.594 5.2.2.3: intermediate spending limit report retrieval
+func SpendingLimitModify(policyCounters PolicyCounters, spendingLimitContext SpendingLimitContext,
+	subscriptionId string) (*SpendingLimitStatus, *models.ProblemDetails) {
+	self := chf_context.CHF_Self()
+
+	subscription, ok := self.SpendingLimitSubscriptionFindById(subscriptionId)
+	if !ok {
+		logger.SpendingLimitLog.Errorf("Do not find spending limit subscription[%s]", subscriptionId)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "SUBSCRIPTION_NOT_FOUND",
+		}
+		return nil, problemDetails
+	}
+
+	subscription.Lock.Lock()
+	defer subscription.Lock.Unlock()
+
+	if spendingLimitContext.Supi != "" && spendingLimitContext.Supi != subscription.Supi {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "USER_UNKNOWN",
+		}
+		return nil, problemDetails
+	}
+
+	counters, problemDetails := retrievePolicyCounters(policyCounters, subscription.Supi,
+		spendingLimitContext.PolicyCounterIds)
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+
+	updateSpendingLimitSubscription(subscription, spendingLimitContext)
+	status := buildSpendingLimitStatus(subscription, counters)
+
+	return &status, nil
+}
+
+// TS 29.594 5.2.2.4: final spending limit report retrieval
+func SpendingLimitUnsubscribe(subscriptionId string) *models.ProblemDetails {
+	self := chf_context.CHF_Self()
+
+	subscription, ok := self.SpendingLimitSubscriptionFindById(subscriptionId)
+	if !ok {
+		logger.SpendingLimitLog.Errorf("Do not find spending limit subscription[%s]", subscriptionId)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "SUBSCRIPTION_NOT_FOUND",
+		}
+		return problemDetails
+	}
+
+	logger.SpendingLimitLog.Infof("UE[%s] unsubscribe spending limit report, subscription[%s]",
+		subscription.Supi, subscriptionId)
+	self.DeleteSpendingLimitSubscription(subscriptionId)
+
+	return nil
+}
+
+// NotifySpendingLimitStatus reports the changed policy counters of the UE to every subscribed PCF
+// TS 29.594 5.2.2.5: spending limit report notification
+func NotifySpendingLimitStatus(policyCounters PolicyCounters, supi string) {
+	self := chf_context.CHF_Self()
+
+	subscriptions := self.SpendingLimitSubscriptionsFindBySupi(supi)
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	counters, err := policyCounters.Get(supi)
+	if err != nil {
+		logger.SpendingLimitLog.Errorf("Get policy counters of UE[%s] error: %+v", supi, err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		subscription.Lock.Lock()
+		if subscription.Expired() {
+			logger.SpendingLimitLog.Infof("Spending limit subscription[%s] expired", subscription.SubscriptionId)
+			self.DeleteSpendingLimitSubscription(subscription.SubscriptionId)
+			subscription.Lock.Unlock()
+			continue
+		}
+
+		// The ABMF account of the subscriber is removed
+		if len(counters) == 0 {
+			terminationInfo := SubscriptionTerminationInfo{
+				Supi:      subscription.Supi,
+				NotifId:   subscription.NotifId,
+				TermCause: TerminationCauseRemovedSubscriber,
+			}
+			self.DeleteSpendingLimitSubscription(subscription.SubscriptionId)
+			subscription.Lock.Unlock()
+
+			SendSubscriptionTermination(subscription.NotifUri, terminationInfo)
+			continue
+		}
+
+		changed := make(map[string]PolicyCounterInfo)
+		for id, status := range subscribedPolicyCounters(subscription, counters) {
+			if subscription.ReportedStatus[id] != status {
+				subscription.ReportedStatus[id] = status
+				changed[id] = PolicyCounterInfo{
+					PolicyCounterId: id,
+					CurrentStatus:   status,
+				}
+			}
+		}
+		notifyUri := subscription.NotifUri
+		spendingLimitStatus := SpendingLimitStatus{
+			Supi:        subscription.Supi,
+			NotifId:     subscription.NotifId,
+			StatusInfos: changed,
+		}
+		subscription.Lock.Unlock()
+
+		if len(changed) != 0 {
+			SendSpendingLimitNotification(notifyUri, spendingLimitStatus)
+		}
+	}
+}
+
+func SendSpendingLimitNotification(notifyUri string, spendingLimitStatus SpendingLimitStatus) {
+	logger.NotifyEventLog.Infof("Send Spending Limit Notification to PCF: uri: %s", notifyUri)
+	sendSpendingLimitCallback(notifyUri+"/notify", spendingLimitStatus)
+}
+
+func SendSubscriptionTermination(notifyUri string, terminationInfo SubscriptionTerminationInfo) {
+	logger.NotifyEventLog.Infof("Send Subscription Termination to PCF: uri: %s", notifyUri)
+	sendSpendingLimitCallback(notifyUri+"/terminate", terminationInfo)
+}
+
+func sendSpendingLimitCallback(uri string, body interface{}) {
+	reqBody, err := openapi.Serialize(body, "application/json")
+	if err != nil {
+		logger.NotifyEventLog.Errorf("Serialize spending limit callback error: %+v", err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(reqBody))
+	if err != nil {
+		logger.NotifyEventLog.Errorf("Build spending limit callback error: %+v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := openapi.GetHttpClient()
+	if req.URL.Scheme == "https" {
+		client = openapi.GetHttpsClient()
+	}
+
+	httpResponse, err := client.Do(req)
+	if err != nil {
+		logger.NotifyEventLog.Warnf("Spending Limit Notification Failed[%s]", err.Error())
+		return
+	}
+	defer func() {
+		if resCloseErr := httpResponse.Body.Close(); resCloseErr != nil {
+			logger.NotifyEventLog.Errorf("Spending limit callback response body cannot close: %+v", resCloseErr)
+		}
+	}()
+	if httpResponse.StatusCode != http.StatusOK && httpResponse.StatusCode != http.StatusNoContent {
+		logger.NotifyEventLog.Warnf("Spending Limit Notification Failed[%s]", httpResponse.Status)
+	} else {
+		logger.NotifyEventLog.Tracef("Spending Limit Notification Success")
+	}
+}
+
+func updateSpendingLimitSubscription(subscription *chf_context.SpendingLimitSubscription,
+	spendingLimitContext SpendingLimitContext) {
+	if spendingLimitContext.Gpsi != "" {
+		subscription.Gpsi = spendingLimitContext.Gpsi
+	}
+	if spendingLimitContext.NotifUri != "" {
+		subscription.NotifUri = spendingLimitContext.NotifUri
+	}
+	if spendingLimitContext.NotifId != "" {
+		subscription.NotifId = spendingLimitContext.NotifId
+	}
+	if spendingLimitContext.SupportedFeatures != "" {
+		subscription.SupportedFeatures = spendingLimitContext.SupportedFeatures
+	}
+	if spendingLimitContext.Expiry != nil {
+		subscription.Expiry = spendingLimitContext.Expiry
+	}
+	subscription.PolicyCounterIds = spendingLimitContext.PolicyCounterIds
+}
+
+func buildSpendingLimitStatus(subscription *chf_context.SpendingLimitSubscription,
+	counters map[string]string) SpendingLimitStatus {
+	statusInfos := make(map[string]PolicyCounterInfo)
+	for id, status := range subscribedPolicyCounters(subscription, counters) {
+		subscription.ReportedStatus[id] = status
+		statusInfos[id] = PolicyCounterInfo{
+			PolicyCounterId: id,
+			CurrentStatus:   status,
+		}
+	}
+
+	return SpendingLimitStatus{
+		Supi:              subscription.Supi,
+		NotifId:           subscription.NotifId,
+		StatusInfos:       statusInfos,
+		Expiry:            subscription.Expiry,
+		SupportedFeatures: subscription.SupportedFeatures,
+	}
+}
+
+func subscribedPolicyCounters(subscription *chf_context.SpendingLimitSubscription,
+	counters map[string]string) map[string]string {
+	if len(subscription.PolicyCounterIds) == 0 {
+		return counters
+	}
+
+	subscribed := make(map[string]string)
+	for _, id := range subscription.PolicyCounterIds {
+		if status, ok := counters[id]; ok {
+			subscribed[id] = status
+		}
+	}
+	return subscribed
+}
+
+func retrievePolicyCounters(policyCounters PolicyCounters, supi string,
+	policyCounterIds []string) (map[string]string, *models.ProblemDetails) {
+	counters, err := policyCounters.Get(supi)
+	if err != nil {
+		logger.SpendingLimitLog.Errorf("Get policy counters of UE[%s] error: %+v", supi, err)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+		}
+		return nil, problemDetails
+	}
+
+	if len(counters) == 0 {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "USER_UNKNOWN",
+		}
+		return nil, problemDetails
+	}
+
+	for _, id := range policyCounterIds {
+		if _, ok := counters[id]; !ok {
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusBadRequest,
+				Cause:  "UNKNOWN_POLICY_COUNTERS",
+				Detail: fmt.Sprintf("Policy counter %s is not maintained for %s", id, supi),
+			}
+			return nil, problemDetails
+		}
+	}
+
+	return counters, nil
+}
+
+// PolicyCounters looks up the status of the policy counters of the subscriber, keyed by policy counter id
+type PolicyCounters interface {
+	Get(supi string) (map[string]string, error)
+}
+
+// AccountPolicyCounters exposes each rating group balance in ABMF as a policy counter identified
+// by the rating group, the balances are kept in the mongodb
+type AccountPolicyCounters struct{}
+
+func (AccountPolicyCounters) Get(supi string) (map[string]string, error) {
+	filter := bson.M{"ueId": supi}
+	chargingDatas, err := mongoapi.RestfulAPIGetMany(chargingDatasColl, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]string)
+	for _, chargingData := range chargingDatas {
+		rg, ok := chargingData["ratingGroup"]
+		if !ok {
+			continue
+		}
+
+		status := PolicyCounterStatusInvalid
+		if quotaStr, ok := chargingData["quota"].(string); ok && !account.Expired(chargingData, time.Now()) {
+			if quota, err := monetary.Parse(quotaStr, 0); err == nil && quota.Sign() > 0 {
+				status = PolicyCounterStatusValid
+			}
+		}
+		counters[fmt.Sprint(rg)] = status
+	}
+
+	return counters, nil
+}
@@ -0,0 +1,150 @@
+package producer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/util/idgenerator"
+)
+
+// pcf receives the spending limit notifications, keyed by the path of the callback
+type pcf struct {
+	lock          sync.Mutex
+	notifications map[string][][]byte
+}
+
+func newPcf(t *testing.T) (*pcf, string) {
+	p := &pcf{notifications: make(map[string][][]byte)}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		p.lock.Lock()
+		p.notifications[r.URL.Path] = append(p.notifications[r.URL.Path], body)
+		p.lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// The callback client speaks HTTP/2
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return p, srv.URL
+}
+
+// testPolicyCounters are the policy counters of every subscriber
+type testPolicyCounters map[string]string
+
+func (c testPolicyCounters) Get(string) (map[string]string, error) {
+	counters := make(map[string]string)
+	for id, status := range c {
+		counters[id] = status
+	}
+	return counters, nil
+}
+
+func (p *pcf) received(path string) [][]byte {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.notifications[path]
+}
+
+func TestSpendingLimitSubscription(t *testing.T) {
+	const supi = "imsi-208930000000001"
+	counters := testPolicyCounters{"1": PolicyCounterStatusValid, "2": PolicyCounterStatusValid}
+	pcf, notifUri := newPcf(t)
+
+	// Create: the status of the subscribed policy counters
+	status, locationURI, problemDetails := SpendingLimitSubscribe(counters, SpendingLimitContext{
+		Supi:             supi,
+		NotifUri:         notifUri,
+		NotifId:          "notif",
+		PolicyCounterIds: []string{"1"},
+	})
+	require.Nil(t, problemDetails)
+	require.Equal(t, map[string]PolicyCounterInfo{
+		"1": {PolicyCounterId: "1", CurrentStatus: PolicyCounterStatusValid},
+	}, status.StatusInfos)
+	subscriptionId := locationURI[strings.LastIndex(locationURI, "/")+1:]
+	_, ok := chf_context.CHF_Self().SpendingLimitSubscriptionFindById(subscriptionId)
+	require.True(t, ok)
+
+	_, _, problemDetails = SpendingLimitSubscribe(counters, SpendingLimitContext{
+		Supi:             supi,
+		NotifUri:         notifUri,
+		PolicyCounterIds: []string{"3"},
+	})
+	require.Equal(t, "UNKNOWN_POLICY_COUNTERS", problemDetails.Cause)
+
+	// Update: the policy counters of the subscription are replaced
+	status, problemDetails = SpendingLimitModify(counters, SpendingLimitContext{
+		PolicyCounterIds: []string{"1", "2"},
+	}, subscriptionId)
+	require.Nil(t, problemDetails)
+	require.Len(t, status.StatusInfos, 2)
+	require.Equal(t, "notif", status.NotifId)
+
+	_, problemDetails = SpendingLimitModify(counters, SpendingLimitContext{Supi: "imsi-208930000000002"}, subscriptionId)
+	require.Equal(t, "USER_UNKNOWN", problemDetails.Cause)
+	_, problemDetails = SpendingLimitModify(counters, SpendingLimitContext{}, "unknown")
+	require.Equal(t, int32(http.StatusNotFound), problemDetails.Status)
+
+	// Notify: only the changed policy counter is reported
+	counters["2"] = PolicyCounterStatusInvalid
+	NotifySpendingLimitStatus(counters, supi)
+	NotifySpendingLimitStatus(counters, supi)
+	notifications := pcf.received("/notify")
+	require.Len(t, notifications, 1)
+	var notified SpendingLimitStatus
+	require.NoError(t, json.Unmarshal(notifications[0], &notified))
+	require.Equal(t, map[string]PolicyCounterInfo{
+		"2": {PolicyCounterId: "2", CurrentStatus: PolicyCounterStatusInvalid},
+	}, notified.StatusInfos)
+
+	// Terminate: the subscription of the removed subscriber ends
+	delete(counters, "1")
+	delete(counters, "2")
+	NotifySpendingLimitStatus(counters, supi)
+	terminations := pcf.received("/terminate")
+	require.Len(t, terminations, 1)
+	var terminationInfo SubscriptionTerminationInfo
+	require.NoError(t, json.Unmarshal(terminations[0], &terminationInfo))
+	require.Equal(t, TerminationCauseRemovedSubscriber, terminationInfo.TermCause)
+	_, ok = chf_context.CHF_Self().SpendingLimitSubscriptionFindById(subscriptionId)
+	require.False(t, ok)
+}
+
+func TestSpendingLimitUnsubscribe(t *testing.T) {
+	counters := testPolicyCounters{"1": PolicyCounterStatusValid}
+
+	self := chf_context.CHF_Self()
+	generator := self.SpendingLimitIdGenerator
+	self.SpendingLimitIdGenerator = idgenerator.NewGenerator(1, 1)
+	defer func() {
+		self.SpendingLimitIdGenerator = generator
+	}()
+
+	spendingLimitContext := SpendingLimitContext{Supi: "imsi-208930000000001", NotifUri: "http://pcf"}
+	_, locationURI, problemDetails := SpendingLimitSubscribe(counters, spendingLimitContext)
+	require.Nil(t, problemDetails)
+
+	// The subscription fails once the subscription ids are used up
+	_, _, problemDetails = SpendingLimitSubscribe(counters, spendingLimitContext)
+	require.Equal(t, int32(http.StatusInternalServerError), problemDetails.Status)
+
+	// The id of the ended subscription is used again
+	subscriptionId := locationURI[strings.LastIndex(locationURI, "/")+1:]
+	require.Nil(t, SpendingLimitUnsubscribe(subscriptionId))
+	require.Equal(t, int32(http.StatusNotFound), SpendingLimitUnsubscribe(subscriptionId).Status)
+	_, _, problemDetails = SpendingLimitSubscribe(counters, spendingLimitContext)
+	require.Nil(t, problemDetails)
+	require.Nil(t, SpendingLimitUnsubscribe(subscriptionId))
+}
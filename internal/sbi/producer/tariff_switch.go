@@ -0,0 +1,119 @@
+package producer
+
+import (
+	"math"
+	"time"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	chf_context "github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/openapi/models"
+)
+
+// Split the used unit containers spanning the tariff switch time of their rating group,
+// so that the usage before and after the switch are priced and recorded separately
+func splitUsageAtTariffSwitch(ue *chf_context.ChfUe,
+	multipleUnitUsage []models.MultipleUnitUsage) []models.MultipleUnitUsage {
+	splitUsage := make([]models.MultipleUnitUsage, 0, len(multipleUnitUsage))
+
+	for _, unitUsage := range multipleUnitUsage {
+		switchTime, ok := ue.TariffSwitchTime[unitUsage.RatingGroup]
+		if !ok || time.Now().Before(switchTime) {
+			splitUsage = append(splitUsage, unitUsage)
+			continue
+		}
+
+		usedUnitContainers := make([]models.UsedUnitContainer, 0, len(unitUsage.UsedUnitContainer))
+		for _, usedUnit := range unitUsage.UsedUnitContainer {
+			usedUnitContainers = append(usedUnitContainers, splitUsedUnitContainer(usedUnit, switchTime)...)
+		}
+		unitUsage.UsedUnitContainer = usedUnitContainers
+		splitUsage = append(splitUsage, unitUsage)
+	}
+
+	return splitUsage
+}
+
+// The units of the container are apportioned by the usage time before and after the switch
+func splitUsedUnitContainer(usedUnit models.UsedUnitContainer, switchTime time.Time) []models.UsedUnitContainer {
+	info := usedUnit.PDUContainerInformation
+	if info == nil || info.TimeofFirstUsage == nil || info.TimeofLastUsage == nil ||
+		!info.TimeofFirstUsage.Before(switchTime) || !info.TimeofLastUsage.After(switchTime) {
+		return []models.UsedUnitContainer{usedUnit}
+	}
+
+	ratio := float64(switchTime.Sub(*info.TimeofFirstUsage)) / float64(info.TimeofLastUsage.Sub(*info.TimeofFirstUsage))
+	partOf := func(units int32) int32 {
+		return int32(math.Round(float64(units) * ratio))
+	}
+
+	before, after := usedUnit, usedUnit
+	beforeInfo, afterInfo := *info, *info
+	tariffSwitchTime := switchTime
+	beforeInfo.TimeofLastUsage = &tariffSwitchTime
+	afterInfo.TimeofFirstUsage = &tariffSwitchTime
+	before.PDUContainerInformation = &beforeInfo
+	after.PDUContainerInformation = &afterInfo
+
+	before.Time = partOf(usedUnit.Time)
+	after.Time = usedUnit.Time - before.Time
+	before.TotalVolume = partOf(usedUnit.TotalVolume)
+	after.TotalVolume = usedUnit.TotalVolume - before.TotalVolume
+	before.UplinkVolume = partOf(usedUnit.UplinkVolume)
+	after.UplinkVolume = usedUnit.UplinkVolume - before.UplinkVolume
+	before.DownlinkVolume = partOf(usedUnit.DownlinkVolume)
+	after.DownlinkVolume = usedUnit.DownlinkVolume - before.DownlinkVolume
+	before.ServiceSpecificUnits = partOf(usedUnit.ServiceSpecificUnits)
+	after.ServiceSpecificUnits = usedUnit.ServiceSpecificUnits - before.ServiceSpecificUnits
+
+	before.EventTimeStamps, after.EventTimeStamps = nil, nil
+	for _, eventTimeStamp := range usedUnit.EventTimeStamps {
+		if eventTimeStamp != nil && eventTimeStamp.Before(switchTime) {
+			before.EventTimeStamps = append(before.EventTimeStamps, eventTimeStamp)
+		} else {
+			after.EventTimeStamps = append(after.EventTimeStamps, eventTimeStamp)
+		}
+	}
+
+	// The container before the switch is closed by the tariff time change
+	before.Triggers = []models.Trigger{tariffTimeChangeTrigger(tariffSwitchTime)}
+	before.TriggerTimestamp = &tariffSwitchTime
+
+	return []models.UsedUnitContainer{before, after}
+}
+
+// The container of the usage after the tariff switch
+func afterTariffSwitch(usedUnit models.UsedUnitContainer, switchTime time.Time) bool {
+	if info := usedUnit.PDUContainerInformation; info != nil && info.TimeofFirstUsage != nil {
+		return !info.TimeofFirstUsage.Before(switchTime)
+	}
+	// The container closed by the tariff time change holds the usage before the switch
+	for _, trigger := range usedUnit.Triggers {
+		if trigger.TriggerType == models.TriggerType_TARIFF_TIME_CHANGE {
+			return false
+		}
+	}
+	return usedUnit.TriggerTimestamp != nil && usedUnit.TriggerTimestamp.After(switchTime)
+}
+
+// Keep the tariff switch of the rating group answered by the RF
+func updateTariffSwitch(ue *chf_context.ChfUe, rg int32, serviceRating *charging_datatype.ServiceRating,
+	actualTime time.Time) {
+	nextTariff := serviceRating.NextMonetaryTariff
+	if nextTariff == nil || nextTariff.RateElement == nil || serviceRating.TariffSwitchTime == 0 {
+		delete(ue.TariffSwitchTime, rg)
+		delete(ue.NextUnitCost, rg)
+		return
+	}
+
+	ue.TariffSwitchTime[rg] = actualTime.Add(time.Duration(serviceRating.TariffSwitchTime) * time.Second)
+	ue.NextUnitCost[rg] = unitCostOf((*charging_datatype.MonetaryTariff)(nextTariff))
+}
+
+// 32.255 5.2.1.4: the SMF closes the containers at the tariff time change
+func tariffTimeChangeTrigger(switchTime time.Time) models.Trigger {
+	return models.Trigger{
+		TriggerType:      models.TriggerType_TARIFF_TIME_CHANGE,
+		TriggerCategory:  models.TriggerCategory_DEFERRED_REPORT,
+		TariffTimeChange: &switchTime,
+	}
+}
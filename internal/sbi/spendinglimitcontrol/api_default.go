@@ -0,0 +1,148 @@
+/*
+ * Nchf_SpendingLimitControl
+ *
+ * Nchf Spending Limit Control Service.   © 2021, 3GPP Organizational Partners (ARIB, ATIS, CCSA, ETSI, TSDSI, TTA, TTC). All rights reserved.
+ *
+ * API version: 1.0.3
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package spendinglimitcontrol
+
+import (
+	"net/http"
+
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/internal/sbi/producer"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/util/httpwrapper"
+	"github.com/gin-gonic/gin"
+)
+
+// SubscriptionsPost -
+func SubscriptionsPost(c *gin.Context) {
+	var spendingLimitContext producer.SpendingLimitContext
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.SpendingLimitLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	err = openapi.Deserialize(&spendingLimitContext, requestBody, "application/json")
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.SpendingLimitLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := httpwrapper.NewRequest(c.Request, spendingLimitContext)
+
+	rsp := producer.HandleSpendingLimitSubscribe(req)
+
+	for key, value := range rsp.Header {
+		c.Header(key, value[0])
+	}
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.SpendingLimitLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
+
+// SubscriptionsSubscriptionIdPut -
+func SubscriptionsSubscriptionIdPut(c *gin.Context) {
+	var spendingLimitContext producer.SpendingLimitContext
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.SpendingLimitLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	err = openapi.Deserialize(&spendingLimitContext, requestBody, "application/json")
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.SpendingLimitLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := httpwrapper.NewRequest(c.Request, spendingLimitContext)
+	req.Params["SubscriptionId"] = c.Param("SubscriptionId")
+
+	rsp := producer.HandleSpendingLimitModify(req)
+
+	for key, value := range rsp.Header {
+		c.Header(key, value[0])
+	}
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.SpendingLimitLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
+
+// SubscriptionsSubscriptionIdDelete -
+func SubscriptionsSubscriptionIdDelete(c *gin.Context) {
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["SubscriptionId"] = c.Param("SubscriptionId")
+
+	rsp := producer.HandleSpendingLimitUnsubscribe(req)
+
+	for key, value := range rsp.Header {
+		c.Header(key, value[0])
+	}
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.SpendingLimitLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
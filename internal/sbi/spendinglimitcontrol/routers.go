@@ -0,0 +1,97 @@
+/*
+ * Nchf_SpendingLimitControl
+ *
+ * Nchf Spending Limit Control Service.   © 2021, 3GPP Organizational Partners (ARIB, ATIS, CCSA, ETSI, TSDSI, TTA, TTC). All rights reserved.
+ *
+ * API version: 1.0.3
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package spendinglimitcontrol
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/chf/internal/logger"
+	logger_util "github.com/free5gc/util/logger"
+)
+
+// Route is the information for every URI.
+type Route struct {
+	// Name is the name of this Route.
+	Name string
+	// Method is the string for the HTTP method. ex) GET, POST etc..
+	Method string
+	// Pattern is the pattern of the URI.
+	Pattern string
+	// HandlerFunc is the handler function of this route.
+	HandlerFunc gin.HandlerFunc
+}
+
+// Routes is the list of the generated Route.
+type Routes []Route
+
+// NewRouter returns a new router.
+func NewRouter() *gin.Engine {
+	router := logger_util.NewGinWithLogrus(logger.GinLog)
+	AddService(router)
+	return router
+}
+
+func AddService(engine *gin.Engine) *gin.RouterGroup {
+	group := engine.Group("/nchf-spendinglimitcontrol/v1")
+
+	for _, route := range routes {
+		switch route.Method {
+		case "GET":
+			group.GET(route.Pattern, route.HandlerFunc)
+		case "POST":
+			group.POST(route.Pattern, route.HandlerFunc)
+		case "PUT":
+			group.PUT(route.Pattern, route.HandlerFunc)
+		case "DELETE":
+			group.DELETE(route.Pattern, route.HandlerFunc)
+		case "PATCH":
+			group.PATCH(route.Pattern, route.HandlerFunc)
+		}
+	}
+	return group
+}
+
+// Index is the index handler.
+func Index(c *gin.Context) {
+	c.String(http.StatusOK, "Hello World!")
+}
+
+var routes = Routes{
+	{
+		"Index",
+		"GET",
+		"/",
+		Index,
+	},
+
+	{
+		"SubscriptionsPost",
+		strings.ToUpper("Post"),
+		"/subscriptions",
+		SubscriptionsPost,
+	},
+
+	{
+		"SubscriptionsSubscriptionIdPut",
+		strings.ToUpper("Put"),
+		"/subscriptions/:SubscriptionId",
+		SubscriptionsSubscriptionIdPut,
+	},
+
+	{
+		"SubscriptionsSubscriptionIdDelete",
+		strings.ToUpper("Delete"),
+		"/subscriptions/:SubscriptionId",
+		SubscriptionsSubscriptionIdDelete,
+	},
+}
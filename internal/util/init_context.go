@@ -8,9 +8,13 @@ import (
 	"github.com/fiorix/go-diameter/diam/sm"
 	"github.com/google/uuid"
 
+	charging_dict "github.com/free5gc/chf/ccs_diameter/dict"
 	"github.com/free5gc/chf/internal/context"
+	"github.com/free5gc/chf/internal/diameter"
 	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/account"
 	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/chf/pkg/monetary"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/util/mongoapi"
 )
@@ -25,12 +29,24 @@ func InitchfContext(context *context.CHFContext) {
 		context.Name = configuration.ChfName
 	}
 
+	monetary.SetExchangeRates(configuration.ExchangeRates)
+
 	mongodb := config.Configuration.Mongodb
 	// Connect to MongoDB
 	if err := mongoapi.SetMongoDB(mongodb.Name, mongodb.Url); err != nil {
 		logger.UtilLog.Errorf("InitpcfContext err: %+v", err)
 		return
 	}
+	account.SetDatabase(mongodb.Name)
+	if err := account.CreateBalanceIndex(); err != nil {
+		logger.UtilLog.Errorf("InitchfContext err: %+v", err)
+	}
+	if err := account.CreateReservationIndex(); err != nil {
+		logger.UtilLog.Errorf("InitchfContext err: %+v", err)
+	}
+	if err := context.InitSessionStore(configuration.SessionStore); err != nil {
+		logger.UtilLog.Errorf("InitchfContext err: %+v", err)
+	}
 
 	sbi := configuration.Sbi
 	context.NrfUri = configuration.NrfUri
@@ -70,8 +86,8 @@ func InitchfContext(context *context.CHFContext) {
 	abmfDiameter := configuration.AbmfDiameter
 
 	context.RatingCfg = &sm.Settings{
-		OriginHost:       datatype.DiameterIdentity("client"),
-		OriginRealm:      datatype.DiameterIdentity("go-diameter"),
+		OriginHost:       datatype.DiameterIdentity(rfDiameter.GetOriginHost()),
+		OriginRealm:      datatype.DiameterIdentity(rfDiameter.GetOriginRealm()),
 		VendorID:         13,
 		ProductName:      "go-diameter",
 		OriginStateID:    datatype.Unsigned32(time.Now().Unix()),
@@ -81,8 +97,8 @@ func InitchfContext(context *context.CHFContext) {
 		},
 	}
 	context.AbmfCfg = &sm.Settings{
-		OriginHost:       datatype.DiameterIdentity("client"),
-		OriginRealm:      datatype.DiameterIdentity("go-diameter"),
+		OriginHost:       datatype.DiameterIdentity(abmfDiameter.GetOriginHost()),
+		OriginRealm:      datatype.DiameterIdentity(abmfDiameter.GetOriginRealm()),
 		VendorID:         13,
 		ProductName:      "go-diameter",
 		OriginStateID:    datatype.Unsigned32(time.Now().Unix()),
@@ -91,6 +107,15 @@ func InitchfContext(context *context.CHFContext) {
 			datatype.Address(abmfDiameter.HostIPv4),
 		},
 	}
+	// The RF and the ABMF may run apart from the CHF, their clients load the dictionaries themselves
+	if err := charging_dict.LoadRateDictionary(); err != nil {
+		logger.UtilLog.Errorf("Load rating dictionary err: %+v", err)
+	}
+	if err := charging_dict.LoadAbmfDictionary(); err != nil {
+		logger.UtilLog.Errorf("Load ABMF dictionary err: %+v", err)
+	}
+	context.RatingRouter = diameter.NewRouter("RF", context.RatingCfg, rfDiameter, logger.RatingLog, "SUA")
+	context.AbmfRouter = diameter.NewRouter("ABMF", context.AbmfCfg, abmfDiameter, logger.AcctLog, "CCA")
 
 	serviceList := configuration.ServiceList
 	context.InitNFService(serviceList, config.Info.Version)
@@ -1,8 +1,10 @@
 package util
 
 const (
-	ChfDefaultKeyLogPath = "./log/chfsslkey.log"
-	ChfDefaultPemPath    = "./config/TLS/chf.pem"
-	ChfDefaultKeyPath    = "./config/TLS/chf.key"
-	ChfDefaultConfigPath = "./config/chfcfg.yaml"
+	ChfDefaultKeyLogPath  = "./log/chfsslkey.log"
+	ChfDefaultPemPath     = "./config/TLS/chf.pem"
+	ChfDefaultKeyPath     = "./config/TLS/chf.key"
+	ChfDefaultConfigPath  = "./config/chfcfg.yaml"
+	RfDefaultConfigPath   = "./config/rfcfg.yaml"
+	AbmfDefaultConfigPath = "./config/abmfcfg.yaml"
 )
@@ -16,42 +16,46 @@
 package abmf
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"math"
+	"runtime/debug"
 	"strconv"
 	"sync"
 	"time"
 
 	_ "net/http/pprof"
 
+	charging_code "github.com/free5gc/chf/ccs_diameter/code"
 	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/account"
 	"github.com/free5gc/chf/pkg/factory"
-	"github.com/free5gc/util/mongoapi"
+	"github.com/free5gc/chf/pkg/identity"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/chf/pkg/rating"
 	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/fiorix/go-diameter/diam"
 	"github.com/fiorix/go-diameter/diam/datatype"
-	"github.com/fiorix/go-diameter/diam/dict"
 	"github.com/fiorix/go-diameter/diam/sm"
 	charging_dict "github.com/free5gc/chf/ccs_diameter/dict"
 	"github.com/free5gc/chf/internal/logger"
 )
 
-const chargingDatasColl = "chargingDatas"
-
-func OpenServer(wg *sync.WaitGroup) {
+// OpenServer starts the server of the configuration, embedded in the CHF or standalone
+func OpenServer(wg *sync.WaitGroup, cfg *factory.DiameterServer) {
 	// Load our custom dictionary on top of the default one, which
 	// always have the Base Protocol (RFC6733) and Credit Control
 	// Application (RFC4006).
 	logger.AcctLog.Infof("Open Account Balance Management Server")
 
-	err := dict.Default.Load(bytes.NewReader([]byte(charging_dict.AbmfDictionary)))
+	err := charging_dict.LoadAbmfDictionary()
 	if err != nil {
-		logger.RatingLog.Error(err)
+		logger.AcctLog.Error(err)
 	}
 	settings := &sm.Settings{
-		OriginHost:       datatype.DiameterIdentity("server"),
-		OriginRealm:      datatype.DiameterIdentity("go-diameter"),
+		OriginHost:       datatype.DiameterIdentity(cfg.GetOriginHost()),
+		OriginRealm:      datatype.DiameterIdentity(cfg.GetOriginRealm()),
 		VendorID:         13,
 		ProductName:      "go-diameter",
 		FirmwareRevision: 1,
@@ -64,15 +68,14 @@ func OpenServer(wg *sync.WaitGroup) {
 
 	// Print error reports.
 	go printErrors(mux.ErrorReports())
+	go sweepReservations()
 	go func() {
 		defer func() {
 			logger.AcctLog.Error("ABMF server stopped")
 			wg.Done()
 		}()
 
-		abmfDiameter := factory.ChfConfig.Configuration.AbmfDiameter
-		addr := abmfDiameter.HostIPv4 + ":" + strconv.Itoa(abmfDiameter.Port)
-		err := diam.ListenAndServeTLS(addr, abmfDiameter.Tls.Pem, abmfDiameter.Tls.Key, mux, nil)
+		err := listen(cfg, mux)
 		if err != nil {
 			logger.AcctLog.Errorf("ABMF server fail to listen: %V", err)
 		}
@@ -85,23 +88,22 @@ func printErrors(ec <-chan *diam.ErrorReport) {
 	}
 }
 
-func listen(addr, cert, key string, handler diam.Handler) error {
+func listen(cfg *factory.DiameterServer, handler diam.Handler) error {
+	network := cfg.Network()
+	addr := cfg.HostIPv4 + ":" + strconv.Itoa(cfg.Port)
 	// Start listening for connections.
-	if len(cert) > 0 && len(key) > 0 {
-		logger.AcctLog.Infof("Starting secure diameter server on", addr)
-		return diam.ListenAndServeTLS(addr, cert, key, handler, nil)
+	if cfg.UseTls() {
+		logger.AcctLog.Infof("Starting secure diameter server on %s %s", network, addr)
+		return diam.ListenAndServeNetworkTLS(network, addr, cfg.Tls.Pem, cfg.Tls.Key, handler, nil)
 	}
 
-	logger.AcctLog.Infof("Starting diameter server on", addr)
-	return diam.ListenAndServe(addr, handler, nil)
+	logger.AcctLog.Infof("Starting diameter server on %s %s", network, addr)
+	return diam.ListenAndServeNetwork(network, addr, handler, nil)
 }
 
 func handleCCR() diam.HandlerFunc {
 	return func(c diam.Conn, m *diam.Message) {
 		var ccr charging_datatype.AccountDebitRequest
-		var cca charging_datatype.AccountDebitResponse
-		var subscriberId string
-		var creditControl *charging_datatype.MultipleServicesCreditControl
 
 		if err := m.Unmarshal(&ccr); err != nil {
 			logger.AcctLog.Errorf("Failed to parse message from %s: %s\n%s",
@@ -109,107 +111,440 @@ func handleCCR() diam.HandlerFunc {
 			return
 		}
 
-		switch ccr.SubscriptionId.SubscriptionIdType {
-		case charging_datatype.END_USER_IMSI:
-			subscriberId = "imsi-" + string(ccr.SubscriptionId.SubscriptionIdData)
+		if err := checkRequest(&ccr); err != nil {
+			logger.AcctLog.Errorf("Session [%s], reject request: %+v", ccr.SessionId, err)
+			answerError(c, m, diam.MissingAVP)
+			return
+		}
+
+		key := requestKeyOf(&ccr)
+		entry, state := answers.begin(key, uint32(ccr.CcRequestNumber), time.Now())
+		switch state {
+		case requestOutOfOrder:
+			logger.AcctLog.Errorf("Session [%s], Rating group [%d], CC-Request-Number [%d] out of order",
+				key.sessionId, key.ratingGroup, ccr.CcRequestNumber)
+			answerError(c, m, diam.InvalidAVPValue)
+			return
+		case requestRetransmitted:
+			// The duplicate gets the answer of the request, which is applied only once.
+			// The client retransmitting while the request is slow is told to retry later.
+			select {
+			case <-entry.done:
+			case <-time.After(answerWaitTimeout):
+				logger.AcctLog.Warnf("Session [%s], Rating group [%d], CC-Request-Number [%d] still being answered",
+					key.sessionId, key.ratingGroup, ccr.CcRequestNumber)
+				answerError(c, m, diam.TooBusy)
+				return
+			}
+			logger.AcctLog.Infof("Session [%s], Rating group [%d], CC-Request-Number [%d] retransmitted",
+				key.sessionId, key.ratingGroup, ccr.CcRequestNumber)
+			writeAnswer(c, m, entry.resultCode, entry.cca)
+			return
+		}
+
+		resultCode, cca := answerRequestSafely(&ccr)
+		answers.finish(key, entry, resultCode, cca, time.Now())
+		writeAnswer(c, m, resultCode, cca)
+	}
+}
+
+// answerRequestSafely answers the request panicking with DIAMETER_UNABLE_TO_COMPLY,
+// the retransmissions waiting on its entry are not left blocked
+func answerRequestSafely(ccr *charging_datatype.AccountDebitRequest) (
+	resultCode uint32, cca *charging_datatype.AccountDebitResponse) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.AcctLog.Errorf("Session [%s], CC-Request-Number [%d] panic: %v\n%s",
+				ccr.SessionId, ccr.CcRequestNumber, p, debug.Stack())
+			resultCode, cca = diam.UnableToComply, nil
 		}
+	}()
+	return answerRequest(ccr)
+}
 
-		mscc := ccr.MultipleServicesCreditControl
-		rg := mscc.RatingGroup
+// answerRequest applies the request to the balance, the answer is nil for the rejected request
+func answerRequest(ccr *charging_datatype.AccountDebitRequest) (uint32, *charging_datatype.AccountDebitResponse) {
+	rg := ccr.MultipleServicesCreditControl.RatingGroup
 
-		// Retrieve quota into mongoDB
-		filter := bson.M{"ueId": subscriberId, "ratingGroup": rg}
-		chargingInterface, err := mongoapi.RestfulAPIGetOne(chargingDatasColl, filter)
+	// The account of the subscriber is looked up by its SUPI or GPSI
+	subscriberId, err := identity.FromSubscriptionId(ccr.SubscriptionId)
+	if err != nil {
+		logger.AcctLog.Errorf("Rating group [%d], reject request: %+v", rg, err)
+		return charging_code.UserUnknown, nil
+	}
+	key := reservationKeyOf(ccr, subscriberId)
+
+	// The refund releases the reservation of the session
+	var refunded *account.Reservation
+	if ccr.RequestedAction == charging_datatype.REFUND_ACCOUNT {
+		if ccr, refunded, err = takeRefund(ccr, key); err != nil {
+			logger.AcctLog.Errorf("UE [%s], Rating group [%d], release reservation: %+v", subscriberId, rg, err)
+			restoreReservation(refunded)
+			return diam.UnableToComply, nil
+		}
+	}
+
+	// The request is applied to the balance read from mongoDB,
+	// and applied again if the balance has been updated meanwhile.
+	// The answer is written with the balance, the request applied already is answered again.
+	var update *balanceUpdate
+	var cca, recorded *charging_datatype.AccountDebitResponse
+	err = account.UpdateBalance(subscriberId, uint32(rg), func(chargingData map[string]interface{}) (bson.M, error) {
+		var err error
+		if recorded, err = recordedAnswer(chargingData, ccr, time.Now()); err != nil || recorded != nil {
+			return nil, err
+		}
+		if update, err = applyRequest(ccr, subscriberId, chargingData); err != nil {
+			return nil, err
+		}
+		cca = answerOf(ccr, update)
+		if !update.changed {
+			return nil, nil
+		}
+		records, err := recordAnswer(chargingData, ccr, cca, time.Now())
 		if err != nil {
-			logger.AcctLog.Errorf("Get quota error: %+v", err)
-		}
-
-		quotaStr := chargingInterface["quota"].(string)
-		quota, _ := strconv.ParseInt(quotaStr, 10, 64)
-
-		switch ccr.RequestedAction {
-		case charging_datatype.CHECK_BALANCE:
-			logger.AcctLog.Errorf("CHECK_BALANCE not supported")
-		case charging_datatype.PRICE_ENQUIRY:
-			logger.AcctLog.Errorf("Should use rating function for PRICE_ENQUIRY")
-		case charging_datatype.REFUND_ACCOUNT:
-			logger.AcctLog.Infof("Refund Account")
-			refundQuota := int64(mscc.RequestedServiceUnit.CCTotalOctets)
-			quota += refundQuota
-		case charging_datatype.DIRECT_DEBITING:
-			switch ccr.CcRequestType {
-			case charging_datatype.INITIAL_REQUEST, charging_datatype.UPDATE_REQUEST:
-				var finalUnitIndication *charging_datatype.FinalUnitIndication
-				requestQuota := int64(mscc.RequestedServiceUnit.CCTotalOctets)
-				if requestQuota > quota {
-					finalUnitIndication = &charging_datatype.FinalUnitIndication{
-						FinalUnitAction: charging_datatype.TERMINATE,
-					}
-
-					requestQuota = quota
-				}
+			return nil, err
+		}
+		return bson.M{"quota": update.quota.String(), answersField: records}, nil
+	})
+	if err != nil {
+		logger.AcctLog.Errorf("UE [%s], Rating group [%d], reject request: %+v", subscriberId, rg, err)
+		restoreReservation(refunded)
+		resultCode := uint32(diam.UnableToComply)
+		var ccErr *creditControlError
+		if errors.As(err, &ccErr) {
+			resultCode = ccErr.resultCode
+		} else if errors.Is(err, account.ErrBalanceNotFound) {
+			resultCode = charging_code.UserUnknown
+		}
+		return resultCode, nil
+	}
+	if recorded != nil {
+		logger.AcctLog.Infof("UE [%s], Rating group [%d], CC-Request-Number [%d] applied already",
+			subscriberId, rg, ccr.CcRequestNumber)
+		restoreReservation(refunded)
+		return diam.Success, recorded
+	}
+	quota := update.quota
+	if update.changed {
+		recordTransactions(subscriberId, uint32(rg), ccr.RequestedAction,
+			update.forfeited, update.openingQuota, quota)
+	}
+	updateReservation(ccr, key, update)
+
+	logger.AcctLog.Infof("UE [%s], Rating group [%d], quota [%s]", subscriberId, rg, quota)
+	return diam.Success, cca
+}
+
+func answerOf(ccr *charging_datatype.AccountDebitRequest, update *balanceUpdate) *charging_datatype.AccountDebitResponse {
+	quota := update.quota
+	return &charging_datatype.AccountDebitResponse{
+		SessionId:       ccr.SessionId,
+		ResultCode:      datatype.Unsigned32(diam.Success),
+		OriginHost:      ccr.DestinationHost,
+		OriginRealm:     ccr.DestinationRealm,
+		CcRequestType:   ccr.CcRequestType,
+		CcRequestNumber: ccr.CcRequestNumber,
+		// The balances and the answers applied are kept in the database, any ABMF may take the session over
+		CCSessionFailover: charging_datatype.FAILOVER_SUPPORTED,
+		CostInformation:   update.costInformation,
+		EventTimestamp:    datatype.Time(time.Now()),
+		RemainingBalance: &charging_datatype.RemainingBalance{
+			UnitValue:    quota.UnitValue(),
+			CurrencyCode: datatype.Unsigned32(quota.CurrencyCode),
+		},
+		ABResponse:                    update.abResponse,
+		MultipleServicesCreditControl: update.creditControl,
+	}
+}
+
+// checkRequest rejects the request without the AVPs its action needs, DIAMETER_MISSING_AVP of RFC 6733 7.1.5
+func checkRequest(ccr *charging_datatype.AccountDebitRequest) error {
+	mscc := ccr.MultipleServicesCreditControl
+	// The rating group of the balance is the one of the Multiple-Services-Credit-Control
+	if mscc == nil {
+		return errors.New("request without Multiple-Services-Credit-Control")
+	}
+	// The event is priced by the client, the price is its usage
+	if ccr.RequestedAction == charging_datatype.DIRECT_DEBITING &&
+		ccr.CcRequestType == charging_datatype.EVENT_REQUEST && mscc.UsedServiceUnit == nil {
+		return errors.New("event without Used-Service-Unit")
+	}
+	return nil
+}
+
+// balanceUpdate is the outcome of the request on the balance read
+type balanceUpdate struct {
+	quota        monetary.Value
+	openingQuota monetary.Value
+	forfeited    monetary.Value
+	changed      bool
+
+	creditControl   *charging_datatype.MultipleServicesCreditControl
+	costInformation *charging_datatype.CostInformation
+	abResponse      *charging_datatype.ABResponse
+}
+
+// creditControlError rejects the request with the result code
+type creditControlError struct {
+	resultCode uint32
+	err        error
+}
+
+func (e *creditControlError) Error() string {
+	return e.err.Error()
+}
+
+// applyRequest applies the request to the balance of the charging data without side effect,
+// it may be applied again on a newer balance. The balance does not go below the overdraft limit,
+// zero unless configured.
+func applyRequest(ccr *charging_datatype.AccountDebitRequest, subscriberId string,
+	chargingData map[string]interface{}) (*balanceUpdate, error) {
+	mscc := ccr.MultipleServicesCreditControl
+	rg := mscc.RatingGroup
+
+	// The quota is a decimal in the currency of the account
+	currencyCode := monetary.CurrencyCodeOf(chargingData)
+	if currencyCode == 0 {
+		currencyCode = monetary.DefaultCurrencyCode
+	}
+	quotaStr, _ := chargingData["quota"].(string)
+	quota, err := monetary.Parse(quotaStr, currencyCode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quota: %+v", err)
+	}
+	overdraftLimit, err := account.OverdraftLimit(chargingData, currencyCode)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &balanceUpdate{changed: true}
+
+	// The expired balance is forfeited, the debt of a negative balance is kept
+	if account.Expired(chargingData, time.Now()) && quota.Sign() > 0 {
+		logger.AcctLog.Infof("UE [%s], Rating group [%d], balance expired", subscriberId, rg)
+		update.forfeited = quota
+		quota = monetary.Value{CurrencyCode: quota.CurrencyCode}
+	}
+	update.openingQuota = quota
 
-				creditControl = &charging_datatype.MultipleServicesCreditControl{
-					RatingGroup: rg,
-					GrantedServiceUnit: &charging_datatype.GrantedServiceUnit{
-						CCTotalOctets: datatype.Unsigned64(requestQuota),
-					},
-					FinalUnitIndication: finalUnitIndication,
+	// The money that may be debited, down to the overdraft limit
+	available, err := quota.Add(overdraftLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// The money of the request is exchanged into the currency of the account,
+	// the request in a currency without exchange rate is rejected
+	amountOf := func(money *charging_datatype.CCMoney) (monetary.Value, error) {
+		return monetary.Exchange(monetary.FromCCMoney(money), quota.CurrencyCode)
+	}
+
+	switch ccr.RequestedAction {
+	case charging_datatype.CHECK_BALANCE:
+		// RFC 4006 5.3.2 Balance check: the balance is answered and left as is,
+		// the credit limit is reached if the requested money is over the balance
+		logger.AcctLog.Infof("Check Balance")
+		update.changed = false
+		update.abResponse = &charging_datatype.ABResponse{
+			AcctBalance: &charging_datatype.AcctBalance{
+				AcctBalanceId: datatype.Unsigned64(rg),
+				UnitValue:     quota.UnitValue(),
+			},
+		}
+		update.creditControl = &charging_datatype.MultipleServicesCreditControl{
+			RatingGroup: rg,
+			ResultCode:  datatype.Unsigned32(diam.Success),
+		}
+		if money := requestedMoneyOf(mscc); money != nil {
+			var requestQuota monetary.Value
+			if requestQuota, err = amountOf(money); err != nil {
+				break
+			}
+			if exceeded, _ := requestQuota.Cmp(available); exceeded > 0 {
+				update.creditControl.ResultCode = datatype.Unsigned32(charging_code.CreditLimitReached)
+			}
+		}
+	case charging_datatype.PRICE_ENQUIRY:
+		// RFC 4006 5.3.3 Price enquiry: the rating function prices the requested units
+		// without debiting the account
+		logger.AcctLog.Infof("Price Enquiry")
+		update.changed = false
+		// The RequestedUnits of the rating are Unsigned32, the octets requested may be more
+		requestedUnits := requestedUnitsOf(mscc)
+		if requestedUnits > math.MaxUint32 {
+			return nil, &creditControlError{
+				resultCode: diam.InvalidAVPValue,
+				err:        fmt.Errorf("price enquiry of %d units over the rating range", requestedUnits),
+			}
+		}
+		answer, rateErr := rating.Rate(subscriberId, &charging_datatype.ServiceRating{
+			ServiceIdentifier: rg,
+			RequestSubType:    charging_datatype.REQ_SUBTYPE_AOC,
+			RequestedUnits:    datatype.Unsigned32(requestedUnits),
+		}, time.Now())
+		if rateErr != nil {
+			return nil, &creditControlError{
+				resultCode: charging_code.RatingFailed,
+				err:        fmt.Errorf("price enquiry failed: %+v", rateErr),
+			}
+		}
+		price := monetary.FromCCMoney(answer.Price)
+		update.costInformation = &charging_datatype.CostInformation{
+			CurrencyCode: datatype.Unsigned32(price.CurrencyCode),
+			UnitValue:    price.UnitValue(),
+		}
+	case charging_datatype.REFUND_ACCOUNT:
+		logger.AcctLog.Infof("Refund Account")
+		var refundQuota monetary.Value
+		if refundQuota, err = amountOf(requestedMoneyOf(mscc)); err == nil {
+			quota, err = quota.Add(refundQuota)
+		}
+	case charging_datatype.DIRECT_DEBITING:
+		switch ccr.CcRequestType {
+		case charging_datatype.INITIAL_REQUEST, charging_datatype.UPDATE_REQUEST:
+			var finalUnitIndication *charging_datatype.FinalUnitIndication
+			var requestQuota monetary.Value
+			if requestQuota, err = amountOf(requestedMoneyOf(mscc)); err != nil {
+				break
+			}
+			if exceeded, _ := requestQuota.Cmp(available); exceeded > 0 {
+				finalUnitIndication = &charging_datatype.FinalUnitIndication{
+					FinalUnitAction: charging_datatype.TERMINATE,
 				}
 
-				quota -= requestQuota
-			case charging_datatype.TERMINATION_REQUEST:
-				usedQuota := int64(mscc.UsedServiceUnit.CCTotalOctets)
-				quota -= usedQuota
+				requestQuota = available
+				if requestQuota.Sign() < 0 {
+					requestQuota = monetary.Value{CurrencyCode: quota.CurrencyCode}
+				}
 			}
 
-			// Convvert quota into valuedigits and expontent expresstion
-			quotaStr = strconv.FormatInt(quota, 10)
-			quotaInt, _ := strconv.ParseInt(quotaStr, 10, 64)
-			quotaLen := len(quotaStr)
-			quotaExp := quotaLen - 1
-			quotaVal := quotaInt / int64(math.Pow10(quotaExp))
-
-			cca = charging_datatype.AccountDebitResponse{
-				SessionId:       ccr.SessionId,
-				OriginHost:      ccr.DestinationHost,
-				OriginRealm:     ccr.DestinationRealm,
-				CcRequestType:   ccr.CcRequestType,
-				CcRequestNumber: ccr.CcRequestNumber,
-				EventTimestamp:  datatype.Time(time.Now()),
-				RemainingBalance: &charging_datatype.RemainingBalance{
-					UnitValue: &charging_datatype.UnitValue{
-						ValueDigits: datatype.Integer64(quotaVal),
-						Exponent:    datatype.Integer32(quotaExp),
-					},
+			update.creditControl = &charging_datatype.MultipleServicesCreditControl{
+				RatingGroup: rg,
+				GrantedServiceUnit: &charging_datatype.GrantedServiceUnit{
+					CCMoney: requestQuota.CCMoney(),
 				},
-				MultipleServicesCreditControl: creditControl,
+				FinalUnitIndication: finalUnitIndication,
 			}
 
+			quota, err = quota.Sub(requestQuota)
+		case charging_datatype.TERMINATION_REQUEST:
+			// The usage over the granted quota is debited down to the overdraft limit
+			var usedQuota monetary.Value
+			if usedQuota, err = amountOf(usedMoneyOf(mscc)); err != nil {
+				break
+			}
+			if exceeded, _ := usedQuota.Cmp(available); exceeded > 0 && usedQuota.Sign() > 0 {
+				logger.AcctLog.Warnf("UE [%s], Rating group [%d], usage %s over the available balance %s",
+					subscriberId, rg, usedQuota, available)
+				if usedQuota = available; usedQuota.Sign() < 0 {
+					usedQuota = monetary.Value{CurrencyCode: quota.CurrencyCode}
+				}
+			}
+			quota, err = quota.Sub(usedQuota)
+		case charging_datatype.EVENT_REQUEST:
+			// Immediate event charging: the price of the event is debited at once,
+			// the event is denied if the balance is insufficient
+			var price monetary.Value
+			if price, err = amountOf(usedMoneyOf(mscc)); err != nil {
+				break
+			}
+			update.creditControl = &charging_datatype.MultipleServicesCreditControl{
+				RatingGroup: rg,
+				ResultCode:  datatype.Unsigned32(diam.Success),
+			}
+			if exceeded, _ := price.Cmp(available); exceeded > 0 {
+				update.creditControl.ResultCode = datatype.Unsigned32(charging_code.CreditLimitReached)
+			} else {
+				update.creditControl.GrantedServiceUnit = &charging_datatype.GrantedServiceUnit{
+					CCMoney:                price.CCMoney(),
+					CCServiceSpecificUnits: mscc.UsedServiceUnit.CCServiceSpecificUnits,
+				}
+				quota, err = quota.Sub(price)
+			}
 		}
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		logger.AcctLog.Infof("UE [%s], Rating group [%d], quota [%d]", subscriberId, rg, quota)
+	update.quota = quota
+	return update, nil
+}
 
-		chargingBsonM := make(bson.M)
-		chargingBsonM["quota"] = strconv.FormatInt(quota, 10)
-		if _, err := mongoapi.RestfulAPIPutOne(chargingDatasColl, filter, chargingBsonM); err != nil {
-			logger.AcctLog.Errorf("RestfulAPIPutOne err: %+v", err)
+// The forfeited balance and the change of the balance by the request are added to the history of the account
+func recordTransactions(subscriberId string, rg uint32, action charging_datatype.RequestedAction,
+	forfeited, openingQuota, quota monetary.Value) {
+	if !forfeited.IsZero() {
+		if err := account.RecordTransaction(subscriberId, rg, account.TransactionExpiry,
+			forfeited.Neg(), openingQuota); err != nil {
+			logger.AcctLog.Errorf("RecordTransaction err: %+v", err)
 		}
+	}
 
-		a := m.Answer(diam.Success)
+	change, err := quota.Sub(openingQuota)
+	if err != nil || change.IsZero() {
+		return
+	}
+	transactionType := account.TransactionDebit
+	if action == charging_datatype.REFUND_ACCOUNT {
+		transactionType = account.TransactionRefund
+	}
+	if err := account.RecordTransaction(subscriberId, rg, transactionType, change, quota); err != nil {
+		logger.AcctLog.Errorf("RecordTransaction err: %+v", err)
+	}
+}
 
-		err = a.Marshal(&cca)
-		if err != nil {
-			logger.AcctLog.Errorf("Marshal CCA Err: %+v:", err)
-		}
+func writeAnswer(c diam.Conn, m *diam.Message, resultCode uint32, cca *charging_datatype.AccountDebitResponse) {
+	if cca == nil {
+		answerError(c, m, resultCode)
+		return
+	}
 
-		_, err = a.WriteTo(c)
-		if err != nil {
-			logger.AcctLog.Errorf("Failed to write message to %s: %s\n%s\n",
-				c.RemoteAddr(), err, a)
-			return
-		}
+	a := m.Answer(resultCode)
+	if err := a.Marshal(cca); err != nil {
+		logger.AcctLog.Errorf("Marshal CCA Err: %+v:", err)
+	}
+	if _, err := a.WriteTo(c); err != nil {
+		logger.AcctLog.Errorf("Failed to write message to %s: %s\n%s\n",
+			c.RemoteAddr(), err, a)
+	}
+}
+
+func answerError(c diam.Conn, m *diam.Message, resultCode uint32) {
+	a := m.Answer(resultCode)
+	if _, err := a.WriteTo(c); err != nil {
+		logger.AcctLog.Errorf("Failed to write message to %s: %s\n%s\n",
+			c.RemoteAddr(), err, a)
+	}
+}
+
+func requestedMoneyOf(mscc *charging_datatype.MultipleServicesCreditControl) *charging_datatype.CCMoney {
+	if mscc.RequestedServiceUnit == nil {
+		return nil
+	}
+	return mscc.RequestedServiceUnit.CCMoney
+}
+
+// The requested units are seconds, octets or service specific units as indicated by the tariff
+func requestedUnitsOf(mscc *charging_datatype.MultipleServicesCreditControl) uint64 {
+	rsu := mscc.RequestedServiceUnit
+	switch {
+	case rsu == nil:
+		return 0
+	case rsu.CCTime != 0:
+		return uint64(rsu.CCTime)
+	case rsu.CCTotalOctets != 0:
+		return uint64(rsu.CCTotalOctets)
+	}
+	return uint64(rsu.CCServiceSpecificUnits)
+}
+
+func usedMoneyOf(mscc *charging_datatype.MultipleServicesCreditControl) *charging_datatype.CCMoney {
+	if mscc.UsedServiceUnit == nil {
+		return nil
 	}
+	return mscc.UsedServiceUnit.CCMoney
 }
 
 func handleALL(c diam.Conn, m *diam.Message) {
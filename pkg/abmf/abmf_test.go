@@ -0,0 +1,174 @@
+package abmf
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/fiorix/go-diameter/diam/datatype"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	charging_code "github.com/free5gc/chf/ccs_diameter/code"
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/monetary"
+)
+
+func debitRequest(requestType charging_datatype.CcRequestType,
+	requested, used string) *charging_datatype.AccountDebitRequest {
+	mscc := &charging_datatype.MultipleServicesCreditControl{RatingGroup: 1}
+	if requested != "" {
+		value, _ := monetary.Parse(requested, monetary.DefaultCurrencyCode)
+		mscc.RequestedServiceUnit = &charging_datatype.RequestedServiceUnit{CCMoney: value.CCMoney()}
+	}
+	if used != "" {
+		value, _ := monetary.Parse(used, monetary.DefaultCurrencyCode)
+		mscc.UsedServiceUnit = &charging_datatype.UsedServiceUnit{CCMoney: value.CCMoney()}
+	}
+	return &charging_datatype.AccountDebitRequest{
+		CcRequestType:                 requestType,
+		RequestedAction:               charging_datatype.DIRECT_DEBITING,
+		MultipleServicesCreditControl: mscc,
+	}
+}
+
+func TestApplyRequestWithoutOverdraft(t *testing.T) {
+	chargingData := map[string]interface{}{"quota": "10"}
+
+	// The reservation is capped to the balance
+	update, err := applyRequest(debitRequest(charging_datatype.INITIAL_REQUEST, "15", ""), "imsi-1", chargingData)
+	require.NoError(t, err)
+	require.Equal(t, "0", update.quota.String())
+	require.Equal(t, "10", monetary.FromCCMoney(update.creditControl.GrantedServiceUnit.CCMoney).String())
+	require.NotNil(t, update.creditControl.FinalUnitIndication)
+
+	// The usage over the balance does not take it negative
+	update, err = applyRequest(debitRequest(charging_datatype.TERMINATION_REQUEST, "", "12"), "imsi-1", chargingData)
+	require.NoError(t, err)
+	require.Equal(t, "0", update.quota.String())
+
+	// The event over the balance is denied
+	update, err = applyRequest(debitRequest(charging_datatype.EVENT_REQUEST, "", "11"), "imsi-1", chargingData)
+	require.NoError(t, err)
+	require.Equal(t, "10", update.quota.String())
+	require.Equal(t, datatype.Unsigned32(charging_code.CreditLimitReached), update.creditControl.ResultCode)
+}
+
+func TestCheckRequest(t *testing.T) {
+	require.NoError(t, checkRequest(debitRequest(charging_datatype.EVENT_REQUEST, "", "1")))
+
+	// The event is priced by its usage
+	require.Error(t, checkRequest(debitRequest(charging_datatype.EVENT_REQUEST, "", "")))
+
+	ccr := debitRequest(charging_datatype.INITIAL_REQUEST, "10", "")
+	ccr.MultipleServicesCreditControl = nil
+	require.Error(t, checkRequest(ccr))
+}
+
+func TestApplyRequestPriceEnquiryRange(t *testing.T) {
+	ccr := debitRequest(charging_datatype.EVENT_REQUEST, "", "")
+	ccr.RequestedAction = charging_datatype.PRICE_ENQUIRY
+	ccr.MultipleServicesCreditControl.RequestedServiceUnit = &charging_datatype.RequestedServiceUnit{
+		CCTotalOctets: datatype.Unsigned64(math.MaxUint32 + 1),
+	}
+
+	// The units over Unsigned32 are rejected before the rating
+	_, err := applyRequest(ccr, "imsi-1", map[string]interface{}{"quota": "10"})
+	var ccErr *creditControlError
+	require.ErrorAs(t, err, &ccErr)
+	require.Equal(t, uint32(diam.InvalidAVPValue), ccErr.resultCode)
+}
+
+func TestApplyRequestWithOverdraft(t *testing.T) {
+	chargingData := map[string]interface{}{"quota": "10", "overdraftLimit": "5"}
+
+	update, err := applyRequest(debitRequest(charging_datatype.INITIAL_REQUEST, "20", ""), "imsi-1", chargingData)
+	require.NoError(t, err)
+	require.Equal(t, "-5", update.quota.String())
+	require.Equal(t, "15", monetary.FromCCMoney(update.creditControl.GrantedServiceUnit.CCMoney).String())
+
+	update, err = applyRequest(debitRequest(charging_datatype.EVENT_REQUEST, "", "14"), "imsi-1", chargingData)
+	require.NoError(t, err)
+	require.Equal(t, "-4", update.quota.String())
+	require.Equal(t, datatype.Unsigned32(2001), update.creditControl.ResultCode)
+}
+
+func TestApplyRequestExpiredBalance(t *testing.T) {
+	chargingData := map[string]interface{}{
+		"quota":      "10",
+		"expiryDate": primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour)),
+	}
+
+	update, err := applyRequest(debitRequest(charging_datatype.INITIAL_REQUEST, "5", ""), "imsi-1", chargingData)
+	require.NoError(t, err)
+	require.Equal(t, "10", update.forfeited.String())
+	require.Equal(t, "0", update.quota.String())
+	require.Equal(t, "0", monetary.FromCCMoney(update.creditControl.GrantedServiceUnit.CCMoney).String())
+}
+
+func TestRefundExpiredReservation(t *testing.T) {
+	chargingData := map[string]interface{}{"quota": "-2", "overdraftLimit": "5"}
+
+	openingQuota, quota, err := refundQuota(chargingData, monetary.Value{ValueDigits: 7})
+	require.NoError(t, err)
+	require.Equal(t, "-2", openingQuota.String())
+	require.Equal(t, "5", quota.String())
+
+	// The reservation is refunded once the quota validity time and the grace period are over
+	now := time.Date(2023, 5, 3, 12, 0, 0, 0, time.UTC)
+	mscc := &charging_datatype.MultipleServicesCreditControl{ValidityTime: 600}
+	require.Equal(t, now.Add(11*time.Minute), reservationExpiryOf(mscc, now))
+	mscc.ValidityTime = 0
+	require.Equal(t, now.Add(defaultReservationValidity+reservationGracePeriod), reservationExpiryOf(mscc, now))
+}
+
+func TestRecordedAnswer(t *testing.T) {
+	now := time.Now()
+	ccr := debitRequest(charging_datatype.UPDATE_REQUEST, "5", "")
+	ccr.OriginHost, ccr.SessionId, ccr.CcRequestNumber = "chf", "chf;1;1", 3
+	ccr.DestinationHost = "abmf1"
+	update, err := applyRequest(ccr, "imsi-1", map[string]interface{}{"quota": "10"})
+	require.NoError(t, err)
+
+	// The answer is read back from the charging data as stored in mongoDB
+	stored := func(records []answerRecord) map[string]interface{} {
+		raw, err := bson.Marshal(bson.M{"quota": "5", answersField: records})
+		require.NoError(t, err)
+		chargingData := make(map[string]interface{})
+		require.NoError(t, bson.Unmarshal(raw, &chargingData))
+		return chargingData
+	}
+	other := answerRecord{OriginHost: "chf", SessionId: "chf;1;2", RequestNumber: 1, Answer: "{}",
+		Expires: now.Add(time.Second)}
+	expired := answerRecord{OriginHost: "chf", SessionId: "chf;1;3", RequestNumber: 1, Answer: "{}",
+		Expires: now}
+	records, err := recordAnswer(stored([]answerRecord{other, expired}), ccr, answerOf(ccr, update), now)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	chargingData := stored(records)
+
+	// The request sent again to another ABMF gets the answer of the request applied
+	ccr.DestinationHost = "abmf2"
+	cca, err := recordedAnswer(chargingData, ccr, now)
+	require.NoError(t, err)
+	require.NotNil(t, cca)
+	require.Equal(t, datatype.DiameterIdentity("abmf2"), cca.OriginHost)
+	require.Equal(t, "5", monetary.FromCCMoney(cca.MultipleServicesCreditControl.GrantedServiceUnit.CCMoney).String())
+
+	// The next request of the session is applied and replaces the answer
+	ccr.CcRequestNumber = 4
+	cca, err = recordedAnswer(chargingData, ccr, now)
+	require.NoError(t, err)
+	require.Nil(t, cca)
+	records, err = recordAnswer(chargingData, ccr, answerOf(ccr, update), now)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, uint32(4), records[1].RequestNumber)
+
+	// The answer is kept for the retransmissions only
+	cca, err = recordedAnswer(stored(records), ccr, now.Add(answerRetention))
+	require.NoError(t, err)
+	require.Nil(t, cca)
+}
@@ -0,0 +1,219 @@
+package abmf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/fiorix/go-diameter/diam/datatype"
+	"go.mongodb.org/mongo-driver/bson"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+)
+
+// The answer is kept for the retransmissions of the request, RFC 4006 5.1:
+// Tx expires within seconds and the request is sent again with the same CC-Request-Number
+const answerRetention = 30 * time.Second
+
+// The retransmission waits that long for the answer of the request being applied
+const answerWaitTimeout = 10 * time.Second
+
+type requestState int
+
+const (
+	requestNew requestState = iota
+	requestRetransmitted
+	requestOutOfOrder
+)
+
+// The CC-Request-Number increases within the session for each rating group,
+// the CHF numbers the requests of a rating group on their own.
+// The subscriber is part of the key: the clients not following RFC 6733 8.8 may share a Session-Id.
+type requestKey struct {
+	originHost     string
+	sessionId      string
+	subscriptionId string
+	ratingGroup    uint32
+}
+
+func requestKeyOf(ccr *charging_datatype.AccountDebitRequest) requestKey {
+	key := requestKey{
+		originHost:  string(ccr.OriginHost),
+		sessionId:   string(ccr.SessionId),
+		ratingGroup: uint32(ccr.MultipleServicesCreditControl.RatingGroup),
+	}
+	if ccr.SubscriptionId != nil {
+		key.subscriptionId = fmt.Sprintf("%d:%s",
+			ccr.SubscriptionId.SubscriptionIdType, ccr.SubscriptionId.SubscriptionIdData)
+	}
+	return key
+}
+
+// requestEntry is the last request of the key, done is closed once it is answered
+type requestEntry struct {
+	requestNumber uint32
+	done          chan struct{}
+	resultCode    uint32
+	cca           *charging_datatype.AccountDebitResponse
+	expires       time.Time
+}
+
+// requestCache detects the duplicate requests of the credit control sessions
+type requestCache struct {
+	mu        sync.Mutex
+	entries   map[requestKey]*requestEntry
+	lastSweep time.Time
+}
+
+var answers = newRequestCache()
+
+func newRequestCache() *requestCache {
+	return &requestCache{
+		entries: make(map[requestKey]*requestEntry),
+	}
+}
+
+// begin registers the request, the new request is answered by the caller with finish.
+// The retransmitted request gets the entry of the request answered or being answered,
+// the request numbered below the last one of the key is out of order.
+func (rc *requestCache) begin(key requestKey, requestNumber uint32, now time.Time) (*requestEntry, requestState) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.sweep(now)
+
+	if entry, ok := rc.entries[key]; ok && now.Before(entry.expires) {
+		switch {
+		case requestNumber == entry.requestNumber:
+			return entry, requestRetransmitted
+		case requestNumber < entry.requestNumber:
+			return nil, requestOutOfOrder
+		}
+	}
+
+	entry := &requestEntry{
+		requestNumber: requestNumber,
+		done:          make(chan struct{}),
+		expires:       now.Add(answerRetention),
+	}
+	rc.entries[key] = entry
+	return entry, requestNew
+}
+
+// finish saves the answer of the new request for its retransmissions. The request failed
+// for the ABMF itself has not been applied, its retransmission is applied again.
+func (rc *requestCache) finish(key requestKey, entry *requestEntry, resultCode uint32,
+	cca *charging_datatype.AccountDebitResponse, now time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry.resultCode = resultCode
+	entry.cca = cca
+	entry.expires = now.Add(answerRetention)
+	close(entry.done)
+
+	if resultCode == diam.UnableToComply && rc.entries[key] == entry {
+		delete(rc.entries, key)
+	}
+}
+
+// The expired entries are removed lazily, at most once per retention period
+func (rc *requestCache) sweep(now time.Time) {
+	if now.Sub(rc.lastSweep) < answerRetention {
+		return
+	}
+	rc.lastSweep = now
+	for key, entry := range rc.entries {
+		if !now.Before(entry.expires) {
+			delete(rc.entries, key)
+		}
+	}
+}
+
+// answersField keeps the answers of the requests applied to the balance in its charging data. The answer
+// is written in the update applying the request, the ABMF the session fails over to answers the request
+// sent again with the T flag, RFC 4006 5.7, instead of applying it a second time.
+const answersField = "answers"
+
+// answerRecord is the last answer of the session on the balance of the rating group
+type answerRecord struct {
+	OriginHost    string    `bson:"originHost"`
+	SessionId     string    `bson:"sessionId"`
+	RequestNumber uint32    `bson:"requestNumber"`
+	Answer        string    `bson:"answer"` // JSON of the CCA
+	Expires       time.Time `bson:"expires"`
+}
+
+func answerRecordsOf(chargingData map[string]interface{}) ([]answerRecord, error) {
+	answers, ok := chargingData[answersField]
+	if !ok || answers == nil {
+		return nil, nil
+	}
+	raw, err := bson.Marshal(bson.M{answersField: answers})
+	if err != nil {
+		return nil, err
+	}
+	var document struct {
+		Answers []answerRecord `bson:"answers"`
+	}
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	return document.Answers, nil
+}
+
+// recordedAnswer is the answer of the request applied to the balance already, nil if it has not been
+func recordedAnswer(chargingData map[string]interface{}, ccr *charging_datatype.AccountDebitRequest,
+	now time.Time) (*charging_datatype.AccountDebitResponse, error) {
+	records, err := answerRecordsOf(chargingData)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.OriginHost != string(ccr.OriginHost) || record.SessionId != string(ccr.SessionId) ||
+			record.RequestNumber != uint32(ccr.CcRequestNumber) || !now.Before(record.Expires) {
+			continue
+		}
+		cca := &charging_datatype.AccountDebitResponse{}
+		if err := json.Unmarshal([]byte(record.Answer), cca); err != nil {
+			return nil, err
+		}
+		// The answer comes from the ABMF the request is sent to now
+		cca.OriginHost = ccr.DestinationHost
+		cca.OriginRealm = ccr.DestinationRealm
+		cca.EventTimestamp = datatype.Time(now)
+		return cca, nil
+	}
+	return nil, nil
+}
+
+// recordAnswer returns the answers of the charging data with the answer of the request in place of the
+// previous answer of its session, the expired answers are dropped
+func recordAnswer(chargingData map[string]interface{}, ccr *charging_datatype.AccountDebitRequest,
+	cca *charging_datatype.AccountDebitResponse, now time.Time) ([]answerRecord, error) {
+	records, err := answerRecordsOf(chargingData)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := json.Marshal(cca)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]answerRecord, 0, len(records)+1)
+	for _, record := range records {
+		if !now.Before(record.Expires) ||
+			record.OriginHost == string(ccr.OriginHost) && record.SessionId == string(ccr.SessionId) {
+			continue
+		}
+		kept = append(kept, record)
+	}
+	return append(kept, answerRecord{
+		OriginHost:    string(ccr.OriginHost),
+		SessionId:     string(ccr.SessionId),
+		RequestNumber: uint32(ccr.CcRequestNumber),
+		Answer:        string(answer),
+		Expires:       now.Add(answerRetention),
+	}), nil
+}
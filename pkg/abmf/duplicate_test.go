@@ -0,0 +1,68 @@
+package abmf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/stretchr/testify/require"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/identity"
+)
+
+func TestRequestCache(t *testing.T) {
+	cache := newRequestCache()
+	key := requestKey{originHost: "chf", sessionId: "1", ratingGroup: 1}
+	now := time.Date(2023, 5, 3, 12, 0, 0, 0, time.UTC)
+
+	entry, state := cache.begin(key, 0, now)
+	require.Equal(t, requestNew, state)
+	cca := &charging_datatype.AccountDebitResponse{CcRequestNumber: 0}
+	cache.finish(key, entry, diam.Success, cca, now)
+
+	// The retransmission gets the answer of the request
+	duplicate, state := cache.begin(key, 0, now.Add(time.Second))
+	require.Equal(t, requestRetransmitted, state)
+	require.Equal(t, uint32(diam.Success), duplicate.resultCode)
+	require.Same(t, cca, duplicate.cca)
+
+	// Another rating group of the session is numbered on its own
+	_, state = cache.begin(requestKey{originHost: "chf", sessionId: "1", ratingGroup: 2}, 0, now)
+	require.Equal(t, requestNew, state)
+
+	entry, state = cache.begin(key, 1, now.Add(2*time.Second))
+	require.Equal(t, requestNew, state)
+	_, state = cache.begin(key, 0, now.Add(3*time.Second))
+	require.Equal(t, requestOutOfOrder, state)
+
+	// The request failed for the ABMF itself is applied again
+	cache.finish(key, entry, diam.UnableToComply, nil, now.Add(3*time.Second))
+	_, state = cache.begin(key, 1, now.Add(4*time.Second))
+	require.Equal(t, requestNew, state)
+
+	// The session idle longer than the retention starts over
+	_, state = cache.begin(key, 0, now.Add(time.Hour))
+	require.Equal(t, requestNew, state)
+}
+
+func TestRequestKeySubscribers(t *testing.T) {
+	cache := newRequestCache()
+	now := time.Date(2023, 5, 3, 12, 0, 0, 0, time.UTC)
+	ccr := debitRequest(charging_datatype.INITIAL_REQUEST, "10", "")
+	ccr.OriginHost = "client"
+	ccr.SessionId = "1"
+
+	// Two subscribers of the same Session-Id are numbered on their own
+	ccr.SubscriptionId = identity.SubscriptionId("imsi-208930000000001")
+	first := requestKeyOf(ccr)
+	entry, state := cache.begin(first, 0, now)
+	require.Equal(t, requestNew, state)
+	cache.finish(first, entry, diam.Success, &charging_datatype.AccountDebitResponse{}, now)
+
+	ccr.SubscriptionId = identity.SubscriptionId("imsi-208930000000002")
+	second := requestKeyOf(ccr)
+	require.NotEqual(t, first, second)
+	_, state = cache.begin(second, 0, now)
+	require.Equal(t, requestNew, state)
+}
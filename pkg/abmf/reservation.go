@@ -0,0 +1,206 @@
+package abmf
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/account"
+	"github.com/free5gc/chf/pkg/monetary"
+)
+
+const (
+	// The reservation of the client without quota validity time is kept for an hour
+	defaultReservationValidity = time.Hour
+	// The client releases the reservation once its validity time is over, it is refunded a while later
+	reservationGracePeriod   = time.Minute
+	reservationSweepInterval = time.Minute
+)
+
+func reservationKeyOf(ccr *charging_datatype.AccountDebitRequest, subscriberId string) account.ReservationKey {
+	return account.ReservationKey{
+		Supi:        subscriberId,
+		RatingGroup: uint32(ccr.MultipleServicesCreditControl.RatingGroup),
+		OriginHost:  string(ccr.OriginHost),
+		SessionId:   string(ccr.SessionId),
+	}
+}
+
+// The reservation is valid for the Validity-Time requested by the client, its quota validity time
+func reservationExpiryOf(mscc *charging_datatype.MultipleServicesCreditControl, now time.Time) time.Time {
+	validity := defaultReservationValidity
+	if mscc.ValidityTime != 0 {
+		validity = time.Duration(mscc.ValidityTime) * time.Second
+	}
+	return now.Add(validity + reservationGracePeriod)
+}
+
+// takeRefund releases the reservation of the session refunded by the request, the refund is limited to the
+// money reserved: the reservation may have been refunded already as it expired.
+// The request refunding the reservation is returned with the money of the refund.
+func takeRefund(ccr *charging_datatype.AccountDebitRequest, key account.ReservationKey) (
+	*charging_datatype.AccountDebitRequest, *account.Reservation, error) {
+	reservation, err := account.TakeReservation(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requested := monetary.FromCCMoney(requestedMoneyOf(ccr.MultipleServicesCreditControl))
+	refund := monetary.Value{CurrencyCode: requested.CurrencyCode}
+	if reservation != nil {
+		reserved, err := reservation.Value()
+		if err != nil {
+			return nil, reservation, err
+		}
+		if requested, err = monetary.Exchange(requested, reserved.CurrencyCode); err != nil {
+			return nil, reservation, err
+		}
+		refund = requested
+		if exceeded, _ := requested.Cmp(reserved); exceeded > 0 {
+			refund = reserved
+		}
+	}
+	if exceeded, _ := requested.Cmp(refund); exceeded > 0 {
+		logger.AcctLog.Warnf("UE [%s], Rating group [%d], refund of %s limited to the reservation %s",
+			key.Supi, key.RatingGroup, requested, refund)
+	}
+
+	mscc := *ccr.MultipleServicesCreditControl
+	mscc.RequestedServiceUnit = &charging_datatype.RequestedServiceUnit{CCMoney: refund.CCMoney()}
+	refundRequest := *ccr
+	refundRequest.MultipleServicesCreditControl = &mscc
+	return &refundRequest, reservation, nil
+}
+
+// updateReservation keeps the reservation of the session with the money granted and used by the request.
+// The balance is updated already, the failure of the ledger is only logged.
+func updateReservation(ccr *charging_datatype.AccountDebitRequest, key account.ReservationKey,
+	update *balanceUpdate) {
+	if ccr.RequestedAction != charging_datatype.DIRECT_DEBITING {
+		return
+	}
+
+	switch ccr.CcRequestType {
+	case charging_datatype.INITIAL_REQUEST, charging_datatype.UPDATE_REQUEST:
+		if update.creditControl == nil || update.creditControl.GrantedServiceUnit == nil {
+			return
+		}
+		granted := monetary.FromCCMoney(update.creditControl.GrantedServiceUnit.CCMoney)
+		// The usage reported is deducted from the reservation, the client holding no reservation reports none
+		used, err := monetary.Exchange(monetary.FromCCMoney(usedMoneyOf(ccr.MultipleServicesCreditControl)),
+			granted.CurrencyCode)
+		if err != nil {
+			logger.AcctLog.Errorf("UE [%s], Rating group [%d], usage of the reservation: %+v",
+				key.Supi, key.RatingGroup, err)
+			return
+		}
+		reservation, err := account.Reserve(key, used, granted,
+			reservationExpiryOf(ccr.MultipleServicesCreditControl, time.Now()))
+		if err != nil {
+			logger.AcctLog.Errorf("UE [%s], Rating group [%d], reserve %s: %+v",
+				key.Supi, key.RatingGroup, granted, err)
+			return
+		}
+		logger.AcctLog.Debugf("UE [%s], Rating group [%d], reserved %s until %s",
+			key.Supi, key.RatingGroup, reservation.Amount, reservation.ExpiryTime)
+	case charging_datatype.TERMINATION_REQUEST:
+		// The reservation is consumed, the usage over it is debited
+		if _, err := account.TakeReservation(key); err != nil {
+			logger.AcctLog.Errorf("UE [%s], Rating group [%d], release reservation: %+v",
+				key.Supi, key.RatingGroup, err)
+		}
+	}
+}
+
+// sweepReservations refunds the reservations abandoned by their sessions, the reservation is
+// refunded once by the ABMFs sharing the database
+func sweepReservations() {
+	ticker := time.NewTicker(reservationSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		reservations, err := account.ExpiredReservations(now)
+		if err != nil {
+			logger.AcctLog.Errorf("Find expired reservations: %+v", err)
+			continue
+		}
+		for i := range reservations {
+			refundReservation(&reservations[i])
+		}
+	}
+}
+
+func refundReservation(reservation *account.Reservation) {
+	amount, err := reservation.Value()
+	if err != nil {
+		logger.AcctLog.Errorf("UE [%s], Rating group [%d], invalid reservation: %+v",
+			reservation.Supi, reservation.RatingGroup, err)
+		return
+	}
+
+	// The session has updated or released the reservation meanwhile.
+	// The reservation is deleted before the refund, it is refunded once: the refund failed restores it.
+	deleted, err := account.DeleteReservation(reservation)
+	if err != nil {
+		logger.AcctLog.Errorf("UE [%s], Rating group [%d], delete reservation: %+v",
+			reservation.Supi, reservation.RatingGroup, err)
+		return
+	}
+	if !deleted || amount.IsZero() {
+		return
+	}
+
+	var openingQuota, quota monetary.Value
+	err = account.UpdateBalance(reservation.Supi, reservation.RatingGroup,
+		func(chargingData map[string]interface{}) (bson.M, error) {
+			var refundErr error
+			if openingQuota, quota, refundErr = refundQuota(chargingData, amount); refundErr != nil {
+				return nil, refundErr
+			}
+			return bson.M{"quota": quota.String()}, nil
+		})
+	if err != nil {
+		logger.AcctLog.Errorf("UE [%s], Rating group [%d], refund expired reservation %s: %+v",
+			reservation.Supi, reservation.RatingGroup, amount, err)
+		restoreReservation(reservation)
+		return
+	}
+
+	logger.AcctLog.Infof("UE [%s], Rating group [%d], expired reservation of session [%s] refunded %s",
+		reservation.Supi, reservation.RatingGroup, reservation.SessionId, amount)
+	recordTransactions(reservation.Supi, reservation.RatingGroup, charging_datatype.REFUND_ACCOUNT,
+		monetary.Value{}, openingQuota, quota)
+}
+
+// The quota of the charging data before and after the refund, in the currency of the balance
+func refundQuota(chargingData map[string]interface{}, amount monetary.Value) (monetary.Value, monetary.Value, error) {
+	currencyCode := monetary.CurrencyCodeOf(chargingData)
+	if currencyCode == 0 {
+		currencyCode = monetary.DefaultCurrencyCode
+	}
+	quotaStr, _ := chargingData["quota"].(string)
+	openingQuota, err := monetary.Parse(quotaStr, currencyCode)
+	if err != nil {
+		return monetary.Value{}, monetary.Value{}, fmt.Errorf("invalid quota: %+v", err)
+	}
+	refund, err := monetary.Exchange(amount, currencyCode)
+	if err != nil {
+		return monetary.Value{}, monetary.Value{}, err
+	}
+	quota, err := openingQuota.Add(refund)
+	return openingQuota, quota, err
+}
+
+// The reservation taken by the refund failed is kept for the retransmission or the sweeper
+func restoreReservation(reservation *account.Reservation) {
+	if reservation == nil {
+		return
+	}
+	if err := account.RestoreReservation(reservation); err != nil {
+		logger.AcctLog.Errorf("UE [%s], Rating group [%d], restore reservation: %+v",
+			reservation.Supi, reservation.RatingGroup, err)
+	}
+}
@@ -0,0 +1,410 @@
+// Package account manages the accounts of the ABMF in MongoDB. The balance of each rating group of the
+// subscriber is kept in its charging data, shared with the rating function, and the changes of the balances
+// are kept as the transaction history of the account.
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/identity"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/util/mongoapi"
+)
+
+const (
+	chargingDatasColl = "chargingDatas"
+	transactionsColl  = "accountTransactions"
+)
+
+var (
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrAccountExists      = errors.New("account already exists")
+	ErrBalanceNotFound    = errors.New("balance not found")
+	ErrBalanceExists      = errors.New("balance already exists")
+	ErrExpiryDateRequired = errors.New("the balance has expired, a new expiry date is required")
+	ErrInvalidRequest     = errors.New("invalid request")
+)
+
+type TransactionType string
+
+const (
+	TransactionTopUp  TransactionType = "TOP_UP"
+	TransactionDebit  TransactionType = "DEBIT"
+	TransactionRefund TransactionType = "REFUND"
+	TransactionExpiry TransactionType = "EXPIRY"
+)
+
+// Account is the subscriber with the balances of its rating groups
+type Account struct {
+	Supi     string    `json:"supi"`
+	Balances []Balance `json:"balances"`
+}
+
+// Balance is the money of the rating group, the balance is forfeited once expired.
+// The balance is changed atomically, see UpdateBalance.
+// The unit cost and unit type of a flat tariff, or the tariff plan, are those of the rating function.
+type Balance struct {
+	RatingGroup  uint32     `json:"ratingGroup" bson:"ratingGroup"`
+	Balance      string     `json:"balance" bson:"quota"`
+	CurrencyCode uint32     `json:"currencyCode,omitempty" bson:"currencyCode,omitempty"`
+	ExpiryDate   *time.Time `json:"expiryDate,omitempty" bson:"expiryDate,omitempty"`
+	UnitCost     string     `json:"unitCost,omitempty" bson:"unitCost,omitempty"`
+	UnitType     string     `json:"unitType,omitempty" bson:"unitType,omitempty"`
+	TariffPlan   string     `json:"tariffPlan,omitempty" bson:"tariffPlan,omitempty"`
+	// The balance may go negative down to the overdraft limit, none by default
+	OverdraftLimit string `json:"overdraftLimit,omitempty" bson:"overdraftLimit,omitempty"`
+}
+
+// Transaction is a change of the balance, the amount and the balance after the change
+// are in the currency of the balance
+type Transaction struct {
+	Id           string          `json:"id" bson:"id"`
+	Supi         string          `json:"supi" bson:"ueId"`
+	RatingGroup  uint32          `json:"ratingGroup" bson:"ratingGroup"`
+	Type         TransactionType `json:"type" bson:"type"`
+	Amount       string          `json:"amount" bson:"amount"`
+	CurrencyCode uint32          `json:"currencyCode" bson:"currencyCode"`
+	Balance      string          `json:"balance" bson:"balance"`
+	Timestamp    time.Time       `json:"timestamp" bson:"timestamp"`
+}
+
+func balanceFilter(supi string, ratingGroup uint32) bson.M {
+	return bson.M{"ueId": supi, "ratingGroup": ratingGroup}
+}
+
+// CreateBalanceIndex makes the balance unique for its rating group, of the accounts created at once
+// one is kept
+func CreateBalanceIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	_, err := collection(chargingDatasColl).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "ueId", Value: 1},
+			{Key: "ratingGroup", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("create balance index: %+v", err)
+	}
+	return nil
+}
+
+// Get returns the account with its balances ordered by rating group
+func Get(supi string) (*Account, error) {
+	chargingDatas, err := mongoapi.RestfulAPIGetMany(chargingDatasColl, bson.M{"ueId": supi})
+	if err != nil {
+		return nil, err
+	}
+	if len(chargingDatas) == 0 {
+		return nil, ErrAccountNotFound
+	}
+
+	account := &Account{Supi: supi}
+	for _, chargingData := range chargingDatas {
+		balance, err := balanceOf(chargingData)
+		if err != nil {
+			return nil, err
+		}
+		account.Balances = append(account.Balances, *balance)
+	}
+	sort.Slice(account.Balances, func(i, j int) bool {
+		return account.Balances[i].RatingGroup < account.Balances[j].RatingGroup
+	})
+	return account, nil
+}
+
+// Create stores the new account, the opening balances are recorded as top-ups.
+// The account created at once by another request is told by the balance index.
+func Create(account *Account) error {
+	if err := identity.Validate(account.Supi); err != nil {
+		return fmt.Errorf("%w: %+v %q", ErrInvalidRequest, err, account.Supi)
+	}
+	if len(account.Balances) == 0 {
+		return fmt.Errorf("%w: an account needs at least one balance", ErrInvalidRequest)
+	}
+	ratingGroups := make(map[uint32]bool)
+	for _, balance := range account.Balances {
+		if ratingGroups[balance.RatingGroup] {
+			return fmt.Errorf("%w: duplicate balance of rating group %d", ErrInvalidRequest, balance.RatingGroup)
+		}
+		ratingGroups[balance.RatingGroup] = true
+		if _, err := valueOf(&balance); err != nil {
+			return err
+		}
+	}
+
+	count, err := mongoapi.RestfulAPICount(chargingDatasColl, bson.M{"ueId": account.Supi})
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return ErrAccountExists
+	}
+
+	for i := range account.Balances {
+		if err := openBalance(account.Supi, &account.Balances[i]); errors.Is(err, ErrBalanceExists) {
+			return ErrAccountExists
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the balances and the transaction history of the account
+func Delete(supi string) error {
+	count, err := mongoapi.RestfulAPICount(chargingDatasColl, bson.M{"ueId": supi})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAccountNotFound
+	}
+
+	if err := mongoapi.RestfulAPIDeleteMany(chargingDatasColl, bson.M{"ueId": supi}); err != nil {
+		return err
+	}
+	if err := mongoapi.RestfulAPIDeleteMany(reservationsColl, bson.M{"ueId": supi}); err != nil {
+		return err
+	}
+	return mongoapi.RestfulAPIDeleteMany(transactionsColl, bson.M{"ueId": supi})
+}
+
+// AddBalance adds the balance of another rating group to the account
+func AddBalance(supi string, balance *Balance) error {
+	if _, err := valueOf(balance); err != nil {
+		return err
+	}
+	count, err := mongoapi.RestfulAPICount(chargingDatasColl, bson.M{"ueId": supi})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAccountNotFound
+	}
+	if _, err := GetBalance(supi, balance.RatingGroup); err == nil {
+		return ErrBalanceExists
+	} else if !errors.Is(err, ErrBalanceNotFound) {
+		return err
+	}
+
+	return openBalance(supi, balance)
+}
+
+// DeleteBalance removes the balance of the rating group from the account
+func DeleteBalance(supi string, ratingGroup uint32) error {
+	if _, err := GetBalance(supi, ratingGroup); err != nil {
+		return err
+	}
+	return mongoapi.RestfulAPIDeleteOne(chargingDatasColl, balanceFilter(supi, ratingGroup))
+}
+
+func GetBalance(supi string, ratingGroup uint32) (*Balance, error) {
+	chargingData, err := mongoapi.RestfulAPIGetOne(chargingDatasColl, balanceFilter(supi, ratingGroup))
+	if err != nil {
+		return nil, err
+	}
+	if len(chargingData) == 0 {
+		return nil, ErrBalanceNotFound
+	}
+	return balanceOf(chargingData)
+}
+
+// TopUp adds the amount, exchanged into the currency of the balance, to the balance of the rating group.
+// The expiry date of the top-up replaces the one of the balance, an expired balance is forfeited
+// and needs a new expiry date.
+func TopUp(supi string, ratingGroup uint32, amount monetary.Value, expiryDate *time.Time) (*Balance, error) {
+	if amount.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: the top-up amount must be positive", ErrInvalidRequest)
+	}
+
+	var balance *Balance
+	var topUp, forfeited, value monetary.Value
+	err := UpdateBalance(supi, ratingGroup, func(chargingData map[string]interface{}) (bson.M, error) {
+		var err error
+		if balance, err = balanceOf(chargingData); err != nil {
+			return nil, err
+		}
+		if value, err = valueOf(balance); err != nil {
+			return nil, err
+		}
+		if topUp, err = monetary.Exchange(amount, value.CurrencyCode); err != nil {
+			return nil, fmt.Errorf("%w: %+v", ErrInvalidRequest, err)
+		}
+
+		forfeited = monetary.Value{}
+		if balance.Expired(time.Now()) {
+			if expiryDate == nil {
+				return nil, ErrExpiryDateRequired
+			}
+			if value.Sign() > 0 {
+				forfeited = value
+				value = monetary.Value{CurrencyCode: value.CurrencyCode}
+			}
+		}
+
+		if value, err = value.Add(topUp); err != nil {
+			return nil, err
+		}
+		balance.Balance = value.String()
+		set := bson.M{"quota": balance.Balance}
+		if expiryDate != nil {
+			balance.ExpiryDate = expiryDate
+			set["expiryDate"] = *expiryDate
+		}
+		return set, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The balance is credited already, the top-up is not failed for the history: the retry would credit it twice
+	if !forfeited.IsZero() {
+		if err := RecordTransaction(supi, ratingGroup, TransactionExpiry, forfeited.Neg(),
+			monetary.Value{CurrencyCode: value.CurrencyCode}); err != nil {
+			logger.AcctLog.Errorf("UE [%s], Rating group [%d], record expiry of %s: %+v",
+				supi, ratingGroup, forfeited, err)
+		}
+	}
+	if err := RecordTransaction(supi, ratingGroup, TransactionTopUp, topUp, value); err != nil {
+		logger.AcctLog.Errorf("UE [%s], Rating group [%d], record top-up of %s: %+v", supi, ratingGroup, topUp, err)
+	}
+	return balance, nil
+}
+
+// Transactions returns the transaction history of the account in chronological order
+func Transactions(supi string) ([]Transaction, error) {
+	count, err := mongoapi.RestfulAPICount(chargingDatasColl, bson.M{"ueId": supi})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrAccountNotFound
+	}
+
+	documents, err := mongoapi.RestfulAPIGetMany(transactionsColl, bson.M{"ueId": supi})
+	if err != nil {
+		return nil, err
+	}
+	transactions := make([]Transaction, 0, len(documents))
+	for _, document := range documents {
+		var transaction Transaction
+		if err := decode(document, &transaction); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+	})
+	return transactions, nil
+}
+
+// RecordTransaction adds the change of the balance of the rating group to the transaction history
+func RecordTransaction(supi string, ratingGroup uint32, transactionType TransactionType,
+	amount, balance monetary.Value) error {
+	transaction := Transaction{
+		Id:           uuid.New().String(),
+		Supi:         supi,
+		RatingGroup:  ratingGroup,
+		Type:         transactionType,
+		Amount:       amount.String(),
+		CurrencyCode: balance.CurrencyCode,
+		Balance:      balance.String(),
+		Timestamp:    time.Now(),
+	}
+	return mongoapi.RestfulAPIPostMany(transactionsColl, nil, []interface{}{transaction})
+}
+
+// Expired tells whether the balance has expired at the time
+func (b *Balance) Expired(t time.Time) bool {
+	return b.ExpiryDate != nil && !t.Before(*b.ExpiryDate)
+}
+
+// Expired tells whether the balance of the charging data has expired at the time
+func Expired(chargingData map[string]interface{}, t time.Time) bool {
+	expiryDate, ok := chargingData["expiryDate"].(primitive.DateTime)
+	return ok && !t.Before(expiryDate.Time())
+}
+
+// The opening balance is recorded as a top-up
+func openBalance(supi string, balance *Balance) error {
+	value, err := valueOf(balance)
+	if err != nil {
+		return err
+	}
+	balance.Balance = value.String()
+	if err := insertBalance(supi, balance); err != nil {
+		return err
+	}
+	if value.IsZero() {
+		return nil
+	}
+	return RecordTransaction(supi, balance.RatingGroup, TransactionTopUp, value, value)
+}
+
+// The balance inserted meanwhile is a duplicate key of the balance index
+func insertBalance(supi string, balance *Balance) error {
+	document := make(bson.M)
+	if err := decode(balance, &document); err != nil {
+		return err
+	}
+	document["ueId"] = supi
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	if _, err := collection(chargingDatasColl).InsertOne(ctx, document); mongo.IsDuplicateKeyError(err) {
+		return ErrBalanceExists
+	} else if err != nil {
+		return fmt.Errorf("insert balance of %s rating group %d: %+v", supi, balance.RatingGroup, err)
+	}
+	return nil
+}
+
+func balanceOf(chargingData map[string]interface{}) (*Balance, error) {
+	balance := &Balance{}
+	if err := decode(chargingData, balance); err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
+
+// The balance in its currency, the default currency for the balance without currency
+func valueOf(balance *Balance) (monetary.Value, error) {
+	currencyCode := balance.CurrencyCode
+	if currencyCode == 0 {
+		currencyCode = monetary.DefaultCurrencyCode
+	}
+	if _, err := OverdraftLimit(bson.M{"overdraftLimit": balance.OverdraftLimit}, currencyCode); err != nil {
+		return monetary.Value{}, fmt.Errorf("%w: rating group %d: %+v", ErrInvalidRequest, balance.RatingGroup, err)
+	}
+	if balance.Balance == "" {
+		return monetary.Value{CurrencyCode: currencyCode}, nil
+	}
+	value, err := monetary.Parse(balance.Balance, currencyCode)
+	if err != nil {
+		return monetary.Value{}, fmt.Errorf("%w: invalid balance of rating group %d: %+v", ErrInvalidRequest, balance.RatingGroup, err)
+	}
+	return value, nil
+}
+
+func decode(in, out interface{}) error {
+	raw, err := bson.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
@@ -0,0 +1,47 @@
+package account
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBalanceChargingData(t *testing.T) {
+	expiryDate := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	balance := &Balance{
+		RatingGroup:  1,
+		Balance:      "12.5",
+		CurrencyCode: 978,
+		ExpiryDate:   &expiryDate,
+		UnitCost:     "1",
+	}
+
+	// The balance is the quota of the charging data shared with the rating function
+	chargingData := make(bson.M)
+	require.NoError(t, decode(balance, &chargingData))
+	require.Equal(t, "12.5", chargingData["quota"])
+	require.Equal(t, "1", chargingData["unitCost"])
+	require.NotContains(t, chargingData, "tariffPlan")
+
+	decoded, err := balanceOf(chargingData)
+	require.NoError(t, err)
+	require.Equal(t, balance.Balance, decoded.Balance)
+	require.Equal(t, balance.CurrencyCode, decoded.CurrencyCode)
+	require.True(t, decoded.ExpiryDate.Equal(expiryDate))
+}
+
+func TestBalanceExpired(t *testing.T) {
+	expiryDate := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	balance := &Balance{ExpiryDate: &expiryDate}
+	require.False(t, balance.Expired(expiryDate.Add(-time.Second)))
+	require.True(t, balance.Expired(expiryDate))
+	require.False(t, (&Balance{}).Expired(expiryDate))
+
+	chargingData := map[string]interface{}{"expiryDate": primitive.NewDateTimeFromTime(expiryDate)}
+	require.False(t, Expired(chargingData, expiryDate.Add(-time.Second)))
+	require.True(t, Expired(chargingData, expiryDate.Add(time.Second)))
+	require.False(t, Expired(map[string]interface{}{}, expiryDate))
+}
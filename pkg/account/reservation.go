@@ -0,0 +1,244 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/util/mongoapi"
+)
+
+const reservationsColl = "reservations"
+
+// Reservation is the money of the balance reserved for a credit control session of the rating group,
+// it is already deducted from the balance. The amount is in the currency of the balance.
+// The reservation not released by its session before the expiry time is refunded by the ABMF.
+type Reservation struct {
+	Supi         string    `json:"supi" bson:"ueId"`
+	RatingGroup  uint32    `json:"ratingGroup" bson:"ratingGroup"`
+	OriginHost   string    `json:"originHost" bson:"originHost"`
+	SessionId    string    `json:"sessionId" bson:"sessionId"`
+	Amount       string    `json:"amount" bson:"amount"`
+	CurrencyCode uint32    `json:"currencyCode" bson:"currencyCode"`
+	ExpiryTime   time.Time `json:"expiryTime" bson:"expiryTime"`
+	Version      int64     `json:"-" bson:"version"`
+}
+
+// ReservationKey identifies the reservation of the rating group in a session of a credit control client
+type ReservationKey struct {
+	Supi        string
+	RatingGroup uint32
+	OriginHost  string
+	SessionId   string
+}
+
+func (k ReservationKey) filter() bson.M {
+	return bson.M{
+		"ueId":        k.Supi,
+		"ratingGroup": k.RatingGroup,
+		"originHost":  k.OriginHost,
+		"sessionId":   k.SessionId,
+	}
+}
+
+// CreateReservationIndex makes the reservation unique for its key, the ABMFs inserting the reservation
+// of a session at once keep one of them
+func CreateReservationIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	_, err := collection(reservationsColl).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "ueId", Value: 1},
+			{Key: "ratingGroup", Value: 1},
+			{Key: "originHost", Value: 1},
+			{Key: "sessionId", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("create reservation index: %+v", err)
+	}
+	return nil
+}
+
+// Value is the amount reserved in the currency of the balance
+func (r *Reservation) Value() (monetary.Value, error) {
+	return monetary.Parse(r.Amount, r.CurrencyCode)
+}
+
+// Reserve changes the reservation of the session by the used money and the granted money,
+// the reservation does not go below zero. The reservation is valid until the expiry time.
+// The requests of a session are serialized by the client, the sweeper may release the reservation meanwhile.
+func Reserve(key ReservationKey, used, granted monetary.Value, expiryTime time.Time) (*Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		reservation, err := findReservation(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		amount := monetary.Value{CurrencyCode: granted.CurrencyCode}
+		var version int64
+		if reservation != nil {
+			if amount, err = reservation.Value(); err != nil {
+				return nil, fmt.Errorf("invalid reservation: %+v", err)
+			}
+			version = reservation.Version
+		}
+		if amount, err = amount.Sub(used); err != nil {
+			return nil, err
+		}
+		if amount.Sign() < 0 {
+			amount = monetary.Value{CurrencyCode: amount.CurrencyCode}
+		}
+		if amount, err = amount.Add(granted); err != nil {
+			return nil, err
+		}
+
+		next := &Reservation{
+			Supi:         key.Supi,
+			RatingGroup:  key.RatingGroup,
+			OriginHost:   key.OriginHost,
+			SessionId:    key.SessionId,
+			Amount:       amount.String(),
+			CurrencyCode: amount.CurrencyCode,
+			ExpiryTime:   expiryTime,
+			Version:      version + 1,
+		}
+		if reservation == nil {
+			_, err = collection(reservationsColl).InsertOne(ctx, next)
+			if mongo.IsDuplicateKeyError(err) {
+				// Inserted meanwhile, it is updated
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("insert reservation: %+v", err)
+			}
+			return next, nil
+		}
+
+		filter := key.filter()
+		filter["version"] = version
+		result, err := collection(reservationsColl).ReplaceOne(ctx, filter, next)
+		if err != nil {
+			return nil, fmt.Errorf("update reservation: %+v", err)
+		}
+		if result.MatchedCount == 1 {
+			return next, nil
+		}
+	}
+	return nil, ErrUpdateConflict
+}
+
+// TakeReservation removes the reservation of the session to release it, nil if there is none
+func TakeReservation(key ReservationKey) (*Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	var reservation Reservation
+	err := collection(reservationsColl).FindOneAndDelete(ctx, key.filter()).Decode(&reservation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("take reservation: %+v", err)
+	}
+	return &reservation, nil
+}
+
+// RestoreReservation puts back the reservation taken but not released
+func RestoreReservation(reservation *Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	_, err := collection(reservationsColl).InsertOne(ctx, reservation)
+	return err
+}
+
+// DeleteReservation removes the reservation if it is still the one read,
+// false if the session has changed or released it meanwhile
+func DeleteReservation(reservation *Reservation) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	key := ReservationKey{
+		Supi:        reservation.Supi,
+		RatingGroup: reservation.RatingGroup,
+		OriginHost:  reservation.OriginHost,
+		SessionId:   reservation.SessionId,
+	}
+	filter := key.filter()
+	filter["version"] = reservation.Version
+	result, err := collection(reservationsColl).DeleteOne(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("delete reservation: %+v", err)
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// ExpiredReservations returns the reservations expired at the time
+func ExpiredReservations(t time.Time) ([]Reservation, error) {
+	documents, err := mongoapi.RestfulAPIGetMany(reservationsColl, bson.M{"expiryTime": bson.M{"$lte": t}})
+	if err != nil {
+		return nil, err
+	}
+	return reservationsOf(documents)
+}
+
+// Reservations returns the outstanding reservations of the account by expiry time
+func Reservations(supi string) ([]Reservation, error) {
+	count, err := mongoapi.RestfulAPICount(chargingDatasColl, bson.M{"ueId": supi})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrAccountNotFound
+	}
+
+	documents, err := mongoapi.RestfulAPIGetMany(reservationsColl, bson.M{"ueId": supi})
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := reservationsOf(documents)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(reservations, func(i, j int) bool {
+		return reservations[i].ExpiryTime.Before(reservations[j].ExpiryTime)
+	})
+	return reservations, nil
+}
+
+func findReservation(ctx context.Context, key ReservationKey) (*Reservation, error) {
+	var reservation Reservation
+	err := collection(reservationsColl).FindOne(ctx, key.filter()).Decode(&reservation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find reservation: %+v", err)
+	}
+	return &reservation, nil
+}
+
+func reservationsOf(documents []map[string]interface{}) ([]Reservation, error) {
+	reservations := make([]Reservation, 0, len(documents))
+	for _, document := range documents {
+		var reservation Reservation
+		if err := decode(document, &reservation); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations, nil
+}
@@ -0,0 +1,116 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/util/mongoapi"
+)
+
+const (
+	// The balance updated concurrently is computed again, up to the attempts
+	maxUpdateAttempts = 10
+	updateTimeout     = 10 * time.Second
+)
+
+var ErrUpdateConflict = errors.New("the balance is updated concurrently, too many conflicts")
+
+var dbName string
+
+// SetDatabase sets the database of the balances, connected by mongoapi.SetMongoDB
+func SetDatabase(name string) {
+	dbName = name
+}
+
+// UpdateBalance changes the balance of the rating group atomically with optimistic concurrency.
+// The update computes the fields to set from the charging data read, they are written only if the
+// version of the charging data is still the one read, else the update is computed again on the charging
+// data written meanwhile. The update returning no field leaves the charging data as is.
+// The CHFs and ABMFs sharing the database may update the same balance at once, no update is lost.
+func UpdateBalance(supi string, ratingGroup uint32,
+	update func(chargingData map[string]interface{}) (bson.M, error)) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		chargingData, err := mongoapi.RestfulAPIGetOne(chargingDatasColl, balanceFilter(supi, ratingGroup))
+		if err != nil {
+			return err
+		}
+		if len(chargingData) == 0 {
+			return ErrBalanceNotFound
+		}
+
+		set, err := update(chargingData)
+		if err != nil {
+			return err
+		}
+		if len(set) == 0 {
+			return nil
+		}
+
+		updated, err := compareAndSet(supi, ratingGroup, versionOf(chargingData), set)
+		if err != nil {
+			return err
+		}
+		if updated {
+			return nil
+		}
+	}
+	return ErrUpdateConflict
+}
+
+// OverdraftLimit is how far the balance of the charging data may go negative, none by default
+func OverdraftLimit(chargingData map[string]interface{}, currencyCode uint32) (monetary.Value, error) {
+	limitStr, _ := chargingData["overdraftLimit"].(string)
+	if limitStr == "" {
+		return monetary.Value{CurrencyCode: currencyCode}, nil
+	}
+	limit, err := monetary.Parse(limitStr, currencyCode)
+	if err != nil {
+		return monetary.Value{}, fmt.Errorf("invalid overdraft limit: %+v", err)
+	}
+	if limit.Sign() < 0 {
+		return monetary.Value{}, fmt.Errorf("negative overdraft limit %s", limit)
+	}
+	return limit, nil
+}
+
+// Set the fields and bump the version if the version is still the one read,
+// the charging data written before versioning has no version
+func compareAndSet(supi string, ratingGroup uint32, version int64, set bson.M) (bool, error) {
+	filter := balanceFilter(supi, ratingGroup)
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{nil, 0}}
+	} else {
+		filter["version"] = version
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	result, err := collection(chargingDatasColl).UpdateOne(ctx, filter,
+		bson.M{"$set": set, "$inc": bson.M{"version": int64(1)}})
+	if err != nil {
+		return false, fmt.Errorf("update balance of %s rating group %d: %+v", supi, ratingGroup, err)
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func versionOf(chargingData map[string]interface{}) int64 {
+	switch version := chargingData["version"].(type) {
+	case int32:
+		return int64(version)
+	case int64:
+		return version
+	case float64:
+		return int64(version)
+	}
+	return 0
+}
+
+func collection(name string) *mongo.Collection {
+	return mongoapi.Client.Database(dbName).Collection(name)
+}
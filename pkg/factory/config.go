@@ -13,9 +13,19 @@ import (
 )
 
 const (
-	ChfExpectedConfigVersion = "1.0.1"
-	ChfSbiDefaultIPv4        = "127.0.0.113"
-	ChfSbiDefaultPort        = 8000
+	ChfExpectedConfigVersion      = "1.0.1"
+	ChfSbiDefaultIPv4             = "127.0.0.113"
+	ChfSbiDefaultPort             = 8000
+	ChfDefaultTerminationTimeout  = 10
+	ChfDefaultValidityGracePeriod = 10
+	CdrFileDefaultPath            = "/tmp"
+	CdrFileDefaultMaxSize         = 1 << 20
+	CdrFileDefaultMaxOpenTime     = 300
+	CdrFileDefaultMaxCdrNum       = 1000
+	DiameterDefaultPoolSize       = 4
+	// the Diameter identity of the clients of the RF and the ABMF
+	DiameterClientDefaultOriginHost  = "client"
+	DiameterClientDefaultOriginRealm = "go-diameter"
 )
 
 type Config struct {
@@ -61,18 +71,65 @@ func (i *Info) validate() (bool, error) {
 }
 
 type Configuration struct {
-	ChfName             string    `yaml:"chfName,omitempty" valid:"required, type(string)"`
-	Sbi                 *Sbi      `yaml:"sbi,omitempty" valid:"required"`
-	NrfUri              string    `yaml:"nrfUri,omitempty" valid:"required, url"`
-	ServiceList         []Service `yaml:"serviceList,omitempty" valid:"required"`
-	Mongodb             *Mongodb  `yaml:"mongodb" valid:"required"`
-	VolumeLimit         int32     `yaml:"volumeLimit,omitempty" valid:"optional"`
-	VolumeLimitPDU      int32     `yaml:"volumeLimitPDU,omitempty" valid:"optional"`
-	VolumeThresholdRate float32   `yaml:"volumeThresholdRate,omitempty" valid:"optional"`
-	QuotaValidityTime   int32     `yaml:"quotaValidityTime,omitempty" valid:"optional"`
-	RfDiameter          *Diameter `yaml:"rfDiameter,omitempty" valid:"required"`
-	AbmfDiameter        *Diameter `yaml:"abmfDiameter,omitempty" valid:"required"`
-	Cgf                 *Cgf      `yaml:"cgf,omitempty" valid:"required"`
+	ChfName             string          `yaml:"chfName,omitempty" valid:"required, type(string)"`
+	Sbi                 *Sbi            `yaml:"sbi,omitempty" valid:"required"`
+	NrfUri              string          `yaml:"nrfUri,omitempty" valid:"required, url"`
+	ServiceList         []Service       `yaml:"serviceList,omitempty" valid:"required"`
+	Mongodb             *Mongodb        `yaml:"mongodb" valid:"required"`
+	VolumeLimit         int32           `yaml:"volumeLimit,omitempty" valid:"optional"`
+	VolumeLimitPDU      int32           `yaml:"volumeLimitPDU,omitempty" valid:"optional"`
+	VolumeThresholdRate float32         `yaml:"volumeThresholdRate,omitempty" valid:"optional"`
+	TimeThresholdRate   float32         `yaml:"timeThresholdRate,omitempty" valid:"optional"`
+	QuotaValidityTime   int32           `yaml:"quotaValidityTime,omitempty" valid:"optional"`
+	TerminationTimeout  int32           `yaml:"terminationTimeout,omitempty" valid:"optional"`
+	ValidityGracePeriod int32           `yaml:"validityGracePeriod,omitempty" valid:"optional"`
+	RfDiameter          *Diameter       `yaml:"rfDiameter,omitempty" valid:"required"`
+	AbmfDiameter        *Diameter       `yaml:"abmfDiameter,omitempty" valid:"required"`
+	RfServer            *DiameterServer `yaml:"rfServer,omitempty" valid:"optional"`
+	AbmfServer          *DiameterServer `yaml:"abmfServer,omitempty" valid:"optional"`
+	Cgf                 *Cgf            `yaml:"cgf,omitempty" valid:"required"`
+	SessionStore        string          `yaml:"sessionStore,omitempty" valid:"optional,in(mongodb|none)"`
+	TimeLimit           int32           `yaml:"timeLimit,omitempty" valid:"optional"`
+	ChargingPolicy      *ChargingPolicy `yaml:"chargingPolicy,omitempty" valid:"optional"`
+	PartialRecord       *PartialRecord  `yaml:"partialRecord,omitempty" valid:"optional"`
+	ExchangeRates       []ExchangeRate  `yaml:"exchangeRates,omitempty" valid:"optional"`
+	Oam                 *Oam            `yaml:"oam,omitempty" valid:"optional"`
+}
+
+// ChargingPolicy decides the charging mode of a subscriber or a DNN, the rule of the subscriber and
+// the DNN takes precedence over the subscriber rule, which takes precedence over the DNN rule
+type ChargingPolicy struct {
+	DefaultMode string             `yaml:"defaultMode,omitempty" valid:"optional,in(online|offline|converged)"`
+	Rules       []ChargingModeRule `yaml:"rules,omitempty" valid:"optional"`
+}
+
+type ChargingModeRule struct {
+	Supi string `yaml:"supi,omitempty" valid:"optional"`
+	Dnn  string `yaml:"dnn,omitempty" valid:"optional"`
+	Mode string `yaml:"mode" valid:"required,in(online|offline|converged)"`
+}
+
+// Partial record closure conditions of the CHF CDR, refer to TS 32.255 5.2.5,
+// a zero limit disables the condition. The conditions are checked on the charging data updates,
+// so the time limit closes the record at the first update after it elapsed.
+// Method default closes the record on the conditions, individual also closes a record for every
+// charging condition change. The roaming charging profile of the NF consumer overrides it.
+type PartialRecord struct {
+	Method                string `yaml:"method,omitempty" valid:"optional,in(default|individual)"`
+	TimeLimit             int    `yaml:"timeLimit,omitempty" valid:"optional"`   // seconds
+	VolumeLimit           uint64 `yaml:"volumeLimit,omitempty" valid:"optional"` // octets
+	MaxChargingConditions int    `yaml:"maxChargingConditions,omitempty" valid:"optional"`
+	ServingNodeChange     bool   `yaml:"servingNodeChange,omitempty" valid:"optional"`
+	RatChange             bool   `yaml:"ratChange,omitempty" valid:"optional"`
+}
+
+// ExchangeRate converts the money in the From currency into the To currency, To = From × Rate.
+// The currencies are ISO 4217 numeric codes and the rate is a decimal, e.g. "31.25".
+// The money between currencies without a rate is rejected.
+type ExchangeRate struct {
+	From uint32 `yaml:"from" valid:"required"`
+	To   uint32 `yaml:"to" valid:"required"`
+	Rate string `yaml:"rate" valid:"required,float"`
 }
 
 func (c *Configuration) validate() (bool, error) {
@@ -94,6 +151,26 @@ func (c *Configuration) validate() (bool, error) {
 		}
 	}
 
+	for _, client := range []*Diameter{c.RfDiameter, c.AbmfDiameter} {
+		if client == nil {
+			continue
+		}
+		if _, err := client.validate(); err != nil {
+			return false, err
+		}
+	}
+
+	if c.RfDiameter != nil && c.AbmfDiameter != nil {
+		for _, server := range []*DiameterServer{c.GetRfServer(), c.GetAbmfServer()} {
+			if server.Disable {
+				continue
+			}
+			if _, err := server.validate(); err != nil {
+				return false, err
+			}
+		}
+	}
+
 	if _, err := govalidator.ValidateStruct(c); err != nil {
 		return false, appendInvalid(err)
 	}
@@ -110,6 +187,7 @@ func (s *Service) validate() (bool, error) {
 	govalidator.TagMap["service"] = govalidator.Validator(func(str string) bool {
 		switch str {
 		case "nchf-convergedcharging":
+		case "nchf-spendinglimitcontrol":
 		default:
 			return false
 		}
@@ -123,18 +201,98 @@ func (s *Service) validate() (bool, error) {
 	return true, nil
 }
 
+// Transport protocols of the Diameter interfaces, tls is TLS over TCP
+const (
+	DiameterProtocolTcp  = "tcp"
+	DiameterProtocolSctp = "sctp"
+	DiameterProtocolTls  = "tls"
+)
+
+// Diameter is the client of the RF or the ABMF, it uses TLS with the tls protocol
 type Diameter struct {
-	Protocol string `yaml:"protocol" valid:"required"`
-	HostIPv4 string `yaml:"hostIPv4,omitempty" valid:"required,host"`
-	Port     int    `yaml:"port,omitempty" valid:"required,port"`
-	Tls      *Tls   `yaml:"tls,omitempty" valid:"optional"`
+	// the Diameter identity of this CHF towards the peer, each CHF sharing the peer has its own
+	OriginHost  string `yaml:"originHost,omitempty" valid:"optional"`
+	OriginRealm string `yaml:"originRealm,omitempty" valid:"optional"`
+	Protocol    string `yaml:"protocol" valid:"required,in(tcp|sctp|tls)"`
+	HostIPv4    string `yaml:"hostIPv4,omitempty" valid:"required,host"`
+	Port        int    `yaml:"port,omitempty" valid:"required,port"`
+	Tls         *Tls   `yaml:"tls,omitempty" valid:"optional"`
+	// number of connections kept to the peer, DiameterDefaultPoolSize if zero
+	PoolSize int `yaml:"poolSize,omitempty" valid:"optional"`
+	// Destination-Realm of the requests, any realm if empty
+	Realm string `yaml:"realm,omitempty" valid:"optional"`
+	// CC-Session-Failover of the sessions until the peer answers one, refer to RFC 4006 5.7
+	SessionFailover bool `yaml:"sessionFailover,omitempty" valid:"optional"`
+	// peers the requests are routed to, the server at hostIPv4 and port if empty
+	Peers []DiameterPeer `yaml:"peers,omitempty" valid:"optional"`
+}
+
+// Network is the transport network of the go-diameter dialer
+func (d *Diameter) Network() string {
+	return diameterNetwork(d.Protocol)
+}
+
+// UseTls is true with the tls protocol, the tls section alone does not enable TLS
+func (d *Diameter) UseTls() bool {
+	return d.Protocol == DiameterProtocolTls
+}
+
+func (d *Diameter) validate() (bool, error) {
+	if d.Protocol == DiameterProtocolSctp && d.Tls != nil {
+		return false, fmt.Errorf("Invalid Diameter %s:%d: TLS is not supported over sctp, remove the tls section",
+			d.HostIPv4, d.Port)
+	}
+	return true, nil
+}
+
+// GetOriginHost is the Origin-Host of the client, DiameterClientDefaultOriginHost if not configured
+func (d *Diameter) GetOriginHost() string {
+	if d.OriginHost != "" {
+		return d.OriginHost
+	}
+	return DiameterClientDefaultOriginHost
+}
+
+// GetOriginRealm is the Origin-Realm of the client, DiameterClientDefaultOriginRealm if not configured
+func (d *Diameter) GetOriginRealm() string {
+	if d.OriginRealm != "" {
+		return d.OriginRealm
+	}
+	return DiameterClientDefaultOriginRealm
+}
+
+func diameterNetwork(protocol string) string {
+	if protocol == DiameterProtocolSctp {
+		return DiameterProtocolSctp
+	}
+	return DiameterProtocolTcp
+}
+
+// DiameterPeer is a peer of the Diameter application, the peers of the lowest priority
+// value are preferred and the others take over when they are down
+type DiameterPeer struct {
+	HostIPv4 string `yaml:"hostIPv4" valid:"required,host"`
+	Port     int    `yaml:"port" valid:"required,port"`
+	// realm served by the peer, the Origin-Realm of its CEA if empty
+	Realm    string `yaml:"realm,omitempty" valid:"optional"`
+	Priority int    `yaml:"priority,omitempty" valid:"optional"`
 }
 
 type Cgf struct {
-	HostIPv4   string `yaml:"hostIPv4,omitempty" valid:"required,host"`
-	Port       int    `yaml:"port,omitempty" valid:"required,port"`
-	ListenPort int    `yaml:"listenPort,omitempty" valid:"required,port"`
-	Tls        *Tls   `yaml:"tls,omitempty" valid:"optional"`
+	HostIPv4   string   `yaml:"hostIPv4,omitempty" valid:"required,host"`
+	Port       int      `yaml:"port,omitempty" valid:"required,port"`
+	ListenPort int      `yaml:"listenPort,omitempty" valid:"required,port"`
+	Tls        *Tls     `yaml:"tls,omitempty" valid:"optional"`
+	CdrFile    *CdrFile `yaml:"cdrFile,omitempty" valid:"optional"`
+}
+
+// CDR file closure limits, refer to TS 32.297 6.1.1.1
+type CdrFile struct {
+	Path        string `yaml:"path,omitempty" valid:"optional"`
+	NodeId      string `yaml:"nodeId,omitempty" valid:"optional"`
+	MaxFileSize uint32 `yaml:"maxFileSize,omitempty" valid:"optional"` // bytes
+	MaxOpenTime int    `yaml:"maxOpenTime,omitempty" valid:"optional"` // seconds
+	MaxCdrNum   uint32 `yaml:"maxCdrNum,omitempty" valid:"optional"`
 }
 type Sbi struct {
 	Scheme       string `yaml:"scheme" valid:"required,scheme"`
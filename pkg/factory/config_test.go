@@ -0,0 +1,58 @@
+package factory
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func readConfig(t *testing.T, file string, config interface{}) {
+	content, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(content, config))
+}
+
+func TestDiameterTlsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		protocol string
+		tls      bool
+		useTls   bool
+		valid    bool
+	}{
+		{"tcp", DiameterProtocolTcp, false, false, true},
+		{"tcp with a tls section", DiameterProtocolTcp, true, false, true},
+		{"tls", DiameterProtocolTls, true, true, true},
+		{"sctp", DiameterProtocolSctp, false, false, true},
+		{"sctp with a tls section", DiameterProtocolSctp, true, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{}
+			readConfig(t, "../../config/chfcfg.yaml", config)
+			client := config.Configuration.AbmfDiameter
+			client.Protocol = tc.protocol
+			if !tc.tls {
+				client.Tls = nil
+			}
+			require.Equal(t, tc.useTls, client.UseTls())
+			require.Equal(t, tc.useTls, config.Configuration.GetAbmfServer().UseTls())
+
+			_, err := config.Validate()
+			require.Equal(t, tc.valid, err == nil, err)
+
+			server := &ServerConfig{}
+			readConfig(t, "../../config/abmfcfg.yaml", server)
+			server.Configuration.Diameter.Protocol = tc.protocol
+			if !tc.tls {
+				server.Configuration.Diameter.Tls = nil
+			}
+			require.Equal(t, tc.useTls, server.Configuration.Diameter.UseTls())
+
+			_, err = server.Validate()
+			require.Equal(t, tc.valid, err == nil, err)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package factory
+
+const (
+	ChfOamDefaultIPv4 = "127.0.0.1"
+	ChfOamDefaultPort = 8010
+)
+
+// Oam is the listener of the operator API, apart from the SBI of the NF services: the API terminates
+// sessions and credits accounts. It listens on the loopback address unless configured.
+type Oam struct {
+	Disable     bool   `yaml:"disable,omitempty" valid:"optional"`
+	Scheme      string `yaml:"scheme,omitempty" valid:"optional,in(http|https)"`
+	BindingIPv4 string `yaml:"bindingIPv4,omitempty" valid:"optional,host"`
+	Port        int    `yaml:"port,omitempty" valid:"optional,port"`
+	// the TLS key of the SBI if empty
+	Tls *Tls `yaml:"tls,omitempty" valid:"optional"`
+}
+
+// GetOam is the OAM listener of the configuration with the defaults of the fields not configured
+func (c *Configuration) GetOam() *Oam {
+	oam := Oam{}
+	if c.Oam != nil {
+		oam = *c.Oam
+	}
+	if oam.Scheme == "" {
+		oam.Scheme = "http"
+	}
+	if oam.BindingIPv4 == "" {
+		oam.BindingIPv4 = ChfOamDefaultIPv4
+	}
+	if oam.Port == 0 {
+		oam.Port = ChfOamDefaultPort
+	}
+	return &oam
+}
@@ -0,0 +1,161 @@
+/*
+ * RF and ABMF Configuration Factory
+ */
+
+package factory
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/asaskevich/govalidator"
+	"gopkg.in/yaml.v2"
+
+	logger_util "github.com/free5gc/util/logger"
+)
+
+const (
+	ServerExpectedConfigVersion      = "1.0.0"
+	DiameterServerDefaultOriginHost  = "server"
+	DiameterServerDefaultOriginRealm = "go-diameter"
+)
+
+// ServerConfig is the configuration of the RF or the ABMF running as a standalone server
+type ServerConfig struct {
+	Info          *Info                   `yaml:"info" valid:"required"`
+	Configuration *ServerConfiguration    `yaml:"configuration" valid:"required"`
+	Logger        *logger_util.LogSetting `yaml:"logger" valid:"-"` // an invalid level falls back to info
+}
+
+type ServerConfiguration struct {
+	Diameter      *DiameterServer `yaml:"diameter" valid:"required"`
+	Mongodb       *Mongodb        `yaml:"mongodb" valid:"required"`
+	ExchangeRates []ExchangeRate  `yaml:"exchangeRates,omitempty" valid:"optional"`
+}
+
+// DiameterServer is the identity and the listen address of the RF or the ABMF
+type DiameterServer struct {
+	// the server embedded in the CHF is not started, the CHF uses a standalone one
+	Disable     bool   `yaml:"disable,omitempty" valid:"optional"`
+	OriginHost  string `yaml:"originHost,omitempty" valid:"optional"`
+	OriginRealm string `yaml:"originRealm,omitempty" valid:"optional"`
+	// tcp if empty, the server uses TLS with the tls protocol and the tls section
+	Protocol string `yaml:"protocol,omitempty" valid:"optional,in(tcp|sctp|tls)"`
+	HostIPv4 string `yaml:"hostIPv4,omitempty" valid:"required,host"`
+	Port     int    `yaml:"port,omitempty" valid:"required,port"`
+	Tls      *Tls   `yaml:"tls,omitempty" valid:"optional"`
+}
+
+// ReadServerConfig reads and validates the configuration of the standalone server
+func ReadServerConfig(f string) (*ServerConfig, error) {
+	content, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &ServerConfig{}
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Info == nil || cfg.Info.Version != ServerExpectedConfigVersion {
+		return nil, fmt.Errorf("config version is [%s], but expected is [%s].",
+			cfg.GetVersion(), ServerExpectedConfigVersion)
+	}
+	if _, err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *ServerConfig) Validate() (bool, error) {
+	if _, err := c.Info.validate(); err != nil {
+		return false, err
+	}
+
+	if configuration := c.Configuration; configuration != nil {
+		if configuration.Mongodb != nil {
+			if _, err := configuration.Mongodb.validate(); err != nil {
+				return false, err
+			}
+		}
+		if configuration.Diameter != nil {
+			if _, err := configuration.Diameter.validate(); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if _, err := govalidator.ValidateStruct(c); err != nil {
+		return false, appendInvalid(err)
+	}
+
+	return true, nil
+}
+
+func (c *ServerConfig) GetVersion() string {
+	if c.Info != nil && c.Info.Version != "" {
+		return c.Info.Version
+	}
+	return ""
+}
+
+// Network is the transport network of the go-diameter listener
+func (s *DiameterServer) Network() string {
+	return diameterNetwork(s.Protocol)
+}
+
+// UseTls is true with the tls protocol, the tls section alone does not enable TLS
+func (s *DiameterServer) UseTls() bool {
+	return s.Protocol == DiameterProtocolTls
+}
+
+func (s *DiameterServer) validate() (bool, error) {
+	if s.Protocol == DiameterProtocolSctp && s.Tls != nil {
+		return false, fmt.Errorf("Invalid Diameter server %s:%d: TLS is not supported over sctp, remove the tls section",
+			s.HostIPv4, s.Port)
+	}
+	if s.Protocol == DiameterProtocolTls && s.Tls == nil {
+		return false, fmt.Errorf("Invalid Diameter server %s:%d: the tls protocol needs the tls section",
+			s.HostIPv4, s.Port)
+	}
+	return true, nil
+}
+
+// GetOriginHost is the Origin-Host of the server, DiameterServerDefaultOriginHost if not configured
+func (s *DiameterServer) GetOriginHost() string {
+	if s.OriginHost != "" {
+		return s.OriginHost
+	}
+	return DiameterServerDefaultOriginHost
+}
+
+// GetOriginRealm is the Origin-Realm of the server, DiameterServerDefaultOriginRealm if not configured
+func (s *DiameterServer) GetOriginRealm() string {
+	if s.OriginRealm != "" {
+		return s.OriginRealm
+	}
+	return DiameterServerDefaultOriginRealm
+}
+
+// GetRfServer is the RF embedded in the CHF, listening at the address of rfDiameter unless configured
+func (c *Configuration) GetRfServer() *DiameterServer {
+	return embeddedServer(c.RfServer, c.RfDiameter)
+}
+
+// GetAbmfServer is the ABMF embedded in the CHF, listening at the address of abmfDiameter unless configured
+func (c *Configuration) GetAbmfServer() *DiameterServer {
+	return embeddedServer(c.AbmfServer, c.AbmfDiameter)
+}
+
+func embeddedServer(server *DiameterServer, client *Diameter) *DiameterServer {
+	if server != nil {
+		return server
+	}
+	return &DiameterServer{
+		Protocol: client.Protocol,
+		HostIPv4: client.HostIPv4,
+		Port:     client.Port,
+		Tls:      client.Tls,
+	}
+}
@@ -0,0 +1,109 @@
+// Package identity maps the subscriber identifiers of the service based interfaces, the SUPI and the GPSI
+// of TS 29.571 5.3.2, to the Subscription-Id of Diameter, RFC 4006 8.46, and of the CDR, TS 32.298 5.1.5.1.x.
+package identity
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fiorix/go-diameter/diam/datatype"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/cdr/asn"
+	"github.com/free5gc/chf/cdr/cdrType"
+)
+
+var ErrUnsupported = errors.New("unsupported subscriber identifier")
+
+// kind is a type of subscriber identifier. The identifier without a Subscription-Id-Type of its own,
+// GCI, GLI and external identifier, is an END_USER_PRIVATE one carrying the whole identifier.
+type kind struct {
+	prefix       string
+	gpsi         bool
+	diameterType charging_datatype.SubscriptionIdType
+	cdrType      asn.Enumerated
+}
+
+func (k *kind) private() bool {
+	return k.diameterType == charging_datatype.END_USER_PRIVATE
+}
+
+var kinds = []kind{
+	{"imsi-", false, charging_datatype.END_USER_IMSI, cdrType.SubscriptionIDTypePresentENDUSERIMSI},
+	{"nai-", false, charging_datatype.END_USER_NAI, cdrType.SubscriptionIDTypePresentENDUSERNAI},
+	{"gci-", false, charging_datatype.END_USER_PRIVATE, cdrType.SubscriptionIDTypePresentENDUSERPRIVATE},
+	{"gli-", false, charging_datatype.END_USER_PRIVATE, cdrType.SubscriptionIDTypePresentENDUSERPRIVATE},
+	{"msisdn-", true, charging_datatype.END_USER_E164, cdrType.SubscriptionIDTypePresentENDUSERE164},
+	{"extid-", true, charging_datatype.END_USER_PRIVATE, cdrType.SubscriptionIDTypePresentENDUSERPRIVATE},
+}
+
+// parse returns the kind of the identifier and the Subscription-Id-Data
+func parse(id string) (*kind, string, error) {
+	for i := range kinds {
+		k := &kinds[i]
+		if value := strings.TrimPrefix(id, k.prefix); value != id && value != "" {
+			if k.private() {
+				return k, id, nil
+			}
+			return k, value, nil
+		}
+	}
+	return nil, "", ErrUnsupported
+}
+
+// Validate tells whether the identifier is a SUPI or a GPSI of a supported type
+func Validate(id string) error {
+	_, _, err := parse(id)
+	return err
+}
+
+// IsGpsi tells whether the identifier is a GPSI, msisdn-<digits> or extid-<external identifier>
+func IsGpsi(id string) bool {
+	k, _, err := parse(id)
+	return err == nil && k.gpsi
+}
+
+// SubscriptionId is the Diameter Subscription-Id of the identifier, nil for an unsupported identifier
+func SubscriptionId(id string) *charging_datatype.SubscriptionId {
+	k, data, err := parse(id)
+	if err != nil {
+		return nil
+	}
+	return &charging_datatype.SubscriptionId{
+		SubscriptionIdType: k.diameterType,
+		SubscriptionIdData: datatype.UTF8String(data),
+	}
+}
+
+// FromSubscriptionId is the identifier of the Diameter Subscription-Id, the subscriber of the accounts
+func FromSubscriptionId(subscriptionId *charging_datatype.SubscriptionId) (string, error) {
+	if subscriptionId == nil {
+		return "", ErrUnsupported
+	}
+	data := string(subscriptionId.SubscriptionIdData)
+
+	if subscriptionId.SubscriptionIdType == charging_datatype.END_USER_PRIVATE {
+		if k, _, err := parse(data); err == nil && k.private() {
+			return data, nil
+		}
+		return "", ErrUnsupported
+	}
+	for i := range kinds {
+		if k := &kinds[i]; k.diameterType == subscriptionId.SubscriptionIdType && data != "" {
+			return k.prefix + data, nil
+		}
+	}
+	return "", ErrUnsupported
+}
+
+// CdrSubscriptionId is the Subscriber Identifier of the CHF record, nil for an unsupported identifier
+func CdrSubscriptionId(id string) *cdrType.SubscriptionID {
+	k, data, err := parse(id)
+	if err != nil {
+		return nil
+	}
+	return &cdrType.SubscriptionID{
+		SubscriptionIDType: cdrType.SubscriptionIDType{Value: k.cdrType},
+		SubscriptionIDData: asn.UTF8String(data),
+	}
+}
@@ -0,0 +1,68 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/cdr/cdrType"
+)
+
+func TestSubscriptionIdRoundTrip(t *testing.T) {
+	testCases := []struct {
+		id           string
+		diameterType charging_datatype.SubscriptionIdType
+		data         string
+	}{
+		{"imsi-208930000000001", charging_datatype.END_USER_IMSI, "208930000000001"},
+		{"nai-user@example.com", charging_datatype.END_USER_NAI, "user@example.com"},
+		{"gci-0011223344@example.com", charging_datatype.END_USER_PRIVATE, "gci-0011223344@example.com"},
+		{"gli-line1@example.com", charging_datatype.END_USER_PRIVATE, "gli-line1@example.com"},
+		{"msisdn-886912345678", charging_datatype.END_USER_E164, "886912345678"},
+		{"extid-device@example.com", charging_datatype.END_USER_PRIVATE, "extid-device@example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.id, func(t *testing.T) {
+			subscriptionId := SubscriptionId(tc.id)
+			require.NotNil(t, subscriptionId)
+			require.Equal(t, tc.diameterType, subscriptionId.SubscriptionIdType)
+			require.Equal(t, tc.data, string(subscriptionId.SubscriptionIdData))
+
+			id, err := FromSubscriptionId(subscriptionId)
+			require.NoError(t, err)
+			require.Equal(t, tc.id, id)
+
+			cdrSubscriptionId := CdrSubscriptionId(tc.id)
+			require.NotNil(t, cdrSubscriptionId)
+			require.Equal(t, tc.data, string(cdrSubscriptionId.SubscriptionIDData))
+		})
+	}
+}
+
+func TestUnsupportedIdentifier(t *testing.T) {
+	require.ErrorIs(t, Validate("imei-490154203237518"), ErrUnsupported)
+	require.ErrorIs(t, Validate("imsi-"), ErrUnsupported)
+	require.Nil(t, SubscriptionId("unknown"))
+	require.Nil(t, CdrSubscriptionId(""))
+
+	require.True(t, IsGpsi("msisdn-886912345678"))
+	require.False(t, IsGpsi("imsi-208930000000001"))
+	require.Equal(t, cdrType.SubscriptionIDTypePresentENDUSERE164,
+		CdrSubscriptionId("msisdn-886912345678").SubscriptionIDType.Value)
+
+	// The private identifier is one of the types without a Subscription-Id-Type of their own
+	_, err := FromSubscriptionId(&charging_datatype.SubscriptionId{
+		SubscriptionIdType: charging_datatype.END_USER_PRIVATE,
+		SubscriptionIdData: "imsi-208930000000001",
+	})
+	require.ErrorIs(t, err, ErrUnsupported)
+	_, err = FromSubscriptionId(&charging_datatype.SubscriptionId{
+		SubscriptionIdType: charging_datatype.END_USER_SIP_URI,
+		SubscriptionIdData: "sip:user@example.com",
+	})
+	require.ErrorIs(t, err, ErrUnsupported)
+	_, err = FromSubscriptionId(nil)
+	require.ErrorIs(t, err, ErrUnsupported)
+}
@@ -0,0 +1,48 @@
+package monetary
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+var ErrNoExchangeRate = errors.New("monetary: no exchange rate")
+
+var exchangeRates []factory.ExchangeRate
+
+// SetExchangeRates sets the exchange rates of the configuration, of the CHF or of the standalone RF and ABMF
+func SetExchangeRates(rates []factory.ExchangeRate) {
+	exchangeRates = rates
+}
+
+// Exchange converts the value into the currency with the exchange rates of the configuration.
+// The value of the zero currency is taken as in the currency, and the zero currency keeps the value.
+func Exchange(v Value, currencyCode uint32) (Value, error) {
+	if currencyCode == 0 || v.CurrencyCode == currencyCode {
+		return v, nil
+	}
+	if v.CurrencyCode == 0 {
+		v.CurrencyCode = currencyCode
+		return v, nil
+	}
+
+	for _, exchangeRate := range exchangeRates {
+		if exchangeRate.From != v.CurrencyCode || exchangeRate.To != currencyCode {
+			continue
+		}
+		rate, err := Parse(exchangeRate.Rate, currencyCode)
+		if err != nil {
+			return Value{}, fmt.Errorf("exchange rate from %d to %d: %w", v.CurrencyCode, currencyCode, err)
+		}
+		return convert(v, rate)
+	}
+	return Value{}, fmt.Errorf("%w from %d to %d", ErrNoExchangeRate, v.CurrencyCode, currencyCode)
+}
+
+// The value multiplied by the rate, in the currency of the rate
+func convert(v, rate Value) (Value, error) {
+	x, y := big.NewInt(v.ValueDigits), big.NewInt(rate.ValueDigits)
+	return fromBig(x.Mul(x, y), v.Exponent+rate.Exponent, rate.CurrencyCode)
+}
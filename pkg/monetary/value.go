@@ -0,0 +1,249 @@
+// Package monetary handles amounts of money exactly, as the Unit-Value AVP of RFC 4006 8.8
+package monetary
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/fiorix/go-diameter/diam/datatype"
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+)
+
+// DefaultCurrencyCode is the ISO 4217 code of the money without currency, New Taiwan dollar
+const DefaultCurrencyCode = 901
+
+var (
+	ErrCurrencyMismatch = errors.New("monetary: currency mismatch")
+	ErrOverflow         = errors.New("monetary: value out of range")
+)
+
+// Value is the amount ValueDigits × 10^Exponent in the currency of the ISO 4217 CurrencyCode.
+// The zero CurrencyCode stands for the currency of the account, it takes the currency of the other operand.
+type Value struct {
+	ValueDigits  int64  `json:"valueDigits" bson:"valueDigits"`
+	Exponent     int32  `json:"exponent,omitempty" bson:"exponent,omitempty"`
+	CurrencyCode uint32 `json:"currencyCode,omitempty" bson:"currencyCode,omitempty"`
+}
+
+// Parse converts the decimal amount, e.g. "-12.05", into the value
+func Parse(amount string, currencyCode uint32) (Value, error) {
+	amount = strings.TrimSpace(amount)
+	if amount == "" {
+		return Value{}, fmt.Errorf("monetary: empty amount")
+	}
+
+	var exponent int32
+	digitsStr := amount
+	if dotPos := strings.Index(amount, "."); dotPos != -1 {
+		digitsStr = amount[:dotPos] + amount[dotPos+1:]
+		exponent = -int32(len(amount) - dotPos - 1)
+	}
+
+	digits, ok := new(big.Int).SetString(digitsStr, 10)
+	if !ok {
+		return Value{}, fmt.Errorf("monetary: invalid amount %q", amount)
+	}
+	return fromBig(digits, exponent, currencyCode)
+}
+
+// String is the decimal amount without the currency
+func (v Value) String() string {
+	digits := new(big.Int).Abs(big.NewInt(v.ValueDigits)).String()
+	sign := ""
+	if v.ValueDigits < 0 {
+		sign = "-"
+	}
+
+	if v.Exponent >= 0 {
+		if v.ValueDigits == 0 {
+			return "0"
+		}
+		return sign + digits + strings.Repeat("0", int(v.Exponent))
+	}
+
+	scale := int(-v.Exponent)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+func (v Value) Sign() int {
+	switch {
+	case v.ValueDigits > 0:
+		return 1
+	case v.ValueDigits < 0:
+		return -1
+	}
+	return 0
+}
+
+func (v Value) IsZero() bool {
+	return v.ValueDigits == 0
+}
+
+func (v Value) Neg() Value {
+	v.ValueDigits = -v.ValueDigits
+	return v
+}
+
+func (v Value) Add(w Value) (Value, error) {
+	currencyCode, err := currencyOf(v, w)
+	if err != nil {
+		return Value{}, err
+	}
+	x, y, exponent := align(v, w)
+	return fromBig(x.Add(x, y), exponent, currencyCode)
+}
+
+func (v Value) Sub(w Value) (Value, error) {
+	currencyCode, err := currencyOf(v, w)
+	if err != nil {
+		return Value{}, err
+	}
+	x, y, exponent := align(v, w)
+	return fromBig(x.Sub(x, y), exponent, currencyCode)
+}
+
+// Mul is the money of the units at the unit cost v
+func (v Value) Mul(units uint64) (Value, error) {
+	x := big.NewInt(v.ValueDigits)
+	return fromBig(x.Mul(x, new(big.Int).SetUint64(units)), v.Exponent, v.CurrencyCode)
+}
+
+// Cmp compares the values as -1, 0 or +1 for v < w, v == w and v > w
+func (v Value) Cmp(w Value) (int, error) {
+	if _, err := currencyOf(v, w); err != nil {
+		return 0, err
+	}
+	x, y, _ := align(v, w)
+	return x.Cmp(y), nil
+}
+
+// Units is the number of whole units affordable with the money v at the unit cost
+func (v Value) Units(unitCost Value) (uint64, error) {
+	if _, err := currencyOf(v, unitCost); err != nil {
+		return 0, err
+	}
+	if v.Sign() <= 0 || unitCost.Sign() <= 0 {
+		return 0, nil
+	}
+	x, y, _ := align(v, unitCost)
+	units := x.Quo(x, y)
+	if !units.IsUint64() {
+		return 0, ErrOverflow
+	}
+	return units.Uint64(), nil
+}
+
+// CurrencyCodeOf is the ISO 4217 currencyCode of the account in the charging data, zero if absent
+func CurrencyCodeOf(chargingData map[string]interface{}) uint32 {
+	switch currencyCode := chargingData["currencyCode"].(type) {
+	case int32:
+		return uint32(currencyCode)
+	case int64:
+		return uint32(currencyCode)
+	case float64:
+		return uint32(currencyCode)
+	}
+	return 0
+}
+
+// FromUnitValue converts the Unit-Value AVP in the currency into the value
+func FromUnitValue(unitValue *charging_datatype.UnitValue, currencyCode uint32) Value {
+	if unitValue == nil {
+		return Value{CurrencyCode: currencyCode}
+	}
+	return Value{
+		ValueDigits:  int64(unitValue.ValueDigits),
+		Exponent:     int32(unitValue.Exponent),
+		CurrencyCode: currencyCode,
+	}
+}
+
+// FromUnitCost converts the Unit-Cost AVP of the tariff in the currency into the value
+func FromUnitCost(unitCost *charging_datatype.UnitCost, currencyCode uint32) Value {
+	return FromUnitValue((*charging_datatype.UnitValue)(unitCost), currencyCode)
+}
+
+// FromCCMoney converts the CC-Money AVP into the value
+func FromCCMoney(money *charging_datatype.CCMoney) Value {
+	if money == nil {
+		return Value{}
+	}
+	return FromUnitValue(money.UnitValue, uint32(money.CurrencyCode))
+}
+
+func (v Value) UnitValue() *charging_datatype.UnitValue {
+	return &charging_datatype.UnitValue{
+		ValueDigits: datatype.Integer64(v.ValueDigits),
+		Exponent:    datatype.Integer32(v.Exponent),
+	}
+}
+
+func (v Value) UnitCost() *charging_datatype.UnitCost {
+	return (*charging_datatype.UnitCost)(v.UnitValue())
+}
+
+func (v Value) CCMoney() *charging_datatype.CCMoney {
+	return &charging_datatype.CCMoney{
+		CurrencyCode: datatype.Unsigned32(v.CurrencyCode),
+		UnitValue:    v.UnitValue(),
+	}
+}
+
+func currencyOf(v, w Value) (uint32, error) {
+	switch {
+	case v.CurrencyCode == 0:
+		return w.CurrencyCode, nil
+	case w.CurrencyCode == 0 || v.CurrencyCode == w.CurrencyCode:
+		return v.CurrencyCode, nil
+	}
+	return 0, fmt.Errorf("%w: %d and %d", ErrCurrencyMismatch, v.CurrencyCode, w.CurrencyCode)
+}
+
+// The digits of both values at the smaller exponent
+func align(v, w Value) (*big.Int, *big.Int, int32) {
+	x, y := big.NewInt(v.ValueDigits), big.NewInt(w.ValueDigits)
+	exponent := v.Exponent
+	switch {
+	case v.Exponent > w.Exponent:
+		x.Mul(x, pow10(v.Exponent-w.Exponent))
+		exponent = w.Exponent
+	case v.Exponent < w.Exponent:
+		y.Mul(y, pow10(w.Exponent-v.Exponent))
+	}
+	return x, y, exponent
+}
+
+// The value of the digits without the trailing zeros after the decimal point
+func fromBig(digits *big.Int, exponent int32, currencyCode uint32) (Value, error) {
+	ten := big.NewInt(10)
+	quotient, remainder := new(big.Int), new(big.Int)
+	for exponent < 0 && digits.Sign() != 0 {
+		quotient.QuoRem(digits, ten, remainder)
+		if remainder.Sign() != 0 {
+			break
+		}
+		digits.Set(quotient)
+		exponent++
+	}
+	if digits.Sign() == 0 {
+		exponent = 0
+	}
+
+	if !digits.IsInt64() {
+		return Value{}, ErrOverflow
+	}
+	return Value{
+		ValueDigits:  digits.Int64(),
+		Exponent:     exponent,
+		CurrencyCode: currencyCode,
+	}, nil
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
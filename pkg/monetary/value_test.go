@@ -0,0 +1,54 @@
+package monetary
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/chf/pkg/factory"
+)
+
+func TestValueArithmetic(t *testing.T) {
+	unitCost, err := Parse("0.5", DefaultCurrencyCode)
+	require.NoError(t, err)
+	require.Equal(t, Value{ValueDigits: 5, Exponent: -1, CurrencyCode: DefaultCurrencyCode}, unitCost)
+
+	price, err := unitCost.Mul(3)
+	require.NoError(t, err)
+	require.Equal(t, "1.5", price.String())
+
+	balance, err := Parse("100", 0)
+	require.NoError(t, err)
+	balance, err = balance.Sub(price)
+	require.NoError(t, err)
+	require.Equal(t, "98.5", balance.String())
+	require.Equal(t, uint32(DefaultCurrencyCode), balance.CurrencyCode)
+
+	units, err := balance.Units(unitCost)
+	require.NoError(t, err)
+	require.Equal(t, uint64(197), units)
+
+	small, err := Parse("-0.007", DefaultCurrencyCode)
+	require.NoError(t, err)
+	require.Equal(t, "-0.007", small.String())
+	require.Equal(t, -1, small.Sign())
+
+	_, err = balance.Add(Value{ValueDigits: 1, CurrencyCode: 840})
+	require.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestExchange(t *testing.T) {
+	SetExchangeRates([]factory.ExchangeRate{
+		{From: 840, To: DefaultCurrencyCode, Rate: "31.25"},
+	})
+
+	dollars, err := Parse("2.5", 840)
+	require.NoError(t, err)
+	exchanged, err := Exchange(dollars, DefaultCurrencyCode)
+	require.NoError(t, err)
+	require.Equal(t, "78.125", exchanged.String())
+	require.Equal(t, uint32(DefaultCurrencyCode), exchanged.CurrencyCode)
+
+	_, err = Exchange(exchanged, 840)
+	require.ErrorIs(t, err, ErrNoExchangeRate)
+}
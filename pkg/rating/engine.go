@@ -0,0 +1,158 @@
+// Package rating is the rating engine of the Rating Function (RF), TS 32.296,
+// it prices the service usage with the tariff plans of the subscribers.
+package rating
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/util/mongoapi"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	chargingDatasColl = "chargingDatas"
+	tariffPlansColl   = "tariffPlans"
+	usageCountersColl = "ratingUsageCounters"
+
+	// The rating without tariff switch is valid for a day
+	ratingValidity = 24 * time.Hour
+)
+
+// Engine rates the service usage of the subscriber with the service rating of the SUR,
+// and returns the service rating of the SUA
+type Engine interface {
+	Rate(subscriberId string, request *charging_datatype.ServiceRating,
+		actualTime time.Time) (*charging_datatype.ServiceRating, error)
+}
+
+var engine Engine = NewPlanEngine()
+
+// SetEngine replaces the rating engine of the RF
+func SetEngine(e Engine) {
+	engine = e
+}
+
+func Rate(subscriberId string, request *charging_datatype.ServiceRating,
+	actualTime time.Time) (*charging_datatype.ServiceRating, error) {
+	return engine.Rate(subscriberId, request, actualTime)
+}
+
+// PlanEngine rates with the tariff plans in MongoDB. The charging data of the subscriber and rating group
+// refers to a plan of the tariffPlans collection, or has a flat unitCost.
+// The consumed units of the month are counted for the free allowance and the tiers of the plan.
+type PlanEngine struct {
+	mu sync.Mutex
+}
+
+func NewPlanEngine() *PlanEngine {
+	return &PlanEngine{}
+}
+
+func (e *PlanEngine) Rate(subscriberId string, request *charging_datatype.ServiceRating,
+	actualTime time.Time) (*charging_datatype.ServiceRating, error) {
+	ratingGroup := uint32(request.ServiceIdentifier)
+
+	plan, err := LoadTariffPlan(subscriberId, ratingGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	// The usage counter is read and updated at once
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	usage, err := loadUsage(subscriberId, ratingGroup, actualTime)
+	if err != nil {
+		return nil, err
+	}
+
+	answer, err := plan.Rate(request, usage, actualTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// The consumed units are counted once per request, the RF answers the duplicates without rating them
+	if consumed := uint64(request.ConsumedUnits); consumed != 0 {
+		if err := saveUsage(subscriberId, ratingGroup, actualTime, usage+consumed); err != nil {
+			return nil, err
+		}
+	}
+
+	return answer, nil
+}
+
+func LoadTariffPlan(subscriberId string, ratingGroup uint32) (*TariffPlan, error) {
+	filter := bson.M{"ueId": subscriberId, "ratingGroup": ratingGroup}
+	chargingData, err := mongoapi.RestfulAPIGetOne(chargingDatasColl, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(chargingData) == 0 {
+		return nil, fmt.Errorf("no charging data of %s rating group %d", subscriberId, ratingGroup)
+	}
+
+	planId, _ := chargingData["tariffPlan"].(string)
+	if planId == "" {
+		// Flat tariff of the charging data
+		unitCost, _ := chargingData["unitCost"].(string)
+		unitType, _ := chargingData["unitType"].(string)
+		return &TariffPlan{
+			UnitCost:     unitCost,
+			UnitType:     unitType,
+			CurrencyCode: monetary.CurrencyCodeOf(chargingData),
+		}, nil
+	}
+
+	planData, err := mongoapi.RestfulAPIGetOne(tariffPlansColl, bson.M{"planId": planId})
+	if err != nil {
+		return nil, err
+	}
+	if len(planData) == 0 {
+		return nil, fmt.Errorf("tariff plan %s of %s not found", planId, subscriberId)
+	}
+
+	raw, err := bson.Marshal(planData)
+	if err != nil {
+		return nil, err
+	}
+	plan := &TariffPlan{}
+	if err := bson.Unmarshal(raw, plan); err != nil {
+		return nil, fmt.Errorf("invalid tariff plan %s: %+v", planId, err)
+	}
+	return plan, nil
+}
+
+func usageFilter(subscriberId string, ratingGroup uint32, t time.Time) bson.M {
+	return bson.M{"ueId": subscriberId, "ratingGroup": ratingGroup, "month": t.Format("2006-01")}
+}
+
+func loadUsage(subscriberId string, ratingGroup uint32, t time.Time) (uint64, error) {
+	counter, err := mongoapi.RestfulAPIGetOne(usageCountersColl, usageFilter(subscriberId, ratingGroup, t))
+	if err != nil {
+		return 0, err
+	}
+
+	switch usedUnits := counter["usedUnits"].(type) {
+	case int64:
+		return uint64(usedUnits), nil
+	case int32:
+		return uint64(usedUnits), nil
+	}
+	return 0, nil
+}
+
+func saveUsage(subscriberId string, ratingGroup uint32, t time.Time, usage uint64) error {
+	filter := usageFilter(subscriberId, ratingGroup, t)
+	counter := bson.M{
+		"ueId":        subscriberId,
+		"ratingGroup": ratingGroup,
+		"month":       t.Format("2006-01"),
+		"usedUnits":   int64(usage),
+	}
+	_, err := mongoapi.RestfulAPIPutOne(usageCountersColl, filter, counter)
+	return err
+}
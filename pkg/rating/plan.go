@@ -0,0 +1,415 @@
+package rating
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam/datatype"
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/monetary"
+)
+
+// TariffPlan prices the service usage of a rating group, the unit costs are decimals in the currency of the plan.
+// The unit cost of the usage is decided in the order:
+// the free allowance, the tier of the usage of the month, the period of the day and the base unit cost.
+type TariffPlan struct {
+	PlanId       string   `json:"planId" bson:"planId"`
+	UnitType     string   `json:"unitType,omitempty" bson:"unitType,omitempty"` // octet, time or event
+	CurrencyCode uint32   `json:"currencyCode,omitempty" bson:"currencyCode,omitempty"`
+	UnitCost     string   `json:"unitCost" bson:"unitCost"`
+	FreeUnits    uint64   `json:"freeUnits,omitempty" bson:"freeUnits,omitempty"` // free allowance of the month
+	Tiers        []Tier   `json:"tiers,omitempty" bson:"tiers,omitempty"`
+	Periods      []Period `json:"periods,omitempty" bson:"periods,omitempty"`
+}
+
+// Tier prices the usage of the month above the threshold
+type Tier struct {
+	Threshold uint64 `json:"threshold" bson:"threshold"`
+	UnitCost  string `json:"unitCost" bson:"unitCost"`
+}
+
+// Period prices the usage between the start and the end time of the given days of the week,
+// e.g. days [sat, sun], start "22:00", end "06:00". A period without days applies to every day,
+// and the first period of the plan containing the time applies.
+type Period struct {
+	Days     []string `json:"days,omitempty" bson:"days,omitempty"`
+	Start    string   `json:"start" bson:"start"`
+	End      string   `json:"end" bson:"end"`
+	UnitCost string   `json:"unitCost" bson:"unitCost"`
+}
+
+// The tariff is applied per second if the unit type is "time",
+// per event if it is "event", otherwise per octet
+func (p *TariffPlan) CCUnitType() charging_datatype.CCUnitType {
+	switch strings.ToLower(p.UnitType) {
+	case "time":
+		return charging_datatype.TIME
+	case "event":
+		return charging_datatype.SERVICESPECIFICUNITS
+	}
+	return charging_datatype.TOTALOCTETS
+}
+
+// Rate answers the service rating request of the Re interface, usage is the units consumed in the month.
+// The monetary quota of the account is exchanged into the currency of the plan,
+// the request is rejected if there is no exchange rate between the currencies.
+func (p *TariffPlan) Rate(request *charging_datatype.ServiceRating, usage uint64,
+	actualTime time.Time) (*charging_datatype.ServiceRating, error) {
+	answer := &charging_datatype.ServiceRating{
+		ServiceIdentifier: request.ServiceIdentifier,
+		MonetaryTariff:    p.MonetaryTariff(p.unitCostAt(actualTime, usage)),
+	}
+
+	switch request.RequestSubType {
+	// advice of charge: price for the requested units, the usage counter is left as is
+	case charging_datatype.REQ_SUBTYPE_AOC:
+		price, err := p.price(actualTime, usage, uint64(request.RequestedUnits))
+		if err != nil {
+			return nil, err
+		}
+		answer.Price = price.CCMoney()
+	// price for the consumed units, octets or seconds as indicated by the tariff
+	case charging_datatype.REQ_SUBTYPE_DEBIT:
+		price, err := p.debitPrice(actualTime, usage,
+			uint64(request.ConsumedUnits), uint64(request.ConsumedUnitsAfterTariffSwitch))
+		if err != nil {
+			return nil, err
+		}
+		answer.Price = price.CCMoney()
+	// price for the reserved units
+	case charging_datatype.REQ_SUBTYPE_RESERVE:
+		quota, err := monetary.Exchange(monetary.FromCCMoney(request.MonetaryQuota), p.currencyCode())
+		if err != nil {
+			return nil, err
+		}
+		allowedUnits, err := p.allowedUnits(actualTime, usage, quota, uint64(request.RequestedUnits))
+		if err != nil {
+			return nil, err
+		}
+		answer.AllowedUnits = clampUnsigned32(allowedUnits)
+		price, err := p.price(actualTime, usage, uint64(answer.AllowedUnits))
+		if err != nil {
+			return nil, err
+		}
+		answer.Price = price.CCMoney()
+	}
+
+	// The tariff changes after the free allowance or the tier is used up
+	if boundary, ok := p.nextUsageBoundary(usage); ok {
+		answer.ValidUnits = clampUnsigned32(boundary - usage)
+		answer.MonetaryTariffAfterValidUnits = (*charging_datatype.MonetaryTariffAfterValidUnits)(
+			p.MonetaryTariff(p.unitCostAt(actualTime, boundary)))
+	}
+
+	// The tariff changes at the start or the end of a period
+	if switchTime, ok := p.nextSwitchTime(actualTime, usage); ok {
+		answer.TariffSwitchTime = datatype.Unsigned32(switchTime.Sub(actualTime) / time.Second)
+		answer.NextMonetaryTariff = (*charging_datatype.NextMonetaryTariff)(
+			p.MonetaryTariff(p.unitCostAt(switchTime, usage)))
+		answer.ExpiryTime = datatype.Time(switchTime)
+	} else {
+		answer.ExpiryTime = datatype.Time(actualTime.Add(ratingValidity))
+	}
+
+	return answer, nil
+}
+
+func (p *TariffPlan) currencyCode() uint32 {
+	if p.CurrencyCode == 0 {
+		return monetary.DefaultCurrencyCode
+	}
+	return p.CurrencyCode
+}
+
+func (p *TariffPlan) MonetaryTariff(unitCostStr string) *charging_datatype.MonetaryTariff {
+	return &charging_datatype.MonetaryTariff{
+		CurrencyCode: datatype.Unsigned32(p.currencyCode()),
+		ScaleFactor: &charging_datatype.ScaleFactor{
+			ValueDigits: datatype.Integer64(1),
+			Exponent:    datatype.Integer32(0),
+		},
+		RateElement: &charging_datatype.RateElement{
+			CCUnitType: p.CCUnitType(),
+			UnitCost:   UnitCostOf(unitCostStr),
+		},
+	}
+}
+
+// UnitCostOf converts the decimal unit cost, e.g. "0.5", into the Unit-Cost AVP, Value-Digits 5 and Exponent -1
+func UnitCostOf(unitCostStr string) *charging_datatype.UnitCost {
+	unitCost, err := monetary.Parse(unitCostStr, 0)
+	if err != nil {
+		return &charging_datatype.UnitCost{}
+	}
+	return unitCost.UnitCost()
+}
+
+// The money of a unit in the currency of the plan, an invalid unit cost is free of charge
+func (p *TariffPlan) costOf(unitCostStr string) monetary.Value {
+	return monetary.FromUnitCost(UnitCostOf(unitCostStr), p.currencyCode())
+}
+
+func (p *TariffPlan) unitCostAt(t time.Time, usage uint64) string {
+	if usage < p.FreeUnits {
+		return "0"
+	}
+	if tier := p.tierOf(usage); tier != nil {
+		return tier.UnitCost
+	}
+	if period := p.periodAt(t); period != nil {
+		return period.UnitCost
+	}
+	return p.UnitCost
+}
+
+// The tier of the highest threshold reached by the usage
+func (p *TariffPlan) tierOf(usage uint64) *Tier {
+	var tier *Tier
+	for i := range p.Tiers {
+		if p.Tiers[i].Threshold <= usage && (tier == nil || p.Tiers[i].Threshold > tier.Threshold) {
+			tier = &p.Tiers[i]
+		}
+	}
+	return tier
+}
+
+// The usage where the unit cost changes next: the end of the free allowance or the threshold of a tier
+func (p *TariffPlan) nextUsageBoundary(usage uint64) (uint64, bool) {
+	var boundary uint64
+	found := false
+
+	candidates := []uint64{p.FreeUnits}
+	for _, tier := range p.Tiers {
+		candidates = append(candidates, tier.Threshold)
+	}
+	for _, candidate := range candidates {
+		if candidate > usage && (!found || candidate < boundary) {
+			boundary = candidate
+			found = true
+		}
+	}
+	return boundary, found
+}
+
+// Price of the units consumed from the usage on, the units over a boundary are priced with the next tariff
+func (p *TariffPlan) price(t time.Time, usage, units uint64) (monetary.Value, error) {
+	price := monetary.Value{CurrencyCode: p.currencyCode()}
+
+	for units > 0 {
+		segment := units
+		if boundary, ok := p.nextUsageBoundary(usage); ok && boundary-usage < segment {
+			segment = boundary - usage
+		}
+		segmentPrice, err := p.costOf(p.unitCostAt(t, usage)).Mul(segment)
+		if err != nil {
+			return monetary.Value{}, err
+		}
+		if price, err = price.Add(segmentPrice); err != nil {
+			return monetary.Value{}, err
+		}
+		usage += segment
+		units -= segment
+	}
+	return price, nil
+}
+
+// Price of the consumed units, of which the units after the tariff switch are priced with the tariff
+// at the actual time and the others with the tariff before the last switch
+func (p *TariffPlan) debitPrice(actualTime time.Time, usage, consumed, afterSwitch uint64) (monetary.Value, error) {
+	if afterSwitch > consumed {
+		afterSwitch = consumed
+	}
+	beforeSwitch := consumed - afterSwitch
+
+	beforeTime := actualTime
+	if afterSwitch != 0 {
+		if switchTime, ok := p.previousSwitchTime(actualTime, usage); ok {
+			beforeTime = switchTime.Add(-time.Second)
+		}
+	}
+	priceBefore, err := p.price(beforeTime, usage, beforeSwitch)
+	if err != nil {
+		return monetary.Value{}, err
+	}
+	priceAfter, err := p.price(actualTime, usage+beforeSwitch, afterSwitch)
+	if err != nil {
+		return monetary.Value{}, err
+	}
+	return priceBefore.Add(priceAfter)
+}
+
+// The units affordable with the money. The free allowance is granted up to the requested units,
+// and the requested units are granted when the usage is free of charge without limit.
+func (p *TariffPlan) allowedUnits(t time.Time, usage uint64, money monetary.Value,
+	requested uint64) (uint64, error) {
+	var allowed uint64
+
+	for {
+		cost := p.costOf(p.unitCostAt(t, usage))
+		boundary, bounded := p.nextUsageBoundary(usage)
+
+		if cost.Sign() <= 0 {
+			if !bounded {
+				if requested > allowed {
+					return requested, nil
+				}
+				return allowed, nil
+			}
+			if requested != 0 && allowed+boundary-usage >= requested {
+				return requested, nil
+			}
+			allowed += boundary - usage
+			usage = boundary
+			continue
+		}
+
+		units, err := money.Units(cost)
+		if err != nil {
+			return 0, err
+		}
+		if bounded && units > boundary-usage {
+			units = boundary - usage
+		}
+		allowed += units
+
+		spent, err := cost.Mul(units)
+		if err != nil {
+			return 0, err
+		}
+		if money, err = money.Sub(spent); err != nil {
+			return 0, err
+		}
+		if !bounded || usage+units < boundary {
+			return allowed, nil
+		}
+		usage = boundary
+	}
+}
+
+func (p *TariffPlan) periodAt(t time.Time) *Period {
+	for i := range p.Periods {
+		if p.Periods[i].contains(t) {
+			return &p.Periods[i]
+		}
+	}
+	return nil
+}
+
+// The first time after t in the coming week when the unit cost changes
+func (p *TariffPlan) nextSwitchTime(t time.Time, usage uint64) (time.Time, bool) {
+	candidates := p.periodBoundaries(t, 0, 7)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	unitCost := p.unitCostAt(t, usage)
+	for _, candidate := range candidates {
+		if candidate.After(t) && p.unitCostAt(candidate, usage) != unitCost {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// The last time up to t in the past week when the unit cost changed
+func (p *TariffPlan) previousSwitchTime(t time.Time, usage uint64) (time.Time, bool) {
+	candidates := p.periodBoundaries(t, -7, 0)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].After(candidates[j])
+	})
+
+	for _, candidate := range candidates {
+		if !candidate.After(t) &&
+			p.unitCostAt(candidate.Add(-time.Second), usage) != p.unitCostAt(candidate, usage) {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// The start and the end times of the periods on the days from the day of t
+func (p *TariffPlan) periodBoundaries(t time.Time, fromDay, toDay int) []time.Time {
+	var boundaries []time.Time
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for day := fromDay; day <= toDay; day++ {
+		date := midnight.AddDate(0, 0, day)
+		for _, period := range p.Periods {
+			for _, clock := range []string{period.Start, period.End} {
+				if minutes, ok := minutesOf(clock); ok {
+					boundaries = append(boundaries, date.Add(time.Duration(minutes)*time.Minute))
+				}
+			}
+		}
+	}
+	return boundaries
+}
+
+func (period *Period) contains(t time.Time) bool {
+	start, okStart := minutesOf(period.Start)
+	end, okEnd := minutesOf(period.End)
+	if !okStart || !okEnd {
+		return false
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case start < end:
+		if minutes < start || minutes >= end {
+			return false
+		}
+	default:
+		// The period over midnight belongs to the day it starts
+		if minutes < start && minutes >= end {
+			return false
+		}
+		if minutes < end {
+			day = (day + 6) % 7
+		}
+	}
+
+	if len(period.Days) == 0 {
+		return true
+	}
+	for _, d := range period.Days {
+		if weekday, ok := weekdays[strings.ToLower(d)]; ok && weekday == day {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// hh:mm into the minutes of the day
+func minutesOf(clock string) (int, bool) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hours, errHours := strconv.Atoi(parts[0])
+	minutes, errMinutes := strconv.Atoi(parts[1])
+	if errHours != nil || errMinutes != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 {
+		return 0, false
+	}
+	return hours*60 + minutes, true
+}
+
+func clampUnsigned32(value uint64) datatype.Unsigned32 {
+	if value > math.MaxUint32 {
+		return datatype.Unsigned32(math.MaxUint32)
+	}
+	return datatype.Unsigned32(value)
+}
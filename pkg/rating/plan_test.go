@@ -0,0 +1,155 @@
+package rating
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fiorix/go-diameter/diam/datatype"
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+	"github.com/free5gc/chf/pkg/monetary"
+)
+
+func priceOf(answer *charging_datatype.ServiceRating) string {
+	return monetary.FromCCMoney(answer.Price).String()
+}
+
+func TestTariffPlanTiersAndFreeUnits(t *testing.T) {
+	plan := &TariffPlan{
+		UnitCost:  "2",
+		FreeUnits: 100,
+		Tiers: []Tier{
+			{Threshold: 1000, UnitCost: "1"},
+		},
+	}
+	now := time.Date(2023, 5, 3, 12, 0, 0, 0, time.UTC)
+
+	// 50 free units and 50 units of the base unit cost
+	answer, err := plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_DEBIT,
+		ConsumedUnits:  100,
+	}, 50, now)
+	require.NoError(t, err)
+	require.Equal(t, "100", priceOf(answer))
+	require.Equal(t, datatype.Unsigned32(50), answer.ValidUnits)
+	require.Equal(t, datatype.Integer64(0), answer.MonetaryTariff.RateElement.UnitCost.ValueDigits)
+	require.Equal(t, datatype.Integer64(2),
+		answer.MonetaryTariffAfterValidUnits.RateElement.UnitCost.ValueDigits)
+
+	// The units over the threshold are priced with the tier
+	answer, err = plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_DEBIT,
+		ConsumedUnits:  200,
+	}, 900, now)
+	require.NoError(t, err)
+	require.Equal(t, "300", priceOf(answer))
+
+	// The free allowance and the units affordable with the money
+	answer, err = plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_RESERVE,
+		MonetaryQuota:  monetary.Value{ValueDigits: 100}.CCMoney(),
+	}, 0, now)
+	require.NoError(t, err)
+	require.Equal(t, datatype.Unsigned32(150), answer.AllowedUnits)
+	require.Equal(t, "100", priceOf(answer))
+
+	// The advice of charge prices the requested units as they would be debited
+	answer, err = plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_AOC,
+		RequestedUnits: 200,
+	}, 900, now)
+	require.NoError(t, err)
+	require.Equal(t, "300", priceOf(answer))
+}
+
+func TestTariffPlanPeriods(t *testing.T) {
+	plan := &TariffPlan{
+		UnitCost: "2",
+		Periods: []Period{
+			{Days: []string{"sat", "sun"}, Start: "00:00", End: "24:00", UnitCost: "0"},
+			{Start: "22:00", End: "06:00", UnitCost: "1"},
+		},
+	}
+
+	// Wednesday evening, the night rate starts at 22:00
+	evening := time.Date(2023, 5, 3, 21, 0, 0, 0, time.UTC)
+	answer, err := plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_DEBIT,
+		ConsumedUnits:  10,
+	}, 0, evening)
+	require.NoError(t, err)
+	require.Equal(t, "20", priceOf(answer))
+	require.Equal(t, datatype.Unsigned32(3600), answer.TariffSwitchTime)
+	require.Equal(t, datatype.Integer64(1), answer.NextMonetaryTariff.RateElement.UnitCost.ValueDigits)
+	require.True(t, time.Time(answer.ExpiryTime).Equal(evening.Add(time.Hour)))
+
+	// Thursday 03:00 is in the night period started on Wednesday
+	night := time.Date(2023, 5, 4, 3, 0, 0, 0, time.UTC)
+	require.Equal(t, "1", plan.unitCostAt(night, 0))
+
+	// Friday night switches to the weekend rate at midnight
+	fridayNight := time.Date(2023, 5, 5, 23, 0, 0, 0, time.UTC)
+	switchTime, ok := plan.nextSwitchTime(fridayNight, 0)
+	require.True(t, ok)
+	require.True(t, switchTime.Equal(time.Date(2023, 5, 6, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, "0", plan.unitCostAt(switchTime, 0))
+}
+
+func TestTariffPlanConsumedUnitsAfterTariffSwitch(t *testing.T) {
+	plan := &TariffPlan{
+		UnitCost: "2",
+		Periods: []Period{
+			{Start: "22:00", End: "06:00", UnitCost: "1"},
+		},
+	}
+
+	// Wednesday 22:30, 4 of the 10 units were consumed before the night rate started at 22:00
+	actualTime := time.Date(2023, 5, 3, 22, 30, 0, 0, time.UTC)
+	switchTime, ok := plan.previousSwitchTime(actualTime, 0)
+	require.True(t, ok)
+	require.True(t, switchTime.Equal(time.Date(2023, 5, 3, 22, 0, 0, 0, time.UTC)))
+
+	answer, err := plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType:                 charging_datatype.REQ_SUBTYPE_DEBIT,
+		ConsumedUnits:                  10,
+		ConsumedUnitsAfterTariffSwitch: 6,
+	}, 0, actualTime)
+	require.NoError(t, err)
+	require.Equal(t, "14", priceOf(answer))
+}
+
+func TestTariffPlanDecimalUnitCost(t *testing.T) {
+	plan := &TariffPlan{
+		UnitCost:     "0.5",
+		CurrencyCode: 840,
+	}
+	now := time.Date(2023, 5, 3, 12, 0, 0, 0, time.UTC)
+
+	answer, err := plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_DEBIT,
+		ConsumedUnits:  3,
+	}, 0, now)
+	require.NoError(t, err)
+	require.Equal(t, "1.5", priceOf(answer))
+	require.Equal(t, datatype.Unsigned32(840), answer.Price.CurrencyCode)
+	require.Equal(t, datatype.Integer64(5), answer.MonetaryTariff.RateElement.UnitCost.ValueDigits)
+	require.Equal(t, datatype.Integer32(-1), answer.MonetaryTariff.RateElement.UnitCost.Exponent)
+
+	quota, err := monetary.Parse("10.25", 840)
+	require.NoError(t, err)
+	answer, err = plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_RESERVE,
+		MonetaryQuota:  quota.CCMoney(),
+	}, 0, now)
+	require.NoError(t, err)
+	require.Equal(t, datatype.Unsigned32(20), answer.AllowedUnits)
+	require.Equal(t, "10", priceOf(answer))
+
+	// The quota in another currency without an exchange rate is rejected
+	_, err = plan.Rate(&charging_datatype.ServiceRating{
+		RequestSubType: charging_datatype.REQ_SUBTYPE_RESERVE,
+		MonetaryQuota:  monetary.Value{ValueDigits: 100, CurrencyCode: monetary.DefaultCurrencyCode}.CCMoney(),
+	}, 0, now)
+	require.ErrorIs(t, err, monetary.ErrNoExchangeRate)
+}
@@ -0,0 +1,97 @@
+package rf
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+)
+
+const (
+	// RFC 6733 3: the End-to-End Identifier of the Origin-Host is not reused within 4 minutes
+	answerRetention = 4 * time.Minute
+	// The retransmission waits that long for the answer of the request being rated
+	answerWaitTimeout = 10 * time.Second
+)
+
+// RFC 6733 6.5: the retransmitted request keeps the End-to-End Identifier of its Origin-Host,
+// with the T flag set if it is sent again after a failover
+type answerKey struct {
+	originHost string
+	endToEnd   uint32
+}
+
+// answerEntry is the answer of the request, done is closed once it is rated
+type answerEntry struct {
+	done       chan struct{}
+	resultCode uint32
+	sua        *charging_datatype.ServiceUsageResponse
+	expires    time.Time
+}
+
+// answerCache answers the duplicate SUR with the answer of the request, the consumed units
+// of the SUR are counted by the rating once
+type answerCache struct {
+	mu        sync.Mutex
+	entries   map[answerKey]*answerEntry
+	lastSweep time.Time
+}
+
+var answers = newAnswerCache()
+
+func newAnswerCache() *answerCache {
+	return &answerCache{
+		entries: make(map[answerKey]*answerEntry),
+	}
+}
+
+// begin registers the request, the new request is rated by the caller and answered with finish.
+// The duplicate request gets the entry of the request answered or being answered.
+func (ac *answerCache) begin(key answerKey, now time.Time) (*answerEntry, bool) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.sweep(now)
+
+	if entry, ok := ac.entries[key]; ok && now.Before(entry.expires) {
+		return entry, true
+	}
+
+	entry := &answerEntry{
+		done:    make(chan struct{}),
+		expires: now.Add(answerRetention),
+	}
+	ac.entries[key] = entry
+	return entry, false
+}
+
+// finish saves the answer of the new request for its duplicates. The request failed
+// for the RF itself has not been counted, its duplicate is rated again.
+func (ac *answerCache) finish(key answerKey, entry *answerEntry, resultCode uint32,
+	sua *charging_datatype.ServiceUsageResponse, now time.Time) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	entry.resultCode = resultCode
+	entry.sua = sua
+	entry.expires = now.Add(answerRetention)
+	close(entry.done)
+
+	if resultCode == diam.UnableToComply && ac.entries[key] == entry {
+		delete(ac.entries, key)
+	}
+}
+
+// The expired entries are removed lazily, at most once per retention period
+func (ac *answerCache) sweep(now time.Time) {
+	if now.Sub(ac.lastSweep) < answerRetention {
+		return
+	}
+	ac.lastSweep = now
+	for key, entry := range ac.entries {
+		if !now.Before(entry.expires) {
+			delete(ac.entries, key)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package rf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-diameter/diam"
+	"github.com/stretchr/testify/require"
+
+	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
+)
+
+func TestAnswerCache(t *testing.T) {
+	cache := newAnswerCache()
+	key := answerKey{originHost: "chf", endToEnd: 1}
+	now := time.Date(2023, 5, 3, 12, 0, 0, 0, time.UTC)
+
+	entry, duplicate := cache.begin(key, now)
+	require.False(t, duplicate)
+	sua := &charging_datatype.ServiceUsageResponse{SessionId: "chf;1;1"}
+	cache.finish(key, entry, diam.Success, sua, now)
+
+	// The request sent again with the T flag is not rated again
+	retransmitted, duplicate := cache.begin(key, now.Add(time.Second))
+	require.True(t, duplicate)
+	require.Same(t, sua, retransmitted.sua)
+
+	// Another request of the client is rated
+	_, duplicate = cache.begin(answerKey{originHost: "chf", endToEnd: 2}, now)
+	require.False(t, duplicate)
+
+	// The request failed for the RF itself is rated again
+	key = answerKey{originHost: "chf", endToEnd: 3}
+	entry, _ = cache.begin(key, now)
+	cache.finish(key, entry, diam.UnableToComply, nil, now)
+	_, duplicate = cache.begin(key, now.Add(time.Second))
+	require.False(t, duplicate)
+}
@@ -16,11 +16,8 @@
 package rf
 
 import (
-	"bytes"
 	"log"
-	"math"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -28,29 +25,27 @@ import (
 
 	"github.com/fiorix/go-diameter/diam"
 	"github.com/fiorix/go-diameter/diam/datatype"
-	"github.com/fiorix/go-diameter/diam/dict"
 	"github.com/fiorix/go-diameter/diam/sm"
 	charging_datatype "github.com/free5gc/chf/ccs_diameter/datatype"
 	charging_dict "github.com/free5gc/chf/ccs_diameter/dict"
 	"github.com/free5gc/chf/internal/logger"
 	"github.com/free5gc/chf/pkg/factory"
-	"github.com/free5gc/util/mongoapi"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/free5gc/chf/pkg/identity"
+	"github.com/free5gc/chf/pkg/rating"
 )
 
-const chargingDatasColl = "chargingDatas"
-
-func OpenServer(wg *sync.WaitGroup) {
+// OpenServer starts the server of the configuration, embedded in the CHF or standalone
+func OpenServer(wg *sync.WaitGroup, cfg *factory.DiameterServer) {
 	// Load our custom dictionary on top of the default one, which
 	// always have the Base Protocol (RFC6733) and Credit Control
 	// Application (RFC4006).
-	err := dict.Default.Load(bytes.NewReader([]byte(charging_dict.RateDictionary)))
+	err := charging_dict.LoadRateDictionary()
 	if err != nil {
 		logger.RatingLog.Error(err)
 	}
 	settings := &sm.Settings{
-		OriginHost:       datatype.DiameterIdentity("server"),
-		OriginRealm:      datatype.DiameterIdentity("go-diameter"),
+		OriginHost:       datatype.DiameterIdentity(cfg.GetOriginHost()),
+		OriginRealm:      datatype.DiameterIdentity(cfg.GetOriginRealm()),
 		VendorID:         13,
 		ProductName:      "go-diameter",
 		FirmwareRevision: 1,
@@ -69,9 +64,7 @@ func OpenServer(wg *sync.WaitGroup) {
 			wg.Done()
 		}()
 
-		rfDiameter := factory.ChfConfig.Configuration.RfDiameter
-		addr := rfDiameter.HostIPv4 + ":" + strconv.Itoa(rfDiameter.Port)
-		err := diam.ListenAndServeTLS(addr, rfDiameter.Tls.Pem, rfDiameter.Tls.Key, mux, nil)
+		err := listen(cfg, mux)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -84,52 +77,22 @@ func printErrors(ec <-chan *diam.ErrorReport) {
 	}
 }
 
-func listen(addr, cert, key string, handler diam.Handler) error {
+func listen(cfg *factory.DiameterServer, handler diam.Handler) error {
+	network := cfg.Network()
+	addr := cfg.HostIPv4 + ":" + strconv.Itoa(cfg.Port)
 	// Start listening for connections.
-	if len(cert) > 0 && len(key) > 0 {
-		logger.RatingLog.Infof("Starting secure diameter server on", addr)
-		return diam.ListenAndServeTLS(addr, cert, key, handler, nil)
-	}
-
-	logger.RatingLog.Infof("Starting diameter server on", addr)
-	return diam.ListenAndServe(addr, handler, nil)
-}
-
-func buildTaffif(unitCostStr string) *charging_datatype.MonetaryTariff {
-	// unitCost
-	unitCost := &charging_datatype.UnitCost{}
-
-	dotPos := strings.Index(unitCostStr, ".")
-	if dotPos == -1 {
-		unitCost.Exponent = datatype.Integer32(0)
-		if digit, err := strconv.Atoi(unitCostStr); err == nil {
-			unitCost.ValueDigits = datatype.Integer64(digit)
-		}
-	} else {
-		if digit, err := strconv.Atoi(strings.Replace(unitCostStr, ".", "", -1)); err == nil {
-			unitCost.ValueDigits = datatype.Integer64(digit)
-		}
-		unitCost.Exponent = datatype.Integer32(len(unitCostStr) - dotPos - 1)
+	if cfg.UseTls() {
+		logger.RatingLog.Infof("Starting secure diameter server on %s %s", network, addr)
+		return diam.ListenAndServeNetworkTLS(network, addr, cfg.Tls.Pem, cfg.Tls.Key, handler, nil)
 	}
 
-	return &charging_datatype.MonetaryTariff{
-		CurrencyCode: datatype.Unsigned32(901),
-		ScaleFactor: &charging_datatype.ScaleFactor{
-			ValueDigits: datatype.Integer64(0),
-			Exponent:    datatype.Integer32(0),
-		},
-		RateElement: &charging_datatype.RateElement{
-			CCUnitType: charging_datatype.MONEY,
-			UnitCost:   unitCost,
-		},
-	}
+	logger.RatingLog.Infof("Starting diameter server on %s %s", network, addr)
+	return diam.ListenAndServeNetwork(network, addr, handler, nil)
 }
 
 func handleSUR() diam.HandlerFunc {
 	return func(c diam.Conn, m *diam.Message) {
 		var sur charging_datatype.ServiceUsageRequest
-		var monetaryCost datatype.Unsigned32
-		var subscriberId string
 
 		if err := m.Unmarshal(&sur); err != nil {
 			logger.RatingLog.Errorf("Failed to parse message from %s: %s\n%s",
@@ -137,61 +100,67 @@ func handleSUR() diam.HandlerFunc {
 			return
 		}
 
-		sr := sur.ServiceRating
-		rg := uint32(sr.ServiceIdentifier)
-
-		switch sur.SubscriptionId.SubscriptionIdType {
-		case charging_datatype.END_USER_IMSI:
-			subscriberId = "imsi-" + string(sur.SubscriptionId.SubscriptionIdData)
+		// The duplicate gets the answer of the request, its usage is counted once
+		key := answerKey{originHost: string(sur.OriginHost), endToEnd: m.Header.EndToEndID}
+		entry, duplicate := answers.begin(key, time.Now())
+		if duplicate {
+			select {
+			case <-entry.done:
+			case <-time.After(answerWaitTimeout):
+				logger.RatingLog.Warnf("Session [%s], request still being rated", sur.SessionId)
+				writeAnswer(c, m, diam.TooBusy, nil)
+				return
+			}
+			logger.RatingLog.Infof("Session [%s], request retransmitted", sur.SessionId)
+			writeAnswer(c, m, entry.resultCode, entry.sua)
+			return
 		}
-		// // Retrieve tarrif information from database
 
-		filter := bson.M{"ueId": subscriberId, "ratingGroup": rg}
-		chargingInterface, err := mongoapi.RestfulAPIGetOne(chargingDatasColl, filter)
-		if err != nil {
-			logger.ChargingdataPostLog.Errorf("Get tarrif error: %+v", err)
-		}
+		resultCode, sua := answerRequest(&sur)
+		answers.finish(key, entry, resultCode, sua, time.Now())
+		writeAnswer(c, m, resultCode, sua)
+	}
+}
 
-		unitCostStr := chargingInterface["unitCost"].(string)
-		monetaryTariff := buildTaffif(unitCostStr)
-		unitCost := datatype.Unsigned32(monetaryTariff.RateElement.UnitCost.ValueDigits) * datatype.Unsigned32(math.Pow10(int(monetaryTariff.RateElement.UnitCost.Exponent)))
-		sua := charging_datatype.ServiceUsageResponse{
-			SessionId:      sur.SessionId,
-			EventTimestamp: datatype.Time(time.Now()),
-			ServiceRating: &charging_datatype.ServiceRating{
-				MonetaryTariff: monetaryTariff,
-			},
-		}
+// answerRequest rates the request, the answer is nil for the rejected request
+func answerRequest(sur *charging_datatype.ServiceUsageRequest) (uint32, *charging_datatype.ServiceUsageResponse) {
+	sr := sur.ServiceRating
 
-		switch sr.RequestSubType {
-		// price for the consumed units
-		case charging_datatype.REQ_SUBTYPE_DEBIT:
-			monetaryCost = sr.ConsumedUnits * unitCost
-			sua.ServiceRating.AllowedUnits = datatype.Unsigned32(0)
-			sua.ServiceRating.Price = monetaryCost
-		// price for the reserved units
-		case charging_datatype.REQ_SUBTYPE_RESERVE:
-			sua.ServiceRating.AllowedUnits = sr.MonetaryQuota / unitCost
-			sua.ServiceRating.Price = sua.ServiceRating.AllowedUnits * unitCost
-		default:
-			logger.RatingLog.Warnf("Unknow request type")
-			sua.ServiceRating.AllowedUnits = datatype.Unsigned32(0)
-			sua.ServiceRating.Price = datatype.Unsigned32(0)
-		}
+	subscriberId, err := identity.FromSubscriptionId(sur.SubscriptionId)
+	if err != nil {
+		logger.RatingLog.Errorf("Subscription-Id of the request of session [%s]: %+v", sur.SessionId, err)
+		return diam.UnableToComply, nil
+	}
 
-		a := m.Answer(diam.Success)
-		err = a.Marshal(&sua)
-		if err != nil {
-			logger.RatingLog.Errorf("Marshal SUA Err: %+v:", err)
-		}
+	// Price the service usage with the tariff plan of the subscriber
+	serviceRating, err := rating.Rate(subscriberId, sr, time.Time(sur.ActualTime))
+	if err != nil {
+		logger.RatingLog.Errorf("Rate service usage of %s error: %+v", subscriberId, err)
+		return diam.UnableToComply, nil
+	}
+	if sr.RequestSubType != charging_datatype.REQ_SUBTYPE_DEBIT &&
+		sr.RequestSubType != charging_datatype.REQ_SUBTYPE_RESERVE {
+		logger.RatingLog.Warnf("Unknow request type")
+	}
 
-		_, err = a.WriteTo(c)
-		if err != nil {
-			logger.RatingLog.Errorf("Failed to write message to %s: %s\n%s\n",
-				c.RemoteAddr(), err, a)
-			return
+	return diam.Success, &charging_datatype.ServiceUsageResponse{
+		SessionId:      sur.SessionId,
+		EventTimestamp: datatype.Time(time.Now()),
+		ServiceRating:  serviceRating,
+	}
+}
+
+func writeAnswer(c diam.Conn, m *diam.Message, resultCode uint32, sua *charging_datatype.ServiceUsageResponse) {
+	a := m.Answer(resultCode)
+	if sua != nil {
+		if err := a.Marshal(sua); err != nil {
+			logger.RatingLog.Errorf("Marshal SUA Err: %+v:", err)
 		}
 	}
+	if _, err := a.WriteTo(c); err != nil {
+		logger.RatingLog.Errorf("Failed to write message to %s: %s\n%s\n",
+			c.RemoteAddr(), err, a)
+	}
 }
 
 func handleALL(c diam.Conn, m *diam.Message) {
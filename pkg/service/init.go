@@ -14,11 +14,15 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 
+	"github.com/free5gc/chf/cdr/cdrFile"
 	"github.com/free5gc/chf/internal/cgf"
 	"github.com/free5gc/chf/internal/context"
 	"github.com/free5gc/chf/internal/logger"
 	"github.com/free5gc/chf/internal/sbi/consumer"
 	"github.com/free5gc/chf/internal/sbi/convergedcharging"
+	"github.com/free5gc/chf/internal/sbi/oam"
+	"github.com/free5gc/chf/internal/sbi/producer"
+	"github.com/free5gc/chf/internal/sbi/spendinglimitcontrol"
 	"github.com/free5gc/chf/internal/util"
 	"github.com/free5gc/chf/pkg/abmf"
 	"github.com/free5gc/chf/pkg/factory"
@@ -129,6 +133,7 @@ func (chf *CHF) Start() {
 	router := logger_util.NewGinWithLogrus(logger.GinLog)
 
 	convergedcharging.AddService(router)
+	spendinglimitcontrol.AddService(router)
 
 	router.Use(cors.New(cors.Config{
 		AllowMethods: []string{"GET", "POST", "OPTIONS", "PUT", "PATCH", "DELETE"},
@@ -160,11 +165,25 @@ func (chf *CHF) Start() {
 	wg.Add(1)
 	cgf.OpenServer(&wg)
 
-	wg.Add(1)
-	rf.OpenServer(&wg)
+	// The embedded RF and ABMF are disabled when the CHF uses standalone ones
+	if rfServer := factory.ChfConfig.Configuration.GetRfServer(); !rfServer.Disable {
+		wg.Add(1)
+		rf.OpenServer(&wg, rfServer)
+	}
 
-	wg.Add(1)
-	abmf.OpenServer(&wg)
+	if abmfServer := factory.ChfConfig.Configuration.GetAbmfServer(); !abmfServer.Disable {
+		wg.Add(1)
+		abmf.OpenServer(&wg, abmfServer)
+	}
+
+	self.RatingRouter.Start()
+	self.AbmfRouter.Start()
+
+	if oamCfg := factory.ChfConfig.Configuration.GetOam(); !oamCfg.Disable {
+		go chf.serveOam(oamCfg, pemPath, keyPath)
+	}
+
+	producer.RecoverChargingSessions()
 
 	profile, err := consumer.BuildNFInstance(self)
 	if err != nil {
@@ -216,6 +235,41 @@ func (chf *CHF) Start() {
 	}
 }
 
+// serveOam serves the operator API on its own listener, the key of the SBI is used unless configured
+func (chf *CHF) serveOam(oamCfg *factory.Oam, pemPath, keyPath string) {
+	defer func() {
+		if p := recover(); p != nil {
+			// Print stack for panic to log. Fatalf() will let program exit.
+			logger.InitLog.Fatalf("panic: %v\n%s", p, string(debug.Stack()))
+		}
+	}()
+
+	if oamCfg.Tls != nil {
+		pemPath = oamCfg.Tls.Pem
+		keyPath = oamCfg.Tls.Key
+	}
+
+	addr := fmt.Sprintf("%s:%d", oamCfg.BindingIPv4, oamCfg.Port)
+	server, err := httpwrapper.NewHttp2Server(addr, chf.KeyLogPath, oam.NewRouter())
+	if server == nil {
+		logger.InitLog.Errorf("Initialize OAM server failed: %+v", err)
+		return
+	}
+	if err != nil {
+		logger.InitLog.Warnf("Initialize OAM server: +%v", err)
+	}
+
+	logger.InitLog.Infof("OAM server listening on %s", addr)
+	if oamCfg.Scheme == "https" {
+		err = server.ListenAndServeTLS(pemPath, keyPath)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		logger.InitLog.Errorf("OAM server stopped: %+v", err)
+	}
+}
+
 func (chf *CHF) Exec(c *cli.Context) error {
 	logger.InitLog.Traceln("args:", c.String("chfcfg"))
 	args := chf.FilterCli(c)
@@ -295,5 +349,9 @@ func (chf *CHF) Terminate() {
 	} else {
 		logger.InitLog.Infof("Deregister from NRF successfully")
 	}
+	self := context.CHF_Self()
+	self.RatingRouter.Stop()
+	self.AbmfRouter.Stop()
+	cgf.CloseCdrFile(cdrFile.NormalClosure)
 	logger.InitLog.Infof("CHF terminated")
 }
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/free5gc/chf/internal/logger"
+	"github.com/free5gc/chf/pkg/account"
+	"github.com/free5gc/chf/pkg/factory"
+	"github.com/free5gc/chf/pkg/monetary"
+	"github.com/free5gc/util/mongoapi"
+)
+
+// Server runs the RF or the ABMF as a standalone server shared by the CHFs
+type Server struct {
+	Name              string
+	DefaultConfigPath string
+	// Open starts the Diameter server of the configuration
+	Open func(wg *sync.WaitGroup, cfg *factory.DiameterServer)
+
+	config *factory.ServerConfig
+}
+
+var serverCliCmd = []cli.Flag{
+	cli.StringFlag{
+		Name:  "config, c",
+		Usage: "Load configuration from `FILE`",
+	},
+}
+
+func (*Server) GetCliCmd() (flags []cli.Flag) {
+	return serverCliCmd
+}
+
+func (s *Server) Initialize(c *cli.Context) error {
+	configPath := c.String("config")
+	if configPath == "" {
+		configPath = s.DefaultConfigPath
+	}
+
+	config, err := factory.ReadServerConfig(configPath)
+	if err != nil {
+		return err
+	}
+	s.config = config
+
+	s.setLogLevel()
+
+	return nil
+}
+
+func (s *Server) setLogLevel() {
+	if s.config.Logger == nil || s.config.Logger.DebugLevel == "" {
+		logger.InitLog.Infof("%s Log level is default set to [info] level", s.Name)
+		logger.SetLogLevel(logrus.InfoLevel)
+		return
+	}
+
+	if level, err := logrus.ParseLevel(s.config.Logger.DebugLevel); err != nil {
+		logger.InitLog.Warnf("%s Log level [%s] is invalid, set to [info] level", s.Name, s.config.Logger.DebugLevel)
+		logger.SetLogLevel(logrus.InfoLevel)
+	} else {
+		logger.InitLog.Infof("%s Log level is set to [%s] level", s.Name, level)
+		logger.SetLogLevel(level)
+	}
+	logger.SetReportCaller(s.config.Logger.ReportCaller)
+}
+
+// Start serves until the server stops or the process is interrupted
+func (s *Server) Start() error {
+	configuration := s.config.Configuration
+	monetary.SetExchangeRates(configuration.ExchangeRates)
+
+	mongodb := configuration.Mongodb
+	if err := mongoapi.SetMongoDB(mongodb.Name, mongodb.Url); err != nil {
+		return err
+	}
+	account.SetDatabase(mongodb.Name)
+	if err := account.CreateBalanceIndex(); err != nil {
+		return err
+	}
+	if err := account.CreateReservationIndex(); err != nil {
+		return err
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	s.Open(&wg, configuration.Diameter)
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-signalChannel:
+		logger.InitLog.Infof("%s terminated", s.Name)
+	case <-stopped:
+	}
+	return nil
+}